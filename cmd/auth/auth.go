@@ -0,0 +1,89 @@
+// Package auth holds the identity providers staff can log in with.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"roster/cmd/models"
+	"roster/cmd/utils"
+)
+
+// ErrDenied is returned by Identify when the user didn't let the provider
+// log them in, e.g. because they cancelled.
+var ErrDenied = errors.New("login denied")
+
+// Provider logs users in with an identity provider.
+type Provider interface {
+	// Name identifies the provider in configuration and in staff members'
+	// identities.
+	Name() string
+	// Label is shown on the provider's login button.
+	Label() string
+	// LoginURL is where to send a user to log in. The provider sends them
+	// back to /auth/callback with state, and verifier is the PKCE verifier
+	// for the attempt.
+	LoginURL(state string, verifier string) string
+}
+
+// Identifier is a Provider that sends users back to /auth/callback, and so
+// can also be linked to an existing account.
+type Identifier interface {
+	Provider
+	// Identify returns the identity the provider vouches for in a request
+	// to /auth/callback.
+	Identify(ctx context.Context, r *http.Request, verifier string) (models.Identity, error)
+}
+
+// FromEnv creates the providers named in AUTH_PROVIDERS, in order, from their
+// environment settings. Google is used if none are named.
+//
+//	google  GOOGLE_CLIENT_ID, GOOGLE_CLIENT_SECRET, REDIRECT_URL
+//	oidc    OIDC_ISSUER, OIDC_CLIENT_ID, OIDC_CLIENT_SECRET, OIDC_REDIRECT_URL,
+//	        OIDC_LABEL
+//	email   BASE_URL, the address staff open emailed login links at
+//	dev     none; lets anyone log in as anyone, so never use it in production
+func FromEnv(ctx context.Context) ([]Provider, error) {
+	names := os.Getenv("AUTH_PROVIDERS")
+	if names == "" {
+		names = GoogleProviderName
+	}
+	providers := []Provider{}
+	for _, name := range strings.Split(names, ",") {
+		var provider Provider
+		switch name = strings.TrimSpace(name); name {
+		case GoogleProviderName:
+			provider = NewGoogle(os.Getenv("GOOGLE_CLIENT_ID"), os.Getenv("GOOGLE_CLIENT_SECRET"), os.Getenv("REDIRECT_URL"))
+		case OIDCProviderName:
+			label := os.Getenv("OIDC_LABEL")
+			if label == "" {
+				label = "Single sign-on"
+			}
+			var err error
+			provider, err = DiscoverOIDC(ctx, os.Getenv("OIDC_ISSUER"), label,
+				os.Getenv("OIDC_CLIENT_ID"), os.Getenv("OIDC_CLIENT_SECRET"), os.Getenv("OIDC_REDIRECT_URL"))
+			if err != nil {
+				return nil, err
+			}
+		case EmailProviderName:
+			baseURL := os.Getenv("BASE_URL")
+			if baseURL == "" {
+				return nil, errors.New("BASE_URL must be set to log in by email")
+			}
+			provider = NewEmail(baseURL)
+		case DevProviderName:
+			utils.PrintLog("WARNING: the dev login provider lets anyone log in as any staff member")
+			provider = NewDev()
+		case "":
+			continue
+		default:
+			return nil, fmt.Errorf("unknown auth provider %q", name)
+		}
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
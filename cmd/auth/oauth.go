@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"roster/cmd/models"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	GoogleProviderName = "google"
+	OIDCProviderName   = "oidc"
+)
+
+// OAuthProvider logs users in with an OAuth 2 authorization code flow,
+// identifying them by a field of the provider's user info.
+type OAuthProvider struct {
+	name         string
+	label        string
+	config       *oauth2.Config
+	userInfoURL  string
+	subjectField string
+	authOptions  []oauth2.AuthCodeOption
+}
+
+// NewGoogle creates a provider for Google accounts.
+func NewGoogle(clientID string, clientSecret string, redirectURL string) *OAuthProvider {
+	return &OAuthProvider{
+		name:  GoogleProviderName,
+		label: "Google",
+		config: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       []string{"https://www.googleapis.com/auth/userinfo.email"},
+			Endpoint:     google.Endpoint,
+		},
+		userInfoURL:  "https://www.googleapis.com/oauth2/v2/userinfo",
+		subjectField: "id",
+		authOptions: []oauth2.AuthCodeOption{
+			oauth2.AccessTypeOffline,
+			oauth2.ApprovalForce,
+			oauth2.SetAuthURLParam("prompt", "select_account"),
+		},
+	}
+}
+
+// oidcDiscovery is the part of an OpenID provider's configuration document
+// needed to log in.
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+// DiscoverOIDC creates a provider for any OpenID Connect issuer, looking up
+// its endpoints from the issuer's discovery document.
+func DiscoverOIDC(ctx context.Context, issuer string, label string, clientID string, clientSecret string, redirectURL string) (*OAuthProvider, error) {
+	if issuer == "" || clientID == "" {
+		return nil, errors.New("OIDC provider needs an issuer and client ID")
+	}
+	issuer = strings.TrimSuffix(issuer, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("DiscoverOIDC: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("DiscoverOIDC: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DiscoverOIDC: %s returned %v", issuer, resp.Status)
+	}
+	var discovery oidcDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return nil, fmt.Errorf("DiscoverOIDC: %w", err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("DiscoverOIDC: issuer %q doesn't match %q", discovery.Issuer, issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.UserInfoEndpoint == "" {
+		return nil, fmt.Errorf("DiscoverOIDC: %s is missing an endpoint", issuer)
+	}
+	return &OAuthProvider{
+		name:  OIDCProviderName,
+		label: label,
+		config: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       []string{"openid", "email"},
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  discovery.AuthorizationEndpoint,
+				TokenURL: discovery.TokenEndpoint,
+			},
+		},
+		userInfoURL:  discovery.UserInfoEndpoint,
+		subjectField: "sub",
+	}, nil
+}
+
+func (p *OAuthProvider) Name() string {
+	return p.name
+}
+
+func (p *OAuthProvider) Label() string {
+	return p.label
+}
+
+func (p *OAuthProvider) LoginURL(state string, verifier string) string {
+	options := append(slices.Clone(p.authOptions), oauth2.S256ChallengeOption(verifier))
+	return p.config.AuthCodeURL(state, options...)
+}
+
+func (p *OAuthProvider) Identify(ctx context.Context, r *http.Request, verifier string) (models.Identity, error) {
+	query := r.URL.Query()
+	if reason := query.Get("error"); reason != "" {
+		return models.Identity{}, fmt.Errorf("%w: %s", ErrDenied, reason)
+	}
+	token, err := p.config.Exchange(ctx, query.Get("code"), oauth2.VerifierOption(verifier))
+	if err != nil {
+		return models.Identity{}, fmt.Errorf("failed to exchange code: %w", err)
+	}
+
+	// The token's client sends the access token in a header, keeping it out
+	// of URLs and so out of logs.
+	resp, err := p.config.Client(ctx, token).Get(p.userInfoURL)
+	if err != nil {
+		return models.Identity{}, fmt.Errorf("failed to get user info: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return models.Identity{}, fmt.Errorf("user info returned %v", resp.Status)
+	}
+	var userInfo map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
+		return models.Identity{}, fmt.Errorf("failed to decode user info: %w", err)
+	}
+	subject, _ := userInfo[p.subjectField].(string)
+	if subject == "" {
+		return models.Identity{}, fmt.Errorf("user info has no %q", p.subjectField)
+	}
+	return models.Identity{Provider: p.name, Subject: subject}, nil
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// newTestIssuer serves a minimal OpenID provider that issues a token for
+// code "good-code" with verifier, and identifies its holder as "user-1".
+func newTestIssuer(t *testing.T, verifier string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	issuer := httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer.URL,
+			"authorization_endpoint": issuer.URL + "/authorize",
+			"token_endpoint":         issuer.URL + "/token",
+			"userinfo_endpoint":      issuer.URL + "/userinfo",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "good-code" || r.FormValue("code_verifier") != verifier {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "access-1", "token_type": "Bearer"})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-1" || r.URL.RawQuery != "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"sub": "user-1", "email": "user@example.com"})
+	})
+	return issuer
+}
+
+// Test an OIDC login sends a PKCE challenge and identifies the user by the
+// subject from their user info.
+func TestOIDCProvider(t *testing.T) {
+	ctx := context.Background()
+	verifier := oauth2.GenerateVerifier()
+	issuer := newTestIssuer(t, verifier)
+	provider, err := DiscoverOIDC(ctx, issuer.URL+"/", "Staff login", "client-id", "secret", "https://roster.test/auth/callback")
+	if err != nil {
+		t.Fatalf("DiscoverOIDC: %v", err)
+	}
+	if provider.Name() != OIDCProviderName || provider.Label() != "Staff login" {
+		t.Errorf("unexpected provider %q %q", provider.Name(), provider.Label())
+	}
+
+	loginURL, err := url.Parse(provider.LoginURL("state-1", verifier))
+	if err != nil {
+		t.Fatalf("bad login URL: %v", err)
+	}
+	query := loginURL.Query()
+	if loginURL.Path != "/authorize" || query.Get("state") != "state-1" || query.Get("code_challenge") != oauth2.S256ChallengeFromVerifier(verifier) {
+		t.Errorf("unexpected login URL %v", loginURL)
+	}
+
+	callback := httptest.NewRequest("GET", "/auth/callback?state=state-1&code=good-code", nil)
+	identity, err := provider.Identify(ctx, callback, verifier)
+	if err != nil {
+		t.Fatalf("Identify: %v", err)
+	}
+	if identity.Provider != OIDCProviderName || identity.Subject != "user-1" {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+
+	if _, err := provider.Identify(ctx, callback, oauth2.GenerateVerifier()); err == nil {
+		t.Error("expected the wrong verifier to be rejected")
+	}
+	denied := httptest.NewRequest("GET", "/auth/callback?state=state-1&error=access_denied", nil)
+	if _, err := provider.Identify(ctx, denied, verifier); !errors.Is(err, ErrDenied) {
+		t.Errorf("expected ErrDenied, got %v", err)
+	}
+}
+
+// Test discovery refuses a document for a different issuer.
+func TestDiscoverOIDC_IssuerMismatch(t *testing.T) {
+	issuer := newTestIssuer(t, "")
+	other := httptest.NewServer(http.RedirectHandler(issuer.URL+"/.well-known/openid-configuration", http.StatusFound))
+	defer other.Close()
+	if _, err := DiscoverOIDC(context.Background(), other.URL, "", "client-id", "", ""); err == nil {
+		t.Error("expected a mismatched issuer to be rejected")
+	}
+}
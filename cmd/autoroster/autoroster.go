@@ -0,0 +1,347 @@
+// Package autoroster fills the empty slots of a roster week.
+package autoroster
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"roster/cmd/models"
+	"roster/cmd/utils"
+
+	"github.com/google/uuid"
+)
+
+// Options control how a week is filled.
+type Options struct {
+	// KeepAssignments keeps the staff already on the week, filling only the
+	// empty slots. Otherwise every slot is cleared and filled again.
+	KeepAssignments bool
+	// Previous and Next are the weeks either side, or nil if they haven't
+	// been rostered, so no one is given a late shift and an early one the
+	// next morning across the end of the week.
+	Previous *models.RosterWeek
+	Next     *models.RosterWeek
+}
+
+// Unfilled is a slot that no one could be found for.
+type Unfilled struct {
+	SlotID   uuid.UUID
+	DayName  string
+	SlotName string
+	// Reason says why each staff member couldn't take the slot.
+	Reason string
+}
+
+// Result is what Fill did to a week.
+type Result struct {
+	Filled   int
+	Unfilled []Unfilled
+}
+
+// Reasons a staff member can't take a slot.
+const (
+	reasonUnavailable = "unavailable"
+	reasonAway        = "on leave"
+	reasonSameDay     = "already on that day"
+	reasonIdeal       = "at their ideal shifts"
+	reasonLateToEarly = "would work a late then an early"
+	reasonKitchen     = "not kitchen staff"
+	reasonBar         = "kitchen staff"
+)
+
+// reasonOrder is the order reasons are checked and explained in.
+var reasonOrder = []string{reasonKitchen, reasonBar, reasonAway, reasonUnavailable, reasonSameDay, reasonIdeal, reasonLateToEarly}
+
+// openSlot is an empty slot waiting to be filled.
+type openSlot struct {
+	day  *models.RosterDay
+	slot *models.Slot
+	date time.Time
+}
+
+// solver holds the shifts each staff member has been given so far.
+type solver struct {
+	week  *models.RosterWeek
+	staff []*models.StaffMember
+	early string
+	late  string
+	names models.SlotNameList
+	// days maps staff to the shift they are on each day, by day offset.
+	days     map[uuid.UUID]map[int]string
+	total    map[uuid.UUID]int
+	weekends map[uuid.UUID]int
+	lates    map[uuid.UUID]int
+}
+
+// Fill assigns staff to the empty slots of week's open days. Staff are only
+// given shifts they are available for and not on leave for, at most one a
+// day, no more than their ideal number of shifts a week, and never a late
+// shift followed by the next day's early shift. Weekend and late shifts are
+// shared out as evenly as possible. Hidden, deleted and trial staff are
+// never rostered.
+//
+// Slots with the fewest staff able to take them are filled first. Slots no
+// one can take are left empty and returned with the reason why.
+func Fill(week *models.RosterWeek, allStaff []*models.StaffMember, opts Options) Result {
+	s := &solver{
+		week:     week,
+		names:    models.SlotNames(week.Slots),
+		days:     map[uuid.UUID]map[int]string{},
+		total:    map[uuid.UUID]int{},
+		weekends: map[uuid.UUID]int{},
+		lates:    map[uuid.UUID]int{},
+	}
+	if len(week.Slots) > 1 {
+		s.early, s.late = week.Slots[0].Name, week.Slots[len(week.Slots)-1].Name
+	}
+	for _, staff := range allStaff {
+		if !staff.IsHidden && !staff.IsDeleted && !staff.IsTrial {
+			s.staff = append(s.staff, staff)
+		}
+		s.days[staff.ID] = map[int]string{}
+	}
+	for _, neighbour := range []*models.RosterWeek{opts.Previous, opts.Next} {
+		if neighbour != nil {
+			s.addNeighbour(neighbour)
+		}
+	}
+	sort.SliceStable(s.staff, func(i, j int) bool {
+		return s.staff[i].RosterName() < s.staff[j].RosterName()
+	})
+
+	startDate := utils.WeekStartFromOffset(week.WeekOffset)
+	open := []openSlot{}
+	for _, day := range week.Days {
+		date := startDate.AddDate(0, 0, day.Offset)
+		for _, row := range day.Rows {
+			for i := range row.Slots {
+				slot := &row.Slots[i]
+				if !opts.KeepAssignments {
+					slot.AssignedStaff = nil
+					slot.StaffString = nil
+				}
+				if slot.AssignedStaff != nil {
+					s.assign(*slot.AssignedStaff, day.Offset, slot.Name, date)
+					continue
+				}
+				if !day.IsClosed {
+					open = append(open, openSlot{day, slot, date})
+				}
+			}
+		}
+	}
+
+	result := Result{Unfilled: []Unfilled{}}
+	for len(open) > 0 {
+		best, bestCandidates := -1, []*models.StaffMember{}
+		for i, o := range open {
+			candidates, reasons := s.candidates(o)
+			if len(candidates) == 0 {
+				best, bestCandidates = i, nil
+				result.Unfilled = append(result.Unfilled, Unfilled{
+					SlotID:   o.slot.ID,
+					DayName:  o.day.DayName,
+					SlotName: o.slot.Name,
+					Reason:   explain(reasons),
+				})
+				break
+			}
+			if best < 0 || len(candidates) < len(bestCandidates) {
+				best, bestCandidates = i, candidates
+			}
+		}
+		o := open[best]
+		open = append(open[:best], open[best+1:]...)
+		if bestCandidates == nil {
+			continue
+		}
+		staff := s.choose(o, bestCandidates)
+		name := staff.RosterName()
+		o.slot.AssignedStaff = &staff.ID
+		o.slot.StaffString = &name
+		s.assign(staff.ID, o.day.Offset, o.slot.Name, o.date)
+		result.Filled++
+	}
+	sort.SliceStable(result.Unfilled, func(i, j int) bool {
+		return s.position(result.Unfilled[i].SlotID) < s.position(result.Unfilled[j].SlotID)
+	})
+	return result
+}
+
+// addNeighbour records the early and late shifts worked in w, a week either
+// side of the one being filled, by their day offset from it. They only rule
+// out shifts either side of them and don't count towards anyone's totals.
+func (s *solver) addNeighbour(w *models.RosterWeek) {
+	if len(w.Slots) < 2 {
+		return
+	}
+	early, late := w.Slots[0].Name, w.Slots[len(w.Slots)-1].Name
+	shift := 7 * (w.WeekOffset - s.week.WeekOffset)
+	for _, day := range w.Days {
+		if day == nil || day.IsClosed {
+			continue
+		}
+		for _, row := range day.Rows {
+			if row == nil {
+				continue
+			}
+			for _, slot := range row.Slots {
+				if slot.AssignedStaff == nil {
+					continue
+				}
+				days := s.days[*slot.AssignedStaff]
+				if days == nil {
+					days = map[int]string{}
+					s.days[*slot.AssignedStaff] = days
+				}
+				switch slot.Name {
+				case early:
+					days[day.Offset+shift] = s.early
+				case late:
+					days[day.Offset+shift] = s.late
+				}
+			}
+		}
+	}
+}
+
+func (s *solver) assign(staffID uuid.UUID, offset int, slot string, date time.Time) {
+	if s.days[staffID] == nil {
+		s.days[staffID] = map[int]string{}
+	}
+	s.days[staffID][offset] = slot
+	s.total[staffID]++
+	if date.Weekday() == time.Saturday || date.Weekday() == time.Sunday {
+		s.weekends[staffID]++
+	}
+	if slot == s.late {
+		s.lates[staffID]++
+	}
+}
+
+// candidates returns the staff who can take o, and why each of the others
+// can't.
+func (s *solver) candidates(o openSlot) ([]*models.StaffMember, map[string]int) {
+	candidates := []*models.StaffMember{}
+	reasons := map[string]int{}
+	kitchen := s.isKitchen(*o.slot)
+	for _, staff := range s.staff {
+		reason := s.ruleOut(staff, o, kitchen)
+		if reason != "" {
+			reasons[reason]++
+			continue
+		}
+		candidates = append(candidates, staff)
+	}
+	return candidates, reasons
+}
+
+// isKitchen reports whether slot is one of the week's kitchen shifts. Kitchen
+// slots are only filled with kitchen staff, and other slots only with bar
+// staff.
+func (s *solver) isKitchen(slot models.Slot) bool {
+	for _, def := range s.week.Slots {
+		if strings.EqualFold(def.Name, slot.Name) {
+			return def.Kitchen
+		}
+	}
+	return false
+}
+
+// ruleOut returns why staff can't take o, or "" if they can.
+func (s *solver) ruleOut(staff *models.StaffMember, o openSlot, kitchen bool) string {
+	offset := o.day.Offset
+	switch {
+	case kitchen && !staff.IsKitchen:
+		return reasonKitchen
+	case !kitchen && staff.IsKitchen:
+		return reasonBar
+	case staff.IsAway(o.date):
+		return reasonAway
+	case offset < len(staff.Availability) && staff.HasConflict(o.slot.Name, offset, s.names):
+		return reasonUnavailable
+	}
+	days := s.days[staff.ID]
+	if _, ok := days[offset]; ok {
+		return reasonSameDay
+	}
+	if s.total[staff.ID] >= staff.IdealShifts {
+		return reasonIdeal
+	}
+	if s.late != "" {
+		if o.slot.Name == s.early && days[offset-1] == s.late {
+			return reasonLateToEarly
+		}
+		if o.slot.Name == s.late && days[offset+1] == s.early {
+			return reasonLateToEarly
+		}
+	}
+	return ""
+}
+
+// choose picks who of candidates takes o: whoever has had the fewest weekend
+// shifts for a weekend slot, then the fewest lates for a late slot or the
+// most for any other, leaving lates to those who have had fewer, then
+// whoever is furthest from their ideal shifts.
+func (s *solver) choose(o openSlot, candidates []*models.StaffMember) *models.StaffMember {
+	weekend := o.date.Weekday() == time.Saturday || o.date.Weekday() == time.Sunday
+	late := o.slot.Name == s.late
+	score := func(staff *models.StaffMember) []float64 {
+		scores := []float64{}
+		if weekend {
+			scores = append(scores, float64(s.weekends[staff.ID]))
+		}
+		if late {
+			scores = append(scores, float64(s.lates[staff.ID]))
+		} else {
+			scores = append(scores, -float64(s.lates[staff.ID]))
+		}
+		return append(scores, float64(s.total[staff.ID])/float64(staff.IdealShifts))
+	}
+	best := candidates[0]
+	bestScore := score(best)
+	for _, staff := range candidates[1:] {
+		staffScore := score(staff)
+		for i := range staffScore {
+			if staffScore[i] != bestScore[i] {
+				if staffScore[i] < bestScore[i] {
+					best, bestScore = staff, staffScore
+				}
+				break
+			}
+		}
+	}
+	return best
+}
+
+// position orders slots by day, then row, then shift.
+func (s *solver) position(slotID uuid.UUID) int {
+	n := 0
+	for _, day := range s.week.Days {
+		for _, row := range day.Rows {
+			for _, slot := range row.Slots {
+				if slot.ID == slotID {
+					return n
+				}
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// explain describes why no one could take a slot.
+func explain(reasons map[string]int) string {
+	parts := []string{}
+	for _, reason := range reasonOrder {
+		if n := reasons[reason]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, reason))
+		}
+	}
+	if len(parts) == 0 {
+		return "no staff can be rostered"
+	}
+	return "no one free: " + strings.Join(parts, ", ")
+}
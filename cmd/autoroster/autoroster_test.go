@@ -0,0 +1,246 @@
+package autoroster
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"roster/cmd/models"
+	"roster/cmd/utils"
+
+	"github.com/google/uuid"
+)
+
+// newWeek returns a week at offset 0 with one row of the early, mid and late
+// shifts a day.
+func newWeek() *models.RosterWeek {
+	week := &models.RosterWeek{ID: uuid.New(), Slots: models.LegacySlots}
+	for i := 0; i < 7; i++ {
+		week.Days = append(week.Days, &models.RosterDay{
+			ID:      uuid.New(),
+			DayName: utils.WeekStartFromOffset(0).AddDate(0, 0, i).Weekday().String(),
+			Offset:  i,
+			Rows:    []*models.Row{models.NewRow(week.Slots)},
+		})
+	}
+	return week
+}
+
+func newStaff(name string, idealShifts int) *models.StaffMember {
+	return &models.StaffMember{ID: uuid.New(), FirstName: name, IdealShifts: idealShifts}
+}
+
+// rostered returns who is on each slot of the week, by day and shift.
+func rostered(week *models.RosterWeek) map[int]map[string]uuid.UUID {
+	got := map[int]map[string]uuid.UUID{}
+	for _, day := range week.Days {
+		got[day.Offset] = map[string]uuid.UUID{}
+		for _, slot := range day.Rows[0].Slots {
+			if slot.AssignedStaff != nil {
+				got[day.Offset][slot.Name] = *slot.AssignedStaff
+			}
+		}
+	}
+	return got
+}
+
+// Test every slot a staff member is rostered on is one they can work.
+func TestFill_RespectsStaff(t *testing.T) {
+	week := newWeek()
+	week.Days[2].IsClosed = true
+	// Only the mid slot of the first day is for the kitchen.
+	week.Slots = []models.SlotDefinition{{Name: "Early"}, {Name: "Mid"}, {Name: "Late"}, {Name: "Prep", Kitchen: true}}
+	week.Days[0].Rows[0].Slots[1].Name = "Prep"
+
+	amy := newStaff("Amy", 7)
+	for i := 0; i < 7; i++ {
+		amy.Availability = append(amy.Availability, models.DayAvailability{Unavailable: models.SlotNameList{}})
+	}
+	amy.Availability[1].Unavailable = models.SlotNameList{"Early", "Mid", "Late"}
+	leaveStart := utils.WeekStartFromOffset(0).AddDate(0, 0, 3)
+	leaveEnd := leaveStart.AddDate(0, 0, 1)
+	amy.LeaveRequests = []models.LeaveRequest{{
+		Status:    models.LeaveApproved,
+		StartDate: models.CustomDate{Time: &leaveStart},
+		EndDate:   models.CustomDate{Time: &leaveEnd},
+	}}
+	cook := newStaff("Cook", 7)
+	cook.IsKitchen = true
+	hidden := newStaff("Hidden", 7)
+	hidden.IsHidden = true
+	bob := newStaff("Bob", 2)
+
+	result := Fill(week, []*models.StaffMember{amy, cook, hidden, bob}, Options{})
+	got := rostered(week)
+	if got[0]["Prep"] != cook.ID {
+		t.Errorf("expected the kitchen slot to go to the cook, got %v", got[0])
+	}
+	if len(got[2]) != 0 {
+		t.Errorf("expected the closed day to be left empty, got %v", got[2])
+	}
+	shifts := map[uuid.UUID]int{}
+	for offset, day := range got {
+		seen := map[uuid.UUID]bool{}
+		for name, id := range day {
+			shifts[id]++
+			if seen[id] {
+				t.Errorf("expected one shift a day, got %v on day %d", day, offset)
+			}
+			seen[id] = true
+			if id == hidden.ID || (id == cook.ID && !(offset == 0 && name == "Prep")) {
+				t.Errorf("expected %v not to be rostered on day %d %s", id, offset, name)
+			}
+			if id == amy.ID && (offset == 1 || offset == 3) {
+				t.Errorf("expected Amy not to work while unavailable or away, got day %d", offset)
+			}
+		}
+	}
+	if shifts[bob.ID] != 2 || shifts[amy.ID] != 4 {
+		t.Errorf("expected Bob to reach his ideal shifts and Amy every day she could, got %v", shifts)
+	}
+	if result.Filled != 7 || len(result.Unfilled) != 11 {
+		t.Errorf("expected 7 slots filled and 11 unfilled, got %d and %d", result.Filled, len(result.Unfilled))
+	}
+	order := map[uuid.UUID]int{}
+	for _, day := range week.Days {
+		for _, slot := range day.Rows[0].Slots {
+			order[slot.ID] = len(order)
+		}
+	}
+	for i := 1; i < len(result.Unfilled); i++ {
+		if order[result.Unfilled[i-1].SlotID] > order[result.Unfilled[i].SlotID] {
+			t.Errorf("expected unfilled slots in roster order, got %+v", result.Unfilled)
+			break
+		}
+	}
+	for _, unfilled := range result.Unfilled {
+		if !strings.Contains(unfilled.Reason, "1 kitchen staff") {
+			t.Errorf("expected the reason to count the cook, got %q", unfilled.Reason)
+		}
+	}
+}
+
+// Test no one is given a late shift and then the next day's early shift.
+func TestFill_LateToEarly(t *testing.T) {
+	week := newWeek()
+	for _, day := range week.Days {
+		day.Rows[0].Slots = []models.Slot{day.Rows[0].Slots[0], day.Rows[0].Slots[2]}
+	}
+	week.Slots = []models.SlotDefinition{{Name: "Early"}, {Name: "Late"}}
+	amy, bob := newStaff("Amy", 7), newStaff("Bob", 7)
+
+	result := Fill(week, []*models.StaffMember{amy, bob}, Options{})
+	got := rostered(week)
+	for offset := 0; offset < 6; offset++ {
+		if late, ok := got[offset]["Late"]; ok && got[offset+1]["Early"] == late {
+			t.Errorf("expected no late then early, got day %d %v and day %d %v", offset, got[offset], offset+1, got[offset+1])
+		}
+	}
+	if result.Filled != 14 {
+		t.Errorf("expected two staff to cover every shift, filled %d: %+v", result.Filled, result.Unfilled)
+	}
+}
+
+// Test no one is given an early shift after a late at the end of the
+// previous week, or a late before an early at the start of the next.
+func TestFill_LateToEarlyAcrossWeeks(t *testing.T) {
+	amy := newStaff("Amy", 7)
+	name := "Amy"
+	previous, next := newWeek(), newWeek()
+	previous.WeekOffset, next.WeekOffset = -1, 1
+	previous.Days[6].Rows[0].Slots[2].AssignedStaff = &amy.ID
+	previous.Days[6].Rows[0].Slots[2].StaffString = &name
+	next.Days[0].Rows[0].Slots[0].AssignedStaff = &amy.ID
+	next.Days[0].Rows[0].Slots[0].StaffString = &name
+
+	week := newWeek()
+	for _, day := range week.Days {
+		day.Rows[0].Slots = day.Rows[0].Slots[:1]
+	}
+	week.Days[6].Rows[0].Slots[0].Name = "Late"
+	result := Fill(week, []*models.StaffMember{amy}, Options{Previous: previous, Next: next})
+	got := rostered(week)
+	if _, ok := got[0]["Early"]; ok {
+		t.Errorf("expected Amy not to work the early after last week's late, got %v", got[0])
+	}
+	if _, ok := got[6]["Late"]; ok {
+		t.Errorf("expected Amy not to work the late before next week's early, got %v", got[6])
+	}
+	if result.Filled != 5 || len(result.Unfilled) != 2 {
+		t.Fatalf("expected the first early and last late to be left empty, filled %d: %+v", result.Filled, result.Unfilled)
+	}
+	for _, u := range result.Unfilled {
+		if !strings.Contains(u.Reason, reasonLateToEarly) {
+			t.Errorf("expected %s %s to be explained, got %q", u.DayName, u.SlotName, u.Reason)
+		}
+	}
+
+	week = newWeek()
+	for _, day := range week.Days {
+		day.Rows[0].Slots = day.Rows[0].Slots[:1]
+	}
+	if result := Fill(week, []*models.StaffMember{amy}, Options{}); result.Filled != 7 {
+		t.Errorf("expected the first early to be filled without a previous week, filled %d", result.Filled)
+	}
+}
+
+// Test kept assignments are left alone and count towards ideal shifts,
+// while otherwise the week is filled again from scratch.
+func TestFill_KeepAssignments(t *testing.T) {
+	amy, bob := newStaff("Amy", 1), newStaff("Bob", 7)
+	week := newWeek()
+	name := "Amy"
+	week.Days[4].Rows[0].Slots[0].AssignedStaff = &amy.ID
+	week.Days[4].Rows[0].Slots[0].StaffString = &name
+
+	Fill(week, []*models.StaffMember{amy, bob}, Options{KeepAssignments: true})
+	got := rostered(week)
+	if got[4]["Early"] != amy.ID {
+		t.Errorf("expected Amy's shift to be kept, got %v", got[4])
+	}
+	for offset, day := range got {
+		for _, id := range day {
+			if id == amy.ID && offset != 4 {
+				t.Errorf("expected Amy to be at her ideal shifts already, got day %d", offset)
+			}
+		}
+	}
+
+	week = newWeek()
+	bobName := "Bob"
+	week.Days[4].Rows[0].Slots[0].AssignedStaff = &bob.ID
+	week.Days[4].Rows[0].Slots[0].StaffString = &bobName
+	Fill(week, []*models.StaffMember{amy}, Options{})
+	if got := rostered(week); got[4]["Early"] == bob.ID {
+		t.Error("expected existing assignments to be cleared")
+	}
+}
+
+// Test weekend and late shifts are shared out rather than all going to the
+// first staff member.
+func TestFill_BalancesWeekendsAndLates(t *testing.T) {
+	week := newWeek()
+	staff := []*models.StaffMember{newStaff("Amy", 7), newStaff("Bob", 7), newStaff("Cat", 7)}
+	Fill(week, staff, Options{})
+
+	weekends, lates := map[uuid.UUID]int{}, map[uuid.UUID]int{}
+	for _, day := range week.Days {
+		date := utils.WeekStartFromOffset(0).AddDate(0, 0, day.Offset)
+		for _, slot := range day.Rows[0].Slots {
+			if slot.AssignedStaff == nil {
+				continue
+			}
+			if date.Weekday() == time.Saturday || date.Weekday() == time.Sunday {
+				weekends[*slot.AssignedStaff]++
+			}
+			if slot.Name == "Late" {
+				lates[*slot.AssignedStaff]++
+			}
+		}
+	}
+	for _, s := range staff {
+		if weekends[s.ID] != 2 || lates[s.ID] < 2 || lates[s.ID] > 3 {
+			t.Errorf("expected %s to get a fair share, got %d weekend and %d late shifts", s.FirstName, weekends[s.ID], lates[s.ID])
+		}
+	}
+}
@@ -0,0 +1,413 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"roster/cmd/migrate"
+	"roster/cmd/models"
+	"roster/cmd/repository"
+	"roster/cmd/utils"
+
+	"github.com/google/uuid"
+)
+
+// Format identifies a JSON document as a roster backup archive.
+const Format = "retreat-roster-backup"
+
+// FormatVersion is the archive layout written by Create. Bump it whenever the
+// layout changes, and keep Restore able to read the versions before it.
+//
+// Version 2 stores roster rows as a list of named slots, each week's shifts,
+// and availability as the shifts staff can't work. Version 1 archives have
+// early, mid and late fields instead, and are read into the new layout.
+//
+// Version 3 adds saved roster templates.
+//
+// Version 4 records which staff are minors.
+//
+// Version 5 records which shifts are for the kitchen.
+const FormatVersion = 5
+
+// configIDs are the config records copied into an archive.
+var configIDs = []string{"version", migrate.VersionID, migrate.WeekStartID}
+
+// Archive is a complete copy of the roster's data that doesn't depend on the
+// repository backend it came from.
+type Archive struct {
+	Format          string                   `json:"format"`
+	Version         int                      `json:"version"`
+	CreatedAt       time.Time                `json:"createdAt"`
+	Staff           []*models.StaffMember    `json:"staff"`
+	RosterWeeks     []*models.RosterWeek     `json:"rosterWeeks"`
+	Timesheets      []*models.TimesheetEntry `json:"timesheets"`
+	Config          []models.Version         `json:"config"`
+	RosterTemplates []*models.RosterTemplate `json:"rosterTemplates"`
+}
+
+// Summary counts the records in an archive.
+type Summary struct {
+	Staff           int
+	RosterWeeks     int
+	Timesheets      int
+	Config          int
+	RosterTemplates int
+}
+
+func (s Summary) String() string {
+	return fmt.Sprintf("%d staff, %d roster weeks, %d timesheet entries, %d config records, %d roster templates",
+		s.Staff, s.RosterWeeks, s.Timesheets, s.Config, s.RosterTemplates)
+}
+
+func (a *Archive) Summary() Summary {
+	return Summary{
+		Staff:           len(a.Staff),
+		RosterWeeks:     len(a.RosterWeeks),
+		Timesheets:      len(a.Timesheets),
+		Config:          len(a.Config),
+		RosterTemplates: len(a.RosterTemplates),
+	}
+}
+
+// Create copies every staff member, roster week, timesheet entry, config
+// record and roster template out of repos. The audit log is not included.
+func Create(ctx context.Context, repos repository.Repositories) (*Archive, error) {
+	staff, err := repos.Staff.LoadAllStaffRecords(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load staff: %w", err)
+	}
+	weeks, err := repos.RosterWeek.LoadAllRosterWeeks(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load roster weeks: %w", err)
+	}
+	timesheets, err := repos.Timesheet.GetAllTimesheetEntries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load timesheets: %w", err)
+	}
+	templates, err := repos.RosterTemplates.LoadAllRosterTemplates(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load roster templates: %w", err)
+	}
+	config := []models.Version{}
+	for _, id := range configIDs {
+		v, err := repos.Config.LoadVersionByID(ctx, id)
+		if errors.Is(err, repository.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load config %q: %w", id, err)
+		}
+		config = append(config, *v)
+	}
+
+	archive := &Archive{
+		Format:          Format,
+		Version:         FormatVersion,
+		CreatedAt:       time.Now(),
+		Staff:           staff,
+		RosterWeeks:     weeks,
+		Timesheets:      *timesheets,
+		Config:          config,
+		RosterTemplates: templates,
+	}
+	// Keep empty sections as [] rather than null in the JSON.
+	if archive.Staff == nil {
+		archive.Staff = []*models.StaffMember{}
+	}
+	if archive.RosterWeeks == nil {
+		archive.RosterWeeks = []*models.RosterWeek{}
+	}
+	if archive.Timesheets == nil {
+		archive.Timesheets = []*models.TimesheetEntry{}
+	}
+	if archive.RosterTemplates == nil {
+		archive.RosterTemplates = []*models.RosterTemplate{}
+	}
+	return archive, nil
+}
+
+// Write encodes the archive as indented JSON.
+func Write(w io.Writer, archive *Archive) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(archive)
+}
+
+// Read decodes and validates an archive.
+func Read(r io.Reader) (*Archive, error) {
+	var archive Archive
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&archive); err != nil {
+		return nil, fmt.Errorf("invalid backup archive: %w", err)
+	}
+	if err := archive.Validate(); err != nil {
+		return nil, err
+	}
+	return &archive, nil
+}
+
+// Validate checks the archive is one this version can restore and that its
+// records are complete and don't collide with each other.
+func (a *Archive) Validate() error {
+	if a.Format != Format {
+		return fmt.Errorf("invalid backup archive: format is %q, want %q", a.Format, Format)
+	}
+	if a.Version < 1 || a.Version > FormatVersion {
+		return fmt.Errorf("invalid backup archive: unsupported version %d", a.Version)
+	}
+
+	staffIDs := map[uuid.UUID]bool{}
+	for i, s := range a.Staff {
+		if s == nil || s.ID == uuid.Nil {
+			return fmt.Errorf("invalid backup archive: staff %d has no ID", i)
+		}
+		if staffIDs[s.ID] {
+			return fmt.Errorf("invalid backup archive: duplicate staff %v", s.ID)
+		}
+		staffIDs[s.ID] = true
+	}
+
+	weekIDs := map[uuid.UUID]bool{}
+	weekOffsets := map[int]bool{}
+	for i, week := range a.RosterWeeks {
+		if week == nil || week.ID == uuid.Nil {
+			return fmt.Errorf("invalid backup archive: roster week %d has no ID", i)
+		}
+		if weekIDs[week.ID] {
+			return fmt.Errorf("invalid backup archive: duplicate roster week %v", week.ID)
+		}
+		if weekOffsets[week.WeekOffset] {
+			return fmt.Errorf("invalid backup archive: more than one roster week at offset %d", week.WeekOffset)
+		}
+		weekIDs[week.ID] = true
+		weekOffsets[week.WeekOffset] = true
+		for _, day := range week.Days {
+			if day == nil {
+				return fmt.Errorf("invalid backup archive: roster week %v has an empty day", week.ID)
+			}
+			for _, row := range day.Rows {
+				if row == nil {
+					return fmt.Errorf("invalid backup archive: roster week %v has an empty row", week.ID)
+				}
+			}
+		}
+	}
+
+	entryIDs := map[uuid.UUID]bool{}
+	for i, entry := range a.Timesheets {
+		if entry == nil || entry.ID == uuid.Nil {
+			return fmt.Errorf("invalid backup archive: timesheet entry %d has no ID", i)
+		}
+		if entryIDs[entry.ID] {
+			return fmt.Errorf("invalid backup archive: duplicate timesheet entry %v", entry.ID)
+		}
+		entryIDs[entry.ID] = true
+	}
+
+	configIDs := map[string]bool{}
+	for _, v := range a.Config {
+		if v.ID == "" || configIDs[v.ID] {
+			return fmt.Errorf("invalid backup archive: missing or duplicate config ID %q", v.ID)
+		}
+		configIDs[v.ID] = true
+	}
+
+	templateIDs := map[uuid.UUID]bool{}
+	for i, template := range a.RosterTemplates {
+		if template == nil || template.ID == uuid.Nil {
+			return fmt.Errorf("invalid backup archive: roster template %d has no ID", i)
+		}
+		if templateIDs[template.ID] {
+			return fmt.Errorf("invalid backup archive: duplicate roster template %v", template.ID)
+		}
+		templateIDs[template.ID] = true
+		for _, day := range template.Days {
+			if day == nil {
+				return fmt.Errorf("invalid backup archive: roster template %v has an empty day", template.ID)
+			}
+			for _, row := range day.Rows {
+				if row == nil {
+					return fmt.Errorf("invalid backup archive: roster template %v has an empty row", template.ID)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Options control how an archive is restored.
+type Options struct {
+	// Replace allows restoring into a database that already has records.
+	// Stored records the archive has a copy of are replaced: roster weeks are
+	// matched by week offset, timesheet entries by staff member and shift
+	// start, and staff members sharing a login with an archived one are
+	// deleted.
+	Replace bool
+}
+
+// ErrNotEmpty is returned by Restore when the database already has records
+// and Options.Replace isn't set.
+var ErrNotEmpty = errors.New("the database isn't empty; restore with replace to overwrite it")
+
+// Restore validates the archive and saves every record in it to repos. Records
+// in repos that aren't in the archive are left alone, so restore into an
+// empty database to get an exact copy.
+func Restore(ctx context.Context, repos repository.Repositories, archive *Archive, opts Options) (Summary, error) {
+	if err := archive.Validate(); err != nil {
+		return Summary{}, err
+	}
+	if archive.Version < 2 {
+		for _, week := range archive.RosterWeeks {
+			if len(week.Slots) == 0 {
+				week.Slots = append([]models.SlotDefinition{}, models.LegacySlots...)
+			}
+		}
+	}
+	if opts.Replace {
+		if err := matchStoredRecords(ctx, repos, archive); err != nil {
+			return Summary{}, err
+		}
+	} else {
+		empty, err := isEmpty(ctx, repos)
+		if err != nil {
+			return Summary{}, err
+		}
+		if !empty {
+			return Summary{}, ErrNotEmpty
+		}
+	}
+	if len(archive.Staff) > 0 {
+		if err := repos.Staff.SaveStaffMembers(ctx, archive.Staff); err != nil {
+			return Summary{}, fmt.Errorf("failed to restore staff: %w", err)
+		}
+	}
+	if len(archive.RosterWeeks) > 0 {
+		if err := repos.RosterWeek.SaveAllRosterWeeks(ctx, archive.RosterWeeks); err != nil {
+			return Summary{}, fmt.Errorf("failed to restore roster weeks: %w", err)
+		}
+	}
+	if len(archive.Timesheets) > 0 {
+		if err := repos.Timesheet.SaveAllTimesheetEntries(ctx, archive.Timesheets); err != nil {
+			return Summary{}, fmt.Errorf("failed to restore timesheets: %w", err)
+		}
+	}
+	for _, v := range archive.Config {
+		if err := repos.Config.SaveVersion(ctx, v); err != nil {
+			return Summary{}, fmt.Errorf("failed to restore config %q: %w", v.ID, err)
+		}
+	}
+	for _, template := range archive.RosterTemplates {
+		if err := repos.RosterTemplates.SaveRosterTemplate(ctx, *template); err != nil {
+			return Summary{}, fmt.Errorf("failed to restore roster template %q: %w", template.Name, err)
+		}
+	}
+	summary := archive.Summary()
+	utils.PrintLog("Restored backup from %v: %v", archive.CreatedAt.Format(time.RFC3339), summary)
+	return summary, nil
+}
+
+// isEmpty reports whether repos has no staff, roster weeks, timesheet entries
+// or roster templates. Config records don't count, as every started database
+// has them.
+func isEmpty(ctx context.Context, repos repository.Repositories) (bool, error) {
+	staff, err := repos.Staff.LoadAllStaffRecords(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to load staff: %w", err)
+	}
+	weeks, err := repos.RosterWeek.LoadAllRosterWeeks(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to load roster weeks: %w", err)
+	}
+	timesheets, err := repos.Timesheet.GetAllTimesheetEntries(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to load timesheets: %w", err)
+	}
+	templates, err := repos.RosterTemplates.LoadAllRosterTemplates(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to load roster templates: %w", err)
+	}
+	return len(staff) == 0 && len(weeks) == 0 && len(*timesheets) == 0 && len(templates) == 0, nil
+}
+
+// matchStoredRecords prepares the archive to replace the stored records it
+// has a copy of under another ID. Archived roster weeks and timesheet entries
+// take the ID of the stored record they replace, so saving them overwrites
+// it. Stored staff members who share a login with an archived one are
+// deleted, as the archived records refer to the archived staff ID.
+func matchStoredRecords(ctx context.Context, repos repository.Repositories, archive *Archive) error {
+	weeks, err := repos.RosterWeek.LoadAllRosterWeeks(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load roster weeks: %w", err)
+	}
+	weekIDs := map[int]uuid.UUID{}
+	for _, week := range weeks {
+		weekIDs[week.WeekOffset] = week.ID
+	}
+	for _, week := range archive.RosterWeeks {
+		if id, ok := weekIDs[week.WeekOffset]; ok {
+			week.ID = id
+		}
+	}
+
+	type shift struct {
+		staffID uuid.UUID
+		start   int64
+	}
+	timesheets, err := repos.Timesheet.GetAllTimesheetEntries(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load timesheets: %w", err)
+	}
+	entryIDs := map[shift]uuid.UUID{}
+	for _, entry := range *timesheets {
+		entryIDs[shift{entry.StaffID, entry.ShiftStart.Unix()}] = entry.ID
+	}
+	for _, entry := range archive.Timesheets {
+		if id, ok := entryIDs[shift{entry.StaffID, entry.ShiftStart.Unix()}]; ok {
+			entry.ID = id
+		}
+	}
+
+	staff, err := repos.Staff.LoadAllStaffRecords(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load staff: %w", err)
+	}
+	archived := map[uuid.UUID]bool{}
+	for _, s := range archive.Staff {
+		archived[s.ID] = true
+	}
+	for _, stored := range staff {
+		if stored.IsDeleted || archived[stored.ID] {
+			continue
+		}
+		for _, s := range archive.Staff {
+			if s.IsDeleted || !sharesLogin(*stored, *s) {
+				continue
+			}
+			if err := repos.Staff.DeleteStaffByID(ctx, stored.ID); err != nil {
+				return fmt.Errorf("failed to replace staff %v: %w", stored.ID, err)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// sharesLogin reports whether a and b can log in with the same identity or
+// email address.
+func sharesLogin(a, b models.StaffMember) bool {
+	if a.Email != "" && strings.EqualFold(a.Email, b.Email) {
+		return true
+	}
+	for _, identity := range a.Identities {
+		if b.HasIdentity(identity) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,251 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"roster/cmd/migrate"
+	"roster/cmd/models"
+	"roster/cmd/repository"
+
+	"github.com/google/uuid"
+)
+
+// seedRepositories stores a little of everything an archive holds.
+func seedRepositories(t *testing.T, repos repository.Repositories) {
+	t.Helper()
+	ctx := context.Background()
+	start := time.Date(2024, 5, 7, 0, 0, 0, 0, time.Local)
+	alice := models.StaffMember{
+		ID:        uuid.New(),
+		FirstName: "Alice",
+		Role:      models.AdminRole,
+		Tokens:    []uuid.UUID{uuid.New()},
+		LeaveRequests: []models.LeaveRequest{{
+			ID:           uuid.New(),
+			CreationDate: models.CustomDate{Time: &start},
+			StartDate:    models.CustomDate{Time: &start},
+			EndDate:      models.CustomDate{Time: &start},
+			Reason:       "Holiday",
+			Status:       models.LeavePending,
+		}},
+	}
+	// Deleted and unfinished accounts must survive a backup too.
+	deleted := models.StaffMember{ID: uuid.New(), FirstName: "Bob", IsDeleted: true}
+	unfinished := models.StaffMember{ID: uuid.New(), Identities: []models.Identity{{Provider: "google", Subject: "google-1"}}}
+	if err := repos.Staff.SaveStaffMembers(ctx, []*models.StaffMember{&alice, &deleted, &unfinished}); err != nil {
+		t.Fatalf("SaveStaffMembers: %v", err)
+	}
+	week, err := repos.RosterWeek.LoadRosterWeek(ctx, 0)
+	if err != nil {
+		t.Fatalf("LoadRosterWeek: %v", err)
+	}
+	template := models.NewRosterTemplate("Winter", *week, false, alice.ID)
+	if err := repos.RosterTemplates.SaveRosterTemplate(ctx, template); err != nil {
+		t.Fatalf("SaveRosterTemplate: %v", err)
+	}
+	entry := models.TimesheetEntry{
+		ID:         uuid.New(),
+		StaffID:    alice.ID,
+		StartDate:  start,
+		ShiftStart: start.Add(17 * time.Hour),
+		ShiftEnd:   start.Add(23 * time.Hour),
+		Approved:   true,
+	}
+	if err := repos.Timesheet.SaveTimesheetEntry(ctx, entry); err != nil {
+		t.Fatalf("SaveTimesheetEntry: %v", err)
+	}
+	if err := repos.Config.SaveVersion(ctx, models.Version{ID: migrate.VersionID, Version: 2}); err != nil {
+		t.Fatalf("SaveVersion: %v", err)
+	}
+	if err := repos.Config.SaveVersion(ctx, models.Version{ID: migrate.WeekStartID, Version: int(time.Monday)}); err != nil {
+		t.Fatalf("SaveVersion: %v", err)
+	}
+}
+
+// Test an archive written from one backend restores everything into another.
+func TestCreateRestore_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	source := repository.NewMemoryRepositories()
+	seedRepositories(t, source)
+
+	archive, err := Create(ctx, source)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, archive); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	read, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	db, err := repository.OpenSQLite(filepath.Join(t.TempDir(), "roster.db"))
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	defer db.Close()
+	target := repository.NewSQLiteRepositories(db)
+	summary, err := Restore(ctx, target, read, Options{})
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	want := Summary{Staff: 3, RosterWeeks: 1, Timesheets: 1, Config: 2, RosterTemplates: 1}
+	if summary != want {
+		t.Errorf("summary = %v; want %v", summary, want)
+	}
+
+	restored, err := Create(ctx, target)
+	if err != nil {
+		t.Fatalf("Create(target): %v", err)
+	}
+	if restored.Summary() != want {
+		t.Errorf("restored %v; want %v", restored.Summary(), want)
+	}
+	for _, s := range restored.Staff {
+		if s.FirstName != "Alice" {
+			continue
+		}
+		if len(s.LeaveRequests) != 1 || s.LeaveRequests[0].Reason != "Holiday" || len(s.Tokens) != 1 {
+			t.Errorf("expected Alice's leave and tokens to be restored, got %+v", s)
+		}
+	}
+	if got := restored.Timesheets[0]; !got.Approved || !got.ShiftStart.Equal(archive.Timesheets[0].ShiftStart) {
+		t.Errorf("expected timesheet entry to be restored, got %+v", got)
+	}
+	if got := restored.RosterWeeks[0]; got.ID != archive.RosterWeeks[0].ID || len(got.Days) != 7 {
+		t.Errorf("expected roster week to be restored, got %+v", got)
+	}
+	if got := restored.RosterTemplates[0]; got.Name != "Winter" || len(got.Days) != 7 {
+		t.Errorf("expected roster template to be restored, got %+v", got)
+	}
+	if v, err := target.Config.LoadVersionByID(ctx, migrate.VersionID); err != nil || v.Version != 2 {
+		t.Errorf("expected migration version 2 to be restored, got %+v, %v", v, err)
+	}
+	if day, err := migrate.StoredWeekStart(ctx, target.Config); err != nil || day != time.Monday {
+		t.Errorf("expected weeks to start on Monday after restoring, got %v, %v", day, err)
+	}
+}
+
+// Test restoring into a database that already has a week at an archived week's
+// offset is refused, and with Replace overwrites the stored week and timesheet
+// entry instead of adding a second one.
+func TestRestore_ConflictingRecords(t *testing.T) {
+	ctx := context.Background()
+	source := repository.NewMemoryRepositories()
+	seedRepositories(t, source)
+	archive, err := Create(ctx, source)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	target := repository.NewMemoryRepositories()
+	week, err := target.RosterWeek.LoadRosterWeek(ctx, 0)
+	if err != nil {
+		t.Fatalf("LoadRosterWeek: %v", err)
+	}
+	if week.ID == archive.RosterWeeks[0].ID {
+		t.Fatal("expected the stored week to have its own ID")
+	}
+	stored := *archive.Timesheets[0]
+	stored.ID, stored.Approved = uuid.New(), false
+	if err := target.Timesheet.SaveTimesheetEntry(ctx, stored); err != nil {
+		t.Fatalf("SaveTimesheetEntry: %v", err)
+	}
+	login := models.Identity{Provider: "google", Subject: "google-1"}
+	other := models.StaffMember{ID: uuid.New(), FirstName: "Other", Identities: []models.Identity{login}}
+	if err := target.Staff.SaveStaffMember(ctx, other); err != nil {
+		t.Fatalf("SaveStaffMember: %v", err)
+	}
+
+	if _, err := Restore(ctx, target, archive, Options{}); !errors.Is(err, ErrNotEmpty) {
+		t.Fatalf("expected restoring into a non-empty database to be refused, got %v", err)
+	}
+	if _, err := Restore(ctx, target, archive, Options{Replace: true}); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	weeks, err := target.RosterWeek.LoadAllRosterWeeks(ctx)
+	if err != nil {
+		t.Fatalf("LoadAllRosterWeeks: %v", err)
+	}
+	if len(weeks) != 1 || weeks[0].ID != week.ID || len(weeks[0].Days) != 7 {
+		t.Errorf("expected the archived week to replace the stored one, got %+v", weeks)
+	}
+	entries, err := target.Timesheet.GetAllTimesheetEntries(ctx)
+	if err != nil {
+		t.Fatalf("GetAllTimesheetEntries: %v", err)
+	}
+	if len(*entries) != 1 || !(*entries)[0].Approved {
+		t.Errorf("expected the archived entry to replace the stored one, got %+v", *entries)
+	}
+	if s, err := target.Staff.GetStaffByIdentity(ctx, login); err != nil || s.ID == other.ID {
+		t.Errorf("expected the login to belong to the archived staff member, got %+v, %v", s, err)
+	}
+}
+
+// Test archives that can't be restored are rejected before anything is saved.
+func TestRead_RejectsInvalidArchives(t *testing.T) {
+	id := uuid.New().String()
+	tests := map[string]string{
+		"not json":       `roster`,
+		"wrong format":   `{"format": "something-else", "version": 1}`,
+		"future version": `{"format": "retreat-roster-backup", "version": 99}`,
+		"unknown field":  `{"format": "retreat-roster-backup", "version": 1, "extra": true}`,
+		"missing id":     `{"format": "retreat-roster-backup", "version": 1, "staff": [{"FirstName": "Al"}]}`,
+		"duplicate id":   `{"format": "retreat-roster-backup", "version": 1, "staff": [{"ID": "` + id + `"}, {"ID": "` + id + `"}]}`,
+	}
+	for name, input := range tests {
+		if _, err := Read(strings.NewReader(input)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	repos := repository.NewMemoryRepositories()
+	if _, err := Restore(context.Background(), repos, &Archive{Format: Format}, Options{}); err == nil {
+		t.Fatal("expected Restore to validate the archive")
+	}
+}
+
+// Test a version 1 archive, from before shifts could be configured, restores
+// with the early, mid and late shifts.
+func TestRestore_Version1(t *testing.T) {
+	ctx := context.Background()
+	weekID, staffID := uuid.New(), uuid.New()
+	input := `{"format": "retreat-roster-backup", "version": 1,
+		"staff": [{"ID": "` + staffID.String() + `", "FirstName": "Al",
+			"Availability": [{"Name": "Tuesday", "Early": true, "Mid": false, "Late": true}]}],
+		"rosterWeeks": [{"ID": "` + weekID.String() + `", "WeekOffset": 3, "Days": [{"ID": "` + uuid.NewString() + `",
+			"Rows": [{"ID": "` + uuid.NewString() + `", "Early": {"ID": "` + uuid.NewString() + `", "Description": "Bar"}, "Mid": {}, "Late": {}}]}]}]}`
+	archive, err := Read(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	repos := repository.NewMemoryRepositories()
+	if _, err := Restore(ctx, repos, archive, Options{}); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	week, err := repos.RosterWeek.LoadRosterWeek(ctx, 3)
+	if err != nil || week.ID != weekID {
+		t.Fatalf("LoadRosterWeek = %v, %v; want week %v", week, err, weekID)
+	}
+	if len(week.Slots) != 3 || week.Slots[0].Name != "Early" {
+		t.Errorf("expected the early, mid and late shifts, got %+v", week.Slots)
+	}
+	if slot := week.Days[0].Rows[0].GetSlot("Early"); slot == nil || slot.Description != "Bar" {
+		t.Errorf("expected the early slot to be restored, got %+v", week.Days[0].Rows[0].Slots)
+	}
+	staff, err := repos.Staff.GetStaffByID(ctx, staffID)
+	if err != nil {
+		t.Fatalf("GetStaffByID: %v", err)
+	}
+	if day := staff.Availability[0]; day.IsAvailable("Mid") || !day.IsAvailable("Late") {
+		t.Errorf("expected mid to be unavailable, got %+v", day)
+	}
+}
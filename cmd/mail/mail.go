@@ -0,0 +1,136 @@
+// Package mail sends email to staff.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrBadHeader is returned for messages whose headers would let them add
+// headers of their own.
+var ErrBadHeader = errors.New("mail header contains a line break")
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers email.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// format renders msg as an RFC 5322 message from the given address.
+func (msg Message) format(from string) ([]byte, error) {
+	for _, header := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, ErrBadHeader
+		}
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return b.Bytes(), nil
+}
+
+// SMTPSender sends email through an SMTP server.
+type SMTPSender struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTP creates a sender for the SMTP server at host:port, logging in with
+// username and password unless username is empty.
+func NewSMTP(host string, port string, username string, password string, from string) *SMTPSender {
+	sender := &SMTPSender{addr: net.JoinHostPort(host, port), from: from}
+	if username != "" {
+		sender.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return sender
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	data, err := msg.format(s.from)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := smtp.SendMail(s.addr, s.auth, s.from, []string{msg.To}, data); err != nil {
+		return fmt.Errorf("failed to send mail to %s: %w", msg.To, err)
+	}
+	return nil
+}
+
+// LogSender writes email to w instead of sending it, for development and
+// tests.
+type LogSender struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewLog(w io.Writer) *LogSender {
+	return &LogSender{w: w}
+}
+
+func (s *LogSender) Send(ctx context.Context, msg Message) error {
+	data, err := msg.format("roster@localhost")
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = fmt.Fprintf(s.w, "%s\r\n\r\n", data)
+	return err
+}
+
+// FromEnv creates the sender named in MAIL_SENDER from its environment
+// settings. Mail is written to stdout if no sender is named.
+//
+//	smtp  SMTP_HOST, SMTP_PORT (default 587), SMTP_USERNAME, SMTP_PASSWORD,
+//	      MAIL_FROM
+//	log   MAIL_LOG_FILE to append to instead of stdout
+func FromEnv() (Sender, error) {
+	switch name := os.Getenv("MAIL_SENDER"); name {
+	case "smtp":
+		host, from := os.Getenv("SMTP_HOST"), os.Getenv("MAIL_FROM")
+		if host == "" || from == "" {
+			return nil, errors.New("SMTP_HOST and MAIL_FROM must be set to send mail over SMTP")
+		}
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return NewSMTP(host, port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from), nil
+	case "", "log":
+		path := os.Getenv("MAIL_LOG_FILE")
+		if path == "" {
+			return NewLog(os.Stdout), nil
+		}
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open mail log: %w", err)
+		}
+		return NewLog(f), nil
+	default:
+		return nil, fmt.Errorf("unknown mail sender %q", name)
+	}
+}
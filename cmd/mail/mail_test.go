@@ -0,0 +1,97 @@
+package mail
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// Test the log sender writes out the whole message.
+func TestLogSender(t *testing.T) {
+	var out bytes.Buffer
+	msg := Message{To: "alice@example.com", Subject: "Your login link", Body: "Hello\nAlice"}
+	if err := NewLog(&out).Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	for _, want := range []string{"To: alice@example.com\r\n", "Subject: Your login link\r\n", "Hello\r\nAlice"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in %q", want, out.String())
+		}
+	}
+}
+
+// Test headers can't be used to add more headers.
+func TestSend_RejectsHeaderInjection(t *testing.T) {
+	var out bytes.Buffer
+	msg := Message{To: "alice@example.com\r\nBcc: mallory@example.com", Subject: "Hi"}
+	if err := NewLog(&out).Send(context.Background(), msg); !errors.Is(err, ErrBadHeader) {
+		t.Errorf("expected ErrBadHeader, got %v", err)
+	}
+	if out.Len() != 0 {
+		t.Error("expected nothing to be written")
+	}
+}
+
+// Test the SMTP sender delivers through a server that speaks just enough SMTP.
+func TestSMTPSender(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer listener.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		text := textproto.NewConn(conn)
+		text.PrintfLine("220 localhost ready")
+		var rcpt string
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			switch verb, arg, _ := strings.Cut(line, " "); strings.ToUpper(verb) {
+			case "EHLO", "HELO", "MAIL", "RSET", "NOOP":
+				text.PrintfLine("250 OK")
+			case "RCPT":
+				rcpt = arg
+				text.PrintfLine("250 OK")
+			case "DATA":
+				text.PrintfLine("354 go ahead")
+				data, _ := text.ReadDotBytes()
+				received <- rcpt + "\n" + string(data)
+				text.PrintfLine("250 OK")
+			case "QUIT":
+				text.PrintfLine("221 bye")
+				return
+			default:
+				text.PrintfLine("502 unsupported")
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	sender := NewSMTP(host, port, "", "", "roster@example.com")
+	msg := Message{To: "alice@example.com", Subject: "Your login link", Body: "Hello"}
+	if err := sender.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	got := <-received
+	reader := bufio.NewReader(strings.NewReader(got))
+	rcpt, _ := reader.ReadString('\n')
+	if rcpt != "TO:<alice@example.com>\n" {
+		t.Errorf("unexpected recipient %q", rcpt)
+	}
+	if !strings.Contains(got, "From: roster@example.com") || !strings.Contains(got, "Hello") {
+		t.Errorf("unexpected message %q", got)
+	}
+}
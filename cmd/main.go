@@ -6,8 +6,15 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
+	"roster/cmd/auth"
+	"roster/cmd/backup"
+	"roster/cmd/mail"
 	"roster/cmd/migrate"
+	"roster/cmd/models"
+	"roster/cmd/repository"
 	"roster/cmd/server"
 	"roster/cmd/utils"
 
@@ -20,31 +27,113 @@ func main() {
 	if err := godotenv.Load(); err != nil {
 		utils.PrintError(err, "No .env file found")
 	}
-	ctx := context.TODO()
+	ctx := context.Background()
 
-	db_host := os.Getenv("DB_HOST")
-	db_user := os.Getenv("DB_USER")
-	db_pass := os.Getenv("DB_PASS")
-	db_port := os.Getenv("DB_PORT")
-	uri := fmt.Sprintf("mongodb://%s:%s@%s:%s", db_user, db_pass, db_host, db_port)
-	clientOptions := options.Client().ApplyURI(uri)
-	client, err := mongo.Connect(ctx, clientOptions)
-	if err != nil {
-		log.Fatalf("Error connecting to database: %v", err)
+	var repos repository.Repositories
+	switch backend := os.Getenv("DB_BACKEND"); backend {
+	case "", "mongo":
+		db_host := os.Getenv("DB_HOST")
+		db_user := os.Getenv("DB_USER")
+		db_pass := os.Getenv("DB_PASS")
+		db_port := os.Getenv("DB_PORT")
+		uri := fmt.Sprintf("mongodb://%s:%s@%s:%s", db_user, db_pass, db_host, db_port)
+		clientOptions := options.Client().ApplyURI(uri)
+		client, err := mongo.Connect(ctx, clientOptions)
+		if err != nil {
+			log.Fatalf("Error connecting to database: %v", err)
+		}
+		defer client.Disconnect(ctx)
+		repos = repository.NewMongoRepositories(client.Database("mongodb"))
+	case "sqlite":
+		path := os.Getenv("SQLITE_PATH")
+		if path == "" {
+			path = "./data/roster.db"
+		}
+		db, err := repository.OpenSQLite(path)
+		if err != nil {
+			log.Fatalf("Error opening sqlite database: %v", err)
+		}
+		defer db.Close()
+		repos = repository.NewSQLiteRepositories(db)
+	case "postgres":
+		db, err := repository.OpenPostgres(os.Getenv("POSTGRES_DSN"))
+		if err != nil {
+			log.Fatalf("Error opening postgres database: %v", err)
+		}
+		defer db.Close()
+		repos = repository.NewPostgresRepositories(db)
+	case "memory":
+		utils.PrintLog("Using in-memory storage, data will not be persisted")
+		repos = repository.NewMemoryRepositories()
+	default:
+		log.Fatalf("Unknown DB_BACKEND %q", backend)
 	}
-	db := client.Database("mongodb")
-	defer client.Disconnect(ctx)
 
-	s, err := server.LoadServerState(db, ctx)
+	// Weeks created from now on get these shifts; existing weeks keep theirs.
+	if list := os.Getenv("SHIFT_SLOTS"); list != "" {
+		slots, err := models.ParseSlotDefinitions(list)
+		if err != nil {
+			log.Fatalf("Invalid SHIFT_SLOTS %q: %v", list, err)
+		}
+		models.SetDefaultSlots(slots)
+	}
+	if list := os.Getenv("ROSTER_RULES"); list != "" {
+		rules, err := models.ParseRuleConfig(list)
+		if err != nil {
+			log.Fatalf("Invalid ROSTER_RULES %q: %v", list, err)
+		}
+		models.SetRuleConfig(rules)
+	}
+
+	// Maintenance commands expect the data in its current layout too.
+	if ok, err := migrateDatabase(ctx, repos); err != nil {
+		log.Fatalf("Error migrating database: %v", err)
+	} else if !ok {
+		return
+	}
+
+	if len(os.Args) > 1 {
+		if err := runCommand(ctx, repos, os.Args[1:]); err != nil {
+			log.Fatalf("Error running %s: %v", os.Args[1], err)
+		}
+		return
+	}
+
+	s, err := server.LoadServerState(repos)
 	if err != nil {
 		log.Fatalf("Error loading server state: %v", err)
 	}
-
-	version, err := s.Repos.Config.LoadVersion()
+	s.Providers, err = auth.FromEnv(ctx)
 	if err != nil {
-		log.Fatalf("Error loading version: %v", err)
+		log.Fatalf("Error configuring login providers: %v", err)
+	}
+	s.Mailer, err = mail.FromEnv()
+	if err != nil {
+		log.Fatalf("Error configuring mail: %v", err)
+	}
+	s.BaseURL = os.Getenv("BASE_URL")
+	if timeout := os.Getenv("REQUEST_TIMEOUT"); timeout != "" {
+		s.RequestTimeout, err = time.ParseDuration(timeout)
+		if err != nil {
+			log.Fatalf("Invalid REQUEST_TIMEOUT %q: %v", timeout, err)
+		}
+	}
+	if timeout := os.Getenv("SESSION_IDLE_TIMEOUT"); timeout != "" {
+		s.SessionIdleTimeout, err = time.ParseDuration(timeout)
+		if err != nil {
+			log.Fatalf("Invalid SESSION_IDLE_TIMEOUT %q: %v", timeout, err)
+		}
+	}
+	if lifetime := os.Getenv("SESSION_LIFETIME"); lifetime != "" {
+		s.SessionLifetime, err = time.ParseDuration(lifetime)
+		if err != nil {
+			log.Fatalf("Invalid SESSION_LIFETIME %q: %v", lifetime, err)
+		}
+	}
+	// Without a fixed secret, logins in progress fail across restarts.
+	if secret := os.Getenv("COOKIE_SECRET"); secret != "" {
+		s.CookieSecret = []byte(secret)
 	}
-	migrate.DoMigration(*version, s)
 
 	http.HandleFunc("/", s.VerifySession(s.HandleIndex))
 	http.HandleFunc("/landing", s.HandleLanding)
@@ -53,50 +142,181 @@ func main() {
 		http.ServeFile(w, r, "./www/app.css")
 	})
 	http.HandleFunc("/timesheets", s.VerifySession(s.HandleTimesheet))
-	http.HandleFunc("/submitLeave", s.VerifySession(s.HandleSubmitLeave))
+	http.HandleFunc("/submitLeave", server.RequirePost(s.VerifySession(s.HandleSubmitLeave)))
 	http.HandleFunc("/profile", s.VerifySession(s.HandleProfileIndex))
 	http.HandleFunc("/profileBody", s.VerifySession(s.HandleProfile))
-	http.HandleFunc("/auth/login", s.HandleGoogleLogin)
-	http.HandleFunc("/auth/logout", s.HandleGoogleLogout)
-	http.HandleFunc("/auth/callback", s.HandleGoogleCallback)
+	http.HandleFunc("/auth/login", s.HandleLogin)
+	http.HandleFunc("/auth/link", s.VerifySession(s.HandleLinkIdentity))
+	http.HandleFunc("/auth/dev", s.HandleDevLogin)
+	http.HandleFunc("/auth/email", s.HandleEmailLogin)
+	http.HandleFunc("/auth/email/verify", s.HandleEmailLoginVerify)
+	http.HandleFunc("/auth/invite", s.HandleInvite)
+	http.HandleFunc("/auth/logout", server.RequirePost(s.VerifySession(s.HandleLogout)))
+	http.HandleFunc("/signOutEverywhere", server.RequirePost(s.VerifySession(s.HandleSignOutEverywhere)))
+	http.HandleFunc("/revokeSession", server.RequirePost(s.VerifySession(s.HandleRevokeSession)))
+	http.HandleFunc("/auth/callback", s.HandleLoginCallback)
 	http.HandleFunc("/newAccount", s.VerifySession(s.HandleNewAccount))
-	http.HandleFunc("/createAccount", s.VerifySession(s.HandleCreateAccount))
-
-	http.HandleFunc("/toggleHideByIdeal", s.VerifySession(s.HandleToggleHideByIdeal))
-	http.HandleFunc("/toggleHideByPreferences", s.VerifySession(s.HandleToggleHideByPreferences))
-	http.HandleFunc("/toggleHideByLeave", s.VerifySession(s.HandleToggleHideByLeave))
-	http.HandleFunc("/toggleHideStaffList", s.VerifyManager(s.HandleToggleHideStaffList))
-
-	http.HandleFunc("/getStaffProfileModal", s.VerifyManager(s.HandleGetStaffProfileModal))
-	http.HandleFunc("/toggleKitchen", s.VerifyManager(s.HandleToggleKitchen))
-	http.HandleFunc("/setRole", s.VerifyAdmin(s.HandleSetRole))
-	http.HandleFunc("/toggleHidden", s.VerifyManager(s.HandleToggleHidden))
-	http.HandleFunc("/toggleLive", s.VerifyManager(s.HandleToggleLive))
-	http.HandleFunc("/toggleClosed", s.VerifyManager(s.HandleToggleClosed))
-	http.HandleFunc("/deleteAcc", s.VerifyAdmin(s.HandleDeleteAccount))
-	http.HandleFunc("/addTrial", s.VerifyManager(s.HandleAddTrial))
-	http.HandleFunc("/shiftWindow", s.VerifySession(s.HandleShiftWindow))
-	http.HandleFunc("/modifyProfile", s.VerifySession(s.HandleModifyProfile))
-	http.HandleFunc("/modifyRows", s.VerifySession(s.HandleModifyRows))
-	http.HandleFunc("/modifySlot", s.VerifySession(s.HandleModifySlot))
-	http.HandleFunc("/modifyTimeSlot", s.VerifySession(s.HandleModifyTimeSlot))
-	http.HandleFunc("/modifyDescriptionSlot", s.VerifySession(s.HandleModifyDescriptionSlot))
-	http.HandleFunc("/deleteLeaveReq", s.VerifySession(s.HandleDeleteLeaveReq))
-	http.HandleFunc("/deleteExpiredLeaveRequests", s.VerifyAdmin(s.HandleDeleteExpiredLeaveRequests))
-	http.HandleFunc("/setLeaveStatus", s.VerifyAdmin(s.HandleSetLeaveStatus))
-
-	http.HandleFunc("/shiftTimesheetWindow", s.VerifySession(s.HandleShiftTimesheetWindow))
-	http.HandleFunc("/addTimesheetEntry", s.VerifySession(s.HandleAddTimesheetEntry))
-	http.HandleFunc("/deleteTimesheetEntry", s.VerifySession(s.HandleDeleteTimesheetEntry))
-	http.HandleFunc("/modifyTimesheetEntry", s.VerifySession(s.HandleModifyTimesheetEntry))
+	http.HandleFunc("/createAccount", server.RequirePost(s.VerifySession(s.HandleCreateAccount)))
+
+	http.HandleFunc("/toggleHideByIdeal", server.RequirePost(s.VerifySession(s.HandleToggleHideByIdeal)))
+	http.HandleFunc("/toggleHideByPreferences", server.RequirePost(s.VerifySession(s.HandleToggleHideByPreferences)))
+	http.HandleFunc("/toggleHideByLeave", server.RequirePost(s.VerifySession(s.HandleToggleHideByLeave)))
+	http.HandleFunc("/toggleHideStaffList", server.RequirePost(s.VerifyPermission(s.HandleToggleHideStaffList, models.PermRosterEdit)))
+
+	http.HandleFunc("/getStaffProfileModal", s.VerifyPermission(s.HandleGetStaffProfileModal, models.PermStaffManage))
+	http.HandleFunc("/toggleKitchen", server.RequirePost(s.VerifyPermission(s.HandleToggleKitchen, models.PermStaffManage)))
+	http.HandleFunc("/setRole", server.RequirePost(s.VerifyPermission(s.HandleSetRole, models.PermStaffRoles)))
+	http.HandleFunc("/toggleHidden", server.RequirePost(s.VerifyPermission(s.HandleToggleHidden, models.PermStaffManage)))
+	http.HandleFunc("/toggleLive", server.RequirePost(s.VerifyPermission(s.HandleToggleLive, models.PermRosterPublish)))
+	http.HandleFunc("/toggleClosed", server.RequirePost(s.VerifyPermission(s.HandleToggleClosed, models.PermRosterEdit)))
+	http.HandleFunc("/deleteAcc", server.RequirePost(s.VerifyPermission(s.HandleDeleteAccount, models.PermStaffDelete)))
+	http.HandleFunc("/addTrial", server.RequirePost(s.VerifyPermission(s.HandleAddTrial, models.PermStaffManage)))
+	http.HandleFunc("/createInvite", server.RequirePost(s.VerifyPermission(s.HandleCreateInvite, models.PermStaffManage)))
+	http.HandleFunc("/createAPIToken", server.RequirePost(s.VerifyPermission(s.HandleCreateAPIToken, models.PermAPITokensManage)))
+	http.HandleFunc("/revokeAPIToken", server.RequirePost(s.VerifyPermission(s.HandleRevokeAPIToken, models.PermAPITokensManage)))
+	http.HandleFunc("/viewAs", server.RequirePost(s.VerifyPermission(s.HandleViewAs, models.PermStaffImpersonate)))
+	http.HandleFunc("/stopViewAs", server.RequirePost(s.VerifySession(s.HandleStopViewAs)))
+	http.HandleFunc("/shiftWindow", server.RequirePost(s.VerifySession(s.HandleShiftWindow)))
+	http.HandleFunc("/modifyProfile", server.RequirePost(s.VerifySession(s.HandleModifyProfile)))
+	http.HandleFunc("/modifyRows", server.RequirePost(s.VerifyPermission(s.HandleModifyRows, models.PermRosterEdit)))
+	http.HandleFunc("/modifySlot", server.RequirePost(s.VerifyPermission(s.HandleModifySlot, models.PermRosterEdit)))
+	http.HandleFunc("/modifyTimeSlot", server.RequirePost(s.VerifyPermission(s.HandleModifyTimeSlot, models.PermRosterEdit)))
+	http.HandleFunc("/modifyDescriptionSlot", server.RequirePost(s.VerifyPermission(s.HandleModifyDescriptionSlot, models.PermRosterEdit)))
+	http.HandleFunc("/deleteLeaveReq", server.RequirePost(s.VerifySession(s.HandleDeleteLeaveReq)))
+	http.HandleFunc("/deleteExpiredLeaveRequests", server.RequirePost(s.VerifyPermission(s.HandleDeleteExpiredLeaveRequests, models.PermLeaveApprove)))
+	http.HandleFunc("/setLeaveStatus", server.RequirePost(s.VerifyPermission(s.HandleSetLeaveStatus, models.PermLeaveApprove)))
+	http.HandleFunc("/audit", s.VerifyPermission(s.HandleAudit, models.PermAuditView))
+	http.HandleFunc("/auditTable", s.VerifyPermission(s.HandleAuditTable, models.PermAuditView))
+	http.HandleFunc("/backup", s.VerifyPermission(s.HandleBackup, models.PermBackupManage))
+	http.HandleFunc("/restore", server.RequirePost(s.VerifyPermission(s.HandleRestore, models.PermBackupManage)))
+
+	http.HandleFunc("/shiftTimesheetWindow", server.RequirePost(s.VerifySession(s.HandleShiftTimesheetWindow)))
+	http.HandleFunc("/addTimesheetEntry", server.RequirePost(s.VerifySession(s.HandleAddTimesheetEntry)))
+	http.HandleFunc("/deleteTimesheetEntry", server.RequirePost(s.VerifySession(s.HandleDeleteTimesheetEntry)))
+	http.HandleFunc("/modifyTimesheetEntry", server.RequirePost(s.VerifySession(s.HandleModifyTimesheetEntry)))
 	http.HandleFunc("/getTimesheetEditModal", s.VerifySession(s.HandleGetTimesheetEditModal))
-	http.HandleFunc("/toggleHideApproved", s.VerifyManager(s.HandleToggleHideApproved))
-	http.HandleFunc("/toggleShowAll", s.VerifyManager(s.HandleToggleShowAll))
-	http.HandleFunc("/importRosterWeek", s.VerifyManager(s.HandleImportRosterWeek))
-	http.HandleFunc("/exportWageReport", s.VerifyManager(s.HandleExportWageReport))
-	http.HandleFunc("/exportKitchenReport", s.VerifyManager(s.HandleExportKitchenReport))
-	http.HandleFunc("/exportEvanReport", s.VerifyManager(s.HandleExportEvanReport))
-	http.HandleFunc("/toggleApproved", s.VerifyManager(s.HandleToggleApproved))
-
-	log.Println(http.ListenAndServe(":6969", nil))
+	http.HandleFunc("/toggleHideApproved", server.RequirePost(s.VerifyPermission(s.HandleToggleHideApproved, models.PermTimesheetApprove, models.PermTimesheetApproveKitchen)))
+	http.HandleFunc("/toggleShowAll", server.RequirePost(s.VerifyPermission(s.HandleToggleShowAll, models.PermTimesheetApprove, models.PermTimesheetApproveKitchen)))
+	http.HandleFunc("/importRosterWeek", server.RequirePost(s.VerifyPermission(s.HandleImportRosterWeek, models.PermRosterEdit)))
+	http.HandleFunc("/saveRosterTemplate", server.RequirePost(s.VerifyPermission(s.HandleSaveRosterTemplate, models.PermRosterEdit)))
+	http.HandleFunc("/previewRosterTemplate", server.RequirePost(s.VerifyPermission(s.HandlePreviewRosterTemplate, models.PermRosterEdit)))
+	http.HandleFunc("/applyRosterTemplate", server.RequirePost(s.VerifyPermission(s.HandleApplyRosterTemplate, models.PermRosterEdit)))
+	http.HandleFunc("/deleteRosterTemplate", server.RequirePost(s.VerifyPermission(s.HandleDeleteRosterTemplate, models.PermRosterEdit)))
+	http.HandleFunc("/autoRoster", server.RequirePost(s.VerifyPermission(s.HandleAutoRoster, models.PermRosterEdit)))
+	http.HandleFunc("/exportWageReport", s.VerifyPermission(s.HandleExportWageReport, models.PermReportsExport))
+	http.HandleFunc("/exportKitchenReport", s.VerifyPermission(s.HandleExportKitchenReport, models.PermReportsExport))
+	http.HandleFunc("/exportEvanReport", s.VerifyPermission(s.HandleExportEvanReport, models.PermReportsExport))
+	http.HandleFunc("/toggleApproved", server.RequirePost(s.VerifyPermission(s.HandleToggleApproved, models.PermTimesheetApprove, models.PermTimesheetApproveKitchen)))
+
+	log.Println(http.ListenAndServe(":6969", s.WithRequestTimeout(http.DefaultServeMux)))
+}
+
+// migrateDatabase applies any pending migrations to repos and moves the roster
+// weeks if WEEK_START has changed. With MIGRATE_DRY_RUN set it prints what
+// would change instead and returns false.
+func migrateDatabase(ctx context.Context, repos repository.Repositories) (bool, error) {
+	migrateOpts := migrate.Options{
+		DryRun: os.Getenv("MIGRATE_DRY_RUN") == "true",
+	}
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			migrateOpts.AdminEmails = append(migrateOpts.AdminEmails, email)
+		}
+	}
+	// Migrations work with offsets counted from the week start they were
+	// stored with.
+	weekStart, err := migrate.StoredWeekStart(ctx, repos.Config)
+	if err != nil {
+		return false, fmt.Errorf("failed to load week start: %w", err)
+	}
+	utils.SetWeekStart(weekStart)
+	reports, err := migrate.Run(ctx, repos, migrateOpts)
+	if err != nil {
+		return false, fmt.Errorf("failed to migrate data: %w", err)
+	}
+	// Without WEEK_START, weeks keep starting on the day they last did, and a
+	// change to it that was interrupted is put back.
+	if name := os.Getenv("WEEK_START"); name != "" {
+		weekStart, err = utils.ParseWeekday(name)
+		if err != nil {
+			return false, fmt.Errorf("invalid WEEK_START %q: %w", name, err)
+		}
+	}
+	weekStartSummary, err := migrate.ChangeWeekStart(ctx, repos, weekStart, migrateOpts)
+	if err != nil {
+		return false, fmt.Errorf("failed to change week start: %w", err)
+	}
+	if migrateOpts.DryRun {
+		for _, report := range reports {
+			fmt.Println(report)
+		}
+		fmt.Println("week start:", weekStartSummary)
+		return false, nil
+	}
+	utils.PrintLog("Week start: %v", weekStartSummary)
+	utils.SetWeekStart(weekStart)
+	return true, nil
+}
+
+// runCommand runs a maintenance command against repos instead of serving:
+//
+//	backup [file]  writes a backup archive to file, or to stdout
+//	restore [--replace] file
+//	               loads a backup archive from file, or from stdin if it is
+//	               "-", into an empty database, or over the stored records
+//	               with --replace
+func runCommand(ctx context.Context, repos repository.Repositories, args []string) error {
+	switch args[0] {
+	case "backup":
+		archive, err := backup.Create(ctx, repos)
+		if err != nil {
+			return err
+		}
+		if len(args) < 2 || args[1] == "-" {
+			return backup.Write(os.Stdout, archive)
+		}
+		f, err := os.Create(args[1])
+		if err != nil {
+			return err
+		}
+		if err := backup.Write(f, archive); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		utils.PrintLog("Wrote backup of %v to %s", archive.Summary(), args[1])
+		return nil
+	case "restore":
+		opts := backup.Options{}
+		if len(args) > 1 && args[1] == "--replace" {
+			opts.Replace = true
+			args = args[1:]
+		}
+		if len(args) < 2 {
+			return fmt.Errorf("usage: restore [--replace] <file>")
+		}
+		in := os.Stdin
+		if args[1] != "-" {
+			f, err := os.Open(args[1])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+		archive, err := backup.Read(in)
+		if err != nil {
+			return err
+		}
+		if _, err := backup.Restore(ctx, repos, archive, opts); err != nil {
+			return err
+		}
+		// The archive may be from before the latest migrations.
+		_, err = migrateDatabase(ctx, repos)
+		return err
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
 }
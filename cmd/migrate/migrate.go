@@ -1,100 +1,330 @@
 package migrate
 
 import (
-	"roster/cmd/models"
-	"roster/cmd/server"
-	"roster/cmd/utils"
+	"context"
+	"errors"
+	"fmt"
 	"slices"
 	"time"
+
+	"roster/cmd/models"
+	"roster/cmd/repository"
+	"roster/cmd/utils"
 )
 
-const STATE_FILE = "./data/state.json"
+// legacyTrialGoogleID marked trial staff, who can't log in, before staff had
+// identities.
+const legacyTrialGoogleID = "Trial"
+
+// legacySessionLifetime is how long sessions moved out of staff records
+// last, since when they were created isn't known.
+const legacySessionLifetime = 30 * 24 * time.Hour
+
+// VersionID identifies the config record holding the number of the last
+// migration applied.
+const VersionID = "migrations"
+
+// Options control a migration run.
+type Options struct {
+	// DryRun reports what each pending migration would change without
+	// writing anything or recording any migration as applied.
+	DryRun bool
+	// AdminEmails are the staff given the admin role by the role migration.
+	AdminEmails []string
+}
+
+// Migration is a single numbered data migration. Apply must be idempotent so
+// that a run interrupted part way through can safely be repeated, and must
+// not write anything when opts.DryRun is set. It returns a one line summary
+// of what it changed, or would change.
+type Migration struct {
+	Version     int
+	Description string
+	Apply       func(ctx context.Context, repos repository.Repositories, opts Options) (string, error)
+}
+
+// migrations is the registry of every migration, in the order they run.
+// Only ever append to this list; versions must count up from 1.
+var migrations = []Migration{
+	{1, "Recompute week offsets and staff roles", migrateOffsetsAndRoles},
+	{2, "Rename timesheet entry field days to staffId", renameTimesheetStaffID},
+	{3, "Move staff session tokens to the sessions store", migrateSessionTokens},
+	{4, "Link staff Google IDs as login identities", migrateGoogleIdentities},
+	{5, "Give roster weeks and availability named shifts", migrateShiftSlots},
+}
+
+// Report describes one migration that was, or in a dry run would be, applied.
+type Report struct {
+	Version     int
+	Description string
+	Summary     string
+}
 
-type Version struct {
-	ID      string
-	Version int
+func (r Report) String() string {
+	return fmt.Sprintf("migration %d (%s): %s", r.Version, r.Description, r.Summary)
 }
 
-func DoMigration(v models.Version, s *server.Server) error {
-	utils.PrintLog("Version: %v", v.Version)
-	// utils.PrintLog("Offset: %v", utils.WeekOffsetFromDate(utils.TuesdayEpoch))
-	// utils.PrintLog("Offset: %v", utils.WeekOffsetFromDate(utils.TuesdayEpoch.AddDate(0, 0, 2887*7)))
-	if v.Version != 0 {
-		utils.PrintLog("Switching to boolean migration")
-		allWeeks, err := s.Repos.RosterWeek.LoadAllRosterWeeks()
+// Run applies, in order, every registered migration newer than the version
+// recorded in the config repository, recording each one as it completes.
+func Run(ctx context.Context, repos repository.Repositories, opts Options) ([]Report, error) {
+	return run(ctx, repos, migrations, opts)
+}
+
+func run(ctx context.Context, repos repository.Repositories, registry []Migration, opts Options) ([]Report, error) {
+	for i, m := range registry {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %q has version %d, want %d", m.Description, m.Version, i+1)
+		}
+	}
+	current, err := appliedVersion(ctx, repos.Config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load migration version: %w", err)
+	}
+	utils.PrintLog("Migration version: %v of %v", current, len(registry))
+
+	reports := []Report{}
+	for _, m := range registry[min(current, len(registry)):] {
+		summary, err := m.Apply(ctx, repos, opts)
 		if err != nil {
-			utils.PrintError(err, "Failed to load all roster weeks")
-			return err
+			return reports, fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Description, err)
 		}
-		for _, week := range allWeeks {
-			week.WeekOffset = utils.WeekOffsetFromDate(week.StartDate)
-			// utils.PrintLog("Date: %v, offset: %v", week.StartDate, utils.WeekOffsetFromDate(week.StartDate))
+		report := Report{Version: m.Version, Description: m.Description, Summary: summary}
+		reports = append(reports, report)
+		if opts.DryRun {
+			utils.PrintLog("Dry run %v", report)
+			continue
 		}
-		err = s.Repos.RosterWeek.SaveAllRosterWeeks(allWeeks)
-		if err != nil {
-			utils.PrintError(err, "Failed to save all weeks")
-			return err
+		if err := repos.Config.SaveVersion(ctx, models.Version{ID: VersionID, Version: m.Version}); err != nil {
+			return reports, fmt.Errorf("failed to record migration %d: %w", m.Version, err)
 		}
+		utils.PrintLog("Applied %v", report)
+	}
+	return reports, nil
+}
 
-		allStaff, err := s.Repos.Staff.LoadAllStaff()
-		if err != nil {
-			utils.PrintError(err, "Failed to load all staff")
-			return err
+// appliedVersion returns the number of the last migration applied. Databases
+// that predate the registry instead mark the first migration as done by
+// setting the legacy version record to 0.
+func appliedVersion(ctx context.Context, config repository.ConfigRepository) (int, error) {
+	v, err := config.LoadVersionByID(ctx, VersionID)
+	if err == nil {
+		return v.Version, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return 0, err
+	}
+	legacy, err := config.LoadVersion(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if legacy.Version == 0 {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// migrateOffsetsAndRoles derives week offsets from dates, moves everyone's
+// view to the current week and gives legacy admins the manager role.
+func migrateOffsetsAndRoles(ctx context.Context, repos repository.Repositories, opts Options) (string, error) {
+	allWeeks, err := repos.RosterWeek.LoadAllRosterWeeks(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to load all roster weeks: %w", err)
+	}
+	for _, week := range allWeeks {
+		week.WeekOffset = utils.WeekOffsetFromDate(week.StartDate)
+	}
+
+	allStaff, err := repos.Staff.LoadAllStaff(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to load all staff: %w", err)
+	}
+	promoted := 0
+	for _, staffMember := range allStaff {
+		staffMember.Config.RosterDateOffset = utils.WeekOffsetFromDate(utils.GetWeekStart())
+		staffMember.Config.TimesheetDateOffset = utils.WeekOffsetFromDate(utils.GetWeekStart())
+		// Only ever promote, so running again can't undo later role changes.
+		role := staffMember.Role
+		if staffMember.IsAdmin && role < models.Manager {
+			role = models.Manager
 		}
-		for _, staffMember := range allStaff {
-			staffMember.Config.RosterDateOffset = utils.WeekOffsetFromDate(utils.GetLastTuesday())
-			staffMember.Config.TimesheetDateOffset = utils.WeekOffsetFromDate(utils.GetLastTuesday())
+		if slices.Contains(opts.AdminEmails, staffMember.Email) {
+			role = models.AdminRole
 		}
-		err = s.Repos.Staff.SaveStaffMembers(allStaff)
-		if err != nil {
-			utils.PrintError(err, "Failed to save all staff")
-			return err
+		if role != staffMember.Role {
+			staffMember.Role = role
+			promoted++
 		}
+	}
+
+	allTimesheets, err := repos.Timesheet.GetAllTimesheetEntries(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to load all timesheets: %w", err)
+	}
+	for _, timesheet := range *allTimesheets {
+		timesheet.WeekOffset = utils.WeekOffsetFromDate(timesheet.StartDate)
+		timesheet.DayOffset = int((timesheet.StartDate.Weekday() - time.Tuesday + 7) % 7)
+	}
 
-		// Role migration: default Staff, legacy IsAdmin -> Manager, selected emails -> Admin
-		adminEmails := []string{
-			"alistair@retreathotelbrunswick.com.au",
-			"beaudan.brown@gmail.com",
-			"kerryn@retreathotelbrunswick.com.au",
+	summary := fmt.Sprintf("%d roster weeks, %d staff (%d promoted), %d timesheet entries",
+		len(allWeeks), len(allStaff), promoted, len(*allTimesheets))
+	if opts.DryRun {
+		return "would update " + summary, nil
+	}
+	if err := repos.RosterWeek.SaveAllRosterWeeks(ctx, allWeeks); err != nil {
+		return "", fmt.Errorf("failed to save all weeks: %w", err)
+	}
+	if err := repos.Staff.SaveStaffMembers(ctx, allStaff); err != nil {
+		return "", fmt.Errorf("failed to save all staff: %w", err)
+	}
+	if err := repos.Timesheet.SaveAllTimesheetEntries(ctx, *allTimesheets); err != nil {
+		return "", fmt.Errorf("failed to save all timesheets: %w", err)
+	}
+	return "updated " + summary, nil
+}
+
+// renameTimesheetStaffID moves timesheet entries' staff ID from the field
+// it was mistakenly stored under. Only document stores keep the old name.
+func renameTimesheetStaffID(ctx context.Context, repos repository.Repositories, opts Options) (string, error) {
+	renamer, ok := repos.Timesheet.(repository.FieldRenamer)
+	if !ok {
+		return "nothing to rename", nil
+	}
+	n, err := renamer.RenameField(ctx, "days", "staffId", opts.DryRun)
+	if err != nil {
+		return "", err
+	}
+	if opts.DryRun {
+		return fmt.Sprintf("would rename the field on %d timesheet entries", n), nil
+	}
+	return fmt.Sprintf("renamed the field on %d timesheet entries", n), nil
+}
+
+// migrateSessionTokens replaces the session tokens stored on staff records
+// with sessions that expire like any other. Deleted staff's tokens are
+// dropped.
+func migrateSessionTokens(ctx context.Context, repos repository.Repositories, opts Options) (string, error) {
+	allStaff, err := repos.Staff.LoadAllStaffRecords(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to load all staff: %w", err)
+	}
+	now := time.Now()
+	moved, dropped := 0, 0
+	for _, staffMember := range allStaff {
+		if len(staffMember.Tokens) == 0 {
+			continue
 		}
-		allStaff, err = s.Repos.Staff.LoadAllStaff()
-		if err != nil {
-			utils.PrintError(err, "Failed to reload all staff for role migration")
-			return err
-		}
-		for _, staffMember := range allStaff {
-			// default
-			staffMember.Role = models.Staff
-			if staffMember.IsAdmin {
-				staffMember.Role = models.Manager
+		if staffMember.IsDeleted {
+			dropped += len(staffMember.Tokens)
+		} else {
+			moved += len(staffMember.Tokens)
+		}
+		if opts.DryRun {
+			continue
+		}
+		for _, token := range staffMember.Tokens {
+			if staffMember.IsDeleted {
+				break
 			}
-			if slices.Contains(adminEmails, staffMember.Email) {
-				staffMember.Role = models.AdminRole
+			_, err := repos.Sessions.GetSession(ctx, token)
+			if err == nil {
+				// Already moved by an earlier, interrupted run.
+				continue
+			}
+			if !errors.Is(err, repository.ErrNotFound) {
+				return "", fmt.Errorf("failed to load session: %w", err)
+			}
+			session := models.Session{
+				ID:        token,
+				StaffID:   staffMember.ID,
+				CreatedAt: now,
+				LastSeen:  now,
+				ExpiresAt: now.Add(legacySessionLifetime),
+			}
+			if err := repos.Sessions.CreateSession(ctx, session); err != nil {
+				return "", fmt.Errorf("failed to create session: %w", err)
 			}
 		}
-		if err := s.Repos.Staff.SaveStaffMembers(allStaff); err != nil {
-			utils.PrintError(err, "Failed to save staff roles during migration")
-			return err
+		staffMember.Tokens = nil
+		if err := repos.Staff.SaveStaffMember(ctx, *staffMember); err != nil {
+			return "", fmt.Errorf("failed to save staff: %w", err)
 		}
+	}
 
-		allTimesheets, err := s.Repos.Timesheet.GetAllTimesheetEntries()
-		if err != nil {
-			utils.PrintError(err, "Failed to load all timesheets")
-			return err
+	summary := fmt.Sprintf("%d session tokens (%d of deleted staff dropped)", moved+dropped, dropped)
+	if opts.DryRun {
+		return "would move " + summary, nil
+	}
+	return "moved " + summary, nil
+}
+
+// migrateGoogleIdentities replaces the Google ID stored on staff records with
+// a linked Google identity.
+func migrateGoogleIdentities(ctx context.Context, repos repository.Repositories, opts Options) (string, error) {
+	allStaff, err := repos.Staff.LoadAllStaffRecords(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to load all staff: %w", err)
+	}
+	linked := 0
+	for _, staffMember := range allStaff {
+		if staffMember.GoogleID == "" {
+			continue
 		}
-		for _, timesheet := range *allTimesheets {
-			timesheet.WeekOffset = utils.WeekOffsetFromDate(timesheet.StartDate)
-			timesheet.DayOffset = int((timesheet.StartDate.Weekday() - time.Tuesday + 7) % 7)
+		identity := models.Identity{Provider: "google", Subject: staffMember.GoogleID}
+		if staffMember.GoogleID != legacyTrialGoogleID && !staffMember.HasIdentity(identity) {
+			staffMember.Identities = append(staffMember.Identities, identity)
+			linked++
 		}
-		err = s.Repos.Timesheet.SaveAllTimesheetEntries(*allTimesheets)
-		if err != nil {
-			utils.PrintError(err, "Failed to save all timesheets")
-			return err
+		if opts.DryRun {
+			continue
 		}
+		staffMember.GoogleID = ""
+		if err := repos.Staff.SaveStaffMember(ctx, *staffMember); err != nil {
+			return "", fmt.Errorf("failed to save staff: %w", err)
+		}
+	}
+
+	summary := fmt.Sprintf("%d Google IDs as identities", linked)
+	if opts.DryRun {
+		return "would link " + summary, nil
+	}
+	return "linked " + summary, nil
+}
 
-		v.Version = 0
-		err = s.Repos.Config.SaveVersion(v)
-		return err
+// migrateShiftSlots records the early, mid and late shifts on roster weeks
+// from before shifts could be configured, and saves weeks and staff again so
+// their rows and availability are stored as lists of named shifts. Older
+// records are read into the new layout, so only saving them is left.
+func migrateShiftSlots(ctx context.Context, repos repository.Repositories, opts Options) (string, error) {
+	allWeeks, err := repos.RosterWeek.LoadAllRosterWeeks(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to load all roster weeks: %w", err)
+	}
+	legacy := 0
+	for _, week := range allWeeks {
+		if len(week.Slots) == 0 {
+			week.Slots = append([]models.SlotDefinition{}, models.LegacySlots...)
+			legacy++
+		}
+	}
+	allStaff, err := repos.Staff.LoadAllStaffRecords(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to load all staff: %w", err)
+	}
+
+	summary := fmt.Sprintf("%d roster weeks (%d given the early, mid and late shifts), %d staff",
+		len(allWeeks), legacy, len(allStaff))
+	if opts.DryRun {
+		return "would update " + summary, nil
+	}
+	if len(allWeeks) > 0 {
+		if err := repos.RosterWeek.SaveAllRosterWeeks(ctx, allWeeks); err != nil {
+			return "", fmt.Errorf("failed to save all weeks: %w", err)
+		}
+	}
+	if len(allStaff) > 0 {
+		if err := repos.Staff.SaveStaffMembers(ctx, allStaff); err != nil {
+			return "", fmt.Errorf("failed to save all staff: %w", err)
+		}
 	}
-	return nil
+	return "updated " + summary, nil
 }
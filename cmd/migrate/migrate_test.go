@@ -0,0 +1,285 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"roster/cmd/models"
+	"roster/cmd/repository"
+
+	"github.com/google/uuid"
+)
+
+// countingMigration returns a migration that counts how often it really runs.
+func countingMigration(version int, runs *int) Migration {
+	return Migration{version, "count", func(ctx context.Context, repos repository.Repositories, opts Options) (string, error) {
+		if !opts.DryRun {
+			*runs++
+		}
+		return "counted", nil
+	}}
+}
+
+func loadMigrationVersion(t *testing.T, repos repository.Repositories) int {
+	t.Helper()
+	v, err := repos.Config.LoadVersionByID(context.Background(), VersionID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return 0
+	}
+	if err != nil {
+		t.Fatalf("LoadVersionByID: %v", err)
+	}
+	return v.Version
+}
+
+// Test migrations run once, in order, and record the version reached.
+func TestRun_AppliesPendingInOrder(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemoryRepositories()
+	var first, second int
+	registry := []Migration{countingMigration(1, &first), countingMigration(2, &second)}
+
+	reports, err := run(ctx, repos, registry, Options{})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(reports) != 2 || reports[0].Version != 1 || reports[1].Version != 2 {
+		t.Fatalf("expected reports for migrations 1 and 2, got %+v", reports)
+	}
+	if got := loadMigrationVersion(t, repos); got != 2 {
+		t.Errorf("migration version = %d; want 2", got)
+	}
+
+	var third int
+	registry = append(registry, countingMigration(3, &third))
+	if _, err := run(ctx, repos, registry, Options{}); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if first != 1 || second != 1 || third != 1 {
+		t.Errorf("expected each migration to run once, got %d, %d, %d", first, second, third)
+	}
+}
+
+// Test a dry run reports pending migrations without applying them.
+func TestRun_DryRun(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemoryRepositories()
+	var runs int
+	reports, err := run(ctx, repos, []Migration{countingMigration(1, &runs)}, Options{DryRun: true})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(reports) != 1 || reports[0].Summary != "counted" {
+		t.Fatalf("expected a report for migration 1, got %+v", reports)
+	}
+	if runs != 0 || loadMigrationVersion(t, repos) != 0 {
+		t.Error("expected a dry run not to apply or record anything")
+	}
+}
+
+// Test a failed migration stops the run and isn't recorded.
+func TestRun_StopsOnError(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemoryRepositories()
+	var runs int
+	failing := Migration{1, "fail", func(context.Context, repository.Repositories, Options) (string, error) {
+		return "", errors.New("boom")
+	}}
+	if _, err := run(ctx, repos, []Migration{failing, countingMigration(2, &runs)}, Options{}); err == nil {
+		t.Fatal("expected error from failing migration")
+	}
+	if runs != 0 || loadMigrationVersion(t, repos) != 0 {
+		t.Error("expected nothing after the failed migration to run or be recorded")
+	}
+}
+
+// Test the registry must be numbered from 1 without gaps.
+func TestRun_RejectsMisnumberedRegistry(t *testing.T) {
+	var runs int
+	registry := []Migration{countingMigration(1, &runs), countingMigration(3, &runs)}
+	if _, err := run(context.Background(), repository.NewMemoryRepositories(), registry, Options{}); err == nil {
+		t.Fatal("expected error for a gap in migration versions")
+	}
+	if runs != 0 {
+		t.Error("expected no migrations to run")
+	}
+}
+
+// Test databases migrated before the registry existed skip the first
+// migration.
+func TestRun_LegacyVersion(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemoryRepositories()
+	if err := repos.Config.SaveVersion(ctx, models.Version{ID: "version", Version: 0}); err != nil {
+		t.Fatalf("SaveVersion: %v", err)
+	}
+	var first, second int
+	if _, err := run(ctx, repos, []Migration{countingMigration(1, &first), countingMigration(2, &second)}, Options{}); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if first != 0 || second != 1 {
+		t.Errorf("expected only migration 2 to run, got %d, %d", first, second)
+	}
+}
+
+// Test the role migration promotes legacy admins and listed emails, and is
+// safe to run again after roles have been changed.
+func TestMigrateOffsetsAndRoles(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemoryRepositories()
+	legacyAdmin := models.StaffMember{ID: uuid.New(), FirstName: "Al", IsAdmin: true}
+	owner := models.StaffMember{ID: uuid.New(), FirstName: "Bo", Email: "bo@example.com"}
+	manager := models.StaffMember{ID: uuid.New(), FirstName: "Cy", Role: models.Manager}
+	if err := repos.Staff.SaveStaffMembers(ctx, []*models.StaffMember{&legacyAdmin, &owner, &manager}); err != nil {
+		t.Fatalf("SaveStaffMembers: %v", err)
+	}
+	opts := Options{AdminEmails: []string{"bo@example.com"}}
+
+	if _, err := migrateOffsetsAndRoles(ctx, repos, opts); err != nil {
+		t.Fatalf("migrateOffsetsAndRoles: %v", err)
+	}
+	if _, err := migrateOffsetsAndRoles(ctx, repos, opts); err != nil {
+		t.Fatalf("migrateOffsetsAndRoles (again): %v", err)
+	}
+	want := map[uuid.UUID]models.StaffRole{
+		legacyAdmin.ID: models.Manager,
+		owner.ID:       models.AdminRole,
+		manager.ID:     models.Manager,
+	}
+	for id, role := range want {
+		staff, err := repos.Staff.GetStaffByID(ctx, id)
+		if err != nil {
+			t.Fatalf("GetStaffByID: %v", err)
+		}
+		if staff.Role != role {
+			t.Errorf("%s has role %v; want %v", staff.FirstName, staff.Role, role)
+		}
+	}
+}
+
+// Test legacy session tokens become sessions, except for deleted staff, and
+// that running again doesn't fail on the sessions already created.
+func TestMigrateSessionTokens(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemoryRepositories()
+	token := uuid.New()
+	active := models.StaffMember{ID: uuid.New(), FirstName: "Al", Tokens: []uuid.UUID{token}}
+	deleted := models.StaffMember{ID: uuid.New(), FirstName: "Bo", Tokens: []uuid.UUID{uuid.New()}, IsDeleted: true}
+	if err := repos.Staff.SaveStaffMembers(ctx, []*models.StaffMember{&active, &deleted}); err != nil {
+		t.Fatalf("SaveStaffMembers: %v", err)
+	}
+	if _, err := migrateSessionTokens(ctx, repos, Options{DryRun: true}); err != nil {
+		t.Fatalf("migrateSessionTokens (dry run): %v", err)
+	}
+	if _, err := repos.Sessions.GetSession(ctx, token); err == nil {
+		t.Fatal("expected a dry run not to create sessions")
+	}
+
+	if _, err := migrateSessionTokens(ctx, repos, Options{}); err != nil {
+		t.Fatalf("migrateSessionTokens: %v", err)
+	}
+	// Simulate a run interrupted after creating the session.
+	active.Tokens = []uuid.UUID{token}
+	if err := repos.Staff.SaveStaffMember(ctx, active); err != nil {
+		t.Fatalf("SaveStaffMember: %v", err)
+	}
+	if _, err := migrateSessionTokens(ctx, repos, Options{}); err != nil {
+		t.Fatalf("migrateSessionTokens (again): %v", err)
+	}
+
+	session, err := repos.Sessions.GetSession(ctx, token)
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	if session.StaffID != active.ID || !session.ExpiresAt.After(time.Now()) {
+		t.Errorf("unexpected session %+v", session)
+	}
+	if sessions, _ := repos.Sessions.FindStaffSessions(ctx, deleted.ID); len(sessions) != 0 {
+		t.Error("expected deleted staff's tokens to be dropped")
+	}
+	records, err := repos.Staff.LoadAllStaffRecords(ctx)
+	if err != nil {
+		t.Fatalf("LoadAllStaffRecords: %v", err)
+	}
+	for _, s := range records {
+		if len(s.Tokens) != 0 {
+			t.Errorf("expected %s's tokens to be cleared, got %v", s.FirstName, s.Tokens)
+		}
+	}
+}
+
+// Test Google IDs become identities, once, and trials get none.
+func TestMigrateGoogleIdentities(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemoryRepositories()
+	al := models.StaffMember{ID: uuid.New(), FirstName: "Al", GoogleID: "google-1"}
+	trial := models.StaffMember{ID: uuid.New(), FirstName: "Bo", GoogleID: legacyTrialGoogleID, IsTrial: true}
+	if err := repos.Staff.SaveStaffMembers(ctx, []*models.StaffMember{&al, &trial}); err != nil {
+		t.Fatalf("SaveStaffMembers: %v", err)
+	}
+	if _, err := migrateGoogleIdentities(ctx, repos, Options{DryRun: true}); err != nil {
+		t.Fatalf("migrateGoogleIdentities (dry run): %v", err)
+	}
+	google := models.Identity{Provider: "google", Subject: "google-1"}
+	if found, _ := repos.Staff.GetStaffByIdentity(ctx, google); found != nil {
+		t.Fatal("expected a dry run not to link identities")
+	}
+
+	// Simulate a run interrupted after linking the identity.
+	al.Identities = []models.Identity{google}
+	if err := repos.Staff.SaveStaffMember(ctx, al); err != nil {
+		t.Fatalf("SaveStaffMember: %v", err)
+	}
+	if _, err := migrateGoogleIdentities(ctx, repos, Options{}); err != nil {
+		t.Fatalf("migrateGoogleIdentities: %v", err)
+	}
+
+	found, err := repos.Staff.GetStaffByIdentity(ctx, google)
+	if err != nil || found == nil || found.ID != al.ID {
+		t.Fatalf("GetStaffByIdentity = %+v, %v", found, err)
+	}
+	if len(found.Identities) != 1 || found.GoogleID != "" {
+		t.Errorf("expected one identity and no Google ID, got %+v", found)
+	}
+	migratedTrial, err := repos.Staff.GetStaffByID(ctx, trial.ID)
+	if err != nil || migratedTrial == nil {
+		t.Fatalf("GetStaffByID = %+v, %v", migratedTrial, err)
+	}
+	if len(migratedTrial.Identities) != 0 || migratedTrial.GoogleID != "" {
+		t.Errorf("expected the trial to have no identities, got %+v", migratedTrial)
+	}
+}
+
+// Test weeks from before shifts could be configured get the early, mid and
+// late shifts, and weeks with their own shifts keep them.
+func TestMigrateShiftSlots(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemoryRepositories()
+	legacy := &models.RosterWeek{ID: uuid.New(), WeekOffset: 1}
+	custom := &models.RosterWeek{ID: uuid.New(), WeekOffset: 2, Slots: []models.SlotDefinition{{Name: "Brunch"}}}
+	if err := repos.RosterWeek.SaveAllRosterWeeks(ctx, []*models.RosterWeek{legacy, custom}); err != nil {
+		t.Fatalf("SaveAllRosterWeeks: %v", err)
+	}
+	if _, err := migrateShiftSlots(ctx, repos, Options{DryRun: true}); err != nil {
+		t.Fatalf("migrateShiftSlots (dry run): %v", err)
+	}
+	if week, _ := repos.RosterWeek.LoadRosterWeek(ctx, 1); len(week.Slots) != 0 {
+		t.Fatalf("expected a dry run not to change weeks, got %+v", week.Slots)
+	}
+
+	summary, err := migrateShiftSlots(ctx, repos, Options{})
+	if err != nil {
+		t.Fatalf("migrateShiftSlots: %v", err)
+	}
+	if summary != "updated 2 roster weeks (1 given the early, mid and late shifts), 0 staff" {
+		t.Errorf("unexpected summary %q", summary)
+	}
+	if week, _ := repos.RosterWeek.LoadRosterWeek(ctx, 1); len(week.Slots) != 3 || week.Slots[2].Name != "Late" {
+		t.Errorf("expected the early, mid and late shifts, got %+v", week.Slots)
+	}
+	if week, _ := repos.RosterWeek.LoadRosterWeek(ctx, 2); len(week.Slots) != 1 || week.Slots[0].Name != "Brunch" {
+		t.Errorf("expected the week to keep its shifts, got %+v", week.Slots)
+	}
+}
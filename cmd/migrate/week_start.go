@@ -0,0 +1,281 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"roster/cmd/models"
+	"roster/cmd/repository"
+	"roster/cmd/utils"
+
+	"github.com/google/uuid"
+)
+
+// WeekStartID identifies the config record holding the day of the week, as a
+// time.Weekday, that stored week and day offsets count from. Databases
+// without one count from Tuesday.
+const WeekStartID = "weekStart"
+
+// legacyWeekStart is the day weeks started on before it could be changed.
+const legacyWeekStart = time.Tuesday
+
+// weekStartStage moves one kind of stored data to weeks starting on a new day.
+// Each stage records the day its data counts from under its own config
+// record, so a change interrupted part way through carries on from the
+// stage it stopped at. It returns how many records it changed, or would
+// change.
+type weekStartStage struct {
+	ID    string
+	Name  string
+	Apply func(ctx context.Context, repos repository.Repositories, from time.Weekday, to time.Weekday, dryRun bool) (int, error)
+}
+
+var weekStartStages = []weekStartStage{
+	{WeekStartID + ".rosterWeeks", "roster weeks", moveRosterWeeks},
+	{WeekStartID + ".timesheets", "timesheet entries", moveTimesheetEntries},
+	{WeekStartID + ".staff", "staff", moveStaff},
+}
+
+// StoredWeekStart returns the day of the week stored offsets count from.
+func StoredWeekStart(ctx context.Context, config repository.ConfigRepository) (time.Weekday, error) {
+	return loadWeekday(ctx, config, WeekStartID, legacyWeekStart)
+}
+
+func loadWeekday(ctx context.Context, config repository.ConfigRepository, id string, fallback time.Weekday) (time.Weekday, error) {
+	v, err := config.LoadVersionByID(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return fallback, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return time.Weekday(v.Version), nil
+}
+
+// ChangeWeekStart moves stored roster weeks, timesheet entries and staff
+// availability and views to weeks beginning on day, then records day as the
+// week start. Nothing is written when opts.DryRun is set. It returns a one
+// line summary of what it changed, or would change.
+func ChangeWeekStart(ctx context.Context, repos repository.Repositories, day time.Weekday, opts Options) (string, error) {
+	current, err := StoredWeekStart(ctx, repos.Config)
+	if err != nil {
+		return "", fmt.Errorf("failed to load week start: %w", err)
+	}
+	summary := ""
+	for _, stage := range weekStartStages {
+		from, err := loadWeekday(ctx, repos.Config, stage.ID, current)
+		if err != nil {
+			return "", fmt.Errorf("failed to load week start of %s: %w", stage.Name, err)
+		}
+		if from == day {
+			continue
+		}
+		n, err := stage.Apply(ctx, repos, from, day, opts.DryRun)
+		if err != nil {
+			return "", fmt.Errorf("failed to move %s to weeks starting %v: %w", stage.Name, day, err)
+		}
+		if summary != "" {
+			summary += ", "
+		}
+		summary += fmt.Sprintf("%d %s from %v", n, stage.Name, from)
+		if opts.DryRun {
+			continue
+		}
+		if err := repos.Config.SaveVersion(ctx, models.Version{ID: stage.ID, Version: int(day)}); err != nil {
+			return "", fmt.Errorf("failed to record week start of %s: %w", stage.Name, err)
+		}
+	}
+	if summary == "" && current == day {
+		return fmt.Sprintf("weeks already start on %v", day), nil
+	}
+	if opts.DryRun {
+		return fmt.Sprintf("would move %s to weeks starting %v", summary, day), nil
+	}
+	if err := repos.Config.SaveVersion(ctx, models.Version{ID: WeekStartID, Version: int(day)}); err != nil {
+		return "", fmt.Errorf("failed to record week start: %w", err)
+	}
+	if summary == "" {
+		return fmt.Sprintf("recorded weeks as starting %v", day), nil
+	}
+	return fmt.Sprintf("moved %s to weeks starting %v", summary, day), nil
+}
+
+// moveOffsets returns the week and day offsets, for weeks starting on to, of
+// the date weekOffset and dayOffset identify for weeks starting on from.
+func moveOffsets(from time.Weekday, to time.Weekday, weekOffset int, dayOffset int) (int, int) {
+	date := utils.WeekEpoch(from).AddDate(0, 0, weekOffset*7+dayOffset)
+	days := int(date.Sub(utils.WeekEpoch(to)).Hours() / 24)
+	week, day := days/7, days%7
+	if day < 0 {
+		week--
+		day += 7
+	}
+	return week, day
+}
+
+// moveRosterWeeks regroups every roster day into the week it falls in when
+// weeks start on to. Each offset keeps its week's ID, and days are given new
+// IDs since they can end up in a different week. A regrouped week is only
+// live if every week it took days from was, and keeps the shifts of the week
+// at its offset.
+//
+// The days of a week move to the week at its offset and the one after it, or
+// the one before it, so weeks are saved in that direction: a week is only
+// overwritten once the other week its days moved to is saved. Weeks saved by
+// a move that was interrupted already start on to, so running it again
+// leaves them where they are.
+func moveRosterWeeks(ctx context.Context, repos repository.Repositories, from time.Weekday, to time.Weekday, dryRun bool) (int, error) {
+	allWeeks, err := repos.RosterWeek.LoadAllRosterWeeks(ctx)
+	if err != nil {
+		return 0, err
+	}
+	moved := map[int]*models.RosterWeek{}
+	weekAt := func(offset int) *models.RosterWeek {
+		if week, ok := moved[offset]; ok {
+			return week
+		}
+		start := utils.WeekEpoch(to).AddDate(0, 0, offset*7)
+		week := &models.RosterWeek{
+			ID:         uuid.New(),
+			StartDate:  time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.Local),
+			WeekOffset: offset,
+			Days:       make([]*models.RosterDay, 7),
+			IsLive:     true,
+		}
+		moved[offset] = week
+		return week
+	}
+	// Every existing week is rewritten, even if none of its days end up in
+	// it, so no week is left holding days from the old week start.
+	for _, old := range allWeeks {
+		week := weekAt(old.WeekOffset)
+		week.ID = old.ID
+		week.Slots = old.Slots
+		week.IsLive = week.IsLive && old.IsLive
+		week.Revision = max(week.Revision, old.Revision+1)
+	}
+	for _, old := range allWeeks {
+		oldFrom := from
+		if startsOn(old, to) {
+			oldFrom = to
+		}
+		for _, day := range old.Days {
+			weekOffset, dayOffset := moveOffsets(oldFrom, to, old.WeekOffset, day.Offset)
+			week := weekAt(weekOffset)
+			week.IsLive = week.IsLive && old.IsLive
+			renewRosterDayIDs(day)
+			day.Offset = dayOffset
+			week.Days[dayOffset] = day
+		}
+	}
+
+	weeks := []*models.RosterWeek{}
+	for _, week := range moved {
+		if week.Slots == nil {
+			week.Slots = models.DefaultSlots()
+		}
+		for i, day := range week.Days {
+			weekday := (to + time.Weekday(i)) % 7
+			empty := repository.NewRosterDay(i, weekday, week.Slots)
+			if day == nil {
+				week.Days[i] = empty
+				continue
+			}
+			day.Colour = empty.Colour
+		}
+		weeks = append(weeks, week)
+	}
+	slices.SortFunc(weeks, func(a, b *models.RosterWeek) int {
+		if from > to {
+			return b.WeekOffset - a.WeekOffset
+		}
+		return a.WeekOffset - b.WeekOffset
+	})
+	if dryRun || len(weeks) == 0 {
+		return len(weeks), nil
+	}
+	return len(weeks), repos.RosterWeek.SaveAllRosterWeeks(ctx, weeks)
+}
+
+// startsOn reports whether week's first day falls on day.
+func startsOn(week *models.RosterWeek, day time.Weekday) bool {
+	if len(week.Days) == 0 || week.Days[0] == nil {
+		return false
+	}
+	weekday, err := utils.ParseWeekday(week.Days[0].DayName)
+	return err == nil && weekday == day
+}
+
+// renewRosterDayIDs gives day, and all of its rows and slots, new IDs.
+func renewRosterDayIDs(day *models.RosterDay) {
+	day.ID = uuid.New()
+	for _, row := range day.Rows {
+		row.ID = uuid.New()
+		for i := range row.Slots {
+			row.Slots[i].ID = uuid.New()
+		}
+	}
+}
+
+func moveTimesheetEntries(ctx context.Context, repos repository.Repositories, from time.Weekday, to time.Weekday, dryRun bool) (int, error) {
+	allTimesheets, err := repos.Timesheet.GetAllTimesheetEntries(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range *allTimesheets {
+		entry.WeekOffset, entry.DayOffset = moveOffsets(from, to, entry.WeekOffset, entry.DayOffset)
+	}
+	if dryRun || len(*allTimesheets) == 0 {
+		return len(*allTimesheets), nil
+	}
+	return len(*allTimesheets), repos.Timesheet.SaveAllTimesheetEntries(ctx, *allTimesheets)
+}
+
+// moveStaff puts everyone's availability in the new day order and moves the
+// weeks they are looking at to the ones their old weeks started in.
+func moveStaff(ctx context.Context, repos repository.Repositories, from time.Weekday, to time.Weekday, dryRun bool) (int, error) {
+	allStaff, err := repos.Staff.LoadAllStaffRecords(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, staffMember := range allStaff {
+		staffMember.Config.RosterDateOffset, _ = moveOffsets(from, to, staffMember.Config.RosterDateOffset, 0)
+		staffMember.Config.TimesheetDateOffset, _ = moveOffsets(from, to, staffMember.Config.TimesheetDateOffset, 0)
+		staffMember.Availability = moveAvailability(staffMember.Availability, from, to)
+	}
+	if dryRun || len(allStaff) == 0 {
+		return len(allStaff), nil
+	}
+	return len(allStaff), repos.Staff.SaveStaffMembers(ctx, allStaff)
+}
+
+// moveAvailability reorders availability, listed in the order of weeks
+// starting on from, for weeks starting on to. Days are matched by name, or by
+// position if their names don't name every day of the week.
+func moveAvailability(availability []models.DayAvailability, from time.Weekday, to time.Weekday) []models.DayAvailability {
+	if len(availability) != 7 {
+		return availability
+	}
+	weekdays := make([]time.Weekday, 7)
+	named := map[time.Weekday]bool{}
+	for i, day := range availability {
+		weekday, err := utils.ParseWeekday(day.Name)
+		if err == nil {
+			named[weekday] = true
+		}
+		weekdays[i] = weekday
+	}
+	moved := make([]models.DayAvailability, 7)
+	for i, day := range availability {
+		weekday := weekdays[i]
+		if len(named) != 7 {
+			weekday = (from + time.Weekday(i)) % 7
+		}
+		day.Name = weekday.String()
+		moved[(weekday-to+7)%7] = day
+	}
+	return moved
+}
@@ -0,0 +1,191 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"roster/cmd/models"
+	"roster/cmd/repository"
+
+	"github.com/google/uuid"
+)
+
+// tuesdayWeek returns a roster week starting on Tuesday whose first row's
+// early slot is described with the day's name.
+func tuesdayWeek(weekOffset int, isLive bool) *models.RosterWeek {
+	week := &models.RosterWeek{ID: uuid.New(), WeekOffset: weekOffset, Slots: models.LegacySlots, IsLive: isLive}
+	for i := 0; i < 7; i++ {
+		day := repository.NewRosterDay(i, (time.Tuesday+time.Weekday(i))%7, week.Slots)
+		day.Rows[0].Slots[0].Description = day.DayName
+		week.Days = append(week.Days, day)
+	}
+	return week
+}
+
+// Test changing the week start regroups roster days, timesheet entries and
+// availability by date, and a dry run changes nothing.
+func TestChangeWeekStart(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemoryRepositories()
+	week := tuesdayWeek(10, true)
+	if err := repos.RosterWeek.SaveAllRosterWeeks(ctx, []*models.RosterWeek{week}); err != nil {
+		t.Fatalf("SaveAllRosterWeeks: %v", err)
+	}
+	monday := models.TimesheetEntry{ID: uuid.New(), StaffID: uuid.New(), WeekOffset: 10, DayOffset: 6}
+	if err := repos.Timesheet.SaveTimesheetEntry(ctx, monday); err != nil {
+		t.Fatalf("SaveTimesheetEntry: %v", err)
+	}
+	staff := models.StaffMember{ID: uuid.New(), Config: models.StaffConfig{RosterDateOffset: 10, TimesheetDateOffset: 10}}
+	for i, name := range []string{"Tues", "Wed", "Thurs", "Fri", "Sat", "Sun", "Mon"} {
+		day := models.DayAvailability{Name: name, Unavailable: models.SlotNameList{}}
+		if i == 6 {
+			day.Unavailable = models.SlotNameList{"Late"}
+		}
+		staff.Availability = append(staff.Availability, day)
+	}
+	if err := repos.Staff.SaveStaffMember(ctx, staff); err != nil {
+		t.Fatalf("SaveStaffMember: %v", err)
+	}
+
+	if _, err := ChangeWeekStart(ctx, repos, time.Monday, Options{DryRun: true}); err != nil {
+		t.Fatalf("ChangeWeekStart: %v", err)
+	}
+	if day, _ := StoredWeekStart(ctx, repos.Config); day != time.Tuesday {
+		t.Errorf("expected a dry run to leave weeks starting Tuesday, got %v", day)
+	}
+	if entry, _ := repos.Timesheet.GetTimesheetEntryByID(ctx, monday.ID); entry.WeekOffset != 10 || entry.DayOffset != 6 {
+		t.Errorf("expected a dry run not to move entries, got %+v", entry)
+	}
+
+	if _, err := ChangeWeekStart(ctx, repos, time.Monday, Options{}); err != nil {
+		t.Fatalf("ChangeWeekStart: %v", err)
+	}
+	if day, _ := StoredWeekStart(ctx, repos.Config); day != time.Monday {
+		t.Errorf("expected weeks to start Monday, got %v", day)
+	}
+	if entry, _ := repos.Timesheet.GetTimesheetEntryByID(ctx, monday.ID); entry.WeekOffset != 11 || entry.DayOffset != 0 {
+		t.Errorf("expected the Monday entry to start week 11, got %+v", entry)
+	}
+	first, err := repos.RosterWeek.LoadRosterWeek(ctx, 10)
+	if err != nil {
+		t.Fatalf("LoadRosterWeek: %v", err)
+	}
+	if first.ID != week.ID || !first.IsLive || first.Days[0].Rows[0].Slots[0].Description != "" || first.Days[1].Rows[0].Slots[0].Description != "Tues" {
+		t.Errorf("expected week 10 to run from an empty Monday into Tuesday, got %+v", first.Days[:2])
+	}
+	second, err := repos.RosterWeek.LoadRosterWeek(ctx, 11)
+	if err != nil {
+		t.Fatalf("LoadRosterWeek: %v", err)
+	}
+	if !second.IsLive || second.Days[0].Rows[0].Slots[0].Description != "Mon" || second.Days[0].Offset != 0 {
+		t.Errorf("expected week 11 to be live and start with the old Monday, got %+v", second.Days[0])
+	}
+	saved, _ := repos.Staff.GetStaffByID(ctx, staff.ID)
+	if saved.Availability[0].Name != "Monday" || saved.Availability[0].IsAvailable("Late") || saved.Availability[1].Name != "Tuesday" {
+		t.Errorf("expected availability to start on Monday, got %+v", saved.Availability)
+	}
+	if saved.Config.RosterDateOffset != 10 || saved.Config.TimesheetDateOffset != 10 {
+		t.Errorf("expected staff to keep looking at week 10, got %+v", saved.Config)
+	}
+
+	summary, err := ChangeWeekStart(ctx, repos, time.Monday, Options{})
+	if err != nil || summary != "weeks already start on Monday" {
+		t.Errorf("expected nothing more to change, got %q, %v", summary, err)
+	}
+	if _, err := ChangeWeekStart(ctx, repos, time.Tuesday, Options{}); err != nil {
+		t.Fatalf("ChangeWeekStart: %v", err)
+	}
+	if entry, _ := repos.Timesheet.GetTimesheetEntryByID(ctx, monday.ID); entry.WeekOffset != 10 || entry.DayOffset != 6 {
+		t.Errorf("expected changing back to restore the entry, got %+v", entry)
+	}
+}
+
+// Test a change interrupted part way through picks up from the stages
+// already moved.
+func TestChangeWeekStart_Resumes(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemoryRepositories()
+	entry := models.TimesheetEntry{ID: uuid.New(), WeekOffset: 10, DayOffset: 6}
+	if err := repos.Timesheet.SaveTimesheetEntry(ctx, entry); err != nil {
+		t.Fatalf("SaveTimesheetEntry: %v", err)
+	}
+	// The roster weeks and timesheets were moved before the change stopped.
+	moved := models.TimesheetEntry{ID: entry.ID, WeekOffset: 11, DayOffset: 0}
+	if err := repos.Timesheet.SaveTimesheetEntry(ctx, moved); err != nil {
+		t.Fatalf("SaveTimesheetEntry: %v", err)
+	}
+	for _, id := range []string{WeekStartID + ".rosterWeeks", WeekStartID + ".timesheets"} {
+		if err := repos.Config.SaveVersion(ctx, models.Version{ID: id, Version: int(time.Monday)}); err != nil {
+			t.Fatalf("SaveVersion: %v", err)
+		}
+	}
+
+	if _, err := ChangeWeekStart(ctx, repos, time.Monday, Options{}); err != nil {
+		t.Fatalf("ChangeWeekStart: %v", err)
+	}
+	if got, _ := repos.Timesheet.GetTimesheetEntryByID(ctx, entry.ID); got.WeekOffset != 11 || got.DayOffset != 0 {
+		t.Errorf("expected the entry not to be moved twice, got %+v", got)
+	}
+	if day, _ := StoredWeekStart(ctx, repos.Config); day != time.Monday {
+		t.Errorf("expected weeks to start Monday, got %v", day)
+	}
+}
+
+// interruptedWeeks saves only the first few weeks of a bulk save, as if the
+// database went away part way through.
+type interruptedWeeks struct {
+	repository.RosterWeekRepository
+	saves int
+}
+
+func (r *interruptedWeeks) SaveAllRosterWeeks(ctx context.Context, weeks []*models.RosterWeek) error {
+	if err := r.RosterWeekRepository.SaveAllRosterWeeks(ctx, weeks[:r.saves]); err != nil {
+		return err
+	}
+	return errors.New("connection lost")
+}
+
+// Test moving roster weeks again after it stopped part way through gives
+// the same weeks as moving them in one go.
+func TestChangeWeekStart_ResumesRosterWeeks(t *testing.T) {
+	ctx := context.Background()
+	for _, to := range []time.Weekday{time.Monday, time.Thursday} {
+		for saves := 1; saves < 4; saves++ {
+			repos := repository.NewMemoryRepositories()
+			weeks := []*models.RosterWeek{tuesdayWeek(10, true), tuesdayWeek(11, true)}
+			if err := repos.RosterWeek.SaveAllRosterWeeks(ctx, weeks); err != nil {
+				t.Fatalf("SaveAllRosterWeeks: %v", err)
+			}
+			stored := repos.RosterWeek
+			repos.RosterWeek = &interruptedWeeks{RosterWeekRepository: stored, saves: saves}
+			if _, err := ChangeWeekStart(ctx, repos, to, Options{}); err == nil {
+				t.Fatal("expected the interrupted change to fail")
+			}
+			repos.RosterWeek = stored
+			if _, err := ChangeWeekStart(ctx, repos, to, Options{}); err != nil {
+				t.Fatalf("ChangeWeekStart: %v", err)
+			}
+
+			all, err := repos.RosterWeek.LoadAllRosterWeeks(ctx)
+			if err != nil {
+				t.Fatalf("LoadAllRosterWeeks: %v", err)
+			}
+			days := map[string]int{}
+			for _, week := range all {
+				for i, day := range week.Days {
+					if name := day.Rows[0].Slots[0].Description; name != "" {
+						days[name]++
+						if name != day.DayName || !startsOn(week, to) {
+							t.Errorf("%v after %d saves: %s is day %d of week %d starting %s", to, saves, name, i, week.WeekOffset, week.Days[0].DayName)
+						}
+					}
+				}
+			}
+			if len(days) != 7 || days["Tues"] != 2 || days["Mon"] != 2 {
+				t.Errorf("%v after %d saves: expected each day of both weeks once, got %v", to, saves, days)
+			}
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APITokenPrefix starts every API token, so they are easy to recognise if
+// they leak.
+const APITokenPrefix = "rst_"
+
+// APIToken lets scripts call the server as a staff member, limited to the
+// token's permissions. Only a hash of the token is stored.
+type APIToken struct {
+	ID          uuid.UUID    `bson:"id"`
+	StaffID     uuid.UUID    `bson:"staffId"`
+	Name        string       `bson:"name"`
+	TokenHash   string       `bson:"tokenHash"`
+	Permissions []Permission `bson:"permissions"`
+	CreatedAt   time.Time    `bson:"createdAt"`
+	// LastUsedAt is zero until the token is first used.
+	LastUsedAt time.Time `bson:"lastUsedAt"`
+}
+
+// NewAPITokenSecret returns a random API token to give to its owner, and the
+// hash to store for it.
+func NewAPITokenSecret() (string, string, error) {
+	token, _, err := NewLoginLinkToken()
+	if err != nil {
+		return "", "", err
+	}
+	token = APITokenPrefix + token
+	return token, HashAPIToken(token), nil
+}
+
+// HashAPIToken returns the hash stored for an API token.
+func HashAPIToken(token string) string {
+	return HashLoginLinkToken(token)
+}
+
+// Scope returns the permissions to limit the token's owner to. It is never
+// nil, so a token without permissions grants none.
+func (t APIToken) Scope() []Permission {
+	return append([]Permission{}, t.Permissions...)
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditEntry records a single change made by a staff member. Before and
+// After hold JSON snapshots of the entity and are empty when the entity did
+// not exist on that side of the change.
+type AuditEntry struct {
+	ID         uuid.UUID `bson:"id"`
+	Timestamp  time.Time `bson:"timestamp"`
+	ActorID    uuid.UUID `bson:"actorId"`
+	ActorName  string    `bson:"actorName"`
+	Action     string    `bson:"action"`
+	EntityType string    `bson:"entityType"`
+	EntityID   uuid.UUID `bson:"entityId"`
+	Before     string    `bson:"before"`
+	After      string    `bson:"after"`
+}
+
+// Entity types recorded in the audit log.
+const (
+	AuditEntityRoster    = "roster"
+	AuditEntityStaff     = "staff"
+	AuditEntityLeave     = "leave"
+	AuditEntityTimesheet = "timesheet"
+	AuditEntityBackup    = "backup"
+	AuditEntityTemplate  = "roster template"
+)
+
+// AuditEntityTypes lists every entity type in display order.
+var AuditEntityTypes = []string{AuditEntityRoster, AuditEntityStaff, AuditEntityLeave, AuditEntityTimesheet, AuditEntityBackup, AuditEntityTemplate}
+
+// Actions recorded in the audit log.
+const (
+	AuditAssignSlot         = "assign slot"
+	AuditSlotStartTime      = "change slot time"
+	AuditSlotDescription    = "change slot description"
+	AuditChangeRows         = "change rows"
+	AuditToggleLive         = "toggle live"
+	AuditToggleClosed       = "toggle closed"
+	AuditImportWeek         = "import week"
+	AuditCreateAccount      = "create account"
+	AuditModifyProfile      = "modify profile"
+	AuditSetRole            = "set role"
+	AuditToggleKitchen      = "toggle kitchen"
+	AuditToggleHidden       = "toggle hidden"
+	AuditAddTrial           = "add trial"
+	AuditDeleteAccount      = "delete account"
+	AuditSubmitLeave        = "submit leave"
+	AuditDeleteLeave        = "delete leave"
+	AuditSetLeaveStatus     = "set leave status"
+	AuditSaveTimesheetEntry = "save timesheet entry"
+	AuditToggleApproved     = "toggle approved"
+	AuditDeleteTimesheet    = "delete timesheet entry"
+	AuditRestoreBackup      = "restore backup"
+	AuditLinkIdentity       = "link identity"
+	AuditCreateInvite       = "create invite"
+	AuditAcceptInvite       = "accept invite"
+	AuditCreateAPIToken     = "create api token"
+	AuditRevokeAPIToken     = "revoke api token"
+	AuditStartViewAs        = "start view as"
+	AuditStopViewAs         = "stop view as"
+	AuditSaveTemplate       = "save roster template"
+	AuditApplyTemplate      = "apply roster template"
+	AuditDeleteTemplate     = "delete roster template"
+	AuditAutoRoster         = "auto roster"
+)
+
+// AuditActions lists every action in display order.
+var AuditActions = []string{
+	AuditAssignSlot, AuditSlotStartTime, AuditSlotDescription, AuditChangeRows,
+	AuditToggleLive, AuditToggleClosed, AuditImportWeek, AuditCreateAccount,
+	AuditModifyProfile, AuditSetRole, AuditToggleKitchen, AuditToggleHidden,
+	AuditAddTrial, AuditDeleteAccount, AuditSubmitLeave, AuditDeleteLeave,
+	AuditSetLeaveStatus, AuditSaveTimesheetEntry, AuditToggleApproved, AuditDeleteTimesheet,
+	AuditRestoreBackup, AuditLinkIdentity, AuditCreateInvite, AuditAcceptInvite,
+	AuditCreateAPIToken, AuditRevokeAPIToken, AuditStartViewAs, AuditStopViewAs,
+	AuditSaveTemplate, AuditApplyTemplate, AuditDeleteTemplate, AuditAutoRoster,
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Login link purposes.
+const (
+	// LoginLinkEmail links are emailed to staff to log in without a password.
+	LoginLinkEmail = "email"
+	// LoginLinkInvite links are given out by managers to bind a login to a
+	// trial or pre-created staff member.
+	LoginLinkInvite = "invite"
+)
+
+// LoginLink is a single-use link that logs a staff member in. Only a hash of
+// the link's token is stored, so the links can't be rebuilt from the
+// database.
+type LoginLink struct {
+	TokenHash string    `bson:"tokenHash"`
+	Purpose   string    `bson:"purpose"`
+	StaffID   uuid.UUID `bson:"staffId"`
+	CreatedAt time.Time `bson:"createdAt"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// NewLoginLinkToken returns a random token to send in a login link, and the
+// hash to store for it.
+func NewLoginLinkToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, HashLoginLinkToken(token), nil
+}
+
+// HashLoginLinkToken returns the hash stored for a login link's token.
+func HashLoginLinkToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,99 @@
+package models
+
+import "slices"
+
+// Permission names something only some staff are allowed to do.
+type Permission string
+
+const (
+	PermRosterEdit              Permission = "roster.edit"
+	PermRosterPublish           Permission = "roster.publish"
+	PermTimesheetApprove        Permission = "timesheet.approve"
+	PermTimesheetApproveKitchen Permission = "timesheet.approve.kitchen"
+	PermReportsExport           Permission = "reports.export"
+	PermStaffManage             Permission = "staff.manage"
+	PermStaffRoles              Permission = "staff.roles"
+	PermStaffDelete             Permission = "staff.delete"
+	PermLeaveApprove            Permission = "leave.approve"
+	PermAuditView               Permission = "audit.view"
+	PermBackupManage            Permission = "backup.manage"
+	PermAPITokensManage         Permission = "apitokens.manage"
+	PermStaffImpersonate        Permission = "staff.impersonate"
+)
+
+// AllPermissions lists every permission.
+var AllPermissions = []Permission{
+	PermRosterEdit, PermRosterPublish, PermTimesheetApprove, PermTimesheetApproveKitchen,
+	PermReportsExport, PermStaffManage, PermStaffRoles, PermStaffDelete,
+	PermLeaveApprove, PermAuditView, PermBackupManage, PermAPITokensManage,
+	PermStaffImpersonate,
+}
+
+// Role is a named group of permissions that can be given to staff.
+type Role struct {
+	ID          StaffRole
+	Name        string
+	Permissions []Permission
+}
+
+// Roles lists every role in the order they are offered.
+var Roles = []Role{
+	{ID: Staff, Name: "Staff"},
+	{ID: KitchenLead, Name: "Kitchen Lead", Permissions: []Permission{PermTimesheetApproveKitchen}},
+	{ID: Bookkeeper, Name: "Bookkeeper", Permissions: []Permission{PermReportsExport}},
+	{ID: Manager, Name: "Manager", Permissions: []Permission{
+		PermRosterEdit, PermRosterPublish, PermTimesheetApprove, PermTimesheetApproveKitchen,
+		PermReportsExport, PermStaffManage,
+	}},
+	{ID: AdminRole, Name: "Admin", Permissions: AllPermissions},
+}
+
+// Role returns the definition of r, or false if r isn't a known role.
+func (r StaffRole) Role() (Role, bool) {
+	for _, role := range Roles {
+		if role.ID == r {
+			return role, true
+		}
+	}
+	return Role{}, false
+}
+
+// Has reports whether the role grants perm. Unknown roles grant nothing.
+func (r StaffRole) Has(perm Permission) bool {
+	role, ok := r.Role()
+	return ok && slices.Contains(role.Permissions, perm)
+}
+
+// Can reports whether the staff member's role grants perm, and their Scope
+// allows it.
+func (s StaffMember) Can(perm Permission) bool {
+	if s.Scope != nil && !slices.Contains(s.Scope, perm) {
+		return false
+	}
+	return s.Role.Has(perm)
+}
+
+// CanApproveTimesheets reports whether the staff member can approve at least
+// some other staff's timesheets.
+func (s StaffMember) CanApproveTimesheets() bool {
+	return s.Can(PermTimesheetApprove) || s.Can(PermTimesheetApproveKitchen)
+}
+
+// CanApprove reports whether the staff member can approve entry. Kitchen
+// approvers can only approve kitchen shifts.
+func (s StaffMember) CanApprove(entry TimesheetEntry) bool {
+	if s.Can(PermTimesheetApprove) {
+		return true
+	}
+	return entry.ShiftType == Kitchen && s.Can(PermTimesheetApproveKitchen)
+}
+
+// CanEditTimesheetEntry reports whether the staff member can change or delete
+// entry. Approvers can edit any entry they could approve; everyone else only
+// their own unapproved entries while that day's timesheet is still open.
+func (s StaffMember) CanEditTimesheetEntry(entry TimesheetEntry) bool {
+	if s.CanApprove(entry) {
+		return true
+	}
+	return entry.StaffID == s.ID && !entry.Approved && !DisableTimesheet(entry.Date(), false)
+}
@@ -0,0 +1,47 @@
+package models
+
+import "testing"
+
+func TestRolePermissions(t *testing.T) {
+	tests := []struct {
+		role StaffRole
+		perm Permission
+		want bool
+	}{
+		{Staff, PermRosterEdit, false},
+		{Manager, PermRosterEdit, true},
+		{Manager, PermStaffRoles, false},
+		{KitchenLead, PermTimesheetApproveKitchen, true},
+		{KitchenLead, PermTimesheetApprove, false},
+		{Bookkeeper, PermReportsExport, true},
+		{Bookkeeper, PermRosterEdit, false},
+		{AdminRole, PermBackupManage, true},
+		{StaffRole(99), PermRosterEdit, false},
+	}
+	for _, tt := range tests {
+		if got := tt.role.Has(tt.perm); got != tt.want {
+			t.Errorf("%v.Has(%v) = %v; want %v", tt.role, tt.perm, got, tt.want)
+		}
+	}
+	for _, perm := range AllPermissions {
+		if !AdminRole.Has(perm) {
+			t.Errorf("expected admins to have %v", perm)
+		}
+	}
+}
+
+func TestCanApprove(t *testing.T) {
+	kitchen := TimesheetEntry{ShiftType: Kitchen}
+	bar := TimesheetEntry{ShiftType: Bar}
+	lead := StaffMember{Role: KitchenLead}
+	if !lead.CanApprove(kitchen) || lead.CanApprove(bar) {
+		t.Error("expected kitchen leads to approve only kitchen shifts")
+	}
+	manager := StaffMember{Role: Manager}
+	if !manager.CanApprove(kitchen) || !manager.CanApprove(bar) {
+		t.Error("expected managers to approve every shift")
+	}
+	if (StaffMember{Role: Bookkeeper}).CanApproveTimesheets() {
+		t.Error("expected bookkeepers not to approve timesheets")
+	}
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RosterTemplate is a saved week layout, like a winter or Christmas week,
+// that can be applied to any roster week. Days are kept in week order.
+type RosterTemplate struct {
+	ID        uuid.UUID `bson:"id"`
+	Name      string    `bson:"name"`
+	CreatedAt time.Time `bson:"createdAt"`
+	CreatedBy uuid.UUID `bson:"createdBy"`
+	// IncludesAssignments is set if the template keeps who was rostered on
+	// each slot, not just the layout.
+	IncludesAssignments bool             `bson:"includesAssignments"`
+	Slots               []SlotDefinition `bson:"slots"`
+	Days                []*RosterDay     `bson:"days"`
+}
+
+// DroppedAssignment is an assignment in a template that wasn't applied
+// because its staff member can no longer be rostered.
+type DroppedAssignment struct {
+	DayName   string
+	SlotName  string
+	StaffName string
+	// Reason is "hidden" or "deleted".
+	Reason string
+}
+
+// NewRosterTemplate returns a template laid out like week: its shifts,
+// closed days, rows, start times and descriptions, and its assignments if
+// includeAssignments is set.
+func NewRosterTemplate(name string, week RosterWeek, includeAssignments bool, createdBy uuid.UUID) RosterTemplate {
+	template := RosterTemplate{
+		ID:                  uuid.New(),
+		Name:                name,
+		CreatedAt:           time.Now(),
+		CreatedBy:           createdBy,
+		IncludesAssignments: includeAssignments,
+		Slots:               append([]SlotDefinition{}, week.Slots...),
+		Days:                []*RosterDay{},
+	}
+	for _, day := range week.Days {
+		copied := copyRosterDay(*day)
+		for _, row := range copied.Rows {
+			for i := range row.Slots {
+				row.Slots[i].Flag = None
+				if !includeAssignments {
+					row.Slots[i].AssignedStaff = nil
+					row.Slots[i].StaffString = nil
+				}
+			}
+		}
+		template.Days = append(template.Days, &copied)
+	}
+	return template
+}
+
+// Apply returns week laid out like the template, and the assignments left
+// out because their staff member is hidden or deleted. Days keep the week's
+// names, colours and offsets. allStaff must include deleted staff so they
+// can be told apart from hidden ones.
+func (t RosterTemplate) Apply(week RosterWeek, allStaff []*StaffMember) (RosterWeek, []DroppedAssignment) {
+	dropped := []DroppedAssignment{}
+	days := []*RosterDay{}
+	for i, day := range week.Days {
+		if i >= len(t.Days) {
+			days = append(days, day)
+			continue
+		}
+		applied := copyRosterDay(*t.Days[i])
+		applied.DayName = day.DayName
+		applied.Colour = day.Colour
+		applied.Offset = day.Offset
+		for _, row := range applied.Rows {
+			for j := range row.Slots {
+				slot := &row.Slots[j]
+				if slot.AssignedStaff == nil {
+					continue
+				}
+				staff := GetStaffFromList(*slot.AssignedStaff, allStaff)
+				reason := ""
+				if staff == nil || staff.IsDeleted {
+					reason = "deleted"
+				} else if staff.IsHidden {
+					reason = "hidden"
+				}
+				if reason == "" {
+					name := staff.RosterName()
+					slot.StaffString = &name
+					continue
+				}
+				staffName := ""
+				if slot.StaffString != nil {
+					staffName = *slot.StaffString
+				}
+				dropped = append(dropped, DroppedAssignment{
+					DayName:   applied.DayName,
+					SlotName:  slot.Name,
+					StaffName: staffName,
+					Reason:    reason,
+				})
+				slot.AssignedStaff = nil
+				slot.StaffString = nil
+			}
+		}
+		days = append(days, &applied)
+	}
+	week.Days = days
+	week.Slots = append([]SlotDefinition{}, t.Slots...)
+	return week, dropped
+}
+
+// copyRosterDay returns a deep copy of day with new IDs for it and all of
+// its rows and slots.
+func copyRosterDay(day RosterDay) RosterDay {
+	day.ID = uuid.New()
+	rows := []*Row{}
+	for _, row := range day.Rows {
+		copied := &Row{ID: uuid.New(), Slots: []Slot{}}
+		for _, slot := range row.Slots {
+			slot.ID = uuid.New()
+			if slot.AssignedStaff != nil {
+				staffID := *slot.AssignedStaff
+				slot.AssignedStaff = &staffID
+			}
+			if slot.StaffString != nil {
+				staffString := *slot.StaffString
+				slot.StaffString = &staffString
+			}
+			copied.Slots = append(copied.Slots, slot)
+		}
+		rows = append(rows, copied)
+	}
+	day.Rows = rows
+	return day
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// templateWeek returns a week of days named after the weekday, each with one
+// row of the given shifts.
+func templateWeek(slots []SlotDefinition) RosterWeek {
+	week := RosterWeek{ID: uuid.New(), Slots: slots}
+	for i, name := range []string{"Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday", "Monday"} {
+		week.Days = append(week.Days, &RosterDay{ID: uuid.New(), DayName: name, Offset: i, Rows: []*Row{NewRow(slots)}})
+	}
+	return week
+}
+
+// Test a template keeps the week's layout, and only keeps assignments when
+// asked to.
+func TestNewRosterTemplate(t *testing.T) {
+	staffID := uuid.New()
+	name := "Amy"
+	week := templateWeek(LegacySlots)
+	week.Days[1].IsClosed = true
+	week.Days[0].Rows = append(week.Days[0].Rows, NewRow(week.Slots))
+	slot := &week.Days[0].Rows[0].Slots[2]
+	slot.StartTime = "17:00"
+	slot.Description = "Bar"
+	slot.AssignedStaff = &staffID
+	slot.StaffString = &name
+	slot.Flag = LateToEarly
+
+	layout := NewRosterTemplate("Winter", week, false, uuid.New())
+	got := layout.Days[0].Rows[0].Slots[2]
+	if !layout.Days[1].IsClosed || len(layout.Days[0].Rows) != 2 || got.StartTime != "17:00" || got.Description != "Bar" {
+		t.Errorf("expected the week's layout to be kept, got %+v", layout.Days[:2])
+	}
+	if got.AssignedStaff != nil || got.StaffString != nil || got.Flag != None {
+		t.Errorf("expected assignments and flags to be left out, got %+v", got)
+	}
+	if got.ID == slot.ID || layout.Days[0].ID == week.Days[0].ID {
+		t.Error("expected the template to have its own IDs")
+	}
+
+	withStaff := NewRosterTemplate("Winter", week, true, uuid.New())
+	got = withStaff.Days[0].Rows[0].Slots[2]
+	if got.AssignedStaff == nil || *got.AssignedStaff != staffID || got.AssignedStaff == slot.AssignedStaff {
+		t.Errorf("expected a copy of the assignment, got %+v", got)
+	}
+}
+
+// Test applying a template keeps the target week's days, takes the
+// template's shifts, and drops assignments to hidden or deleted staff.
+func TestRosterTemplateApply(t *testing.T) {
+	amy := &StaffMember{ID: uuid.New(), FirstName: "Amy", NickName: "Ames"}
+	hidden := &StaffMember{ID: uuid.New(), FirstName: "Hal", IsHidden: true}
+	deleted := &StaffMember{ID: uuid.New(), FirstName: "Dee", IsDeleted: true}
+	gone := uuid.New()
+	source := templateWeek([]SlotDefinition{{Name: "Open", StartTime: "09:00"}, {Name: "Close"}})
+	for i, staff := range []uuid.UUID{amy.ID, hidden.ID, deleted.ID, gone} {
+		id, name := staff, "Old name"
+		slot := &source.Days[i].Rows[0].Slots[0]
+		slot.AssignedStaff, slot.StaffString = &id, &name
+	}
+	template := NewRosterTemplate("Summer", source, true, uuid.New())
+
+	target := templateWeek(LegacySlots)
+	target.Days[0].DayName = "Monday 1st"
+	target.Revision = 4
+	applied, dropped := template.Apply(target, []*StaffMember{amy, hidden, deleted})
+
+	if applied.ID != target.ID || applied.Revision != 4 || applied.Days[0].DayName != "Monday 1st" {
+		t.Errorf("expected the target week's identity and days to be kept, got %+v", applied)
+	}
+	if len(applied.Slots) != 2 || applied.Slots[0].Name != "Open" || applied.Days[0].Rows[0].Slots[0].Name != "Open" {
+		t.Errorf("expected the template's shifts, got %+v", applied.Slots)
+	}
+	if got := applied.Days[0].Rows[0].Slots[0]; got.AssignedStaff == nil || *got.StaffString != "Ames" {
+		t.Errorf("expected Amy to be assigned under her roster name, got %+v", got)
+	}
+	for i := 1; i < 4; i++ {
+		if got := applied.Days[i].Rows[0].Slots[0]; got.AssignedStaff != nil || got.StaffString != nil {
+			t.Errorf("expected day %d's assignment to be dropped, got %+v", i, got)
+		}
+	}
+	want := []string{"hidden", "deleted", "deleted"}
+	if len(dropped) != len(want) {
+		t.Fatalf("expected %d dropped assignments, got %+v", len(want), dropped)
+	}
+	for i, reason := range want {
+		if dropped[i].Reason != reason || dropped[i].SlotName != "Open" || dropped[i].StaffName != "Old name" {
+			t.Errorf("dropped[%d] = %+v; want reason %q", i, dropped[i], reason)
+		}
+	}
+	if template.Days[0].Rows[0].Slots[0].StaffString == applied.Days[0].Rows[0].Slots[0].StaffString {
+		t.Error("expected applying not to share state with the template")
+	}
+}
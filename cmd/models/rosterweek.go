@@ -1,10 +1,11 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 
-	"roster/cmd/utils"
-
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
 )
@@ -13,11 +14,17 @@ import (
 // Any custom JSON/BSON marshalling that is domain–specific is located here.
 
 type RosterWeek struct {
-	ID         uuid.UUID    `bson:"id"`
-	StartDate  time.Time    `bson:"startDate"`
-	WeekOffset int          `bson:"weekOffset"`
-	Days       []*RosterDay `bson:"days"`
-	IsLive     bool         `bson:"isLive"`
+	ID         uuid.UUID `bson:"id"`
+	StartDate  time.Time `bson:"startDate"`
+	WeekOffset int       `bson:"weekOffset"`
+	// Slots are the shifts each row of the week has a slot for, in order. They
+	// are copied from the venue's slots when the week is created, so changing
+	// those doesn't change weeks already rostered.
+	Slots  []SlotDefinition `bson:"slots"`
+	Days   []*RosterDay     `bson:"days"`
+	IsLive bool             `bson:"isLive"`
+	// Revision is incremented on every save and used to detect concurrent edits.
+	Revision int `bson:"revision"`
 }
 
 type RosterDay struct {
@@ -29,33 +36,184 @@ type RosterDay struct {
 	IsClosed bool
 }
 
+// SlotNames returns the names of the shifts the day's rows have slots for.
+func (d RosterDay) SlotNames() SlotNameList {
+	names := SlotNameList{}
+	if len(d.Rows) > 0 {
+		for _, slot := range d.Rows[0].Slots {
+			names = append(names, slot.Name)
+		}
+	}
+	return names
+}
+
+// SlotDefinition describes one of the shifts rostered each day, like the
+// early or late shift.
+type SlotDefinition struct {
+	Name string `bson:"name"`
+	// StartTime is filled in for the shift's slots when rows are added.
+	StartTime string `bson:"startTime"`
+	// Kitchen shifts are only filled with kitchen staff by the auto roster,
+	// and other shifts only with bar staff.
+	Kitchen bool `bson:"kitchen"`
+}
+
+// LegacySlots are the shifts every row had before they could be configured.
+var LegacySlots = []SlotDefinition{{Name: "Early"}, {Name: "Mid"}, {Name: "Late"}}
+
+var defaultSlots = LegacySlots
+
+// SetDefaultSlots sets the venue's shifts, which weeks created from now on
+// are rostered with. It must only be called at startup.
+func SetDefaultSlots(slots []SlotDefinition) {
+	defaultSlots = slots
+}
+
+// DefaultSlots returns a copy of the venue's shifts.
+func DefaultSlots() []SlotDefinition {
+	return append([]SlotDefinition{}, defaultSlots...)
+}
+
+// ParseSlotDefinitions parses a comma separated list of shifts, in order,
+// each a name optionally followed by "=" and its start time, like
+// "Early=10:00,Mid,Late=19:00". Kitchen shifts have "(kitchen)" after their
+// name, like "Prep (kitchen)=09:00".
+func ParseSlotDefinitions(list string) ([]SlotDefinition, error) {
+	slots := []SlotDefinition{}
+	for _, item := range strings.Split(list, ",") {
+		name, startTime, _ := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		kitchen := strings.HasSuffix(strings.ToLower(name), "(kitchen)")
+		if kitchen {
+			name = strings.TrimSpace(name[:len(name)-len("(kitchen)")])
+		}
+		slot := SlotDefinition{Name: name, StartTime: strings.TrimSpace(startTime), Kitchen: kitchen}
+		if slot.Name == "" {
+			return nil, fmt.Errorf("shift %q has no name", item)
+		}
+		if SlotNames(slots).Contains(slot.Name) {
+			return nil, fmt.Errorf("shift %q is listed twice", slot.Name)
+		}
+		slots = append(slots, slot)
+	}
+	return slots, nil
+}
+
+// SlotNameList is a list of shift names.
+type SlotNameList []string
+
+// SlotNames returns the names of slots, in order.
+func SlotNames(slots []SlotDefinition) SlotNameList {
+	names := SlotNameList{}
+	for _, slot := range slots {
+		names = append(names, slot.Name)
+	}
+	return names
+}
+
+// Contains reports whether name is in the list, ignoring case.
+func (l SlotNameList) Contains(name string) bool {
+	for _, n := range l {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
 type Row struct {
-	ID    uuid.UUID
-	Early Slot
-	Mid   Slot
-	Late  Slot
+	ID uuid.UUID
+	// Slots has a slot for each of the week's shifts, in the same order.
+	Slots []Slot
 }
 
+// NewRow returns an empty row with a slot for each of slots.
+func NewRow(slots []SlotDefinition) *Row {
+	row := &Row{ID: uuid.New(), Slots: []Slot{}}
+	for _, def := range slots {
+		row.Slots = append(row.Slots, Slot{ID: uuid.New(), Name: def.Name, StartTime: def.StartTime})
+	}
+	return row
+}
+
+// GetSlot returns the row's slot for the named shift, or nil.
 func (r Row) GetSlot(slotName string) *Slot {
-	switch slotName {
-	case "Early":
-		return &r.Early
-	case "Mid":
-		return &r.Mid
-	case "Late":
-		return &r.Late
-	default:
-		return nil
+	for i := range r.Slots {
+		if strings.EqualFold(r.Slots[i].Name, slotName) {
+			return &r.Slots[i]
+		}
+	}
+	return nil
+}
+
+// legacySlots returns the slots of a row saved before shifts could be
+// configured, named after the shifts they were for.
+func legacySlots(early *Slot, mid *Slot, late *Slot) []Slot {
+	slots := []Slot{}
+	for i, slot := range []*Slot{early, mid, late} {
+		if slot != nil {
+			slot.Name = LegacySlots[i].Name
+			slots = append(slots, *slot)
+		}
 	}
+	return slots
+}
+
+// UnmarshalBSON reads rows saved before shifts could be configured, which had
+// early, mid and late fields, as well as current ones.
+func (r *Row) UnmarshalBSON(data []byte) error {
+	type Alias Row
+	aux := &struct {
+		*Alias `bson:",inline"`
+		Early  *Slot `bson:"early"`
+		Mid    *Slot `bson:"mid"`
+		Late   *Slot `bson:"late"`
+	}{
+		Alias: (*Alias)(r),
+	}
+	if err := bson.Unmarshal(data, aux); err != nil {
+		return err
+	}
+	if r.Slots == nil {
+		r.Slots = legacySlots(aux.Early, aux.Mid, aux.Late)
+	}
+	return nil
+}
+
+// UnmarshalJSON reads rows from backups made before shifts could be
+// configured as well as current ones.
+func (r *Row) UnmarshalJSON(data []byte) error {
+	type Alias Row
+	aux := &struct {
+		*Alias
+		Early *Slot
+		Mid   *Slot
+		Late  *Slot
+	}{
+		Alias: (*Alias)(r),
+	}
+	if err := json.Unmarshal(data, aux); err != nil {
+		return err
+	}
+	if r.Slots == nil {
+		r.Slots = legacySlots(aux.Early, aux.Mid, aux.Late)
+	}
+	return nil
 }
 
 type Slot struct {
-	ID            uuid.UUID
+	ID uuid.UUID
+	// Name is the shift the slot is for.
+	Name          string
 	StartTime     string
 	AssignedStaff *uuid.UUID
 	StaffString   *string
-	Flag          Highlight
-	Description   string
+	// Flag is the most important of the slot's violations' highlights.
+	Flag        Highlight
+	Description string
+	// Violations are the roster rules the slot breaks, set by CheckRules.
+	// They are recomputed whenever the roster is shown, so are never stored.
+	Violations []Violation `bson:"-" json:"-"`
 }
 
 type Highlight int
@@ -100,16 +258,11 @@ func (rw *RosterWeek) UnmarshalBSON(data []byte) error {
 
 func (week *RosterWeek) GetSlotByID(slotID uuid.UUID) *Slot {
 	for _, day := range week.Days {
-		for j := range day.Rows {
-			row := day.Rows[j]
-			if row.Early.ID == slotID {
-				return &row.Early
-			}
-			if row.Mid.ID == slotID {
-				return &row.Mid
-			}
-			if row.Late.ID == slotID {
-				return &row.Late
+		for _, row := range day.Rows {
+			for j := range row.Slots {
+				if row.Slots[j].ID == slotID {
+					return &row.Slots[j]
+				}
 			}
 		}
 	}
@@ -154,63 +307,45 @@ func GetHighlightCol(defaultCol string, flag Highlight) string {
 	return defaultCol
 }
 
-func GetHighlightDesc(flag Highlight) string {
-	switch flag {
-	case Duplicate:
-		return "Duplicate shifts on this day"
-	case PrefConflict:
-		return "Conflict with staff preference"
-	case LateToEarly:
-		return "Late shift followed by early shift"
-	case LeaveConflict:
-		return "Conflict with leave request"
-	case PrefRefuse:
-		return "Staff refused this shift preference"
-	case IdealMet:
-		return "Ideal number of shifts met"
-	case IdealExceeded:
-		return "Ideal number of shifts exceeded"
-	default:
-		return ""
+// SlotColour returns the colour of slot on the roster: the colour of its
+// flag, or if its violations have no flag the colour of the most severe, or
+// defaultCol if it breaks no rules.
+func SlotColour(defaultCol string, slot Slot) string {
+	if slot.Flag != None {
+		return GetHighlightCol(defaultCol, slot.Flag)
 	}
-}
-
-func (week *RosterWeek) CheckFlags(allStaff []*StaffMember) RosterWeek {
-	staffMap := make(map[uuid.UUID]*StaffMember, len(allStaff))
-	shiftCounts := make(map[uuid.UUID][]int, len(allStaff))
-
-	for _, staff := range allStaff {
-		staffMap[staff.ID] = staff
-		shiftCounts[staff.ID] = make([]int, 7)
+	if len(slot.Violations) == 0 {
+		return defaultCol
 	}
-
-	for _, day := range week.Days {
-		if day != nil {
-			day.CountShifts(shiftCounts)
-		}
+	severity := SeverityInfo
+	for _, v := range slot.Violations {
+		severity = max(severity, v.Severity)
 	}
-
-	// Pre-calculate total weekly shifts for each staff member
-	weeklyShiftTotals := make(map[uuid.UUID]int, len(shiftCounts))
-	for staffID, dailyCounts := range shiftCounts {
-		weeklyShiftTotals[staffID] = SumArray(dailyCounts)
+	switch severity {
+	case SeverityError:
+		return "#CC3333"
+	case SeverityWarning:
+		return "#FF9999"
+	default:
+		return "#D7A9A9"
 	}
+}
 
-	startDate := utils.WeekStartFromOffset(week.WeekOffset)
-	for i := range week.Days {
-		if week.Days[i] != nil {
-			assignFlags(week.Days[i], startDate.AddDate(0, 0, i), shiftCounts, weeklyShiftTotals, staffMap, week.Days[i].Offset)
-		}
+// ViolationSummary lists the slot's violations, a line each, like
+// "Error: Sam is on approved leave".
+func (s Slot) ViolationSummary() string {
+	lines := []string{}
+	for _, v := range s.Violations {
+		severity := v.Severity.String()
+		lines = append(lines, strings.ToUpper(severity[:1])+severity[1:]+": "+v.Message)
 	}
+	return strings.Join(lines, "\n")
+}
 
-	for i := 0; i < len(week.Days)-1; i++ {
-		currentDay := week.Days[i]
-		nextDay := week.Days[i+1]
-		if currentDay.IsClosed || nextDay.IsClosed {
-			continue
-		}
-		checkLateToEarly(currentDay, nextDay)
-	}
+// CheckFlags sets the violations and flags of week's slots, checking only
+// the week itself.
+func (week *RosterWeek) CheckFlags(allStaff []*StaffMember) RosterWeek {
+	week.CheckRules(allStaff, nil, nil)
 	return *week
 }
 
@@ -228,9 +363,9 @@ func (day *RosterDay) CountShifts(shiftCounts map[uuid.UUID][]int) {
 		if row == nil {
 			continue
 		}
-		recordShifts(&row.Early)
-		recordShifts(&row.Mid)
-		recordShifts(&row.Late)
+		for i := range row.Slots {
+			recordShifts(&row.Slots[i])
+		}
 	}
 }
 
@@ -242,78 +377,6 @@ func SumArray(arr []int) int {
 	return total
 }
 
-func assignFlags(day *RosterDay, date time.Time, shiftCounts map[uuid.UUID][]int, weeklyShiftTotals map[uuid.UUID]int, staffMap map[uuid.UUID]*StaffMember, dayIdx int) {
-	processSlot := func(row *Row, slotStr string, dayIndex int) Highlight {
-		slot := row.GetSlot(slotStr)
-		if slot == nil || slot.AssignedStaff == nil {
-			return None
-		}
-		staffID := *slot.AssignedStaff
-
-		if dailyCounts, ok := shiftCounts[staffID]; ok {
-			if dayIndex >= 0 && dayIndex < len(dailyCounts) && dailyCounts[dayIndex] > 1 {
-				return Duplicate
-			}
-		}
-		if staff, ok := staffMap[staffID]; ok {
-			for _, req := range staff.LeaveRequests {
-				if req.Status != LeaveApproved {
-					continue
-				}
-				if !req.StartDate.After(date) && req.EndDate.After(date) {
-					return LeaveConflict
-				}
-			}
-			conflict := staff.GetConflict(slotStr, dayIndex)
-			if conflict != None {
-				return conflict
-			}
-			currentShifts := weeklyShiftTotals[staffID]
-			if currentShifts == staff.IdealShifts {
-				//TODO: move this to a better place for viewing
-				// return IdealMet
-				return None
-			}
-			if currentShifts > staff.IdealShifts {
-				return IdealExceeded
-			}
-		}
-		return None
-	}
-
-	for _, row := range day.Rows {
-		if row == nil {
-			continue
-		} // Added nil check for row
-		row.Early.Flag = processSlot(row, "Early", day.Offset)
-		row.Mid.Flag = processSlot(row, "Mid", day.Offset)
-		row.Late.Flag = processSlot(row, "Late", day.Offset)
-	}
-}
-
-func checkLateToEarly(day *RosterDay, nextDay *RosterDay) {
-	for _, row := range day.Rows {
-		if row.Late.Flag > LateToEarly {
-			// Don't overwrite more important flags
-			continue
-		}
-		staffID := row.Late.AssignedStaff
-		if staffID == nil {
-			continue
-		}
-		for _, row2 := range nextDay.Rows {
-			if row2.Early.Flag > LateToEarly {
-				// Don't overwrite more important flags
-				continue
-			}
-			if row2.Early.HasThisStaff(*staffID) {
-				row2.Early.Flag = LateToEarly
-				row.Late.Flag = LateToEarly
-			}
-		}
-	}
-}
-
 // CountShiftsForStaff returns the total number of shifts assigned to a specific staff member in this roster week.
 func (week *RosterWeek) CountShiftsForStaff(staffID uuid.UUID) int {
 	totalShifts := 0
@@ -325,15 +388,10 @@ func (week *RosterWeek) CountShiftsForStaff(staffID uuid.UUID) int {
 			if row == nil {
 				continue
 			}
-			// Count Early, Mid, Late shifts
-			if row.Early.AssignedStaff != nil && *row.Early.AssignedStaff == staffID {
-				totalShifts++
-			}
-			if row.Mid.AssignedStaff != nil && *row.Mid.AssignedStaff == staffID {
-				totalShifts++
-			}
-			if row.Late.AssignedStaff != nil && *row.Late.AssignedStaff == staffID {
-				totalShifts++
+			for _, slot := range row.Slots {
+				if slot.HasThisStaff(staffID) {
+					totalShifts++
+				}
 			}
 		}
 	}
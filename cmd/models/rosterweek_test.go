@@ -1,17 +1,19 @@
 package models
 
 import (
+	"encoding/json"
+	"reflect"
 	"testing"
 
 	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 func TestGetSlotByIDAndGetDayByID(t *testing.T) {
 	// Build a roster week with known IDs
 	dayID := uuid.New()
 	slotID := uuid.New()
-	slot := &Slot{ID: slotID}
-	row := &Row{Early: *slot}
+	row := &Row{Slots: []Slot{{ID: slotID, Name: "Early"}}}
 	day := &RosterDay{ID: dayID, Rows: []*Row{row}, Offset: 0}
 	week := &RosterWeek{Days: []*RosterDay{day}}
 	// Test GetDayByID
@@ -83,7 +85,7 @@ func TestCountShifts(t *testing.T) {
 	s := staffID
 	// day with one row, Early and Late assigned to the same staff
 	day := &RosterDay{Offset: 2}
-	row1 := &Row{Early: Slot{AssignedStaff: &s}, Mid: Slot{}, Late: Slot{AssignedStaff: &s}}
+	row1 := &Row{Slots: []Slot{{Name: "Early", AssignedStaff: &s}, {Name: "Mid"}, {Name: "Late", AssignedStaff: &s}}}
 	day.Rows = []*Row{row1}
 	counts := map[uuid.UUID][]int{staffID: make([]int, 7)}
 	day.CountShifts(counts)
@@ -91,3 +93,71 @@ func TestCountShifts(t *testing.T) {
 		t.Errorf("CountShifts: expected 2 shifts at offset 2, got %d", counts[staffID][2])
 	}
 }
+
+func TestParseSlotDefinitions(t *testing.T) {
+	slots, err := ParseSlotDefinitions("Brunch=10:00, Dinner ,Prep (Kitchen)=09:00,Late=21:30")
+	if err != nil {
+		t.Fatalf("ParseSlotDefinitions: %v", err)
+	}
+	want := []SlotDefinition{{Name: "Brunch", StartTime: "10:00"}, {Name: "Dinner"}, {Name: "Prep", StartTime: "09:00", Kitchen: true}, {Name: "Late", StartTime: "21:30"}}
+	if !reflect.DeepEqual(slots, want) {
+		t.Errorf("ParseSlotDefinitions: got %+v, want %+v", slots, want)
+	}
+	for _, list := range []string{"", "Early,,Late", "Early,early", "=10:00", "(kitchen)=10:00"} {
+		if _, err := ParseSlotDefinitions(list); err == nil {
+			t.Errorf("ParseSlotDefinitions(%q): expected an error", list)
+		}
+	}
+}
+
+// Rows saved with early, mid and late fields must load as named slots.
+func TestRowUnmarshal_Legacy(t *testing.T) {
+	earlyID, lateID := uuid.New(), uuid.New()
+	legacy := bson.M{"id": uuid.New(), "early": bson.M{"id": earlyID, "starttime": "10:00"}, "mid": bson.M{}, "late": bson.M{"id": lateID}}
+	data, err := bson.Marshal(legacy)
+	if err != nil {
+		t.Fatalf("bson.Marshal: %v", err)
+	}
+	var row Row
+	if err := bson.Unmarshal(data, &row); err != nil {
+		t.Fatalf("bson.Unmarshal: %v", err)
+	}
+	if len(row.Slots) != 3 || row.GetSlot("early").ID != earlyID || row.GetSlot("Early").StartTime != "10:00" || row.GetSlot("Late").ID != lateID {
+		t.Errorf("expected early, mid and late slots, got %+v", row.Slots)
+	}
+
+	var fromJSON Row
+	if err := json.Unmarshal([]byte(`{"ID":"`+uuid.NewString()+`","Early":{"Description":"Bar"},"Mid":{},"Late":{}}`), &fromJSON); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if len(fromJSON.Slots) != 3 || fromJSON.Slots[0].Name != "Early" || fromJSON.Slots[0].Description != "Bar" {
+		t.Errorf("expected early, mid and late slots, got %+v", fromJSON.Slots)
+	}
+
+	current := Row{ID: uuid.New(), Slots: []Slot{{ID: uuid.New(), Name: "Brunch"}}}
+	data, _ = bson.Marshal(current)
+	var roundTrip Row
+	if err := bson.Unmarshal(data, &roundTrip); err != nil {
+		t.Fatalf("bson.Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(roundTrip, current) {
+		t.Errorf("round trip: got %+v, want %+v", roundTrip, current)
+	}
+}
+
+// Late to early is checked between the week's last and first shifts.
+func TestCheckFlags_LateToEarlyUsesWeekSlots(t *testing.T) {
+	staffID := uuid.New()
+	slots := []SlotDefinition{{Name: "Brunch"}, {Name: "Lunch"}, {Name: "Dinner"}}
+	week := RosterWeek{Slots: slots}
+	for i := 0; i < 2; i++ {
+		week.Days = append(week.Days, &RosterDay{Offset: i, Rows: []*Row{NewRow(slots)}})
+	}
+	week.Days[0].Rows[0].GetSlot("Dinner").AssignedStaff = &staffID
+	week.Days[1].Rows[0].GetSlot("Brunch").AssignedStaff = &staffID
+	staff := &StaffMember{ID: staffID, IdealShifts: 5, Availability: make([]DayAvailability, 7)}
+	week.CheckFlags([]*StaffMember{staff})
+	if flag := week.Days[1].Rows[0].GetSlot("Brunch").Flag; flag != LateToEarly {
+		t.Errorf("expected Dinner then Brunch to be flagged late to early, got %v", flag)
+	}
+}
@@ -0,0 +1,626 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"roster/cmd/utils"
+
+	"github.com/google/uuid"
+)
+
+// Severity is how serious breaking a roster rule is.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return "info"
+	}
+}
+
+// Violation is a roster rule broken by a slot.
+type Violation struct {
+	// Rule is the name of the rule broken.
+	Rule     string
+	Severity Severity
+	Message  string
+	// StaffID is who is rostered on the slot, and Date the day it's on.
+	StaffID uuid.UUID
+	Date    time.Time
+	// Flag is the highlight the slot is coloured with for the violation, or
+	// None to colour it by severity.
+	Flag Highlight
+}
+
+// RuleConfig configures the roster rules. Rules with a zero limit are off.
+type RuleConfig struct {
+	// MinRest is the least time allowed between the end of one shift and the
+	// start of the next.
+	MinRest time.Duration
+	// MaxConsecutiveDays is the most days in a row anyone can work.
+	MaxConsecutiveDays int
+	// MaxShiftsPerWeek is the most shifts anyone can work in a week.
+	MaxShiftsPerWeek int
+	// LateToEarly is whether working a late shift and then the next day's
+	// early shift is flagged, including across the end of the week.
+	LateToEarly bool
+	// MinorsFinishBy is how long after the start of the day a shift worked
+	// by a minor must end, so 24 hours is midnight.
+	MinorsFinishBy time.Duration
+	// ShiftLength is how long shifts are taken to last, since slots only
+	// have a start time.
+	ShiftLength time.Duration
+}
+
+// DefaultRuleConfig is the rules checked unless configured otherwise.
+var DefaultRuleConfig = RuleConfig{
+	MinRest:            10 * time.Hour,
+	MaxConsecutiveDays: 6,
+	LateToEarly:        true,
+	MinorsFinishBy:     24 * time.Hour,
+	ShiftLength:        8 * time.Hour,
+}
+
+var ruleConfig = DefaultRuleConfig
+
+// SetRuleConfig sets the rules rosters are checked against. It must only be
+// called at startup.
+func SetRuleConfig(config RuleConfig) {
+	ruleConfig = config
+}
+
+// ParseRuleConfig parses a comma separated list of settings, each a rule's
+// name, "=" and its limit, like "min-rest=11h,max-shifts=5,minors-finish=23:00".
+// A limit of "off" turns the rule off. Rules not listed keep their defaults.
+func ParseRuleConfig(list string) (RuleConfig, error) {
+	config := DefaultRuleConfig
+	for _, item := range strings.Split(list, ",") {
+		name, value, _ := strings.Cut(item, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		off := value == "off"
+		var err error
+		switch name {
+		case "min-rest":
+			config.MinRest, err = parseRuleDuration(value)
+		case "max-consecutive-days":
+			config.MaxConsecutiveDays, err = parseRuleLimit(value)
+		case "max-shifts":
+			config.MaxShiftsPerWeek, err = parseRuleLimit(value)
+		case "late-to-early":
+			config.LateToEarly = !off
+			if !off && value != "on" {
+				err = fmt.Errorf("expected on or off")
+			}
+		case "minors-finish":
+			config.MinorsFinishBy = 0
+			if !off {
+				var ok bool
+				if config.MinorsFinishBy, ok = ParseClock(value); !ok {
+					err = fmt.Errorf("expected a time of day")
+				} else if config.MinorsFinishBy == 0 {
+					config.MinorsFinishBy = 24 * time.Hour
+				}
+			}
+		case "shift-length":
+			config.ShiftLength, err = time.ParseDuration(value)
+			if err == nil && config.ShiftLength <= 0 {
+				err = fmt.Errorf("must be positive")
+			}
+		default:
+			return RuleConfig{}, fmt.Errorf("unknown rule %q", name)
+		}
+		if err != nil {
+			return RuleConfig{}, fmt.Errorf("rule %q: %w", name, err)
+		}
+	}
+	return config, nil
+}
+
+func parseRuleDuration(value string) (time.Duration, error) {
+	if value == "off" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err == nil && d < 0 {
+		err = fmt.Errorf("must not be negative")
+	}
+	return d, err
+}
+
+func parseRuleLimit(value string) (int, error) {
+	if value == "off" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err == nil && n < 1 {
+		err = fmt.Errorf("must be at least 1")
+	}
+	return n, err
+}
+
+// ParseClock reads a time of day like "17:00", "06:30", "5pm" or "5:30 pm",
+// returning how long after midnight it is. Without am or pm the hour must
+// have two digits, as "6:30" could be in the morning or the evening.
+func ParseClock(s string) (time.Duration, bool) {
+	s = strings.ToLower(strings.ReplaceAll(s, " ", ""))
+	pm := strings.HasSuffix(s, "pm")
+	twelveHour := pm || strings.HasSuffix(s, "am")
+	if twelveHour {
+		s = s[:len(s)-2]
+	}
+	hourText, minuteText, hasMinutes := strings.Cut(strings.Replace(s, ".", ":", 1), ":")
+	hour, err := strconv.Atoi(hourText)
+	if err != nil || hour < 0 || hour > 23 || (twelveHour && (hour < 1 || hour > 12)) || (!twelveHour && len(hourText) != 2) {
+		return 0, false
+	}
+	minute := 0
+	if hasMinutes {
+		minute, err = strconv.Atoi(minuteText)
+		if err != nil || len(minuteText) != 2 || minute > 59 {
+			return 0, false
+		}
+	}
+	if twelveHour {
+		hour %= 12
+		if pm {
+			hour += 12
+		}
+	}
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute, true
+}
+
+// formatClock formats a time of day, how long after midnight it is.
+func formatClock(d time.Duration) string {
+	d %= 24 * time.Hour
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// Shift is a slot someone is rostered on, and when it is.
+type Shift struct {
+	StaffID uuid.UUID
+	Slot    *Slot
+	Day     *RosterDay
+	Date    time.Time
+	// Start is when the shift starts, or zero if its slot's start time isn't
+	// set or can't be read.
+	Start time.Time
+	// IsEarly and IsLate are set for the first and last of the week's shifts,
+	// if it has more than one.
+	IsEarly bool
+	IsLate  bool
+	// InWeek is set for shifts in the week being checked.
+	InWeek bool
+}
+
+// End returns when the shift ends if it lasts length, or zero if its start
+// time isn't known.
+func (s Shift) End(length time.Duration) time.Time {
+	if s.Start.IsZero() {
+		return time.Time{}
+	}
+	return s.Start.Add(length)
+}
+
+// violates returns a violation of rule by the shift.
+func (s Shift) violates(rule string, severity Severity, flag Highlight, message string) SlotViolation {
+	return SlotViolation{s.Slot.ID, Violation{
+		Rule:     rule,
+		Severity: severity,
+		Message:  message,
+		StaffID:  s.StaffID,
+		Date:     s.Date,
+		Flag:     flag,
+	}}
+}
+
+// describe names the shift for messages, like "Tue 4 Mar Late".
+func (s Shift) describe() string {
+	return s.Date.Format("Mon 2 Jan") + " " + s.Slot.Name
+}
+
+// RuleContext is what rules check: a week and the shifts each staff member
+// works in it and the weeks either side of it.
+type RuleContext struct {
+	Week   *RosterWeek
+	Config RuleConfig
+	Staff  map[uuid.UUID]*StaffMember
+	// Shifts are each staff member's shifts in date order. Closed days are
+	// left out.
+	Shifts map[uuid.UUID][]Shift
+}
+
+// SlotViolation is a violation of a rule by the slot with SlotID.
+type SlotViolation struct {
+	SlotID uuid.UUID
+	Violation
+}
+
+// Rule is a rostering rule weeks are checked against.
+type Rule interface {
+	// Name identifies the rule in its violations.
+	Name() string
+	// Check returns the rule's violations by shifts in c.Week. Violations
+	// by shifts in the weeks either side are ignored.
+	Check(c *RuleContext) []SlotViolation
+}
+
+// Rules returns the rules config turns on, in the order their violations
+// are listed.
+func (config RuleConfig) Rules() []Rule {
+	rules := []Rule{duplicateRule{}, leaveRule{}, availabilityRule{}}
+	if config.LateToEarly {
+		rules = append(rules, lateToEarlyRule{})
+	}
+	if config.MinRest > 0 {
+		rules = append(rules, minRestRule{config.MinRest})
+	}
+	if config.MaxConsecutiveDays > 0 {
+		rules = append(rules, maxConsecutiveDaysRule{config.MaxConsecutiveDays})
+	}
+	if config.MaxShiftsPerWeek > 0 {
+		rules = append(rules, maxShiftsRule{config.MaxShiftsPerWeek})
+	}
+	if config.MinorsFinishBy > 0 {
+		rules = append(rules, minorsRule{config.MinorsFinishBy})
+	}
+	return append(rules, idealShiftsRule{})
+}
+
+// CheckRules sets the violations and flag of every slot in week from the
+// configured rules. previous and next are the weeks either side, or nil if
+// they haven't been rostered, so rules can look across the end of the week.
+func (week *RosterWeek) CheckRules(allStaff []*StaffMember, previous *RosterWeek, next *RosterWeek) {
+	c := &RuleContext{
+		Week:   week,
+		Config: ruleConfig,
+		Staff:  make(map[uuid.UUID]*StaffMember, len(allStaff)),
+		Shifts: map[uuid.UUID][]Shift{},
+	}
+	for _, staff := range allStaff {
+		c.Staff[staff.ID] = staff
+	}
+	for _, w := range []*RosterWeek{previous, week, next} {
+		if w != nil {
+			c.addShifts(w, w == week)
+		}
+	}
+	for _, shifts := range c.Shifts {
+		sort.SliceStable(shifts, func(i, j int) bool {
+			return shifts[i].Date.Before(shifts[j].Date)
+		})
+	}
+
+	violations := map[uuid.UUID][]Violation{}
+	for _, rule := range c.Config.Rules() {
+		for _, v := range rule.Check(c) {
+			violations[v.SlotID] = append(violations[v.SlotID], v.Violation)
+		}
+	}
+	for _, day := range week.Days {
+		for _, row := range day.Rows {
+			for i := range row.Slots {
+				slot := &row.Slots[i]
+				slot.Violations = violations[slot.ID]
+				slot.Flag = None
+				for _, v := range slot.Violations {
+					slot.Flag = max(slot.Flag, v.Flag)
+				}
+			}
+		}
+	}
+}
+
+// addShifts adds the shifts worked in w to c.Shifts, marking them InWeek if
+// w is the week being checked.
+func (c *RuleContext) addShifts(w *RosterWeek, inWeek bool) {
+	startDate := utils.WeekStartFromOffset(w.WeekOffset)
+	startTimes := map[string]string{}
+	for _, def := range w.Slots {
+		startTimes[def.Name] = def.StartTime
+	}
+	var early, late string
+	if len(w.Slots) > 1 {
+		early, late = w.Slots[0].Name, w.Slots[len(w.Slots)-1].Name
+	}
+	for _, day := range w.Days {
+		if day == nil || day.IsClosed {
+			continue
+		}
+		date := startDate.AddDate(0, 0, day.Offset)
+		for _, row := range day.Rows {
+			if row == nil {
+				continue
+			}
+			for i := range row.Slots {
+				slot := &row.Slots[i]
+				if slot.AssignedStaff == nil {
+					continue
+				}
+				shift := Shift{StaffID: *slot.AssignedStaff, Slot: slot, Day: day, Date: date, IsEarly: slot.Name == early, IsLate: slot.Name == late, InWeek: inWeek}
+				startTime := slot.StartTime
+				if startTime == "" {
+					startTime = startTimes[slot.Name]
+				}
+				if start, ok := ParseClock(startTime); ok {
+					shift.Start = date.Add(start)
+				}
+				c.Shifts[*slot.AssignedStaff] = append(c.Shifts[*slot.AssignedStaff], shift)
+			}
+		}
+	}
+}
+
+// weekShifts returns the shifts of staffID in the week being checked.
+func (c *RuleContext) weekShifts(staffID uuid.UUID) []Shift {
+	shifts := []Shift{}
+	for _, shift := range c.Shifts[staffID] {
+		if shift.InWeek {
+			shifts = append(shifts, shift)
+		}
+	}
+	return shifts
+}
+
+// staffName is how a staff member is named in messages.
+func (c *RuleContext) staffName(staffID uuid.UUID, shift Shift) string {
+	if staff, ok := c.Staff[staffID]; ok {
+		return staff.RosterName()
+	}
+	if shift.Slot.StaffString != nil {
+		return *shift.Slot.StaffString
+	}
+	return "Staff member"
+}
+
+// sortedStaff returns the IDs of everyone with shifts, so violations are
+// always listed in the same order.
+func (c *RuleContext) sortedStaff() []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(c.Shifts))
+	for id := range c.Shifts {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+	return ids
+}
+
+type duplicateRule struct{}
+
+func (duplicateRule) Name() string { return "duplicate" }
+
+func (r duplicateRule) Check(c *RuleContext) []SlotViolation {
+	violations := []SlotViolation{}
+	for _, staffID := range c.sortedStaff() {
+		byDay := map[*RosterDay][]Shift{}
+		for _, shift := range c.weekShifts(staffID) {
+			byDay[shift.Day] = append(byDay[shift.Day], shift)
+		}
+		for _, shift := range c.weekShifts(staffID) {
+			if n := len(byDay[shift.Day]); n > 1 {
+				violations = append(violations, shift.violates(r.Name(), SeverityError, Duplicate, fmt.Sprintf("%s has %d shifts on %s", c.staffName(staffID, shift), n, shift.Date.Format("Mon 2 Jan"))))
+			}
+		}
+	}
+	return violations
+}
+
+type leaveRule struct{}
+
+func (leaveRule) Name() string { return "leave" }
+
+func (r leaveRule) Check(c *RuleContext) []SlotViolation {
+	violations := []SlotViolation{}
+	for _, staffID := range c.sortedStaff() {
+		staff, ok := c.Staff[staffID]
+		if !ok {
+			continue
+		}
+		for _, shift := range c.weekShifts(staffID) {
+			if staff.IsAway(shift.Date) {
+				violations = append(violations, shift.violates(r.Name(), SeverityError, LeaveConflict, fmt.Sprintf("%s is on approved leave", staff.RosterName())))
+			}
+		}
+	}
+	return violations
+}
+
+type availabilityRule struct{}
+
+func (availabilityRule) Name() string { return "availability" }
+
+func (r availabilityRule) Check(c *RuleContext) []SlotViolation {
+	violations := []SlotViolation{}
+	names := SlotNames(c.Week.Slots)
+	for _, staffID := range c.sortedStaff() {
+		staff, ok := c.Staff[staffID]
+		if !ok {
+			continue
+		}
+		for _, shift := range c.weekShifts(staffID) {
+			if shift.Day.Offset >= len(staff.Availability) {
+				continue
+			}
+			switch staff.GetConflict(shift.Slot.Name, shift.Day.Offset, names) {
+			case PrefRefuse:
+				violations = append(violations, shift.violates(r.Name(), SeverityError, PrefRefuse, fmt.Sprintf("%s can't work on %ss", staff.RosterName(), shift.Date.Weekday())))
+			case PrefConflict:
+				violations = append(violations, shift.violates(r.Name(), SeverityWarning, PrefConflict, fmt.Sprintf("%s can't work %s shifts on %ss", staff.RosterName(), shift.Slot.Name, shift.Date.Weekday())))
+			}
+		}
+	}
+	return violations
+}
+
+type lateToEarlyRule struct{}
+
+func (lateToEarlyRule) Name() string { return "late-to-early" }
+
+func (r lateToEarlyRule) Check(c *RuleContext) []SlotViolation {
+	violations := []SlotViolation{}
+	for _, staffID := range c.sortedStaff() {
+		shifts := c.Shifts[staffID]
+		for i, late := range shifts {
+			if !late.IsLate {
+				continue
+			}
+			for _, early := range shifts[i+1:] {
+				if !early.IsEarly || !early.Date.Equal(late.Date.AddDate(0, 0, 1)) {
+					continue
+				}
+				name := c.staffName(staffID, late)
+				violations = append(violations,
+					late.violates(r.Name(), SeverityWarning, LateToEarly, fmt.Sprintf("%s is on %s the next morning", name, early.describe())),
+					early.violates(r.Name(), SeverityWarning, LateToEarly, fmt.Sprintf("%s was on %s the night before", name, late.describe())))
+			}
+		}
+	}
+	return violations
+}
+
+type minRestRule struct {
+	minRest time.Duration
+}
+
+func (minRestRule) Name() string { return "min-rest" }
+
+func (r minRestRule) Check(c *RuleContext) []SlotViolation {
+	violations := []SlotViolation{}
+	for _, staffID := range c.sortedStaff() {
+		shifts := c.Shifts[staffID]
+		for i := 1; i < len(shifts); i++ {
+			before, after := shifts[i-1], shifts[i]
+			if before.Start.IsZero() || after.Start.IsZero() || before.Date.Equal(after.Date) {
+				continue
+			}
+			rest := after.Start.Sub(before.End(c.Config.ShiftLength))
+			if rest >= r.minRest {
+				continue
+			}
+			name := c.staffName(staffID, after)
+			violations = append(violations,
+				before.violates(r.Name(), SeverityWarning, None, fmt.Sprintf("%s has %s rest before %s, less than %s", name, formatRest(rest), after.describe(), formatRest(r.minRest))),
+				after.violates(r.Name(), SeverityWarning, None, fmt.Sprintf("%s has %s rest after %s, less than %s", name, formatRest(rest), before.describe(), formatRest(r.minRest))))
+		}
+	}
+	return violations
+}
+
+// formatRest formats a rest period like "9h" or "9h30m".
+func formatRest(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	d = d.Round(time.Minute)
+	hours, minutes := int(d.Hours()), int(d.Minutes())%60
+	if minutes == 0 {
+		return fmt.Sprintf("%dh", hours)
+	}
+	return fmt.Sprintf("%dh%02dm", hours, minutes)
+}
+
+type maxConsecutiveDaysRule struct {
+	maxDays int
+}
+
+func (maxConsecutiveDaysRule) Name() string { return "max-consecutive-days" }
+
+func (r maxConsecutiveDaysRule) Check(c *RuleContext) []SlotViolation {
+	violations := []SlotViolation{}
+	for _, staffID := range c.sortedStaff() {
+		run := 0
+		var last time.Time
+		for _, shift := range c.Shifts[staffID] {
+			switch {
+			case shift.Date.Equal(last):
+			case !last.IsZero() && shift.Date.Equal(last.AddDate(0, 0, 1)):
+				run++
+			default:
+				run = 1
+			}
+			last = shift.Date
+			if run > r.maxDays && shift.InWeek {
+				violations = append(violations, shift.violates(r.Name(), SeverityWarning, None, fmt.Sprintf("%s is working %d days in a row, more than %d", c.staffName(staffID, shift), run, r.maxDays)))
+			}
+		}
+	}
+	return violations
+}
+
+type maxShiftsRule struct {
+	maxShifts int
+}
+
+func (maxShiftsRule) Name() string { return "max-shifts" }
+
+func (r maxShiftsRule) Check(c *RuleContext) []SlotViolation {
+	violations := []SlotViolation{}
+	for _, staffID := range c.sortedStaff() {
+		shifts := c.weekShifts(staffID)
+		if len(shifts) <= r.maxShifts {
+			continue
+		}
+		for _, shift := range shifts[r.maxShifts:] {
+			violations = append(violations, shift.violates(r.Name(), SeverityWarning, None, fmt.Sprintf("%s has %d shifts this week, more than %d", c.staffName(staffID, shift), len(shifts), r.maxShifts)))
+		}
+	}
+	return violations
+}
+
+type minorsRule struct {
+	finishBy time.Duration
+}
+
+func (minorsRule) Name() string { return "minors" }
+
+func (r minorsRule) Check(c *RuleContext) []SlotViolation {
+	violations := []SlotViolation{}
+	for _, staffID := range c.sortedStaff() {
+		staff, ok := c.Staff[staffID]
+		if !ok || !staff.IsMinor {
+			continue
+		}
+		for _, shift := range c.weekShifts(staffID) {
+			end := shift.End(c.Config.ShiftLength)
+			if end.IsZero() || !end.After(shift.Date.Add(r.finishBy)) {
+				continue
+			}
+			violations = append(violations, shift.violates(r.Name(), SeverityError, None, fmt.Sprintf("%s is a minor and would finish at %s, after %s", staff.RosterName(), formatClock(end.Sub(shift.Date)), formatClock(r.finishBy))))
+		}
+	}
+	return violations
+}
+
+type idealShiftsRule struct{}
+
+func (idealShiftsRule) Name() string { return "ideal-shifts" }
+
+func (r idealShiftsRule) Check(c *RuleContext) []SlotViolation {
+	violations := []SlotViolation{}
+	for _, staffID := range c.sortedStaff() {
+		staff, ok := c.Staff[staffID]
+		if !ok {
+			continue
+		}
+		shifts := c.weekShifts(staffID)
+		if len(shifts) <= staff.IdealShifts {
+			continue
+		}
+		for _, shift := range shifts {
+			violations = append(violations, shift.violates(r.Name(), SeverityInfo, IdealExceeded, fmt.Sprintf("%s has %d shifts, more than their ideal %d", staff.RosterName(), len(shifts), staff.IdealShifts)))
+		}
+	}
+	return violations
+}
@@ -0,0 +1,179 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"roster/cmd/utils"
+
+	"github.com/google/uuid"
+)
+
+func TestParseClock(t *testing.T) {
+	cases := map[string]time.Duration{
+		"17:00":   17 * time.Hour,
+		"09":      9 * time.Hour,
+		"06:30":   6*time.Hour + 30*time.Minute,
+		"5pm":     17 * time.Hour,
+		"5:30 PM": 17*time.Hour + 30*time.Minute,
+		"12am":    0,
+		"10.15":   10*time.Hour + 15*time.Minute,
+	}
+	for in, want := range cases {
+		if got, ok := ParseClock(in); !ok || got != want {
+			t.Errorf("ParseClock(%q) = %v, %v; want %v", in, got, ok, want)
+		}
+	}
+	// Times that could be morning or evening aren't guessed at.
+	for _, in := range []string{"", "late", "24:00", "13pm", "5:3", "10:60", "9", "5", "6:30", "6.30"} {
+		if _, ok := ParseClock(in); ok {
+			t.Errorf("ParseClock(%q): expected an error", in)
+		}
+	}
+}
+
+func TestParseRuleConfig(t *testing.T) {
+	config, err := ParseRuleConfig("min-rest=11h, max-shifts=5, late-to-early=off, minors-finish=00:00, max-consecutive-days=off")
+	if err != nil {
+		t.Fatalf("ParseRuleConfig: %v", err)
+	}
+	want := DefaultRuleConfig
+	want.MinRest, want.MaxShiftsPerWeek, want.LateToEarly, want.MaxConsecutiveDays = 11*time.Hour, 5, false, 0
+	if config != want {
+		t.Errorf("ParseRuleConfig: got %+v, want %+v", config, want)
+	}
+	for _, list := range []string{"max-hours=5", "min-rest=soon", "max-shifts=0", "late-to-early=maybe", "minors-finish=late", "shift-length=0s"} {
+		if _, err := ParseRuleConfig(list); err == nil {
+			t.Errorf("ParseRuleConfig(%q): expected an error", list)
+		}
+	}
+}
+
+// newRuleWeek returns an empty week at offset with one row of an early, mid
+// and late shift a day.
+func newRuleWeek(offset int) *RosterWeek {
+	slots := []SlotDefinition{{Name: "Early", StartTime: "10:00"}, {Name: "Mid", StartTime: "13:00"}, {Name: "Late", StartTime: "18:00"}}
+	week := &RosterWeek{ID: uuid.New(), WeekOffset: offset, Slots: slots}
+	for i := 0; i < 7; i++ {
+		week.Days = append(week.Days, &RosterDay{ID: uuid.New(), Offset: i, Rows: []*Row{NewRow(slots)}})
+	}
+	return week
+}
+
+func rosterOn(week *RosterWeek, offset int, slot string, staff *StaffMember) *Slot {
+	s := week.Days[offset].Rows[0].GetSlot(slot)
+	s.AssignedStaff = &staff.ID
+	return s
+}
+
+func violatedRules(slot *Slot) []string {
+	rules := []string{}
+	for _, v := range slot.Violations {
+		rules = append(rules, v.Rule)
+	}
+	return rules
+}
+
+// Test a late shift at the end of one week and an early shift at the start
+// of the next are flagged in both weeks.
+func TestCheckRules_LateToEarlyAcrossWeeks(t *testing.T) {
+	staff := &StaffMember{ID: uuid.New(), FirstName: "Sam", IdealShifts: 5}
+	previous, week, next := newRuleWeek(0), newRuleWeek(1), newRuleWeek(2)
+	rosterOn(previous, 6, "Late", staff)
+	early := rosterOn(week, 0, "Early", staff)
+	late := rosterOn(week, 6, "Late", staff)
+	rosterOn(next, 0, "Early", staff)
+
+	week.CheckRules([]*StaffMember{staff}, previous, next)
+	for _, slot := range []*Slot{early, late} {
+		if slot.Flag != LateToEarly || !strings.Contains(slot.ViolationSummary(), "Sam") {
+			t.Errorf("expected %s to be flagged late to early, got %v %+v", slot.Name, slot.Flag, slot.Violations)
+		}
+	}
+	if v := previous.Days[6].Rows[0].GetSlot("Late").Violations; v != nil {
+		t.Errorf("expected the previous week to be left alone, got %+v", v)
+	}
+
+	week.CheckRules([]*StaffMember{staff}, nil, nil)
+	if early.Flag != None || late.Flag != None {
+		t.Error("expected no flags without the weeks either side")
+	}
+}
+
+// Test a slot lists every rule it breaks, and only configured rules are
+// checked.
+func TestCheckRules_EveryViolation(t *testing.T) {
+	defer SetRuleConfig(ruleConfig)
+	config := DefaultRuleConfig
+	config.MaxConsecutiveDays, config.MaxShiftsPerWeek = 3, 4
+	SetRuleConfig(config)
+
+	week := newRuleWeek(0)
+	leaveStart := utils.WeekStartFromOffset(0).AddDate(0, 0, 1)
+	leaveEnd := leaveStart.AddDate(0, 0, 1)
+	amy := &StaffMember{ID: uuid.New(), FirstName: "Amy", IdealShifts: 7, LeaveRequests: []LeaveRequest{{
+		Status:    LeaveApproved,
+		StartDate: CustomDate{Time: &leaveStart},
+		EndDate:   CustomDate{Time: &leaveEnd},
+	}}}
+	rosterOn(week, 0, "Late", amy)
+	onLeave := rosterOn(week, 1, "Early", amy)
+	rosterOn(week, 2, "Mid", amy)
+	fourth := rosterOn(week, 3, "Mid", amy)
+	fifth := rosterOn(week, 4, "Mid", amy)
+
+	kid := &StaffMember{ID: uuid.New(), FirstName: "Kid", IdealShifts: 1, IsMinor: true}
+	lateKid := rosterOn(week, 5, "Late", kid)
+	midKid := rosterOn(week, 6, "Mid", kid)
+
+	week.CheckRules([]*StaffMember{amy, kid}, nil, nil)
+	if got := strings.Join(violatedRules(onLeave), ","); got != "leave,late-to-early,min-rest" {
+		t.Errorf("expected the shift on leave after a late to break three rules, got %s: %+v", got, onLeave.Violations)
+	}
+	if onLeave.Flag != LeaveConflict {
+		t.Errorf("expected the leave conflict to colour the slot, got %v", onLeave.Flag)
+	}
+	if v := onLeave.Violations[0]; v.StaffID != amy.ID || !v.Date.Equal(leaveStart) {
+		t.Errorf("expected the violation to name Amy and the day, got %+v", v)
+	}
+	if summary := onLeave.ViolationSummary(); !strings.HasPrefix(summary, "Error: Amy is on approved leave\nWarning: ") {
+		t.Errorf("expected every violation in the summary, got %q", summary)
+	}
+	if got := strings.Join(violatedRules(fourth), ","); got != "max-consecutive-days" {
+		t.Errorf("expected the fourth day in a row to be flagged, got %s", got)
+	}
+	if got := strings.Join(violatedRules(fifth), ","); got != "max-consecutive-days,max-shifts" {
+		t.Errorf("expected the fifth shift to break both limits, got %s", got)
+	}
+	if got := strings.Join(violatedRules(lateKid), ","); got != "minors,ideal-shifts" {
+		t.Errorf("expected the minor's late shift to be flagged, got %s", got)
+	}
+	if !strings.Contains(lateKid.ViolationSummary(), "02:00") {
+		t.Errorf("expected the finish time in the message, got %q", lateKid.ViolationSummary())
+	}
+	if got := strings.Join(violatedRules(midKid), ","); got != "ideal-shifts" {
+		t.Errorf("expected the minor's mid shift to finish in time, got %s", got)
+	}
+	if SlotColour("#fff", *fourth) != "#FF9999" {
+		t.Errorf("expected a warning without a flag to be coloured by severity, got %s", SlotColour("#fff", *fourth))
+	}
+}
+
+// Test a start time that could be morning or evening isn't used for the rules
+// that need one.
+func TestCheckRules_AmbiguousStartTime(t *testing.T) {
+	week := newRuleWeek(0)
+	kid := &StaffMember{ID: uuid.New(), FirstName: "Kid", IdealShifts: 1, IsMinor: true}
+	late := rosterOn(week, 2, "Late", kid)
+	late.StartTime = "6:30"
+	week.CheckRules([]*StaffMember{kid}, nil, nil)
+	if len(late.Violations) != 0 {
+		t.Errorf("expected no rules to guess at the start time, got %+v", late.Violations)
+	}
+	late.StartTime = "6:30pm"
+	week.CheckRules([]*StaffMember{kid}, nil, nil)
+	if got := strings.Join(violatedRules(late), ","); got != "minors" {
+		t.Errorf("expected the minor's evening shift to be flagged, got %s", got)
+	}
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is a signed in browser. Its ID is the token kept in the client's
+// session cookie.
+type Session struct {
+	ID        uuid.UUID `bson:"id"`
+	StaffID   uuid.UUID `bson:"staffId"`
+	CreatedAt time.Time `bson:"createdAt"`
+	LastSeen  time.Time `bson:"lastSeen"`
+	// ExpiresAt is when the session ends however recently it was used.
+	ExpiresAt time.Time `bson:"expiresAt"`
+	UserAgent string    `bson:"userAgent"`
+}
+
+// IdleExpiresAt is when the session ends if it isn't used again.
+func (s Session) IdleExpiresAt(idleTimeout time.Duration) time.Time {
+	idle := s.LastSeen.Add(idleTimeout)
+	if idle.Before(s.ExpiresAt) {
+		return idle
+	}
+	return s.ExpiresAt
+}
+
+// Active reports whether the session can still be used at now.
+func (s Session) Active(now time.Time, idleTimeout time.Duration) bool {
+	return now.Before(s.IdleExpiresAt(idleTimeout))
+}
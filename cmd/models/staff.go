@@ -3,23 +3,31 @@ package models
 import (
 	"encoding/json"
 	"roster/cmd/utils"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
 )
 
-// StaffRole represents a user's privilege level.
+// StaffRole identifies the role a staff member has been given, which decides
+// their permissions. The values are stored, so new roles must be added at the
+// end.
 type StaffRole int
 
 const (
 	Staff StaffRole = iota
 	Manager
 	AdminRole
+	KitchenLead
+	Bookkeeper
 )
 
 func (r StaffRole) String() string {
-	return [...]string{"Staff", "Manager", "Admin"}[r]
+	if role, ok := r.Role(); ok {
+		return role.Name
+	}
+	return "Unknown"
 }
 
 // LeaveStatus represents the approval state of a leave request.
@@ -48,25 +56,55 @@ func (s LeaveStatus) String() string {
 type StaffMember struct {
 	ID uuid.UUID
 	// LegacyIsAdmin is kept for migration/back-compat with old DBs.
-	IsAdmin       bool
-	Role          StaffRole
-	IsTrial       bool
-	IsHidden      bool
-	IsKitchen     bool
-	GoogleID      string
-	NickName      string
-	FirstName     string
-	LastName      string
-	Email         string
-	Phone         string
-	ContactName   string
-	ContactPhone  string
-	IdealShifts   int
-	Availability  []DayAvailability
+	IsAdmin   bool
+	Role      StaffRole
+	IsTrial   bool
+	IsHidden  bool
+	IsKitchen bool
+	// IsMinor is set for staff under 18, who can't work late.
+	IsMinor bool
+	// GoogleID is the legacy Google account ID, moved to Identities by
+	// migration 4.
+	GoogleID string
+	// Identities are the accounts the staff member can log in with.
+	Identities   []Identity
+	NickName     string
+	FirstName    string
+	LastName     string
+	Email        string
+	Phone        string
+	ContactName  string
+	ContactPhone string
+	IdealShifts  int
+	Availability []DayAvailability
+	// Tokens are legacy session tokens, moved to the sessions store by
+	// migration 3.
 	Tokens        []uuid.UUID
 	LeaveRequests []LeaveRequest
 	Config        StaffConfig
 	IsDeleted     bool
+	// Scope limits the permissions the staff member's role grants for the
+	// current request, such as to those of the API token it was made with.
+	// Nil means no limit. It is never stored.
+	Scope []Permission `bson:"-" json:"-"`
+}
+
+// Identity is an account with an identity provider, identified by the
+// provider's name and the provider's ID for the account.
+type Identity struct {
+	Provider string
+	Subject  string
+}
+
+// HasIdentity reports whether the staff member can log in with identity.
+func (s StaffMember) HasIdentity(identity Identity) bool {
+	return slices.Contains(s.Identities, identity)
+}
+
+// HasProvider reports whether the staff member has an identity with the
+// named provider.
+func (s StaffMember) HasProvider(provider string) bool {
+	return slices.ContainsFunc(s.Identities, func(i Identity) bool { return i.Provider == provider })
 }
 
 // StaffConfig defines configuration data for staff.
@@ -84,10 +122,70 @@ type StaffConfig struct {
 
 // DayAvailability represents a staff member's availability on a given day.
 type DayAvailability struct {
-	Name  string
-	Early bool
-	Mid   bool
-	Late  bool
+	Name string
+	// Unavailable lists the shifts, by name, the staff member can't work.
+	// They are available for any shift not listed.
+	Unavailable SlotNameList
+}
+
+// IsAvailable reports whether the staff member can work the named shift.
+func (d DayAvailability) IsAvailable(slot string) bool {
+	return !d.Unavailable.Contains(slot)
+}
+
+// legacyUnavailable returns the shifts unticked in availability saved before
+// shifts could be configured, which had a flag for each of early, mid and
+// late.
+func legacyUnavailable(early *bool, mid *bool, late *bool) SlotNameList {
+	unavailable := SlotNameList{}
+	for i, available := range []*bool{early, mid, late} {
+		if available != nil && !*available {
+			unavailable = append(unavailable, LegacySlots[i].Name)
+		}
+	}
+	return unavailable
+}
+
+// UnmarshalBSON reads availability saved before shifts could be configured
+// as well as current availability.
+func (d *DayAvailability) UnmarshalBSON(data []byte) error {
+	type Alias DayAvailability
+	aux := &struct {
+		*Alias `bson:",inline"`
+		Early  *bool `bson:"early"`
+		Mid    *bool `bson:"mid"`
+		Late   *bool `bson:"late"`
+	}{
+		Alias: (*Alias)(d),
+	}
+	if err := bson.Unmarshal(data, aux); err != nil {
+		return err
+	}
+	if d.Unavailable == nil {
+		d.Unavailable = legacyUnavailable(aux.Early, aux.Mid, aux.Late)
+	}
+	return nil
+}
+
+// UnmarshalJSON reads availability from backups made before shifts could be
+// configured as well as current availability.
+func (d *DayAvailability) UnmarshalJSON(data []byte) error {
+	type Alias DayAvailability
+	aux := &struct {
+		*Alias
+		Early *bool
+		Mid   *bool
+		Late  *bool
+	}{
+		Alias: (*Alias)(d),
+	}
+	if err := json.Unmarshal(data, aux); err != nil {
+		return err
+	}
+	if d.Unavailable == nil {
+		d.Unavailable = legacyUnavailable(aux.Early, aux.Mid, aux.Late)
+	}
+	return nil
 }
 
 // LeaveRequest defines a leave request.
@@ -176,8 +274,21 @@ func (s *StaffMember) UnmarshalBSON(data []byte) error {
 	return nil
 }
 
+// MarshalJSON writes an unset CustomDate as null rather than panicking on the
+// nil time.
+func (cd CustomDate) MarshalJSON() ([]byte, error) {
+	if cd.Time == nil {
+		return []byte("null"), nil
+	}
+	return cd.Time.MarshalJSON()
+}
+
 // UnmarshalJSON implements custom JSON unmarshalling for CustomDate.
 func (cd *CustomDate) UnmarshalJSON(input []byte) error {
+	if string(input) == "null" {
+		cd.Time = nil
+		return nil
+	}
 	// Unmarshal into a string first.
 	var strInput string
 	if err := json.Unmarshal(input, &strInput); err != nil {
@@ -216,31 +327,28 @@ func GetStaffFromList(staffID uuid.UUID, allStaff []*StaffMember) *StaffMember {
 	return nil
 }
 
-func (staff *StaffMember) GetConflict(slot string, offset int) Highlight {
-	if !staff.Availability[offset].Early &&
-		!staff.Availability[offset].Mid &&
-		!staff.Availability[offset].Late {
+// GetConflict returns whether the staff member's availability on the day
+// offset days into the week rules out the named shift. slots are all of the
+// week's shifts, to tell whether the staff member refused the whole day.
+func (staff *StaffMember) GetConflict(slot string, offset int, slots SlotNameList) Highlight {
+	availability := staff.Availability[offset]
+	refused := len(slots) > 0
+	for _, name := range slots {
+		if availability.IsAvailable(name) {
+			refused = false
+		}
+	}
+	if refused {
 		return PrefRefuse
 	}
-	switch slot {
-	case "Early":
-		if !staff.Availability[offset].Early {
-			return PrefConflict
-		}
-	case "Mid":
-		if !staff.Availability[offset].Mid {
-			return PrefConflict
-		}
-	case "Late":
-		if !staff.Availability[offset].Late {
-			return PrefConflict
-		}
+	if !availability.IsAvailable(slot) {
+		return PrefConflict
 	}
 	return None
 }
 
-func (staff *StaffMember) HasConflict(slot string, offset int) bool {
-	conflict := staff.GetConflict(slot, offset)
+func (staff *StaffMember) HasConflict(slot string, offset int, slots SlotNameList) bool {
+	conflict := staff.GetConflict(slot, offset, slots)
 	return conflict == PrefConflict || conflict == PrefRefuse
 }
 
@@ -256,14 +364,14 @@ func (staff *StaffMember) IsAway(date time.Time) bool {
 	return false
 }
 
-func (s StaffMember) IsManagerRole() bool {
-	return s.Role >= Manager
-}
-
-func (s StaffMember) IsAdminRole() bool {
-	return s.Role >= AdminRole
-}
-
 func (s StaffMember) RoleLabel() string {
 	return s.Role.String()
 }
+
+// RosterName is the name shown for the staff member on the roster.
+func (s StaffMember) RosterName() string {
+	if s.NickName != "" {
+		return s.NickName
+	}
+	return s.FirstName
+}
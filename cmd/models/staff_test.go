@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -26,24 +27,63 @@ func TestGetStaffFromList(t *testing.T) {
 func TestGetConflict(t *testing.T) {
 	base := StaffMember{
 		Availability: []DayAvailability{
-			{Name: "Day0", Early: false, Mid: false, Late: false},
-			{Name: "Day1", Early: true, Mid: false, Late: true},
+			{Name: "Day0", Unavailable: SlotNameList{"Early", "Mid", "Late"}},
+			{Name: "Day1", Unavailable: SlotNameList{"Mid"}},
 		},
 	}
+	slots := SlotNames(LegacySlots)
 	// fully unavailable
-	if got := base.GetConflict("Early", 0); got != PrefRefuse {
+	if got := base.GetConflict("Early", 0, slots); got != PrefRefuse {
 		t.Errorf("expected PrefRefuse, got %v", got)
 	}
 	// conflict slot
-	if got := base.GetConflict("Mid", 1); got != PrefConflict {
+	if got := base.GetConflict("Mid", 1, slots); got != PrefConflict {
 		t.Errorf("expected PrefConflict, got %v", got)
 	}
 	// no conflict
-	if got := base.GetConflict("Late", 1); got != None {
+	if got := base.GetConflict("Late", 1, slots); got != None {
 		t.Errorf("expected None, got %v", got)
 	}
 }
 
+// A shift not in the week's list is only a conflict if it was unticked.
+func TestGetConflict_ConfiguredShifts(t *testing.T) {
+	staff := StaffMember{Availability: []DayAvailability{{Name: "Tuesday", Unavailable: SlotNameList{"brunch"}}}}
+	slots := SlotNameList{"Brunch", "Dinner"}
+	if got := staff.GetConflict("Brunch", 0, slots); got != PrefConflict {
+		t.Errorf("expected PrefConflict, got %v", got)
+	}
+	if got := staff.GetConflict("Dinner", 0, slots); got != None {
+		t.Errorf("expected None, got %v", got)
+	}
+	if got := staff.GetConflict("Brunch", 0, SlotNameList{"Brunch"}); got != PrefRefuse {
+		t.Errorf("expected PrefRefuse when every shift is unticked, got %v", got)
+	}
+}
+
+// Availability saved with early, mid and late flags must load as the shifts
+// that were unticked.
+func TestDayAvailabilityUnmarshal_Legacy(t *testing.T) {
+	data, err := bson.Marshal(bson.M{"name": "Tuesday", "early": true, "mid": false, "late": false})
+	if err != nil {
+		t.Fatalf("bson.Marshal: %v", err)
+	}
+	var day DayAvailability
+	if err := bson.Unmarshal(data, &day); err != nil {
+		t.Fatalf("bson.Unmarshal: %v", err)
+	}
+	if day.Name != "Tuesday" || !day.IsAvailable("Early") || day.IsAvailable("Mid") || day.IsAvailable("Late") {
+		t.Errorf("expected only early availability, got %+v", day)
+	}
+	var fromJSON DayAvailability
+	if err := json.Unmarshal([]byte(`{"Name":"Monday","Early":false,"Mid":true,"Late":true}`), &fromJSON); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if fromJSON.IsAvailable("Early") || !fromJSON.IsAvailable("Late") {
+		t.Errorf("expected early to be unavailable, got %+v", fromJSON)
+	}
+}
+
 func TestCustomDateUnmarshalJSON(t *testing.T) {
 	tests := []struct {
 		input string
@@ -53,6 +93,7 @@ func TestCustomDateUnmarshalJSON(t *testing.T) {
 		{`"2006-01-02"`, true},
 		{`"15:04"`, true},
 		{`"invalid-date"`, false},
+		{`null`, false},
 	}
 	for _, tc := range tests {
 		var cd CustomDate
@@ -72,6 +113,25 @@ func TestCustomDateUnmarshalJSON(t *testing.T) {
 	}
 }
 
+func TestCustomDateMarshalJSON_RoundTrip(t *testing.T) {
+	now := time.Date(2021, 12, 25, 9, 30, 0, 0, time.Local)
+	in := LeaveRequest{ID: uuid.New(), StartDate: CustomDate{&now}}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var out LeaveRequest
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if out.StartDate.Time == nil || !out.StartDate.Equal(now) {
+		t.Errorf("StartDate = %v; want %v", out.StartDate.Time, now)
+	}
+	if out.EndDate.Time != nil {
+		t.Errorf("expected unset EndDate to stay nil, got %v", out.EndDate.Time)
+	}
+}
+
 func TestBSONMarshalUnmarshal_RoundTrip(t *testing.T) {
 	now := time.Date(2021, 12, 25, 0, 0, 0, 0, time.Local)
 	lr := LeaveRequest{
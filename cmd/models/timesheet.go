@@ -10,9 +10,8 @@ import (
 )
 
 type TimesheetEntry struct {
-	ID uuid.UUID
-	// TODO: Fucked up the name
-	StaffID    uuid.UUID `bson:"days"`
+	ID         uuid.UUID
+	StaffID    uuid.UUID `bson:"staffId"`
 	WeekOffset int       `bson:"weekOffset"`
 	DayOffset  int       `bson:"dayOffset"`
 
@@ -126,12 +125,17 @@ func StringToShiftType(typeStr string) ShiftType {
 	return ShiftType(num)
 }
 
+// Date returns the day the entry's shift was worked.
+func (e TimesheetEntry) Date() time.Time {
+	return utils.WeekStartFromOffset(e.WeekOffset).AddDate(0, 0, e.DayOffset)
+}
+
 func DisableTimesheet(timesheetDate time.Time, isAdmin bool) bool {
-	lastTuesday := utils.GetLastTuesday().Add(-time.Minute) // Inclusive
+	weekStart := utils.GetWeekStart().Add(-time.Minute) // Inclusive
 	now := time.Now()
-	if now.Sub(lastTuesday).Hours() < 12 {
+	if now.Sub(weekStart).Hours() < 12 {
 		// 12 hour overlap between weeks
-		lastTuesday = lastTuesday.AddDate(0, 0, -7)
+		weekStart = weekStart.AddDate(0, 0, -7)
 	}
 	tomorrow := time.Date(
 		now.Year(),
@@ -143,7 +147,7 @@ func DisableTimesheet(timesheetDate time.Time, isAdmin bool) bool {
 		// early morning shift date is the day before
 		tomorrow = tomorrow.AddDate(0, 0, -1)
 	}
-	if timesheetDate.After(lastTuesday) && timesheetDate.Before(tomorrow) {
+	if timesheetDate.After(weekStart) && timesheetDate.Before(tomorrow) {
 		return false
 	}
 	return !isAdmin
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"roster/cmd/models"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// APITokenRepository defines persistence operations for personal API tokens.
+// Revoking a token deletes it.
+type APITokenRepository interface {
+	CreateAPIToken(ctx context.Context, token models.APIToken) error
+	// GetAPITokenByHash returns the token with the given hash, or
+	// ErrNotFound.
+	GetAPITokenByHash(ctx context.Context, tokenHash string) (*models.APIToken, error)
+	// FindStaffAPITokens returns a staff member's tokens, newest first.
+	FindStaffAPITokens(ctx context.Context, staffID uuid.UUID) ([]*models.APIToken, error)
+	// TouchAPIToken records that the token was used at lastUsed.
+	TouchAPIToken(ctx context.Context, id uuid.UUID, lastUsed time.Time) error
+	DeleteAPIToken(ctx context.Context, id uuid.UUID) error
+}
+
+// MongoAPITokenRepository implements APITokenRepository using MongoDB.
+type MongoAPITokenRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoAPITokenRepository creates a new instance of
+// MongoAPITokenRepository.
+func NewMongoAPITokenRepository(db *mongo.Database) *MongoAPITokenRepository {
+	return &MongoAPITokenRepository{
+		collection: db.Collection("apiTokens"),
+	}
+}
+
+func (r *MongoAPITokenRepository) CreateAPIToken(ctx context.Context, token models.APIToken) error {
+	if _, err := r.collection.InsertOne(ctx, token); err != nil {
+		return fmt.Errorf("CreateAPIToken: %w", err)
+	}
+	return nil
+}
+
+func (r *MongoAPITokenRepository) GetAPITokenByHash(ctx context.Context, tokenHash string) (*models.APIToken, error) {
+	var token models.APIToken
+	if err := r.collection.FindOne(ctx, bson.M{"tokenHash": tokenHash}).Decode(&token); err != nil {
+		return nil, fmt.Errorf("GetAPITokenByHash: %w", err)
+	}
+	localAPITokenTimes(&token)
+	return &token, nil
+}
+
+func (r *MongoAPITokenRepository) FindStaffAPITokens(ctx context.Context, staffID uuid.UUID) ([]*models.APIToken, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"staffId": staffID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("FindStaffAPITokens: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	tokens := []*models.APIToken{}
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, fmt.Errorf("FindStaffAPITokens: %w", err)
+	}
+	for _, token := range tokens {
+		localAPITokenTimes(token)
+	}
+	return tokens, nil
+}
+
+func (r *MongoAPITokenRepository) TouchAPIToken(ctx context.Context, id uuid.UUID, lastUsed time.Time) error {
+	res, err := r.collection.UpdateOne(ctx, bson.M{"id": id}, bson.M{"$set": bson.M{"lastUsedAt": lastUsed}})
+	if err != nil {
+		return fmt.Errorf("TouchAPIToken: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("TouchAPIToken: %w", ErrNotFound)
+	}
+	return nil
+}
+
+func (r *MongoAPITokenRepository) DeleteAPIToken(ctx context.Context, id uuid.UUID) error {
+	if _, err := r.collection.DeleteOne(ctx, bson.M{"id": id}); err != nil {
+		return fmt.Errorf("DeleteAPIToken: %w", err)
+	}
+	return nil
+}
+
+// localAPITokenTimes converts the UTC times the database returns back into
+// local time.
+func localAPITokenTimes(t *models.APIToken) {
+	t.CreatedAt = t.CreatedAt.Local()
+	if !t.LastUsedAt.IsZero() {
+		t.LastUsedAt = t.LastUsedAt.Local()
+	}
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"roster/cmd/models"
+	"roster/cmd/utils"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditRepository defines persistence operations for the audit log. Entries
+// are only ever appended.
+type AuditRepository interface {
+	RecordAudit(ctx context.Context, entry models.AuditEntry) error
+	FindAuditEntries(ctx context.Context, filter AuditFilter) ([]*models.AuditEntry, error)
+}
+
+// AuditFilter narrows FindAuditEntries. Zero valued fields match everything.
+type AuditFilter struct {
+	ActorID    *uuid.UUID
+	EntityType string
+	EntityID   *uuid.UUID
+	Action     string
+	// From and To bound the timestamp, inclusive of From and exclusive of To.
+	From  time.Time
+	To    time.Time
+	Limit int
+}
+
+// matches reports whether e passes the filter, ignoring Limit.
+func (f AuditFilter) matches(e *models.AuditEntry) bool {
+	switch {
+	case f.ActorID != nil && e.ActorID != *f.ActorID:
+		return false
+	case f.EntityType != "" && e.EntityType != f.EntityType:
+		return false
+	case f.EntityID != nil && e.EntityID != *f.EntityID:
+		return false
+	case f.Action != "" && e.Action != f.Action:
+		return false
+	case !f.From.IsZero() && e.Timestamp.Before(f.From):
+		return false
+	case !f.To.IsZero() && !e.Timestamp.Before(f.To):
+		return false
+	}
+	return true
+}
+
+// MongoAuditRepository implements AuditRepository using MongoDB.
+type MongoAuditRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoAuditRepository creates a new instance of MongoAuditRepository.
+func NewMongoAuditRepository(db *mongo.Database) *MongoAuditRepository {
+	return &MongoAuditRepository{
+		collection: db.Collection("audit"),
+	}
+}
+
+func (r *MongoAuditRepository) RecordAudit(ctx context.Context, entry models.AuditEntry) error {
+	if _, err := r.collection.InsertOne(ctx, entry); err != nil {
+		utils.PrintError(err, "Failed to record audit entry")
+		return err
+	}
+	return nil
+}
+
+// FindAuditEntries returns the entries matching filter, newest first.
+func (r *MongoAuditRepository) FindAuditEntries(ctx context.Context, filter AuditFilter) ([]*models.AuditEntry, error) {
+	query := bson.M{}
+	if filter.ActorID != nil {
+		query["actorId"] = *filter.ActorID
+	}
+	if filter.EntityType != "" {
+		query["entityType"] = filter.EntityType
+	}
+	if filter.EntityID != nil {
+		query["entityId"] = *filter.EntityID
+	}
+	if filter.Action != "" {
+		query["action"] = filter.Action
+	}
+	timestamp := bson.M{}
+	if !filter.From.IsZero() {
+		timestamp["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		timestamp["$lt"] = filter.To
+	}
+	if len(timestamp) > 0 {
+		query["timestamp"] = timestamp
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(int64(filter.Limit))
+	}
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		utils.PrintError(err, "Error finding audit entries")
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := []*models.AuditEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		utils.PrintError(err, "Error decoding audit entries")
+		return nil, err
+	}
+	for _, e := range entries {
+		e.Timestamp = e.Timestamp.Local()
+	}
+	return entries, nil
+}
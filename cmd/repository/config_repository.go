@@ -13,29 +13,30 @@ import (
 
 // ConfigRepository defines persistence operations for server config.
 type ConfigRepository interface {
-	SaveVersion(v models.Version) error
-	LoadVersion() (*models.Version, error)
+	SaveVersion(ctx context.Context, v models.Version) error
+	LoadVersion(ctx context.Context) (*models.Version, error)
+	// LoadVersionByID returns the version record with the given ID, or
+	// ErrNotFound if it has never been saved.
+	LoadVersionByID(ctx context.Context, id string) (*models.Version, error)
 }
 
 // MongoConfigRepository implements ConfigRepository using MongoDB.
 type MongoConfigRepository struct {
 	collection *mongo.Collection
-	ctx        context.Context
 }
 
 // NewMongoTimesheetRepository creates a new instance of MongoTimesheetRepository.
-func NewMongoConfigRepository(ctx context.Context, db *mongo.Database) *MongoConfigRepository {
+func NewMongoConfigRepository(db *mongo.Database) *MongoConfigRepository {
 	return &MongoConfigRepository{
 		collection: db.Collection("server"),
-		ctx:        ctx,
 	}
 }
 
-func (r *MongoConfigRepository) SaveVersion(v models.Version) error {
+func (r *MongoConfigRepository) SaveVersion(ctx context.Context, v models.Version) error {
 	filter := bson.M{"id": v.ID}
 	update := bson.M{"$set": v}
 	opts := options.Update().SetUpsert(true)
-	_, err := r.collection.UpdateOne(r.ctx, filter, update, opts)
+	_, err := r.collection.UpdateOne(ctx, filter, update, opts)
 	if err != nil {
 		utils.PrintError(err, "Failed to save version")
 		return err
@@ -44,9 +45,9 @@ func (r *MongoConfigRepository) SaveVersion(v models.Version) error {
 	return nil
 }
 
-func (r *MongoConfigRepository) LoadVersion() (*models.Version, error) {
+func (r *MongoConfigRepository) LoadVersion(ctx context.Context) (*models.Version, error) {
 	var version models.Version
-	err := r.collection.FindOne(r.ctx, bson.M{"id": "version"}).Decode(&version)
+	err := r.collection.FindOne(ctx, bson.M{"id": "version"}).Decode(&version)
 
 	if err != nil {
 		if err != mongo.ErrNoDocuments {
@@ -61,7 +62,7 @@ func (r *MongoConfigRepository) LoadVersion() (*models.Version, error) {
 	}
 	if version.ID != "version" {
 		// Fix up borked databases
-		_, err := r.collection.DeleteMany(r.ctx, bson.M{})
+		_, err := r.collection.DeleteMany(ctx, bson.M{})
 		if err != nil {
 			utils.PrintError(err, "Error deleting versions")
 			return nil, err
@@ -71,7 +72,7 @@ func (r *MongoConfigRepository) LoadVersion() (*models.Version, error) {
 			ID:      "version",
 			Version: 2,
 		}
-		_, err = r.collection.InsertOne(r.ctx, version)
+		_, err = r.collection.InsertOne(ctx, version)
 		if err != nil {
 			utils.PrintError(err, "Error inserting new version")
 			return nil, err
@@ -79,3 +80,14 @@ func (r *MongoConfigRepository) LoadVersion() (*models.Version, error) {
 	}
 	return &version, nil
 }
+
+func (r *MongoConfigRepository) LoadVersionByID(ctx context.Context, id string) (*models.Version, error) {
+	var version models.Version
+	if err := r.collection.FindOne(ctx, bson.M{"id": id}).Decode(&version); err != nil {
+		if err != mongo.ErrNoDocuments {
+			utils.PrintError(err, "Error reading version")
+		}
+		return nil, err
+	}
+	return &version, nil
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"roster/cmd/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// LoginLinkRepository defines persistence operations for single-use login
+// links.
+type LoginLinkRepository interface {
+	CreateLoginLink(ctx context.Context, link models.LoginLink) error
+	// ConsumeLoginLink deletes and returns the link with the given purpose
+	// and token hash, or returns ErrNotFound. Expired links are returned like
+	// any other, so callers must check ExpiresAt.
+	ConsumeLoginLink(ctx context.Context, purpose string, tokenHash string) (*models.LoginLink, error)
+	// DeleteExpiredLoginLinks removes links that expired before the given
+	// time, returning how many were removed.
+	DeleteExpiredLoginLinks(ctx context.Context, expiredBefore time.Time) (int64, error)
+}
+
+// MongoLoginLinkRepository implements LoginLinkRepository using MongoDB.
+type MongoLoginLinkRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoLoginLinkRepository creates a new instance of
+// MongoLoginLinkRepository.
+func NewMongoLoginLinkRepository(db *mongo.Database) *MongoLoginLinkRepository {
+	return &MongoLoginLinkRepository{
+		collection: db.Collection("loginLinks"),
+	}
+}
+
+func (r *MongoLoginLinkRepository) CreateLoginLink(ctx context.Context, link models.LoginLink) error {
+	if _, err := r.collection.InsertOne(ctx, link); err != nil {
+		return fmt.Errorf("CreateLoginLink: %w", err)
+	}
+	return nil
+}
+
+func (r *MongoLoginLinkRepository) ConsumeLoginLink(ctx context.Context, purpose string, tokenHash string) (*models.LoginLink, error) {
+	var link models.LoginLink
+	filter := bson.M{"purpose": purpose, "tokenHash": tokenHash}
+	if err := r.collection.FindOneAndDelete(ctx, filter).Decode(&link); err != nil {
+		return nil, fmt.Errorf("ConsumeLoginLink: %w", err)
+	}
+	link.CreatedAt = link.CreatedAt.Local()
+	link.ExpiresAt = link.ExpiresAt.Local()
+	return &link, nil
+}
+
+func (r *MongoLoginLinkRepository) DeleteExpiredLoginLinks(ctx context.Context, expiredBefore time.Time) (int64, error) {
+	res, err := r.collection.DeleteMany(ctx, bson.M{"expiresAt": bson.M{"$lt": expiredBefore}})
+	if err != nil {
+		return 0, fmt.Errorf("DeleteExpiredLoginLinks: %w", err)
+	}
+	return res.DeletedCount, nil
+}
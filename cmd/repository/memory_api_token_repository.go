@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"roster/cmd/models"
+
+	"github.com/google/uuid"
+)
+
+// MemoryAPITokenRepository implements APITokenRepository in process memory.
+type MemoryAPITokenRepository struct {
+	mu     sync.RWMutex
+	tokens map[uuid.UUID]models.APIToken
+}
+
+// NewMemoryAPITokenRepository creates a new, empty MemoryAPITokenRepository.
+func NewMemoryAPITokenRepository() *MemoryAPITokenRepository {
+	return &MemoryAPITokenRepository{tokens: map[uuid.UUID]models.APIToken{}}
+}
+
+func (r *MemoryAPITokenRepository) CreateAPIToken(ctx context.Context, token models.APIToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tokens[token.ID]; ok {
+		return fmt.Errorf("CreateAPIToken: token %v already exists", token.ID)
+	}
+	token.Permissions = slices.Clone(token.Permissions)
+	r.tokens[token.ID] = token
+	return nil
+}
+
+func (r *MemoryAPITokenRepository) GetAPITokenByHash(ctx context.Context, tokenHash string) (*models.APIToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, token := range r.tokens {
+		if token.TokenHash == tokenHash {
+			token.Permissions = slices.Clone(token.Permissions)
+			return &token, nil
+		}
+	}
+	return nil, fmt.Errorf("GetAPITokenByHash: %w", ErrNotFound)
+}
+
+func (r *MemoryAPITokenRepository) FindStaffAPITokens(ctx context.Context, staffID uuid.UUID) ([]*models.APIToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tokens := []*models.APIToken{}
+	for _, token := range r.tokens {
+		if token.StaffID == staffID {
+			token.Permissions = slices.Clone(token.Permissions)
+			tokens = append(tokens, &token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+	return tokens, nil
+}
+
+func (r *MemoryAPITokenRepository) TouchAPIToken(ctx context.Context, id uuid.UUID, lastUsed time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token, ok := r.tokens[id]
+	if !ok {
+		return fmt.Errorf("TouchAPIToken: %w", ErrNotFound)
+	}
+	token.LastUsedAt = lastUsed
+	r.tokens[id] = token
+	return nil
+}
+
+func (r *MemoryAPITokenRepository) DeleteAPIToken(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tokens, id)
+	return nil
+}
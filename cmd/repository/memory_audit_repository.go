@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"roster/cmd/models"
+)
+
+// MemoryAuditRepository implements AuditRepository in process memory.
+type MemoryAuditRepository struct {
+	mu      sync.RWMutex
+	entries []models.AuditEntry
+}
+
+// NewMemoryAuditRepository creates a new, empty MemoryAuditRepository.
+func NewMemoryAuditRepository() *MemoryAuditRepository {
+	return &MemoryAuditRepository{}
+}
+
+func (r *MemoryAuditRepository) RecordAudit(ctx context.Context, entry models.AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+// FindAuditEntries returns the entries matching filter, newest first.
+func (r *MemoryAuditRepository) FindAuditEntries(ctx context.Context, filter AuditFilter) ([]*models.AuditEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entries := []*models.AuditEntry{}
+	// Entries are appended in time order, so walk them backwards.
+	for i := len(r.entries) - 1; i >= 0; i-- {
+		if filter.Limit > 0 && len(entries) == filter.Limit {
+			break
+		}
+		e := r.entries[i]
+		if filter.matches(&e) {
+			entries = append(entries, &e)
+		}
+	}
+	return entries, nil
+}
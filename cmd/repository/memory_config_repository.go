@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"roster/cmd/models"
+	"roster/cmd/utils"
+)
+
+// MemoryConfigRepository implements ConfigRepository in process memory.
+type MemoryConfigRepository struct {
+	mu       sync.RWMutex
+	versions map[string]models.Version
+}
+
+// NewMemoryConfigRepository creates a new, empty MemoryConfigRepository.
+func NewMemoryConfigRepository() *MemoryConfigRepository {
+	return &MemoryConfigRepository{
+		versions: map[string]models.Version{},
+	}
+}
+
+func (r *MemoryConfigRepository) SaveVersion(ctx context.Context, v models.Version) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.versions[v.ID] = v
+	utils.PrintLog("Saved version")
+	return nil
+}
+
+func (r *MemoryConfigRepository) LoadVersion(ctx context.Context) (*models.Version, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	version, ok := r.versions["version"]
+	if !ok {
+		utils.PrintLog("Creating new version")
+		version = models.Version{
+			ID:      "version",
+			Version: 1,
+		}
+	}
+	return &version, nil
+}
+
+func (r *MemoryConfigRepository) LoadVersionByID(ctx context.Context, id string) (*models.Version, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	version, ok := r.versions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &version, nil
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"roster/cmd/models"
+)
+
+// MemoryLoginLinkRepository implements LoginLinkRepository in process memory.
+type MemoryLoginLinkRepository struct {
+	mu    sync.Mutex
+	links map[string]models.LoginLink
+}
+
+// NewMemoryLoginLinkRepository creates a new, empty MemoryLoginLinkRepository.
+func NewMemoryLoginLinkRepository() *MemoryLoginLinkRepository {
+	return &MemoryLoginLinkRepository{links: map[string]models.LoginLink{}}
+}
+
+func (r *MemoryLoginLinkRepository) CreateLoginLink(ctx context.Context, link models.LoginLink) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.links[link.TokenHash]; ok {
+		return fmt.Errorf("CreateLoginLink: link already exists")
+	}
+	r.links[link.TokenHash] = link
+	return nil
+}
+
+func (r *MemoryLoginLinkRepository) ConsumeLoginLink(ctx context.Context, purpose string, tokenHash string) (*models.LoginLink, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	link, ok := r.links[tokenHash]
+	if !ok || link.Purpose != purpose {
+		return nil, fmt.Errorf("ConsumeLoginLink: %w", ErrNotFound)
+	}
+	delete(r.links, tokenHash)
+	return &link, nil
+}
+
+func (r *MemoryLoginLinkRepository) DeleteExpiredLoginLinks(ctx context.Context, expiredBefore time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deleted int64
+	for hash, link := range r.links {
+		if link.ExpiresAt.Before(expiredBefore) {
+			delete(r.links, hash)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
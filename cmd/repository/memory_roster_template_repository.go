@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"roster/cmd/models"
+
+	"github.com/google/uuid"
+)
+
+// MemoryRosterTemplateRepository implements RosterTemplateRepository in
+// process memory.
+type MemoryRosterTemplateRepository struct {
+	mu        sync.RWMutex
+	templates map[uuid.UUID]models.RosterTemplate
+}
+
+// NewMemoryRosterTemplateRepository creates a new, empty
+// MemoryRosterTemplateRepository.
+func NewMemoryRosterTemplateRepository() *MemoryRosterTemplateRepository {
+	return &MemoryRosterTemplateRepository{templates: map[uuid.UUID]models.RosterTemplate{}}
+}
+
+func (r *MemoryRosterTemplateRepository) SaveRosterTemplate(ctx context.Context, template models.RosterTemplate) error {
+	stored, err := cloneDocument(template)
+	if err != nil {
+		return fmt.Errorf("SaveRosterTemplate: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.templates[template.ID] = stored
+	return nil
+}
+
+func (r *MemoryRosterTemplateRepository) GetRosterTemplate(ctx context.Context, id uuid.UUID) (*models.RosterTemplate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	stored, ok := r.templates[id]
+	if !ok {
+		return nil, fmt.Errorf("GetRosterTemplate: %w", ErrNotFound)
+	}
+	template, err := cloneDocument(stored)
+	if err != nil {
+		return nil, fmt.Errorf("GetRosterTemplate: %w", err)
+	}
+	template.CreatedAt = template.CreatedAt.Local()
+	return &template, nil
+}
+
+func (r *MemoryRosterTemplateRepository) LoadAllRosterTemplates(ctx context.Context) ([]*models.RosterTemplate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	templates := []*models.RosterTemplate{}
+	for _, stored := range r.templates {
+		template, err := cloneDocument(stored)
+		if err != nil {
+			return nil, fmt.Errorf("LoadAllRosterTemplates: %w", err)
+		}
+		template.CreatedAt = template.CreatedAt.Local()
+		templates = append(templates, &template)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	return templates, nil
+}
+
+func (r *MemoryRosterTemplateRepository) DeleteRosterTemplate(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.templates, id)
+	return nil
+}
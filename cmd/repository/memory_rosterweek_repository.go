@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"roster/cmd/models"
+	"roster/cmd/utils"
+
+	"github.com/google/uuid"
+)
+
+// MemoryRosterWeekRepository implements RosterWeekRepository in process memory.
+type MemoryRosterWeekRepository struct {
+	mu    sync.RWMutex
+	order []uuid.UUID
+	weeks map[uuid.UUID]models.RosterWeek
+}
+
+// NewMemoryRosterWeekRepository creates a new, empty MemoryRosterWeekRepository.
+func NewMemoryRosterWeekRepository() *MemoryRosterWeekRepository {
+	return &MemoryRosterWeekRepository{
+		weeks: map[uuid.UUID]models.RosterWeek{},
+	}
+}
+
+// SaveRosterWeek stores a copy of a single roster week if its revision is
+// current, incrementing week.Revision.
+func (r *MemoryRosterWeekRepository) SaveRosterWeek(ctx context.Context, week *models.RosterWeek) error {
+	updated := *week
+	updated.Revision++
+	stored, err := cloneDocument(updated)
+	if err != nil {
+		return fmt.Errorf("failed to save roster week (id: %v): %w", week.ID, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if current, ok := r.weeks[week.ID]; ok && current.Revision != week.Revision {
+		return fmt.Errorf("failed to save roster week (id: %v): %w", week.ID, ErrRevisionConflict)
+	}
+	r.put(stored)
+	week.Revision = updated.Revision
+	return nil
+}
+
+// SaveAllRosterWeeks stores a copy of every given roster week without
+// checking revisions.
+func (r *MemoryRosterWeekRepository) SaveAllRosterWeeks(ctx context.Context, weeks []*models.RosterWeek) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, week := range weeks {
+		stored, err := cloneDocument(*week)
+		if err != nil {
+			return fmt.Errorf("failed to bulk save roster weeks: %w", err)
+		}
+		r.put(stored)
+	}
+	return nil
+}
+
+// put stores week; the caller must hold the write lock.
+func (r *MemoryRosterWeekRepository) put(week models.RosterWeek) {
+	if _, ok := r.weeks[week.ID]; !ok {
+		r.order = append(r.order, week.ID)
+	}
+	r.weeks[week.ID] = week
+}
+
+// LoadAllRosterWeeks returns copies of all stored roster weeks.
+func (r *MemoryRosterWeekRepository) LoadAllRosterWeeks(ctx context.Context) ([]*models.RosterWeek, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var weeks []*models.RosterWeek
+	for _, id := range r.order {
+		week, err := cloneDocument(r.weeks[id])
+		if err != nil {
+			utils.PrintError(err, "Error decoding roster week")
+			continue
+		}
+		weeks = append(weeks, &week)
+	}
+	return weeks, nil
+}
+
+// LoadRosterWeek returns the week with the given offset, creating and saving
+// an empty one if it does not exist yet.
+func (r *MemoryRosterWeekRepository) LoadRosterWeek(ctx context.Context, weekOffset int) (*models.RosterWeek, error) {
+	week, err := r.GetRosterWeek(ctx, weekOffset)
+	if !errors.Is(err, ErrNotFound) {
+		return week, err
+	}
+
+	utils.PrintLog("Creating new roster week")
+	newWeek := newRosterWeek(weekOffset)
+	if err := r.SaveRosterWeek(ctx, &newWeek); err != nil {
+		return nil, fmt.Errorf("failed to save new roster week: %w", err)
+	}
+	return &newWeek, nil
+}
+
+// GetRosterWeek returns the week with the given offset, or ErrNotFound.
+func (r *MemoryRosterWeekRepository) GetRosterWeek(ctx context.Context, weekOffset int) (*models.RosterWeek, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, id := range r.order {
+		if stored := r.weeks[id]; stored.WeekOffset == weekOffset {
+			week, err := cloneDocument(stored)
+			if err != nil {
+				return nil, fmt.Errorf("error loading roster week: %w", err)
+			}
+			return &week, nil
+		}
+	}
+	return nil, fmt.Errorf("GetRosterWeek: %w", ErrNotFound)
+}
+
+// ChangeDayRowCount adds ("+") or removes (any other action) the last row of
+// a specific RosterDay. Days never shrink below minDayRows. Returns the
+// affected day, the roster week's live status and an error if applicable.
+func (r *MemoryRosterWeekRepository) ChangeDayRowCount(ctx context.Context, weekOffset int, dayID uuid.UUID, action string) (*models.RosterDay, bool, error) {
+	if _, err := r.LoadRosterWeek(ctx, weekOffset); err != nil {
+		return nil, false, fmt.Errorf("failed to load roster week for modifying row count: %w", err)
+	}
+	var isLive bool
+	var affected *models.RosterDay
+	err := r.update(weekOffset, func(week *models.RosterWeek) error {
+		isLive = week.IsLive
+		day := week.GetDayByID(dayID)
+		if day == nil {
+			return fmt.Errorf("no roster day found with id: %v", dayID)
+		}
+		if action == "+" {
+			day.Rows = append(day.Rows, models.NewRow(week.Slots))
+		} else if len(day.Rows) > minDayRows {
+			day.Rows = day.Rows[:len(day.Rows)-1]
+		}
+		copied, err := cloneDocument(*day)
+		if err != nil {
+			return err
+		}
+		affected = &copied
+		return nil
+	})
+	if err != nil {
+		return nil, isLive, err
+	}
+	return affected, isLive, nil
+}
+
+func (r *MemoryRosterWeekRepository) UpdateSlotAssignment(ctx context.Context, weekOffset int, slotID uuid.UUID, staffID *uuid.UUID, staffString *string) (int, error) {
+	return r.updateSlot(weekOffset, slotID, func(slot *models.Slot) {
+		slot.AssignedStaff = staffID
+		slot.StaffString = staffString
+	})
+}
+
+func (r *MemoryRosterWeekRepository) UpdateSlotStartTime(ctx context.Context, weekOffset int, slotID uuid.UUID, startTime string) (int, error) {
+	return r.updateSlot(weekOffset, slotID, func(slot *models.Slot) {
+		slot.StartTime = startTime
+	})
+}
+
+func (r *MemoryRosterWeekRepository) UpdateSlotDescription(ctx context.Context, weekOffset int, slotID uuid.UUID, description string) (int, error) {
+	return r.updateSlot(weekOffset, slotID, func(slot *models.Slot) {
+		slot.Description = description
+	})
+}
+
+func (r *MemoryRosterWeekRepository) updateSlot(weekOffset int, slotID uuid.UUID, fn func(slot *models.Slot)) (int, error) {
+	var revision int
+	err := r.update(weekOffset, func(week *models.RosterWeek) error {
+		slot := week.GetSlotByID(slotID)
+		if slot == nil {
+			return ErrNotFound
+		}
+		fn(slot)
+		revision = week.Revision + 1
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to update slot (id: %v): %w", slotID, err)
+	}
+	return revision, nil
+}
+
+// update applies fn to the stored week with the given offset and bumps its
+// revision, all under the write lock. Nothing is changed if fn fails.
+func (r *MemoryRosterWeekRepository) update(weekOffset int, fn func(week *models.RosterWeek) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range r.order {
+		if r.weeks[id].WeekOffset != weekOffset {
+			continue
+		}
+		// Work on a copy so a failing fn leaves the stored week untouched.
+		week, err := cloneDocument(r.weeks[id])
+		if err != nil {
+			return err
+		}
+		if err := fn(&week); err != nil {
+			return err
+		}
+		week.Revision++
+		r.weeks[id] = week
+		return nil
+	}
+	return ErrNotFound
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"roster/cmd/models"
+
+	"github.com/google/uuid"
+)
+
+// MemorySessionRepository implements SessionRepository in process memory.
+type MemorySessionRepository struct {
+	mu       sync.RWMutex
+	sessions map[uuid.UUID]models.Session
+}
+
+// NewMemorySessionRepository creates a new, empty MemorySessionRepository.
+func NewMemorySessionRepository() *MemorySessionRepository {
+	return &MemorySessionRepository{sessions: map[uuid.UUID]models.Session{}}
+}
+
+func (r *MemorySessionRepository) CreateSession(ctx context.Context, session models.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.sessions[session.ID]; ok {
+		return fmt.Errorf("CreateSession: session %v already exists", session.ID)
+	}
+	r.sessions[session.ID] = session
+	return nil
+}
+
+func (r *MemorySessionRepository) GetSession(ctx context.Context, id uuid.UUID) (*models.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	session, ok := r.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("GetSession: %w", ErrNotFound)
+	}
+	return &session, nil
+}
+
+func (r *MemorySessionRepository) TouchSession(ctx context.Context, id uuid.UUID, lastSeen time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.sessions[id]
+	if !ok {
+		return fmt.Errorf("TouchSession: %w", ErrNotFound)
+	}
+	session.LastSeen = lastSeen
+	r.sessions[id] = session
+	return nil
+}
+
+func (r *MemorySessionRepository) FindStaffSessions(ctx context.Context, staffID uuid.UUID) ([]*models.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	sessions := []*models.Session{}
+	for _, session := range r.sessions {
+		if session.StaffID == staffID {
+			session := session
+			sessions = append(sessions, &session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen.After(sessions[j].LastSeen)
+	})
+	return sessions, nil
+}
+
+func (r *MemorySessionRepository) DeleteSession(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions, id)
+	return nil
+}
+
+func (r *MemorySessionRepository) DeleteStaffSessions(ctx context.Context, staffID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, session := range r.sessions {
+		if session.StaffID == staffID {
+			delete(r.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (r *MemorySessionRepository) DeleteExpiredSessions(ctx context.Context, expiredBefore time.Time, idleBefore time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deleted int64
+	for id, session := range r.sessions {
+		if session.ExpiresAt.Before(expiredBefore) || session.LastSeen.Before(idleBefore) {
+			delete(r.sessions, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"roster/cmd/models"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStaffRepository implements StaffRepository in process memory.
+type MemoryStaffRepository struct {
+	mu    sync.RWMutex
+	order []uuid.UUID
+	staff map[uuid.UUID]models.StaffMember
+}
+
+// NewMemoryStaffRepository creates a new, empty MemoryStaffRepository.
+func NewMemoryStaffRepository() *MemoryStaffRepository {
+	return &MemoryStaffRepository{
+		staff: map[uuid.UUID]models.StaffMember{},
+	}
+}
+
+func (repo *MemoryStaffRepository) SaveStaffMember(ctx context.Context, staff models.StaffMember) error {
+	stored, err := cloneDocument(staff)
+	if err != nil {
+		return fmt.Errorf("SaveStaffMember: %w", err)
+	}
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if _, ok := repo.staff[staff.ID]; !ok {
+		repo.order = append(repo.order, staff.ID)
+	}
+	repo.staff[staff.ID] = stored
+	return nil
+}
+
+func (repo *MemoryStaffRepository) SaveStaffMembers(ctx context.Context, staffMembers []*models.StaffMember) error {
+	for _, s := range staffMembers {
+		if err := repo.SaveStaffMember(ctx, *s); err != nil {
+			return fmt.Errorf("SaveStaffMembers: %w", err)
+		}
+	}
+	return nil
+}
+
+func (repo *MemoryStaffRepository) LoadAllStaff(ctx context.Context) ([]*models.StaffMember, error) {
+	matches, err := repo.find(func(s models.StaffMember) bool {
+		// Only include valid records.
+		return !s.IsDeleted && s.FirstName != ""
+	})
+	if err != nil {
+		return nil, fmt.Errorf("LoadAllStaff: %w", err)
+	}
+	sortStaffByName(matches)
+	return matches, nil
+}
+
+func (repo *MemoryStaffRepository) LoadAllStaffRecords(ctx context.Context) ([]*models.StaffMember, error) {
+	all, err := repo.find(func(models.StaffMember) bool { return true })
+	if err != nil {
+		return nil, fmt.Errorf("LoadAllStaffRecords: %w", err)
+	}
+	return all, nil
+}
+
+func (repo *MemoryStaffRepository) GetStaffByIdentity(ctx context.Context, identity models.Identity) (*models.StaffMember, error) {
+	s, err := repo.findOne(func(s models.StaffMember) bool {
+		return s.HasIdentity(identity) && !s.IsDeleted
+	})
+	if err != nil {
+		return nil, fmt.Errorf("GetStaffByIdentity: %w", err)
+	}
+	return s, nil
+}
+
+func (repo *MemoryStaffRepository) GetStaffByEmail(ctx context.Context, email string) (*models.StaffMember, error) {
+	s, err := repo.findOne(func(s models.StaffMember) bool {
+		return strings.EqualFold(s.Email, email) && !s.IsDeleted
+	})
+	if err != nil {
+		return nil, fmt.Errorf("GetStaffByEmail: %w", err)
+	}
+	return s, nil
+}
+
+func (repo *MemoryStaffRepository) GetStaffByID(ctx context.Context, id uuid.UUID) (*models.StaffMember, error) {
+	s, err := repo.findOne(func(s models.StaffMember) bool {
+		return s.ID == id && !s.IsDeleted
+	})
+	if err != nil {
+		return nil, fmt.Errorf("GetStaffByID: %w", err)
+	}
+	return s, nil
+}
+
+func (repo *MemoryStaffRepository) RefreshStaffConfig(ctx context.Context, staff models.StaffMember) (models.StaffMember, error) {
+	return refreshStaffConfig(ctx, repo, staff)
+}
+
+func (repo *MemoryStaffRepository) CreateStaffMember(ctx context.Context, identity models.Identity) (*models.StaffMember, error) {
+	return createStaffMember(ctx, repo, identity)
+}
+
+func (repo *MemoryStaffRepository) DeleteLeaveReqByID(ctx context.Context, staff models.StaffMember, leaveReqID uuid.UUID) error {
+	return deleteLeaveReqByID(ctx, repo, staff, leaveReqID)
+}
+
+func (repo *MemoryStaffRepository) GetStaffByLeaveReqID(ctx context.Context, leaveReqID uuid.UUID) (*models.StaffMember, error) {
+	s, err := repo.findOne(func(s models.StaffMember) bool {
+		if s.IsDeleted {
+			return false
+		}
+		return slices.ContainsFunc(s.LeaveRequests, func(lr models.LeaveRequest) bool {
+			return lr.ID == leaveReqID
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("GetStaffByLeaveReqID: %w", err)
+	}
+	return s, nil
+}
+
+func (repo *MemoryStaffRepository) CreateTrial(ctx context.Context, trialName string) error {
+	return createTrial(ctx, repo, trialName)
+}
+
+func (repo *MemoryStaffRepository) DeleteStaffByID(ctx context.Context, id uuid.UUID) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	s, ok := repo.staff[id]
+	if !ok {
+		return fmt.Errorf("DeleteStaffByID: no document found")
+	}
+	s.IsDeleted = true
+	repo.staff[id] = s
+	return nil
+}
+
+// find returns copies of every stored staff member matching the predicate,
+// in insertion order.
+func (repo *MemoryStaffRepository) find(match func(models.StaffMember) bool) ([]*models.StaffMember, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	var matches []*models.StaffMember
+	for _, id := range repo.order {
+		stored := repo.staff[id]
+		if !match(stored) {
+			continue
+		}
+		s, err := cloneDocument(stored)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, &s)
+	}
+	return matches, nil
+}
+
+// findOne returns the first match, or nil when nothing matches.
+func (repo *MemoryStaffRepository) findOne(match func(models.StaffMember) bool) (*models.StaffMember, error) {
+	matches, err := repo.find(match)
+	if err != nil || len(matches) == 0 {
+		return nil, err
+	}
+	return matches[0], nil
+}
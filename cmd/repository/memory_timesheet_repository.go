@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"roster/cmd/models"
+	"roster/cmd/utils"
+
+	"github.com/google/uuid"
+)
+
+// MemoryTimesheetRepository implements TimesheetRepository in process memory.
+type MemoryTimesheetRepository struct {
+	mu      sync.RWMutex
+	order   []uuid.UUID
+	entries map[uuid.UUID]TimesheetEntry
+}
+
+// NewMemoryTimesheetRepository creates a new, empty MemoryTimesheetRepository.
+func NewMemoryTimesheetRepository() *MemoryTimesheetRepository {
+	return &MemoryTimesheetRepository{
+		entries: map[uuid.UUID]TimesheetEntry{},
+	}
+}
+
+func (repo *MemoryTimesheetRepository) SaveTimesheetEntry(ctx context.Context, e TimesheetEntry) error {
+	stored, err := cloneDocument(e)
+	if err != nil {
+		utils.PrintError(err, "Failed to save timesheet entry")
+		return err
+	}
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if _, ok := repo.entries[e.ID]; !ok {
+		repo.order = append(repo.order, e.ID)
+	}
+	repo.entries[e.ID] = stored
+	return nil
+}
+
+func (repo *MemoryTimesheetRepository) GetTimesheetEntryByID(ctx context.Context, entryID uuid.UUID) (*models.TimesheetEntry, error) {
+	entries, err := repo.find(func(e TimesheetEntry) bool {
+		return e.ID == entryID
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		utils.PrintError(ErrNotFound, "Error getting timesheet entry")
+		return nil, ErrNotFound
+	}
+	return entries[0], nil
+}
+
+func (repo *MemoryTimesheetRepository) GetAllTimesheetEntries(ctx context.Context) (*[]*TimesheetEntry, error) {
+	entries, err := repo.find(func(TimesheetEntry) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	entries = SortTimesheetEntries(entries)
+	return &entries, nil
+}
+
+func (repo *MemoryTimesheetRepository) SaveAllTimesheetEntries(ctx context.Context, entries []*TimesheetEntry) error {
+	for _, entry := range entries {
+		if err := repo.SaveTimesheetEntry(ctx, *entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (repo *MemoryTimesheetRepository) GetStaffTimesheetWeek(ctx context.Context, staffID uuid.UUID, weekOffset int) (*[]*TimesheetEntry, error) {
+	entries, err := repo.find(func(e TimesheetEntry) bool {
+		return e.WeekOffset == weekOffset && e.StaffID == staffID
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &entries, nil
+}
+
+func (repo *MemoryTimesheetRepository) GetTimesheetWeek(ctx context.Context, weekOffset int) (*[]*TimesheetEntry, error) {
+	entries, err := repo.find(func(e TimesheetEntry) bool {
+		return e.WeekOffset == weekOffset
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries = SortTimesheetEntries(entries)
+	return &entries, nil
+}
+
+func (repo *MemoryTimesheetRepository) DeleteTimesheetEntry(ctx context.Context, entryID uuid.UUID) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	delete(repo.entries, entryID)
+	for i, id := range repo.order {
+		if id == entryID {
+			repo.order = append(repo.order[:i], repo.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// find returns copies of every stored entry matching the predicate, in
+// insertion order.
+func (repo *MemoryTimesheetRepository) find(match func(TimesheetEntry) bool) ([]*TimesheetEntry, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	entries := []*TimesheetEntry{}
+	for _, id := range repo.order {
+		stored := repo.entries[id]
+		if !match(stored) {
+			continue
+		}
+		e, err := cloneDocument(stored)
+		if err != nil {
+			utils.PrintError(err, "Error decoding timesheet entry")
+			return nil, err
+		}
+		entries = append(entries, &e)
+	}
+	return entries, nil
+}
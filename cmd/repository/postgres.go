@@ -0,0 +1,237 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/lib/pq"
+)
+
+var postgresDialect = sqlDialect{name: "postgres", numberedParams: true}
+
+// postgresMigrations holds the PostgreSQL schema, one entry per version. Only
+// ever append to this list; applied entries must not change.
+var postgresMigrations = []string{
+	`CREATE TABLE staff (
+		id UUID PRIMARY KEY,
+		is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+		role INTEGER NOT NULL DEFAULT 0,
+		is_trial BOOLEAN NOT NULL DEFAULT FALSE,
+		is_hidden BOOLEAN NOT NULL DEFAULT FALSE,
+		is_kitchen BOOLEAN NOT NULL DEFAULT FALSE,
+		google_id TEXT NOT NULL DEFAULT '',
+		nick_name TEXT NOT NULL DEFAULT '',
+		first_name TEXT NOT NULL DEFAULT '',
+		last_name TEXT NOT NULL DEFAULT '',
+		email TEXT NOT NULL DEFAULT '',
+		phone TEXT NOT NULL DEFAULT '',
+		contact_name TEXT NOT NULL DEFAULT '',
+		contact_phone TEXT NOT NULL DEFAULT '',
+		ideal_shifts INTEGER NOT NULL DEFAULT 0,
+		last_visit TIMESTAMPTZ NOT NULL,
+		timesheet_date_offset INTEGER NOT NULL DEFAULT 0,
+		roster_date_offset INTEGER NOT NULL DEFAULT 0,
+		hide_by_ideal BOOLEAN NOT NULL DEFAULT FALSE,
+		hide_by_prefs BOOLEAN NOT NULL DEFAULT FALSE,
+		hide_by_leave BOOLEAN NOT NULL DEFAULT FALSE,
+		hide_approved BOOLEAN NOT NULL DEFAULT FALSE,
+		hide_staff_list BOOLEAN NOT NULL DEFAULT FALSE,
+		show_all BOOLEAN NOT NULL DEFAULT FALSE,
+		is_deleted BOOLEAN NOT NULL DEFAULT FALSE
+	);
+	CREATE INDEX staff_google_id ON staff (google_id);
+
+	CREATE TABLE staff_tokens (
+		token UUID PRIMARY KEY,
+		staff_id UUID NOT NULL REFERENCES staff (id) ON DELETE CASCADE
+	);
+	CREATE INDEX staff_tokens_staff_id ON staff_tokens (staff_id);
+
+	CREATE TABLE staff_availability (
+		staff_id UUID NOT NULL REFERENCES staff (id) ON DELETE CASCADE,
+		day_index INTEGER NOT NULL,
+		name TEXT NOT NULL DEFAULT '',
+		early BOOLEAN NOT NULL DEFAULT FALSE,
+		mid BOOLEAN NOT NULL DEFAULT FALSE,
+		late BOOLEAN NOT NULL DEFAULT FALSE,
+		PRIMARY KEY (staff_id, day_index)
+	);
+
+	CREATE TABLE leave_requests (
+		id UUID PRIMARY KEY,
+		staff_id UUID NOT NULL REFERENCES staff (id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		creation_date TIMESTAMPTZ,
+		reason TEXT NOT NULL DEFAULT '',
+		start_date TIMESTAMPTZ,
+		end_date TIMESTAMPTZ,
+		status INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX leave_requests_staff_id ON leave_requests (staff_id);
+
+	CREATE TABLE roster_weeks (
+		id UUID PRIMARY KEY,
+		start_date TIMESTAMPTZ NOT NULL,
+		week_offset INTEGER NOT NULL,
+		is_live BOOLEAN NOT NULL DEFAULT FALSE
+	);
+	CREATE INDEX roster_weeks_week_offset ON roster_weeks (week_offset);
+
+	CREATE TABLE roster_days (
+		id UUID PRIMARY KEY,
+		week_id UUID NOT NULL REFERENCES roster_weeks (id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		day_name TEXT NOT NULL DEFAULT '',
+		colour TEXT NOT NULL DEFAULT '',
+		day_offset INTEGER NOT NULL DEFAULT 0,
+		is_closed BOOLEAN NOT NULL DEFAULT FALSE
+	);
+	CREATE INDEX roster_days_week_id ON roster_days (week_id);
+
+	CREATE TABLE roster_rows (
+		id UUID PRIMARY KEY,
+		day_id UUID NOT NULL REFERENCES roster_days (id) ON DELETE CASCADE,
+		position INTEGER NOT NULL
+	);
+	CREATE INDEX roster_rows_day_id ON roster_rows (day_id);
+
+	CREATE TABLE roster_slots (
+		id UUID PRIMARY KEY,
+		row_id UUID NOT NULL REFERENCES roster_rows (id) ON DELETE CASCADE,
+		slot_key TEXT NOT NULL,
+		start_time TEXT NOT NULL DEFAULT '',
+		assigned_staff UUID,
+		staff_string TEXT,
+		flag INTEGER NOT NULL DEFAULT 0,
+		description TEXT NOT NULL DEFAULT '',
+		UNIQUE (row_id, slot_key)
+	);
+	CREATE INDEX roster_slots_assigned_staff ON roster_slots (assigned_staff);
+
+	CREATE TABLE timesheet_entries (
+		id UUID PRIMARY KEY,
+		staff_id UUID NOT NULL,
+		week_offset INTEGER NOT NULL,
+		day_offset INTEGER NOT NULL DEFAULT 0,
+		start_date TIMESTAMPTZ NOT NULL,
+		shift_start TIMESTAMPTZ NOT NULL,
+		shift_end TIMESTAMPTZ NOT NULL,
+		has_break BOOLEAN NOT NULL DEFAULT FALSE,
+		break_start TIMESTAMPTZ NOT NULL,
+		break_end TIMESTAMPTZ NOT NULL,
+		break_length DOUBLE PRECISION NOT NULL DEFAULT 0,
+		shift_length DOUBLE PRECISION NOT NULL DEFAULT 0,
+		approved BOOLEAN NOT NULL DEFAULT FALSE,
+		shift_type INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX timesheet_entries_week ON timesheet_entries (week_offset, staff_id);
+
+	CREATE TABLE config_versions (
+		id TEXT PRIMARY KEY,
+		version INTEGER NOT NULL
+	);`,
+	`ALTER TABLE roster_weeks ADD COLUMN revision INTEGER NOT NULL DEFAULT 0;`,
+	`CREATE TABLE audit_log (
+		id UUID PRIMARY KEY,
+		timestamp TIMESTAMPTZ NOT NULL,
+		actor_id UUID NOT NULL,
+		actor_name TEXT NOT NULL DEFAULT '',
+		action TEXT NOT NULL,
+		entity_type TEXT NOT NULL,
+		entity_id UUID NOT NULL,
+		before_value TEXT NOT NULL DEFAULT '',
+		after_value TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX audit_log_timestamp ON audit_log (timestamp);
+	CREATE INDEX audit_log_entity ON audit_log (entity_type, entity_id);`,
+	`CREATE TABLE sessions (
+		id UUID PRIMARY KEY,
+		staff_id UUID NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL,
+		last_seen TIMESTAMPTZ NOT NULL,
+		expires_at TIMESTAMPTZ NOT NULL,
+		user_agent TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX sessions_staff ON sessions (staff_id);`,
+	`CREATE TABLE staff_identities (
+		staff_id UUID NOT NULL REFERENCES staff (id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		provider TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		PRIMARY KEY (staff_id, position)
+	);
+	CREATE INDEX staff_identities_subject ON staff_identities (provider, subject);`,
+	`CREATE TABLE login_links (
+		token_hash TEXT PRIMARY KEY,
+		purpose TEXT NOT NULL,
+		staff_id UUID NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL,
+		expires_at TIMESTAMPTZ NOT NULL
+	);
+	CREATE INDEX login_links_expires_at ON login_links (expires_at);`,
+	`CREATE TABLE api_tokens (
+		id UUID PRIMARY KEY,
+		staff_id UUID NOT NULL,
+		name TEXT NOT NULL DEFAULT '',
+		token_hash TEXT NOT NULL UNIQUE,
+		permissions TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL,
+		last_used_at TIMESTAMPTZ
+	);
+	CREATE INDEX api_tokens_staff ON api_tokens (staff_id);`,
+	`ALTER TABLE roster_slots ADD COLUMN position INTEGER NOT NULL DEFAULT 0;
+	UPDATE roster_slots SET
+		position = CASE slot_key WHEN 'mid' THEN 1 WHEN 'late' THEN 2 ELSE 0 END,
+		slot_key = CASE slot_key WHEN 'early' THEN 'Early' WHEN 'mid' THEN 'Mid' WHEN 'late' THEN 'Late' ELSE slot_key END;
+
+	CREATE TABLE roster_week_slots (
+		week_id UUID NOT NULL REFERENCES roster_weeks (id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		start_time TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (week_id, position)
+	);
+	INSERT INTO roster_week_slots (week_id, position, name) SELECT id, 0, 'Early' FROM roster_weeks;
+	INSERT INTO roster_week_slots (week_id, position, name) SELECT id, 1, 'Mid' FROM roster_weeks;
+	INSERT INTO roster_week_slots (week_id, position, name) SELECT id, 2, 'Late' FROM roster_weeks;
+
+	ALTER TABLE staff_availability ADD COLUMN unavailable TEXT NOT NULL DEFAULT '';
+	UPDATE staff_availability SET unavailable = rtrim(
+			(CASE WHEN NOT early THEN 'Early,' ELSE '' END) ||
+			(CASE WHEN NOT mid THEN 'Mid,' ELSE '' END) ||
+			(CASE WHEN NOT late THEN 'Late,' ELSE '' END), ',');`,
+	`CREATE TABLE roster_templates (
+		id UUID PRIMARY KEY,
+		name TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL,
+		created_by UUID NOT NULL,
+		includes_assignments BOOLEAN NOT NULL DEFAULT FALSE,
+		layout TEXT NOT NULL
+	);`,
+	`ALTER TABLE staff ADD COLUMN is_minor BOOLEAN NOT NULL DEFAULT FALSE;`,
+	`ALTER TABLE roster_week_slots ADD COLUMN kitchen BOOLEAN NOT NULL DEFAULT FALSE;`,
+}
+
+// OpenPostgres connects to the PostgreSQL database described by dsn and
+// brings its schema up to date.
+func OpenPostgres(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to postgres database: %w", err)
+	}
+	if err := migrateSQLSchema(&sqlStore{db: db, dialect: postgresDialect}, postgresMigrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// NewPostgresRepositories creates the PostgreSQL implementation of every
+// repository on a database returned by OpenPostgres.
+func NewPostgresRepositories(db *sql.DB) Repositories {
+	return newSQLRepositories(&sqlStore{db: db, dialect: postgresDialect})
+}
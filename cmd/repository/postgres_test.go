@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"database/sql"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestSQLDialectRebind(t *testing.T) {
+	query := "SELECT id FROM staff WHERE google_id = ? AND id IN (?, ?)"
+	if got := sqliteDialect.rebind(query); got != query {
+		t.Errorf("sqlite rebind = %q; want query unchanged", got)
+	}
+	want := "SELECT id FROM staff WHERE google_id = $1 AND id IN ($2, $3)"
+	if got := postgresDialect.rebind(query); got != want {
+		t.Errorf("postgres rebind = %q; want %q", got, want)
+	}
+}
+
+// TestPostgresRepositories runs the suite against a real server when
+// TEST_POSTGRES_DSN is set. Each run uses a throwaway schema.
+func TestPostgresRepositories(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN not set")
+	}
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	runRepositorySuite(t, func(t *testing.T) Repositories {
+		schema := "roster_test_" + strings.ReplaceAll(uuid.NewString()[:8], "-", "")
+		if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+			t.Fatalf("creating schema: %v", err)
+		}
+		t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+		db, err := OpenPostgres(withSearchPath(dsn, schema))
+		if err != nil {
+			t.Fatalf("OpenPostgres: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return NewPostgresRepositories(db)
+	})
+}
+
+// withSearchPath points every connection made with dsn at schema.
+func withSearchPath(dsn, schema string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	return dsn + " search_path=" + schema
+}
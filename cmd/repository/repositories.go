@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Repositories groups every persistence interface the server depends on.
+type Repositories struct {
+	Staff           StaffRepository
+	RosterWeek      RosterWeekRepository
+	Timesheet       TimesheetRepository
+	Config          ConfigRepository
+	Audit           AuditRepository
+	Sessions        SessionRepository
+	LoginLinks      LoginLinkRepository
+	APITokens       APITokenRepository
+	RosterTemplates RosterTemplateRepository
+}
+
+// ErrNotFound is returned by lookups that require a match. It is the same
+// value as mongo.ErrNoDocuments so callers can test for either.
+var ErrNotFound = mongo.ErrNoDocuments
+
+// NewMongoRepositories creates the MongoDB implementation of every repository.
+func NewMongoRepositories(db *mongo.Database) Repositories {
+	return Repositories{
+		Staff:           NewMongoStaffRepository(db),
+		RosterWeek:      NewMongoRosterWeekRepository(db),
+		Timesheet:       NewMongoTimesheetRepository(db),
+		Config:          NewMongoConfigRepository(db),
+		Audit:           NewMongoAuditRepository(db),
+		Sessions:        NewMongoSessionRepository(db),
+		LoginLinks:      NewMongoLoginLinkRepository(db),
+		APITokens:       NewMongoAPITokenRepository(db),
+		RosterTemplates: NewMongoRosterTemplateRepository(db),
+	}
+}
+
+// NewMemoryRepositories creates empty in-memory repositories. Nothing is
+// persisted, which makes them suitable for demos and tests.
+func NewMemoryRepositories() Repositories {
+	return Repositories{
+		Staff:           NewMemoryStaffRepository(),
+		RosterWeek:      NewMemoryRosterWeekRepository(),
+		Timesheet:       NewMemoryTimesheetRepository(),
+		Config:          NewMemoryConfigRepository(),
+		Audit:           NewMemoryAuditRepository(),
+		Sessions:        NewMemorySessionRepository(),
+		LoginLinks:      NewMemoryLoginLinkRepository(),
+		APITokens:       NewMemoryAPITokenRepository(),
+		RosterTemplates: NewMemoryRosterTemplateRepository(),
+	}
+}
+
+// cloneDocument deep copies a value by round tripping it through BSON. The
+// in-memory repositories use it so that callers never share state with the
+// store, and so that the custom MarshalBSON/UnmarshalBSON date handling is
+// applied exactly as it would be by MongoDB.
+func cloneDocument[T any](src T) (T, error) {
+	var dst T
+	data, err := bson.Marshal(src)
+	if err != nil {
+		return dst, fmt.Errorf("failed to marshal document: %w", err)
+	}
+	if err := bson.Unmarshal(data, &dst); err != nil {
+		return dst, fmt.Errorf("failed to unmarshal document: %w", err)
+	}
+	return dst, nil
+}
@@ -0,0 +1,731 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"roster/cmd/models"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// runRepositorySuite exercises the behaviour every backend must share.
+// newRepos must return a fresh, empty set of repositories on each call.
+func runRepositorySuite(t *testing.T, newRepos func(t *testing.T) Repositories) {
+	t.Run("Staff", func(t *testing.T) { testStaffRepository(t, newRepos(t).Staff) })
+	t.Run("RosterWeek", func(t *testing.T) { testRosterWeekRepository(t, newRepos(t).RosterWeek) })
+	t.Run("Timesheet", func(t *testing.T) { testTimesheetRepository(t, newRepos(t).Timesheet) })
+	t.Run("Config", func(t *testing.T) { testConfigRepository(t, newRepos(t).Config) })
+	t.Run("Audit", func(t *testing.T) { testAuditRepository(t, newRepos(t).Audit) })
+	t.Run("Sessions", func(t *testing.T) { testSessionRepository(t, newRepos(t).Sessions) })
+	t.Run("LoginLinks", func(t *testing.T) { testLoginLinkRepository(t, newRepos(t).LoginLinks) })
+	t.Run("APITokens", func(t *testing.T) { testAPITokenRepository(t, newRepos(t).APITokens) })
+	t.Run("RosterTemplates", func(t *testing.T) { testRosterTemplateRepository(t, newRepos(t).RosterTemplates) })
+}
+
+func testStaffRepository(t *testing.T, repo StaffRepository) {
+	ctx := context.Background()
+	google := models.Identity{Provider: "google", Subject: "google-1"}
+	created, err := repo.CreateStaffMember(ctx, google)
+	if err != nil {
+		t.Fatalf("CreateStaffMember: %v", err)
+	}
+	if _, err := repo.CreateStaffMember(ctx, google); err == nil {
+		t.Fatal("expected error creating duplicate staff member")
+	}
+
+	first, err := repo.GetStaffByID(ctx, created.ID)
+	if err != nil || first == nil {
+		t.Fatalf("GetStaffByID = %+v, %v", first, err)
+	}
+	if first.Role != models.AdminRole || len(first.Availability) != 7 {
+		t.Fatalf("first user should be an admin with full availability, got %+v", first)
+	}
+
+	// Accounts without a first name are not listed.
+	all, err := repo.LoadAllStaff(ctx)
+	if err != nil {
+		t.Fatalf("LoadAllStaff: %v", err)
+	}
+	if len(all) != 0 {
+		t.Fatalf("expected incomplete account to be hidden, got %d staff", len(all))
+	}
+
+	first.FirstName = "Zed"
+	first.IsMinor = true
+	first.Availability[2].Unavailable = models.SlotNameList{"Early", "Late"}
+	if err := repo.SaveStaffMember(ctx, *first); err != nil {
+		t.Fatalf("SaveStaffMember: %v", err)
+	}
+	if saved, _ := repo.GetStaffByID(ctx, first.ID); !saved.Availability[2].IsAvailable("Mid") ||
+		saved.Availability[2].IsAvailable("late") || !saved.Availability[3].IsAvailable("Late") {
+		t.Fatalf("availability not persisted: %+v", saved.Availability)
+	} else if !saved.IsMinor {
+		t.Fatal("IsMinor not persisted")
+	}
+	if err := repo.CreateTrial(ctx, "Amy"); err != nil {
+		t.Fatalf("CreateTrial: %v", err)
+	}
+	nick := models.StaffMember{ID: uuid.New(), FirstName: "Zoe", NickName: "Bo"}
+	if err := repo.SaveStaffMembers(ctx, []*models.StaffMember{&nick}); err != nil {
+		t.Fatalf("SaveStaffMembers: %v", err)
+	}
+
+	all, err = repo.LoadAllStaff(ctx)
+	if err != nil {
+		t.Fatalf("LoadAllStaff: %v", err)
+	}
+	var names []string
+	for _, s := range all {
+		names = append(names, s.FirstName)
+	}
+	if fmt.Sprint(names) != "[Amy Zoe Zed]" {
+		t.Fatalf("expected staff sorted by display name, got %v", names)
+	}
+	if !all[0].IsTrial {
+		t.Fatalf("expected trial staff member, got %+v", all[0])
+	}
+
+	// Returned values must not alias the stored copy.
+	all[0].FirstName = "Mutated"
+	byID, err := repo.GetStaffByID(ctx, all[0].ID)
+	if err != nil || byID == nil || byID.FirstName != "Amy" {
+		t.Fatalf("GetStaffByID = %+v, %v; want stored copy", byID, err)
+	}
+	byGoogle, err := repo.GetStaffByIdentity(ctx, google)
+	if err != nil || byGoogle == nil || byGoogle.ID != first.ID {
+		t.Fatalf("GetStaffByIdentity = %+v, %v", byGoogle, err)
+	}
+	// A second provider can be linked to the same account.
+	oidc := models.Identity{Provider: "oidc", Subject: "google-1"}
+	if other, err := repo.GetStaffByIdentity(ctx, oidc); err != nil || other != nil {
+		t.Fatalf("GetStaffByIdentity(unlinked) = %+v, %v; want nil, nil", other, err)
+	}
+	byGoogle.Identities = append(byGoogle.Identities, oidc)
+	if err := repo.SaveStaffMember(ctx, *byGoogle); err != nil {
+		t.Fatalf("SaveStaffMember: %v", err)
+	}
+	byOIDC, err := repo.GetStaffByIdentity(ctx, oidc)
+	if err != nil || byOIDC == nil || byOIDC.ID != first.ID || len(byOIDC.Identities) != 2 {
+		t.Fatalf("GetStaffByIdentity(linked) = %+v, %v", byOIDC, err)
+	}
+	if missing, err := repo.GetStaffByID(ctx, uuid.New()); err != nil || missing != nil {
+		t.Fatalf("GetStaffByID(unknown) = %+v, %v; want nil, nil", missing, err)
+	}
+	byOIDC.Email = "Zed@Example.com"
+	if err := repo.SaveStaffMember(ctx, *byOIDC); err != nil {
+		t.Fatalf("SaveStaffMember: %v", err)
+	}
+	byEmail, err := repo.GetStaffByEmail(ctx, "zed@example.COM")
+	if err != nil || byEmail == nil || byEmail.ID != first.ID {
+		t.Fatalf("GetStaffByEmail = %+v, %v", byEmail, err)
+	}
+	if missing, err := repo.GetStaffByEmail(ctx, "z%@example.com"); err != nil || missing != nil {
+		t.Fatalf("GetStaffByEmail(unknown) = %+v, %v; want nil, nil", missing, err)
+	}
+
+	// Leave requests keep their local calendar dates.
+	start := time.Date(2024, 3, 5, 0, 0, 0, 0, time.Local)
+	end := start.AddDate(0, 0, 2)
+	leave := models.LeaveRequest{
+		ID:           uuid.New(),
+		CreationDate: models.CustomDate{Time: &start},
+		StartDate:    models.CustomDate{Time: &start},
+		EndDate:      models.CustomDate{Time: &end},
+		Status:       models.LeavePending,
+	}
+	first, _ = repo.GetStaffByID(ctx, first.ID)
+	first.LeaveRequests = append(first.LeaveRequests, leave)
+	if err := repo.SaveStaffMember(ctx, *first); err != nil {
+		t.Fatalf("SaveStaffMember: %v", err)
+	}
+	owner, err := repo.GetStaffByLeaveReqID(ctx, leave.ID)
+	if err != nil || owner == nil || owner.ID != first.ID {
+		t.Fatalf("GetStaffByLeaveReqID = %+v, %v", owner, err)
+	}
+	if got := owner.LeaveRequests[0].StartDate.Time; !got.Equal(start) || got.Day() != 5 {
+		t.Fatalf("leave start date = %v; want %v", got, start)
+	}
+	if err := repo.DeleteLeaveReqByID(ctx, *owner, leave.ID); err != nil {
+		t.Fatalf("DeleteLeaveReqByID: %v", err)
+	}
+	if owner, _ := repo.GetStaffByLeaveReqID(ctx, leave.ID); owner != nil {
+		t.Fatal("expected leave request to be deleted")
+	}
+
+	// Deletion is soft: the record stays but is no longer returned.
+	if err := repo.DeleteStaffByID(ctx, nick.ID); err != nil {
+		t.Fatalf("DeleteStaffByID: %v", err)
+	}
+	if s, _ := repo.GetStaffByID(ctx, nick.ID); s != nil {
+		t.Fatal("expected deleted staff member to be hidden")
+	}
+	all, _ = repo.LoadAllStaff(ctx)
+	if len(all) != 2 {
+		t.Fatalf("expected 2 staff after delete, got %d", len(all))
+	}
+	records, err := repo.LoadAllStaffRecords(ctx)
+	if err != nil {
+		t.Fatalf("LoadAllStaffRecords: %v", err)
+	}
+	if len(records) != 3 || !slices.ContainsFunc(records, func(s *models.StaffMember) bool { return s.IsDeleted }) {
+		t.Fatalf("expected all 3 staff including the deleted one, got %d", len(records))
+	}
+	if err := repo.DeleteStaffByID(ctx, uuid.New()); err == nil {
+		t.Fatal("expected error deleting unknown staff member")
+	}
+}
+
+func testRosterWeekRepository(t *testing.T, repo RosterWeekRepository) {
+	ctx := context.Background()
+	if _, err := repo.GetRosterWeek(ctx, 3); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetRosterWeek before creation: expected ErrNotFound, got %v", err)
+	}
+	week, err := repo.LoadRosterWeek(ctx, 3)
+	if err != nil {
+		t.Fatalf("LoadRosterWeek: %v", err)
+	}
+	if week.WeekOffset != 3 || len(week.Days) != 7 || week.Revision != 1 {
+		t.Fatalf("expected new week with 7 days at revision 1, got %+v", week)
+	}
+	if !reflect.DeepEqual(week.Slots, models.DefaultSlots()) {
+		t.Fatalf("expected new week to have the venue's shifts, got %+v", week.Slots)
+	}
+
+	// Loading again must return the week created above.
+	again, err := repo.LoadRosterWeek(ctx, 3)
+	if err != nil || again.ID != week.ID {
+		t.Fatalf("LoadRosterWeek(again) = %v, %v; want id %v", again.ID, err, week.ID)
+	}
+	if got, err := repo.GetRosterWeek(ctx, 3); err != nil || got.ID != week.ID {
+		t.Fatalf("GetRosterWeek = %v, %v; want id %v", got, err, week.ID)
+	}
+
+	staffID := uuid.New()
+	week.StartDate = time.Date(2024, 3, 5, 0, 0, 0, 0, time.Local)
+	week.IsLive = true
+	week.Days[1].Rows[0].Slots[0].AssignedStaff = &staffID
+	week.Days[1].Rows[0].Slots[0].StartTime = "11:30"
+	week.Slots[0].Kitchen = true
+	if err := repo.SaveRosterWeek(ctx, week); err != nil {
+		t.Fatalf("SaveRosterWeek: %v", err)
+	}
+	saved, _ := repo.LoadRosterWeek(ctx, 3)
+	if !saved.Slots[0].Kitchen || saved.Slots[1].Kitchen {
+		t.Fatalf("kitchen shift not persisted: %+v", saved.Slots)
+	}
+	slot := saved.Days[1].Rows[0].Slots[0]
+	if slot.AssignedStaff == nil || *slot.AssignedStaff != staffID || slot.StartTime != "11:30" {
+		t.Fatalf("slot not persisted: %+v", slot)
+	}
+	if !saved.StartDate.Equal(week.StartDate) || saved.StartDate.Day() != 5 {
+		t.Fatalf("StartDate = %v; want %v", saved.StartDate, week.StartDate)
+	}
+
+	day, isLive, err := repo.ChangeDayRowCount(ctx, 3, week.Days[1].ID, "+")
+	if err != nil {
+		t.Fatalf("ChangeDayRowCount(+): %v", err)
+	}
+	if !isLive || len(day.Rows) != 5 {
+		t.Fatalf("expected live week with 5 rows, got live=%v rows=%d", isLive, len(day.Rows))
+	}
+	day, _, _ = repo.ChangeDayRowCount(ctx, 3, week.Days[1].ID, "-")
+	day, _, _ = repo.ChangeDayRowCount(ctx, 3, week.Days[1].ID, "-")
+	if len(day.Rows) != 4 {
+		t.Fatalf("expected row count to stop at 4, got %d", len(day.Rows))
+	}
+	if _, _, err := repo.ChangeDayRowCount(ctx, 3, uuid.New(), "+"); err == nil {
+		t.Fatal("expected error for unknown day")
+	}
+
+	// Slot updates change only the targeted slot and bump the revision.
+	before, _ := repo.LoadRosterWeek(ctx, 3)
+	slotID := before.Days[2].Rows[1].Slots[1].ID
+	if _, err := repo.UpdateSlotDescription(ctx, 3, slotID, "Bar"); err != nil {
+		t.Fatalf("UpdateSlotDescription: %v", err)
+	}
+	if _, err := repo.UpdateSlotStartTime(ctx, 3, slotID, "17:00"); err != nil {
+		t.Fatalf("UpdateSlotStartTime: %v", err)
+	}
+	name := "Alice"
+	rev, err := repo.UpdateSlotAssignment(ctx, 3, slotID, &staffID, &name)
+	if err != nil {
+		t.Fatalf("UpdateSlotAssignment: %v", err)
+	}
+	after, _ := repo.LoadRosterWeek(ctx, 3)
+	if rev != before.Revision+3 || after.Revision != rev {
+		t.Fatalf("revision = %d (stored %d); want %d", rev, after.Revision, before.Revision+3)
+	}
+	mid := after.Days[2].Rows[1].Slots[1]
+	if mid.Description != "Bar" || mid.StartTime != "17:00" || mid.AssignedStaff == nil ||
+		*mid.AssignedStaff != staffID || mid.StaffString == nil || *mid.StaffString != name {
+		t.Fatalf("slot not updated: %+v", mid)
+	}
+	if early := after.Days[1].Rows[0].Slots[0]; early.StartTime != "11:30" {
+		t.Fatalf("unrelated slot changed: %+v", early)
+	}
+	if _, err := repo.UpdateSlotAssignment(ctx, 3, slotID, nil, nil); err != nil {
+		t.Fatalf("UpdateSlotAssignment(nil): %v", err)
+	}
+	if cleared, _ := repo.LoadRosterWeek(ctx, 3); cleared.Days[2].Rows[1].Slots[1].AssignedStaff != nil {
+		t.Fatal("expected slot assignment to be cleared")
+	}
+	if _, err := repo.UpdateSlotDescription(ctx, 3, uuid.New(), "Bar"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for unknown slot, got %v", err)
+	}
+	if _, err := repo.UpdateSlotDescription(ctx, 5, slotID, "Bar"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for slot in another week, got %v", err)
+	}
+
+	// Saving from a stale revision must fail and leave the stored week alone.
+	current, err := repo.LoadRosterWeek(ctx, 3)
+	if err != nil {
+		t.Fatalf("LoadRosterWeek: %v", err)
+	}
+	stale := *current
+	current.IsLive = false
+	if err := repo.SaveRosterWeek(ctx, current); err != nil {
+		t.Fatalf("SaveRosterWeek(current): %v", err)
+	}
+	if current.Revision != stale.Revision+1 {
+		t.Fatalf("revision = %d; want %d", current.Revision, stale.Revision+1)
+	}
+	stale.IsLive = true
+	if err := repo.SaveRosterWeek(ctx, &stale); !errors.Is(err, ErrRevisionConflict) {
+		t.Fatalf("expected ErrRevisionConflict saving stale week, got %v", err)
+	}
+	if reloaded, _ := repo.LoadRosterWeek(ctx, 3); reloaded.IsLive || reloaded.Revision != current.Revision {
+		t.Fatalf("stale save changed the week: %+v", reloaded)
+	}
+
+	other, _ := repo.LoadRosterWeek(ctx, 4)
+	other.IsLive = true
+	if err := repo.SaveAllRosterWeeks(ctx, []*models.RosterWeek{other}); err != nil {
+		t.Fatalf("SaveAllRosterWeeks: %v", err)
+	}
+	weeks, err := repo.LoadAllRosterWeeks(ctx)
+	if err != nil {
+		t.Fatalf("LoadAllRosterWeeks: %v", err)
+	}
+	if len(weeks) != 2 {
+		t.Fatalf("expected 2 weeks, got %d", len(weeks))
+	}
+}
+
+func testTimesheetRepository(t *testing.T, repo TimesheetRepository) {
+	ctx := context.Background()
+	staffA, staffB := uuid.New(), uuid.New()
+	base := time.Date(2024, 3, 5, 0, 0, 0, 0, time.Local)
+	entry := func(staff uuid.UUID, week int, hour int) *TimesheetEntry {
+		start := base.Add(time.Duration(hour) * time.Hour)
+		return &TimesheetEntry{
+			ID:         uuid.New(),
+			StaffID:    staff,
+			WeekOffset: week,
+			StartDate:  base,
+			ShiftStart: start,
+			ShiftEnd:   start.Add(4 * time.Hour),
+		}
+	}
+	late := entry(staffA, 1, 18)
+	early := entry(staffB, 1, 10)
+	otherWeek := entry(staffA, 2, 12)
+	if err := repo.SaveTimesheetEntry(ctx, *late); err != nil {
+		t.Fatalf("SaveTimesheetEntry: %v", err)
+	}
+	if err := repo.SaveAllTimesheetEntries(ctx, []*TimesheetEntry{early, otherWeek}); err != nil {
+		t.Fatalf("SaveAllTimesheetEntries: %v", err)
+	}
+
+	got, err := repo.GetTimesheetEntryByID(ctx, late.ID)
+	if err != nil {
+		t.Fatalf("GetTimesheetEntryByID: %v", err)
+	}
+	if got.StaffID != staffA || !got.StartDate.Equal(base) || !got.ShiftStart.Equal(late.ShiftStart) {
+		t.Fatalf("entry not round tripped: %+v", got)
+	}
+	if _, err := repo.GetTimesheetEntryByID(ctx, uuid.New()); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for unknown entry, got %v", err)
+	}
+
+	week, err := repo.GetTimesheetWeek(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetTimesheetWeek: %v", err)
+	}
+	if len(*week) != 2 || (*week)[0].ID != early.ID {
+		t.Fatalf("expected week entries sorted by shift start, got %v", *week)
+	}
+	staffWeek, err := repo.GetStaffTimesheetWeek(ctx, staffA, 1)
+	if err != nil || len(*staffWeek) != 1 || (*staffWeek)[0].ID != late.ID {
+		t.Fatalf("GetStaffTimesheetWeek = %v, %v", staffWeek, err)
+	}
+	all, err := repo.GetAllTimesheetEntries(ctx)
+	if err != nil || len(*all) != 3 {
+		t.Fatalf("GetAllTimesheetEntries = %v, %v", all, err)
+	}
+
+	late.Approved = true
+	if err := repo.SaveTimesheetEntry(ctx, *late); err != nil {
+		t.Fatalf("SaveTimesheetEntry(update): %v", err)
+	}
+	if got, _ := repo.GetTimesheetEntryByID(ctx, late.ID); !got.Approved {
+		t.Fatal("expected entry update to persist")
+	}
+
+	if err := repo.DeleteTimesheetEntry(ctx, late.ID); err != nil {
+		t.Fatalf("DeleteTimesheetEntry: %v", err)
+	}
+	empty, err := repo.GetStaffTimesheetWeek(ctx, staffA, 1)
+	if err != nil || empty == nil || len(*empty) != 0 {
+		t.Fatalf("expected no entries after delete, got %v, %v", empty, err)
+	}
+}
+
+func testConfigRepository(t *testing.T, repo ConfigRepository) {
+	ctx := context.Background()
+	v, err := repo.LoadVersion(ctx)
+	if err != nil {
+		t.Fatalf("LoadVersion: %v", err)
+	}
+	if v.ID != "version" || v.Version != 1 {
+		t.Fatalf("expected default version 1, got %+v", v)
+	}
+	v.Version = 4
+	if err := repo.SaveVersion(ctx, *v); err != nil {
+		t.Fatalf("SaveVersion: %v", err)
+	}
+	if v, _ := repo.LoadVersion(ctx); v.Version != 4 {
+		t.Fatalf("expected saved version 4, got %+v", v)
+	}
+
+	if _, err := repo.LoadVersionByID(ctx, "migrations"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for unsaved version, got %v", err)
+	}
+	if err := repo.SaveVersion(ctx, models.Version{ID: "migrations", Version: 2}); err != nil {
+		t.Fatalf("SaveVersion: %v", err)
+	}
+	if v, err := repo.LoadVersionByID(ctx, "migrations"); err != nil || v.Version != 2 {
+		t.Fatalf("LoadVersionByID = %+v, %v; want version 2", v, err)
+	}
+	if v, _ := repo.LoadVersion(ctx); v.Version != 4 {
+		t.Fatalf("expected other versions to be unaffected, got %+v", v)
+	}
+}
+
+func testAuditRepository(t *testing.T, repo AuditRepository) {
+	ctx := context.Background()
+	alice, bob := uuid.New(), uuid.New()
+	slotID := uuid.New()
+	base := time.Date(2024, 5, 7, 9, 0, 0, 0, time.Local)
+	entries := []models.AuditEntry{
+		{ActorID: alice, Action: models.AuditAssignSlot, EntityType: models.AuditEntityRoster, EntityID: slotID, After: `{"a":1}`},
+		{ActorID: bob, Action: models.AuditSetRole, EntityType: models.AuditEntityStaff, EntityID: alice, Before: `{"r":0}`},
+		{ActorID: alice, Action: models.AuditAssignSlot, EntityType: models.AuditEntityRoster, EntityID: slotID},
+	}
+	for i, e := range entries {
+		e.ID = uuid.New()
+		e.ActorName = "Actor"
+		e.Timestamp = base.Add(time.Duration(i) * time.Hour)
+		if err := repo.RecordAudit(ctx, e); err != nil {
+			t.Fatalf("RecordAudit: %v", err)
+		}
+	}
+
+	all, err := repo.FindAuditEntries(ctx, AuditFilter{})
+	if err != nil {
+		t.Fatalf("FindAuditEntries: %v", err)
+	}
+	if len(all) != 3 || !all[0].Timestamp.Equal(base.Add(2*time.Hour)) {
+		t.Fatalf("expected 3 entries newest first, got %+v", all)
+	}
+	if all[1].Before != `{"r":0}` || all[1].ActorID != bob || all[1].ActorName != "Actor" {
+		t.Fatalf("entry not round tripped: %+v", all[1])
+	}
+
+	byActor, _ := repo.FindAuditEntries(ctx, AuditFilter{ActorID: &alice})
+	if len(byActor) != 2 {
+		t.Fatalf("expected 2 entries for actor, got %d", len(byActor))
+	}
+	byEntity, _ := repo.FindAuditEntries(ctx, AuditFilter{EntityType: models.AuditEntityStaff, Action: models.AuditSetRole})
+	if len(byEntity) != 1 || byEntity[0].EntityID != alice {
+		t.Fatalf("expected the role change, got %+v", byEntity)
+	}
+	window, _ := repo.FindAuditEntries(ctx, AuditFilter{From: base.Add(time.Hour), To: base.Add(2 * time.Hour)})
+	if len(window) != 1 || window[0].ActorID != bob {
+		t.Fatalf("expected only the middle entry in the window, got %+v", window)
+	}
+	limited, _ := repo.FindAuditEntries(ctx, AuditFilter{EntityID: &slotID, Limit: 1})
+	if len(limited) != 1 || !limited[0].Timestamp.Equal(base.Add(2*time.Hour)) {
+		t.Fatalf("expected the newest slot entry only, got %+v", limited)
+	}
+}
+
+func TestMemoryRepositories(t *testing.T) {
+	runRepositorySuite(t, func(t *testing.T) Repositories {
+		return NewMemoryRepositories()
+	})
+}
+
+// TestMongoRepositories runs the suite against a real server when
+// TEST_MONGO_URI is set. Each run uses a throwaway database.
+func TestMongoRepositories(t *testing.T) {
+	uri := os.Getenv("TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("TEST_MONGO_URI not set")
+	}
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("mongo.Connect: %v", err)
+	}
+	t.Cleanup(func() { client.Disconnect(ctx) })
+
+	runRepositorySuite(t, func(t *testing.T) Repositories {
+		db := client.Database("roster_test_" + uuid.NewString()[:8])
+		t.Cleanup(func() { db.Drop(ctx) })
+		return NewMongoRepositories(db)
+	})
+}
+
+func testSessionRepository(t *testing.T, repo SessionRepository) {
+	ctx := context.Background()
+	staffID := uuid.New()
+	now := time.Now().Truncate(time.Second)
+	older := models.Session{
+		ID:        uuid.New(),
+		StaffID:   staffID,
+		CreatedAt: now.Add(-2 * time.Hour),
+		LastSeen:  now.Add(-2 * time.Hour),
+		ExpiresAt: now.Add(time.Hour),
+		UserAgent: "Firefox",
+	}
+	newer := models.Session{ID: uuid.New(), StaffID: staffID, CreatedAt: now, LastSeen: now, ExpiresAt: now.Add(time.Hour)}
+	other := models.Session{ID: uuid.New(), StaffID: uuid.New(), CreatedAt: now, LastSeen: now, ExpiresAt: now.Add(time.Hour)}
+	for _, session := range []models.Session{older, newer, other} {
+		if err := repo.CreateSession(ctx, session); err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+	}
+
+	got, err := repo.GetSession(ctx, older.ID)
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	if got.StaffID != staffID || got.UserAgent != "Firefox" || !got.ExpiresAt.Equal(older.ExpiresAt) {
+		t.Fatalf("GetSession = %+v; want %+v", got, older)
+	}
+	if _, err := repo.GetSession(ctx, uuid.New()); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetSession(unknown) error = %v; want ErrNotFound", err)
+	}
+
+	all, err := repo.FindStaffSessions(ctx, staffID)
+	if err != nil {
+		t.Fatalf("FindStaffSessions: %v", err)
+	}
+	if len(all) != 2 || all[0].ID != newer.ID {
+		t.Fatalf("expected both sessions, most recently used first, got %+v", all)
+	}
+	if err := repo.TouchSession(ctx, older.ID, now.Add(time.Minute)); err != nil {
+		t.Fatalf("TouchSession: %v", err)
+	}
+	all, _ = repo.FindStaffSessions(ctx, staffID)
+	if all[0].ID != older.ID {
+		t.Fatalf("expected touched session first, got %+v", all)
+	}
+	if err := repo.TouchSession(ctx, uuid.New(), now); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("TouchSession(unknown) error = %v; want ErrNotFound", err)
+	}
+
+	if err := repo.DeleteSession(ctx, older.ID); err != nil {
+		t.Fatalf("DeleteSession: %v", err)
+	}
+	if _, err := repo.GetSession(ctx, older.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected deleted session to be gone")
+	}
+	if err := repo.DeleteStaffSessions(ctx, staffID); err != nil {
+		t.Fatalf("DeleteStaffSessions: %v", err)
+	}
+	if all, _ := repo.FindStaffSessions(ctx, staffID); len(all) != 0 {
+		t.Fatalf("expected no sessions left for staff, got %d", len(all))
+	}
+	if _, err := repo.GetSession(ctx, other.ID); err != nil {
+		t.Fatalf("expected other staff's session to remain, got %v", err)
+	}
+
+	idle := models.Session{ID: uuid.New(), StaffID: staffID, CreatedAt: now, LastSeen: now.Add(-48 * time.Hour), ExpiresAt: now.Add(time.Hour)}
+	expired := models.Session{ID: uuid.New(), StaffID: staffID, CreatedAt: now, LastSeen: now, ExpiresAt: now.Add(-time.Hour)}
+	for _, session := range []models.Session{idle, expired} {
+		if err := repo.CreateSession(ctx, session); err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+	}
+	removed, err := repo.DeleteExpiredSessions(ctx, now, now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("DeleteExpiredSessions: %v", err)
+	}
+	if removed != 2 {
+		t.Fatalf("expected idle and expired sessions to be removed, removed %d", removed)
+	}
+	if _, err := repo.GetSession(ctx, other.ID); err != nil {
+		t.Fatalf("expected active session to remain, got %v", err)
+	}
+}
+
+func testLoginLinkRepository(t *testing.T, repo LoginLinkRepository) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+	link := models.LoginLink{
+		TokenHash: "current",
+		Purpose:   models.LoginLinkEmail,
+		StaffID:   uuid.New(),
+		CreatedAt: now,
+		ExpiresAt: now.Add(15 * time.Minute),
+	}
+	expired := models.LoginLink{TokenHash: "expired", Purpose: models.LoginLinkEmail, StaffID: uuid.New(), CreatedAt: now, ExpiresAt: now.Add(-time.Minute)}
+	for _, l := range []models.LoginLink{link, expired} {
+		if err := repo.CreateLoginLink(ctx, l); err != nil {
+			t.Fatalf("CreateLoginLink: %v", err)
+		}
+	}
+	if err := repo.CreateLoginLink(ctx, link); err == nil {
+		t.Fatal("expected error creating duplicate login link")
+	}
+
+	if _, err := repo.ConsumeLoginLink(ctx, "other", link.TokenHash); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("ConsumeLoginLink(wrong purpose) error = %v; want ErrNotFound", err)
+	}
+	got, err := repo.ConsumeLoginLink(ctx, models.LoginLinkEmail, link.TokenHash)
+	if err != nil {
+		t.Fatalf("ConsumeLoginLink: %v", err)
+	}
+	if got.StaffID != link.StaffID || !got.ExpiresAt.Equal(link.ExpiresAt) {
+		t.Fatalf("ConsumeLoginLink = %+v; want %+v", got, link)
+	}
+	if _, err := repo.ConsumeLoginLink(ctx, models.LoginLinkEmail, link.TokenHash); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("ConsumeLoginLink(used) error = %v; want ErrNotFound", err)
+	}
+
+	removed, err := repo.DeleteExpiredLoginLinks(ctx, now)
+	if err != nil {
+		t.Fatalf("DeleteExpiredLoginLinks: %v", err)
+	}
+	if removed != 1 {
+		t.Fatalf("expected the expired link to be removed, removed %d", removed)
+	}
+}
+
+func testAPITokenRepository(t *testing.T, repo APITokenRepository) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+	staffID := uuid.New()
+	older := models.APIToken{ID: uuid.New(), StaffID: staffID, Name: "old", TokenHash: "old", Permissions: []models.Permission{}, CreatedAt: now.Add(-time.Hour)}
+	token := models.APIToken{
+		ID:          uuid.New(),
+		StaffID:     staffID,
+		Name:        "reports",
+		TokenHash:   "hash",
+		Permissions: []models.Permission{models.PermReportsExport, models.PermRosterEdit},
+		CreatedAt:   now,
+	}
+	other := models.APIToken{ID: uuid.New(), StaffID: uuid.New(), TokenHash: "other", CreatedAt: now}
+	for _, tok := range []models.APIToken{older, token, other} {
+		if err := repo.CreateAPIToken(ctx, tok); err != nil {
+			t.Fatalf("CreateAPIToken: %v", err)
+		}
+	}
+
+	got, err := repo.GetAPITokenByHash(ctx, token.TokenHash)
+	if err != nil {
+		t.Fatalf("GetAPITokenByHash: %v", err)
+	}
+	if got.ID != token.ID || got.Name != token.Name || !slices.Equal(got.Permissions, token.Permissions) || !got.LastUsedAt.IsZero() {
+		t.Fatalf("GetAPITokenByHash = %+v; want %+v", got, token)
+	}
+	if got, _ := repo.GetAPITokenByHash(ctx, older.TokenHash); got == nil || got.Permissions == nil || len(got.Permissions) != 0 {
+		t.Fatalf("expected a token without permissions, got %+v", got)
+	}
+	if _, err := repo.GetAPITokenByHash(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetAPITokenByHash(missing) error = %v; want ErrNotFound", err)
+	}
+
+	if err := repo.TouchAPIToken(ctx, token.ID, now.Add(time.Minute)); err != nil {
+		t.Fatalf("TouchAPIToken: %v", err)
+	}
+	if err := repo.TouchAPIToken(ctx, uuid.New(), now); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("TouchAPIToken(missing) error = %v; want ErrNotFound", err)
+	}
+	tokens, err := repo.FindStaffAPITokens(ctx, staffID)
+	if err != nil {
+		t.Fatalf("FindStaffAPITokens: %v", err)
+	}
+	if len(tokens) != 2 || tokens[0].ID != token.ID || !tokens[0].LastUsedAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("FindStaffAPITokens = %+v; want the newest, used token first", tokens)
+	}
+
+	if err := repo.DeleteAPIToken(ctx, token.ID); err != nil {
+		t.Fatalf("DeleteAPIToken: %v", err)
+	}
+	if _, err := repo.GetAPITokenByHash(ctx, token.TokenHash); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected the revoked token to be gone, got %v", err)
+	}
+}
+
+func testRosterTemplateRepository(t *testing.T, repo RosterTemplateRepository) {
+	ctx := context.Background()
+	staffID := uuid.New()
+	week := newRosterWeek(1)
+	week.Days[2].IsClosed = true
+	week.Days[0].Rows[0].Slots[1].StartTime = "11:30"
+	week.Days[0].Rows[0].Slots[1].Description = "Deliveries"
+	week.Days[0].Rows[0].Slots[1].AssignedStaff = &staffID
+	winter := models.NewRosterTemplate("Winter", week, true, uuid.New())
+	winter.CreatedAt = time.Now().Truncate(time.Second)
+	autumn := models.NewRosterTemplate("Autumn", week, false, uuid.New())
+	for _, template := range []models.RosterTemplate{winter, autumn} {
+		if err := repo.SaveRosterTemplate(ctx, template); err != nil {
+			t.Fatalf("SaveRosterTemplate: %v", err)
+		}
+	}
+
+	got, err := repo.GetRosterTemplate(ctx, winter.ID)
+	if err != nil {
+		t.Fatalf("GetRosterTemplate: %v", err)
+	}
+	slot := got.Days[0].Rows[0].Slots[1]
+	if got.Name != "Winter" || !got.IncludesAssignments || !got.CreatedAt.Equal(winter.CreatedAt) || len(got.Slots) != len(week.Slots) {
+		t.Fatalf("GetRosterTemplate = %+v; want %+v", got, winter)
+	}
+	if !got.Days[2].IsClosed || slot.Name != "Mid" || slot.StartTime != "11:30" || slot.Description != "Deliveries" || slot.AssignedStaff == nil || *slot.AssignedStaff != staffID {
+		t.Fatalf("expected the week's layout to be kept, got %+v", got.Days[:3])
+	}
+	if _, err := repo.GetRosterTemplate(ctx, uuid.New()); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetRosterTemplate(missing) error = %v; want ErrNotFound", err)
+	}
+
+	winter.Name = "Winter weekdays"
+	if err := repo.SaveRosterTemplate(ctx, winter); err != nil {
+		t.Fatalf("SaveRosterTemplate: %v", err)
+	}
+	templates, err := repo.LoadAllRosterTemplates(ctx)
+	if err != nil {
+		t.Fatalf("LoadAllRosterTemplates: %v", err)
+	}
+	if len(templates) != 2 || templates[0].ID != autumn.ID || templates[1].Name != "Winter weekdays" {
+		t.Fatalf("LoadAllRosterTemplates = %+v; want Autumn then the renamed Winter", templates)
+	}
+
+	if err := repo.DeleteRosterTemplate(ctx, autumn.ID); err != nil {
+		t.Fatalf("DeleteRosterTemplate: %v", err)
+	}
+	if _, err := repo.GetRosterTemplate(ctx, autumn.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected the deleted template to be gone, got %v", err)
+	}
+}
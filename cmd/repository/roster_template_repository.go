@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"roster/cmd/models"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RosterTemplateRepository defines persistence operations for saved roster
+// week templates.
+type RosterTemplateRepository interface {
+	// SaveRosterTemplate stores template, replacing any with the same ID.
+	SaveRosterTemplate(ctx context.Context, template models.RosterTemplate) error
+	// GetRosterTemplate returns the template with the given ID, or
+	// ErrNotFound.
+	GetRosterTemplate(ctx context.Context, id uuid.UUID) (*models.RosterTemplate, error)
+	// LoadAllRosterTemplates returns every template, ordered by name.
+	LoadAllRosterTemplates(ctx context.Context) ([]*models.RosterTemplate, error)
+	DeleteRosterTemplate(ctx context.Context, id uuid.UUID) error
+}
+
+// MongoRosterTemplateRepository implements RosterTemplateRepository using
+// MongoDB.
+type MongoRosterTemplateRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoRosterTemplateRepository creates a new instance of
+// MongoRosterTemplateRepository.
+func NewMongoRosterTemplateRepository(db *mongo.Database) *MongoRosterTemplateRepository {
+	return &MongoRosterTemplateRepository{
+		collection: db.Collection("rosterTemplates"),
+	}
+}
+
+func (r *MongoRosterTemplateRepository) SaveRosterTemplate(ctx context.Context, template models.RosterTemplate) error {
+	opts := options.Replace().SetUpsert(true)
+	if _, err := r.collection.ReplaceOne(ctx, bson.M{"id": template.ID}, template, opts); err != nil {
+		return fmt.Errorf("SaveRosterTemplate: %w", err)
+	}
+	return nil
+}
+
+func (r *MongoRosterTemplateRepository) GetRosterTemplate(ctx context.Context, id uuid.UUID) (*models.RosterTemplate, error) {
+	var template models.RosterTemplate
+	if err := r.collection.FindOne(ctx, bson.M{"id": id}).Decode(&template); err != nil {
+		return nil, fmt.Errorf("GetRosterTemplate: %w", err)
+	}
+	template.CreatedAt = template.CreatedAt.Local()
+	return &template, nil
+}
+
+func (r *MongoRosterTemplateRepository) LoadAllRosterTemplates(ctx context.Context) ([]*models.RosterTemplate, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("LoadAllRosterTemplates: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	templates := []*models.RosterTemplate{}
+	if err := cursor.All(ctx, &templates); err != nil {
+		return nil, fmt.Errorf("LoadAllRosterTemplates: %w", err)
+	}
+	for _, template := range templates {
+		template.CreatedAt = template.CreatedAt.Local()
+	}
+	return templates, nil
+}
+
+func (r *MongoRosterTemplateRepository) DeleteRosterTemplate(ctx context.Context, id uuid.UUID) error {
+	if _, err := r.collection.DeleteOne(ctx, bson.M{"id": id}); err != nil {
+		return fmt.Errorf("DeleteRosterTemplate: %w", err)
+	}
+	return nil
+}
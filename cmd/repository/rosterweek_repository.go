@@ -2,7 +2,9 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"roster/cmd/models"
 	"roster/cmd/utils"
@@ -14,53 +16,90 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrRevisionConflict is returned when a roster week is saved from a revision
+// that has since been superseded by another save.
+var ErrRevisionConflict = errors.New("roster week was modified concurrently")
+
 // RosterWeekRepository defines the interface for RosterWeek persistence.
 type RosterWeekRepository interface {
-	SaveRosterWeek(week *models.RosterWeek) error
-	SaveAllRosterWeeks(weeks []*models.RosterWeek) error
-	LoadAllRosterWeeks() ([]*models.RosterWeek, error)
-	LoadRosterWeek(weekOffset int) (*models.RosterWeek, error)
-	ChangeDayRowCount(weekOffset int, dayID uuid.UUID, action string) (*models.RosterDay, bool, error)
+	SaveRosterWeek(ctx context.Context, week *models.RosterWeek) error
+	SaveAllRosterWeeks(ctx context.Context, weeks []*models.RosterWeek) error
+	LoadAllRosterWeeks(ctx context.Context) ([]*models.RosterWeek, error)
+	LoadRosterWeek(ctx context.Context, weekOffset int) (*models.RosterWeek, error)
+	// GetRosterWeek returns the week with the given offset, or ErrNotFound if
+	// it hasn't been created. Unlike LoadRosterWeek it never creates one.
+	GetRosterWeek(ctx context.Context, weekOffset int) (*models.RosterWeek, error)
+	ChangeDayRowCount(ctx context.Context, weekOffset int, dayID uuid.UUID, action string) (*models.RosterDay, bool, error)
+	// UpdateSlotAssignment, UpdateSlotStartTime and UpdateSlotDescription
+	// change a single slot in place without rewriting the rest of the week.
+	// They return the week's new revision, or ErrNotFound if the week has no
+	// slot with the given ID.
+	UpdateSlotAssignment(ctx context.Context, weekOffset int, slotID uuid.UUID, staffID *uuid.UUID, staffString *string) (int, error)
+	UpdateSlotStartTime(ctx context.Context, weekOffset int, slotID uuid.UUID, startTime string) (int, error)
+	UpdateSlotDescription(ctx context.Context, weekOffset int, slotID uuid.UUID, description string) (int, error)
 }
 
+// minDayRows is the number of rows a roster day can not be shrunk below.
+const minDayRows = 4
+
 // MongoRosterWeekRepository is the MongoDB implementation of RosterWeekRepository.
 type MongoRosterWeekRepository struct {
 	collection *mongo.Collection
-	ctx        context.Context
 }
 
 // NewMongoRosterWeekRepository creates a new instance of MongoRosterWeekRepository.
 // Typically this is called during server/repository initialization.
-func NewMongoRosterWeekRepository(ctx context.Context, db *mongo.Database) RosterWeekRepository {
+func NewMongoRosterWeekRepository(db *mongo.Database) RosterWeekRepository {
 	return &MongoRosterWeekRepository{
 		collection: db.Collection("rosters"),
-		ctx:        ctx,
 	}
 }
 
-// SaveRosterWeek saves a single roster week to MongoDB.
-func (r *MongoRosterWeekRepository) SaveRosterWeek(week *models.RosterWeek) error {
-	filter := bson.M{"id": week.ID}
-	update := bson.M{"$set": week}
-	opts := options.Update().SetUpsert(true)
-	_, err := r.collection.UpdateOne(r.ctx, filter, update, opts)
+// SaveRosterWeek saves a single roster week to MongoDB. The save only succeeds
+// if the stored revision still matches week.Revision, otherwise
+// ErrRevisionConflict is returned. On success week.Revision is incremented.
+func (r *MongoRosterWeekRepository) SaveRosterWeek(ctx context.Context, week *models.RosterWeek) error {
+	filter := bson.M{"id": week.ID, "revision": week.Revision}
+	if week.Revision == 0 {
+		// Weeks saved before revisions were introduced have no revision field.
+		filter["revision"] = bson.M{"$in": bson.A{0, nil}}
+	}
+	updated := *week
+	updated.Revision++
+	res, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": updated})
 	if err != nil {
 		return fmt.Errorf("failed to save roster week (id: %v): %w", week.ID, err)
 	}
-	utils.PrintLog("Saved roster week (id: %v)", week.ID)
+	if res.MatchedCount == 0 {
+		count, err := r.collection.CountDocuments(ctx, bson.M{"id": week.ID})
+		if err != nil {
+			return fmt.Errorf("failed to save roster week (id: %v): %w", week.ID, err)
+		}
+		if count > 0 {
+			return fmt.Errorf("failed to save roster week (id: %v): %w", week.ID, ErrRevisionConflict)
+		}
+		if _, err := r.collection.InsertOne(ctx, updated); err != nil {
+			return fmt.Errorf("failed to save roster week (id: %v): %w", week.ID, err)
+		}
+	}
+	week.Revision = updated.Revision
+	utils.PrintLog("Saved roster week (id: %v, revision: %v)", week.ID, week.Revision)
 	return nil
 }
 
-// SaveAllRosterWeeks performs a bulk upsert of roster weeks.
-func (r *MongoRosterWeekRepository) SaveAllRosterWeeks(weeks []*models.RosterWeek) error {
+// SaveAllRosterWeeks performs a bulk upsert of roster weeks. Revisions are not
+// checked, so it is only suitable for maintenance tasks such as migrations.
+// Weeks are saved in order, stopping at the first that fails, so a caller can
+// rely on every week before it having been saved.
+func (r *MongoRosterWeekRepository) SaveAllRosterWeeks(ctx context.Context, weeks []*models.RosterWeek) error {
 	bulkModels := make([]mongo.WriteModel, len(weeks))
 	for i, week := range weeks {
 		filter := bson.M{"id": week.ID}
 		update := bson.M{"$set": week}
 		bulkModels[i] = mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(true)
 	}
-	opts := options.BulkWrite().SetOrdered(false)
-	results, err := r.collection.BulkWrite(r.ctx, bulkModels, opts)
+	opts := options.BulkWrite().SetOrdered(true)
+	results, err := r.collection.BulkWrite(ctx, bulkModels, opts)
 	if err != nil {
 		return fmt.Errorf("failed to bulk save roster weeks: %w", err)
 	}
@@ -69,15 +108,15 @@ func (r *MongoRosterWeekRepository) SaveAllRosterWeeks(weeks []*models.RosterWee
 }
 
 // LoadAllRosterWeeks returns all roster weeks from the database.
-func (r *MongoRosterWeekRepository) LoadAllRosterWeeks() ([]*models.RosterWeek, error) {
-	cursor, err := r.collection.Find(r.ctx, bson.M{})
+func (r *MongoRosterWeekRepository) LoadAllRosterWeeks(ctx context.Context) ([]*models.RosterWeek, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{})
 	if err != nil {
 		return nil, fmt.Errorf("error executing query for all roster weeks: %w", err)
 	}
-	defer cursor.Close(r.ctx)
+	defer cursor.Close(ctx)
 
 	var weeks []*models.RosterWeek
-	for cursor.Next(r.ctx) {
+	for cursor.Next(ctx) {
 		var week models.RosterWeek
 		if err := cursor.Decode(&week); err != nil {
 			utils.PrintError(err, "Error decoding roster week")
@@ -88,15 +127,15 @@ func (r *MongoRosterWeekRepository) LoadAllRosterWeeks() ([]*models.RosterWeek,
 	return weeks, nil
 }
 
-func (r *MongoRosterWeekRepository) LoadRosterWeek(weekOffset int) (*models.RosterWeek, error) {
+func (r *MongoRosterWeekRepository) LoadRosterWeek(ctx context.Context, weekOffset int) (*models.RosterWeek, error) {
 	filter := bson.M{"weekOffset": weekOffset}
 
 	var rosterWeek models.RosterWeek
-	err := r.collection.FindOne(r.ctx, filter).Decode(&rosterWeek)
+	err := r.collection.FindOne(ctx, filter).Decode(&rosterWeek)
 	if err == mongo.ErrNoDocuments {
 		utils.PrintError(err, "Creating new roster week")
 		newWeek := newRosterWeek(weekOffset)
-		if saveErr := r.SaveRosterWeek(&newWeek); saveErr != nil {
+		if saveErr := r.SaveRosterWeek(ctx, &newWeek); saveErr != nil {
 			return nil, fmt.Errorf("failed to save new roster week: %w", saveErr)
 		}
 		return &newWeek, nil
@@ -106,84 +145,133 @@ func (r *MongoRosterWeekRepository) LoadRosterWeek(weekOffset int) (*models.Rost
 	return &rosterWeek, nil
 }
 
-// ChangeDayRowCount modifies the number of rows in a specific RosterDay.
-// Returns the affected day, the roster week's live status and an error if applicable.
-func (r *MongoRosterWeekRepository) ChangeDayRowCount(weekOffset int, dayID uuid.UUID, action string) (*models.RosterDay, bool, error) {
-	week, err := r.LoadRosterWeek(weekOffset)
+// GetRosterWeek returns the week with the given offset, or ErrNotFound.
+func (r *MongoRosterWeekRepository) GetRosterWeek(ctx context.Context, weekOffset int) (*models.RosterWeek, error) {
+	var rosterWeek models.RosterWeek
+	err := r.collection.FindOne(ctx, bson.M{"weekOffset": weekOffset}).Decode(&rosterWeek)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("GetRosterWeek: %w", ErrNotFound)
+	} else if err != nil {
+		return nil, fmt.Errorf("error loading roster week: %w", err)
+	}
+	return &rosterWeek, nil
+}
+
+// ChangeDayRowCount adds ("+") or removes (any other action) the last row of
+// a specific RosterDay with a single atomic update. Days never shrink below
+// minDayRows. Returns the affected day, the roster week's live status and an
+// error if applicable.
+func (r *MongoRosterWeekRepository) ChangeDayRowCount(ctx context.Context, weekOffset int, dayID uuid.UUID, action string) (*models.RosterDay, bool, error) {
+	// The week's shifts never change, so the row can be made before the update.
+	current, err := r.LoadRosterWeek(ctx, weekOffset)
 	if err != nil {
 		return nil, false, fmt.Errorf("failed to load roster week for modifying row count: %w", err)
 	}
-
-	var affectedDay *models.RosterDay
-	for i, day := range week.Days {
-		if day.ID == dayID {
-			if action == "+" {
-				week.Days[i].Rows = append(week.Days[i].Rows, newRow())
-			} else {
-				if len(week.Days[i].Rows) > 4 {
-					week.Days[i].Rows = week.Days[i].Rows[:len(week.Days[i].Rows)-1]
-				}
-			}
-			affectedDay = week.Days[i]
-			break
+	filter := bson.M{"weekOffset": weekOffset, "days.id": dayID}
+	update := bson.M{
+		"$push": bson.M{"days.$[day].rows": models.NewRow(current.Slots)},
+		"$inc":  bson.M{"revision": 1},
+	}
+	if action != "+" {
+		filter = bson.M{
+			"weekOffset": weekOffset,
+			"days": bson.M{"$elemMatch": bson.M{
+				"id":                               dayID,
+				fmt.Sprintf("rows.%d", minDayRows): bson.M{"$exists": true},
+			}},
+		}
+		update = bson.M{
+			"$pop": bson.M{"days.$[day].rows": 1},
+			"$inc": bson.M{"revision": 1},
 		}
 	}
+	opts := options.FindOneAndUpdate().
+		SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"day.id": dayID}}}).
+		SetReturnDocument(options.After)
 
-	if affectedDay == nil {
+	var week models.RosterWeek
+	err = r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&week)
+	if err == mongo.ErrNoDocuments {
+		// Either the day does not exist or it is already at its minimum size.
+		week = *current
+	} else if err != nil {
+		return nil, false, fmt.Errorf("failed to change day row count: %w", err)
+	}
+
+	day := week.GetDayByID(dayID)
+	if day == nil {
 		return nil, week.IsLive, fmt.Errorf("no roster day found with id: %v", dayID)
 	}
+	return day, week.IsLive, nil
+}
+
+func (r *MongoRosterWeekRepository) UpdateSlotAssignment(ctx context.Context, weekOffset int, slotID uuid.UUID, staffID *uuid.UUID, staffString *string) (int, error) {
+	return r.updateSlot(ctx, weekOffset, slotID, bson.M{"assignedstaff": staffID, "staffstring": staffString})
+}
+
+func (r *MongoRosterWeekRepository) UpdateSlotStartTime(ctx context.Context, weekOffset int, slotID uuid.UUID, startTime string) (int, error) {
+	return r.updateSlot(ctx, weekOffset, slotID, bson.M{"starttime": startTime})
+}
 
-	if err := r.SaveRosterWeek(week); err != nil {
-		return nil, week.IsLive, fmt.Errorf("failed to save roster week after changing day row count: %w", err)
+func (r *MongoRosterWeekRepository) UpdateSlotDescription(ctx context.Context, weekOffset int, slotID uuid.UUID, description string) (int, error) {
+	return r.updateSlot(ctx, weekOffset, slotID, bson.M{"description": description})
+}
+
+// updateSlot sets fields on the slot with the given ID and bumps the week's
+// revision in one update.
+func (r *MongoRosterWeekRepository) updateSlot(ctx context.Context, weekOffset int, slotID uuid.UUID, fields bson.M) (int, error) {
+	set := bson.M{}
+	for field, value := range fields {
+		set["days.$[].rows.$[].slots.$[slot]."+field] = value
 	}
+	filter := bson.M{"weekOffset": weekOffset, "days.rows.slots.id": slotID}
+	update := bson.M{"$set": set, "$inc": bson.M{"revision": 1}}
+	opts := options.FindOneAndUpdate().
+		SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"slot.id": slotID}}}).
+		SetReturnDocument(options.After).
+		SetProjection(bson.M{"revision": 1})
 
-	return affectedDay, week.IsLive, nil
+	var result struct {
+		Revision int `bson:"revision"`
+	}
+	if err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&result); err != nil {
+		return 0, fmt.Errorf("failed to update slot (id: %v): %w", slotID, err)
+	}
+	utils.PrintLog("Updated slot (id: %v, revision: %v)", slotID, result.Revision)
+	return result.Revision, nil
 }
 
 // -- Helper functions for repository internal use --
 
 // newRosterWeek is a helper for creating a new RosterWeek from a startDate.
 func newRosterWeek(weekOffset int) models.RosterWeek {
-	// Convert the start date to local time then use it to generate days.
-	dayNames := []string{"Tues", "Wed", "Thurs", "Fri", "Sat", "Sun", "Mon"}
+	slots := models.DefaultSlots()
 	var days []*models.RosterDay
-
-	for i, name := range dayNames {
-		colour := "#ffffff"
-		if i%2 == 0 {
-			colour = "#b7b7b7"
-		}
-		day := &models.RosterDay{
-			ID:      uuid.New(),
-			DayName: name,
-			Rows:    []*models.Row{newRow(), newRow(), newRow(), newRow()},
-			Colour:  colour,
-			Offset:  i,
-		}
-		days = append(days, day)
+	for i, weekday := range utils.WeekDays() {
+		days = append(days, NewRosterDay(i, weekday, slots))
 	}
 
 	return models.RosterWeek{
 		ID:         uuid.New(),
 		WeekOffset: weekOffset,
+		Slots:      slots,
 		Days:       days,
 		IsLive:     false,
 	}
 }
 
-func newRow() *models.Row {
-	return &models.Row{
-		ID:    uuid.New(),
-		Early: newSlot(),
-		Mid:   newSlot(),
-		Late:  newSlot(),
+// NewRosterDay returns an empty roster day for weekday, offset days into its
+// week, with rows of slots.
+func NewRosterDay(offset int, weekday time.Weekday, slots []models.SlotDefinition) *models.RosterDay {
+	colour := "#ffffff"
+	if offset%2 == 0 {
+		colour = "#b7b7b7"
 	}
-}
-
-func newSlot() models.Slot {
-	return models.Slot{
-		ID:        uuid.New(),
-		StartTime: "",
-		// AssignedStaff remains nil until set.
+	return &models.RosterDay{
+		ID:      uuid.New(),
+		DayName: utils.ShortDayName(weekday),
+		Rows:    []*models.Row{models.NewRow(slots), models.NewRow(slots), models.NewRow(slots), models.NewRow(slots)},
+		Colour:  colour,
+		Offset:  offset,
 	}
 }
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"roster/cmd/models"
@@ -45,17 +46,23 @@ func TestNewRosterWeek(t *testing.T) {
 	}
 }
 
-func TestNewRowAndNewSlot(t *testing.T) {
-	row := newRow()
-	// Row should have 3 slots
-	slots := []models.Slot{row.Early, row.Mid, row.Late}
-	for _, slot := range slots {
-		if slot.ID == uuid.Nil {
-			t.Errorf("newRow: slot has nil ID")
+func TestNewRosterDay(t *testing.T) {
+	slots := []models.SlotDefinition{{Name: "Lunch", StartTime: "11:30"}, {Name: "Dinner"}}
+	day := NewRosterDay(2, time.Saturday, slots)
+	if day.DayName != "Sat" || day.Offset != 2 {
+		t.Errorf("NewRosterDay: got %s at offset %d, want Sat at 2", day.DayName, day.Offset)
+	}
+	for _, row := range day.Rows {
+		if len(row.Slots) != 2 {
+			t.Fatalf("NewRosterDay: expected a slot per shift, got %d", len(row.Slots))
 		}
-		// StartTime defaults to empty
-		if slot.StartTime != "" {
-			t.Errorf("newRow: expected empty StartTime, got %s", slot.StartTime)
+		for i, slot := range row.Slots {
+			if slot.ID == uuid.Nil {
+				t.Errorf("NewRosterDay: slot has nil ID")
+			}
+			if slot.Name != slots[i].Name || slot.StartTime != slots[i].StartTime {
+				t.Errorf("NewRosterDay: slot %d = %s at %q, want %s at %q", i, slot.Name, slot.StartTime, slots[i].Name, slots[i].StartTime)
+			}
 		}
 	}
 }
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"roster/cmd/models"
+	"roster/cmd/utils"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SessionRepository defines persistence operations for login sessions.
+// Revoking a session deletes it.
+type SessionRepository interface {
+	CreateSession(ctx context.Context, session models.Session) error
+	// GetSession returns the session with the given ID, or ErrNotFound.
+	GetSession(ctx context.Context, id uuid.UUID) (*models.Session, error)
+	// TouchSession records that the session was used at lastSeen.
+	TouchSession(ctx context.Context, id uuid.UUID, lastSeen time.Time) error
+	// FindStaffSessions returns a staff member's sessions, most recently used
+	// first, including any that have expired but not yet been deleted.
+	FindStaffSessions(ctx context.Context, staffID uuid.UUID) ([]*models.Session, error)
+	DeleteSession(ctx context.Context, id uuid.UUID) error
+	DeleteStaffSessions(ctx context.Context, staffID uuid.UUID) error
+	// DeleteExpiredSessions removes sessions whose absolute expiry or last
+	// use is before the given times, returning how many were removed.
+	DeleteExpiredSessions(ctx context.Context, expiredBefore time.Time, idleBefore time.Time) (int64, error)
+}
+
+// MongoSessionRepository implements SessionRepository using MongoDB.
+type MongoSessionRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoSessionRepository creates a new instance of MongoSessionRepository.
+func NewMongoSessionRepository(db *mongo.Database) *MongoSessionRepository {
+	return &MongoSessionRepository{
+		collection: db.Collection("sessions"),
+	}
+}
+
+func (r *MongoSessionRepository) CreateSession(ctx context.Context, session models.Session) error {
+	if _, err := r.collection.InsertOne(ctx, session); err != nil {
+		return fmt.Errorf("CreateSession: %w", err)
+	}
+	return nil
+}
+
+func (r *MongoSessionRepository) GetSession(ctx context.Context, id uuid.UUID) (*models.Session, error) {
+	var session models.Session
+	if err := r.collection.FindOne(ctx, bson.M{"id": id}).Decode(&session); err != nil {
+		return nil, fmt.Errorf("GetSession: %w", err)
+	}
+	localSessionTimes(&session)
+	return &session, nil
+}
+
+func (r *MongoSessionRepository) TouchSession(ctx context.Context, id uuid.UUID, lastSeen time.Time) error {
+	res, err := r.collection.UpdateOne(ctx, bson.M{"id": id}, bson.M{"$set": bson.M{"lastSeen": lastSeen}})
+	if err != nil {
+		return fmt.Errorf("TouchSession: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("TouchSession: %w", ErrNotFound)
+	}
+	return nil
+}
+
+func (r *MongoSessionRepository) FindStaffSessions(ctx context.Context, staffID uuid.UUID) ([]*models.Session, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "lastSeen", Value: -1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"staffId": staffID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("FindStaffSessions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []*models.Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, fmt.Errorf("FindStaffSessions: %w", err)
+	}
+	for _, session := range sessions {
+		localSessionTimes(session)
+	}
+	return sessions, nil
+}
+
+func (r *MongoSessionRepository) DeleteSession(ctx context.Context, id uuid.UUID) error {
+	if _, err := r.collection.DeleteOne(ctx, bson.M{"id": id}); err != nil {
+		return fmt.Errorf("DeleteSession: %w", err)
+	}
+	return nil
+}
+
+func (r *MongoSessionRepository) DeleteStaffSessions(ctx context.Context, staffID uuid.UUID) error {
+	res, err := r.collection.DeleteMany(ctx, bson.M{"staffId": staffID})
+	if err != nil {
+		return fmt.Errorf("DeleteStaffSessions: %w", err)
+	}
+	utils.PrintLog("Deleted %d sessions for staff %v", res.DeletedCount, staffID)
+	return nil
+}
+
+func (r *MongoSessionRepository) DeleteExpiredSessions(ctx context.Context, expiredBefore time.Time, idleBefore time.Time) (int64, error) {
+	res, err := r.collection.DeleteMany(ctx, bson.M{"$or": bson.A{
+		bson.M{"expiresAt": bson.M{"$lt": expiredBefore}},
+		bson.M{"lastSeen": bson.M{"$lt": idleBefore}},
+	}})
+	if err != nil {
+		return 0, fmt.Errorf("DeleteExpiredSessions: %w", err)
+	}
+	return res.DeletedCount, nil
+}
+
+// localSessionTimes converts the UTC times the database returns back into
+// local time.
+func localSessionTimes(s *models.Session) {
+	s.CreatedAt = s.CreatedAt.Local()
+	s.LastSeen = s.LastSeen.Local()
+	s.ExpiresAt = s.ExpiresAt.Local()
+}
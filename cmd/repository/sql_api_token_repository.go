@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"roster/cmd/models"
+
+	"github.com/google/uuid"
+)
+
+// SQLAPITokenRepository implements APITokenRepository on a SQL database.
+type SQLAPITokenRepository struct {
+	store *sqlStore
+}
+
+func newSQLAPITokenRepository(store *sqlStore) *SQLAPITokenRepository {
+	return &SQLAPITokenRepository{store: store}
+}
+
+const apiTokenColumns = "id, staff_id, name, token_hash, permissions, created_at, last_used_at"
+
+func (r *SQLAPITokenRepository) CreateAPIToken(ctx context.Context, t models.APIToken) error {
+	var lastUsed sql.NullTime
+	if !t.LastUsedAt.IsZero() {
+		lastUsed = sql.NullTime{Time: sqlTime(t.LastUsedAt), Valid: true}
+	}
+	_, err := r.store.conn(ctx).exec(`INSERT INTO api_tokens (`+apiTokenColumns+`) VALUES (`+sqlPlaceholders(7)+`)`,
+		t.ID, t.StaffID, t.Name, t.TokenHash, joinPermissions(t.Permissions), sqlTime(t.CreatedAt), lastUsed)
+	if err != nil {
+		return fmt.Errorf("CreateAPIToken: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLAPITokenRepository) GetAPITokenByHash(ctx context.Context, tokenHash string) (*models.APIToken, error) {
+	row := r.store.conn(ctx).queryRow("SELECT "+apiTokenColumns+" FROM api_tokens WHERE token_hash = ?", tokenHash)
+	token, err := scanSQLAPIToken(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("GetAPITokenByHash: %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetAPITokenByHash: %w", err)
+	}
+	return token, nil
+}
+
+func (r *SQLAPITokenRepository) FindStaffAPITokens(ctx context.Context, staffID uuid.UUID) ([]*models.APIToken, error) {
+	tokens := []*models.APIToken{}
+	query := "SELECT " + apiTokenColumns + " FROM api_tokens WHERE staff_id = ? ORDER BY created_at DESC"
+	err := scanSQLRows(r.store.conn(ctx), query, []any{staffID}, func(rows *sql.Rows) error {
+		token, err := scanSQLAPIToken(rows)
+		if err != nil {
+			return err
+		}
+		tokens = append(tokens, token)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("FindStaffAPITokens: %w", err)
+	}
+	return tokens, nil
+}
+
+func (r *SQLAPITokenRepository) TouchAPIToken(ctx context.Context, id uuid.UUID, lastUsed time.Time) error {
+	res, err := r.store.conn(ctx).exec("UPDATE api_tokens SET last_used_at = ? WHERE id = ?", sqlTime(lastUsed), id)
+	if err != nil {
+		return fmt.Errorf("TouchAPIToken: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("TouchAPIToken: %w", ErrNotFound)
+	}
+	return nil
+}
+
+func (r *SQLAPITokenRepository) DeleteAPIToken(ctx context.Context, id uuid.UUID) error {
+	if _, err := r.store.conn(ctx).exec("DELETE FROM api_tokens WHERE id = ?", id); err != nil {
+		return fmt.Errorf("DeleteAPIToken: %w", err)
+	}
+	return nil
+}
+
+func scanSQLAPIToken(row interface{ Scan(dest ...any) error }) (*models.APIToken, error) {
+	var t models.APIToken
+	var permissions string
+	var lastUsed sql.NullTime
+	if err := row.Scan(&t.ID, &t.StaffID, &t.Name, &t.TokenHash, &permissions, &t.CreatedAt, &lastUsed); err != nil {
+		return nil, err
+	}
+	t.Permissions = splitPermissions(permissions)
+	t.CreatedAt = localTime(t.CreatedAt)
+	if lastUsed.Valid {
+		t.LastUsedAt = localTime(lastUsed.Time)
+	}
+	return &t, nil
+}
+
+// joinPermissions stores a list of permissions in a single column.
+func joinPermissions(perms []models.Permission) string {
+	names := make([]string, len(perms))
+	for i, perm := range perms {
+		names[i] = string(perm)
+	}
+	return strings.Join(names, ",")
+}
+
+func splitPermissions(column string) []models.Permission {
+	perms := []models.Permission{}
+	if column == "" {
+		return perms
+	}
+	for _, name := range strings.Split(column, ",") {
+		perms = append(perms, models.Permission(name))
+	}
+	return perms
+}
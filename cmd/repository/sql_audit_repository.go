@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"roster/cmd/models"
+	"roster/cmd/utils"
+)
+
+// SQLAuditRepository implements AuditRepository on a SQL database.
+type SQLAuditRepository struct {
+	store *sqlStore
+}
+
+func newSQLAuditRepository(store *sqlStore) *SQLAuditRepository {
+	return &SQLAuditRepository{store: store}
+}
+
+const auditColumns = `id, timestamp, actor_id, actor_name, action, entity_type, entity_id,
+	before_value, after_value`
+
+func (r *SQLAuditRepository) RecordAudit(ctx context.Context, e models.AuditEntry) error {
+	_, err := r.store.conn(ctx).exec(`INSERT INTO audit_log (`+auditColumns+`) VALUES (`+sqlPlaceholders(9)+`)`,
+		e.ID, sqlTime(e.Timestamp), e.ActorID, e.ActorName, e.Action, e.EntityType, e.EntityID,
+		e.Before, e.After)
+	if err != nil {
+		utils.PrintError(err, "Failed to record audit entry")
+		return err
+	}
+	return nil
+}
+
+// FindAuditEntries returns the entries matching filter, newest first.
+func (r *SQLAuditRepository) FindAuditEntries(ctx context.Context, filter AuditFilter) ([]*models.AuditEntry, error) {
+	where := []string{"1 = 1"}
+	var args []any
+	if filter.ActorID != nil {
+		where = append(where, "actor_id = ?")
+		args = append(args, *filter.ActorID)
+	}
+	if filter.EntityType != "" {
+		where = append(where, "entity_type = ?")
+		args = append(args, filter.EntityType)
+	}
+	if filter.EntityID != nil {
+		where = append(where, "entity_id = ?")
+		args = append(args, *filter.EntityID)
+	}
+	if filter.Action != "" {
+		where = append(where, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if !filter.From.IsZero() {
+		where = append(where, "timestamp >= ?")
+		args = append(args, sqlTime(filter.From))
+	}
+	if !filter.To.IsZero() {
+		where = append(where, "timestamp < ?")
+		args = append(args, sqlTime(filter.To))
+	}
+	query := "SELECT " + auditColumns + " FROM audit_log WHERE " + strings.Join(where, " AND ") + " ORDER BY timestamp DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	entries := []*models.AuditEntry{}
+	err := scanSQLRows(r.store.conn(ctx), query, args, func(rows *sql.Rows) error {
+		var e models.AuditEntry
+		err := rows.Scan(&e.ID, &e.Timestamp, &e.ActorID, &e.ActorName, &e.Action, &e.EntityType,
+			&e.EntityID, &e.Before, &e.After)
+		if err != nil {
+			return err
+		}
+		e.Timestamp = localTime(e.Timestamp)
+		entries = append(entries, &e)
+		return nil
+	})
+	if err != nil {
+		utils.PrintError(err, "Error finding audit entries")
+		return nil, err
+	}
+	return entries, nil
+}
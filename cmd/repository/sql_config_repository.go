@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"roster/cmd/models"
+	"roster/cmd/utils"
+)
+
+// SQLConfigRepository implements ConfigRepository on a SQL database.
+type SQLConfigRepository struct {
+	store *sqlStore
+}
+
+func newSQLConfigRepository(store *sqlStore) *SQLConfigRepository {
+	return &SQLConfigRepository{store: store}
+}
+
+func (r *SQLConfigRepository) SaveVersion(ctx context.Context, v models.Version) error {
+	_, err := r.store.conn(ctx).exec(`INSERT INTO config_versions (id, version) VALUES (?, ?)
+		ON CONFLICT (id) DO UPDATE SET version = excluded.version`, v.ID, v.Version)
+	if err != nil {
+		utils.PrintError(err, "Failed to save version")
+		return err
+	}
+	utils.PrintLog("Saved version")
+	return nil
+}
+
+func (r *SQLConfigRepository) LoadVersion(ctx context.Context) (*models.Version, error) {
+	version := models.Version{ID: "version"}
+	err := r.store.conn(ctx).queryRow("SELECT version FROM config_versions WHERE id = ?", version.ID).Scan(&version.Version)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			utils.PrintError(err, "Error reading version")
+			return nil, err
+		}
+		utils.PrintLog("Creating new version")
+		version.Version = 1
+	}
+	return &version, nil
+}
+
+func (r *SQLConfigRepository) LoadVersionByID(ctx context.Context, id string) (*models.Version, error) {
+	version := models.Version{ID: id}
+	err := r.store.conn(ctx).queryRow("SELECT version FROM config_versions WHERE id = ?", id).Scan(&version.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		utils.PrintError(err, "Error reading version")
+		return nil, err
+	}
+	return &version, nil
+}
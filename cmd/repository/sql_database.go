@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"roster/cmd/utils"
+)
+
+// sqlDialect captures the differences between the SQL databases we support.
+// Queries are written with ? placeholders and rebound for the dialect.
+type sqlDialect struct {
+	name string
+	// numberedParams selects $1, $2, ... placeholders instead of ?.
+	numberedParams bool
+}
+
+var sqliteDialect = sqlDialect{name: "sqlite"}
+
+// sqlQuerier is satisfied by both *sql.DB and *sql.Tx.
+type sqlQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// sqlStore is the shared state behind every SQL backed repository.
+type sqlStore struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+// sqlConn runs dialect-aware queries against a database or transaction,
+// bounded by the context of the request that issued them.
+type sqlConn struct {
+	ctx     context.Context
+	q       sqlQuerier
+	dialect sqlDialect
+}
+
+func (s *sqlStore) conn(ctx context.Context) sqlConn {
+	return sqlConn{ctx: ctx, q: s.db, dialect: s.dialect}
+}
+
+// withTx runs fn inside a transaction, committing only if it succeeds. The
+// transaction is rolled back if ctx is done before it commits.
+func (s *sqlStore) withTx(ctx context.Context, fn func(c sqlConn) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := fn(sqlConn{ctx: ctx, q: tx, dialect: s.dialect}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (c sqlConn) exec(query string, args ...any) (sql.Result, error) {
+	return c.q.ExecContext(c.ctx, c.dialect.rebind(query), args...)
+}
+
+func (c sqlConn) query(query string, args ...any) (*sql.Rows, error) {
+	return c.q.QueryContext(c.ctx, c.dialect.rebind(query), args...)
+}
+
+func (c sqlConn) queryRow(query string, args ...any) *sql.Row {
+	return c.q.QueryRowContext(c.ctx, c.dialect.rebind(query), args...)
+}
+
+// rebind rewrites ? placeholders for dialects that number their parameters.
+func (d sqlDialect) rebind(query string) string {
+	if !d.numberedParams {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// migrateSQLSchema applies, in order, every migration that has not yet been
+// recorded in the schema_migrations table. Migration i has version i+1.
+func migrateSQLSchema(s *sqlStore, migrations []string) error {
+	ctx := context.Background()
+	c := s.conn(ctx)
+	if _, err := c.exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	var current int
+	if err := c.queryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		err := s.withTx(ctx, func(c sqlConn) error {
+			if _, err := c.exec(migrations[i]); err != nil {
+				return err
+			}
+			_, err := c.exec("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)", version, sqlTime(time.Now()))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply %s schema migration %d: %w", s.dialect.name, version, err)
+		}
+		utils.PrintLog("Applied %s schema migration %d", s.dialect.name, version)
+	}
+	return nil
+}
+
+// sqlDate stores a calendar date the same way the models' MarshalBSON does:
+// as midnight local time on that date, converted to UTC.
+func sqlDate(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.Local).UTC()
+}
+
+// sqlTime stores an instant as UTC.
+func sqlTime(t time.Time) time.Time {
+	return t.UTC()
+}
+
+// localTime converts a stored date or instant back to local time, mirroring
+// the models' UnmarshalBSON.
+func localTime(t time.Time) time.Time {
+	return t.In(time.Local)
+}
+
+// sqlPlaceholders returns n comma separated ? placeholders.
+func sqlPlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"roster/cmd/models"
+)
+
+// SQLLoginLinkRepository implements LoginLinkRepository on a SQL database.
+type SQLLoginLinkRepository struct {
+	store *sqlStore
+}
+
+func newSQLLoginLinkRepository(store *sqlStore) *SQLLoginLinkRepository {
+	return &SQLLoginLinkRepository{store: store}
+}
+
+func (r *SQLLoginLinkRepository) CreateLoginLink(ctx context.Context, link models.LoginLink) error {
+	_, err := r.store.conn(ctx).exec(`INSERT INTO login_links (token_hash, purpose, staff_id, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		link.TokenHash, link.Purpose, link.StaffID, sqlTime(link.CreatedAt), sqlTime(link.ExpiresAt))
+	if err != nil {
+		return fmt.Errorf("CreateLoginLink: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLLoginLinkRepository) ConsumeLoginLink(ctx context.Context, purpose string, tokenHash string) (*models.LoginLink, error) {
+	var link models.LoginLink
+	err := r.store.withTx(ctx, func(c sqlConn) error {
+		row := c.queryRow(`SELECT token_hash, purpose, staff_id, created_at, expires_at
+			FROM login_links WHERE purpose = ? AND token_hash = ?`, purpose, tokenHash)
+		if err := row.Scan(&link.TokenHash, &link.Purpose, &link.StaffID, &link.CreatedAt, &link.ExpiresAt); err != nil {
+			return err
+		}
+		res, err := c.exec("DELETE FROM login_links WHERE token_hash = ?", tokenHash)
+		if err != nil {
+			return err
+		}
+		// Another request consumed the link first.
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("ConsumeLoginLink: %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ConsumeLoginLink: %w", err)
+	}
+	link.CreatedAt = localTime(link.CreatedAt)
+	link.ExpiresAt = localTime(link.ExpiresAt)
+	return &link, nil
+}
+
+func (r *SQLLoginLinkRepository) DeleteExpiredLoginLinks(ctx context.Context, expiredBefore time.Time) (int64, error) {
+	res, err := r.store.conn(ctx).exec("DELETE FROM login_links WHERE expires_at < ?", sqlTime(expiredBefore))
+	if err != nil {
+		return 0, fmt.Errorf("DeleteExpiredLoginLinks: %w", err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"roster/cmd/models"
+
+	"github.com/google/uuid"
+)
+
+// SQLRosterTemplateRepository implements RosterTemplateRepository on a SQL
+// database. A template's shifts and days are only ever read and written
+// whole, so they are stored as JSON in the layout column.
+type SQLRosterTemplateRepository struct {
+	store *sqlStore
+}
+
+func newSQLRosterTemplateRepository(store *sqlStore) *SQLRosterTemplateRepository {
+	return &SQLRosterTemplateRepository{store: store}
+}
+
+const rosterTemplateColumns = "id, name, created_at, created_by, includes_assignments, layout"
+
+// rosterTemplateLayout is the part of a template stored in the layout column.
+type rosterTemplateLayout struct {
+	Slots []models.SlotDefinition
+	Days  []*models.RosterDay
+}
+
+func (r *SQLRosterTemplateRepository) SaveRosterTemplate(ctx context.Context, t models.RosterTemplate) error {
+	layout, err := json.Marshal(rosterTemplateLayout{Slots: t.Slots, Days: t.Days})
+	if err != nil {
+		return fmt.Errorf("SaveRosterTemplate: %w", err)
+	}
+	_, err = r.store.conn(ctx).exec(`INSERT INTO roster_templates (`+rosterTemplateColumns+`) VALUES (`+sqlPlaceholders(6)+`)
+		ON CONFLICT (id) DO UPDATE SET
+			name = excluded.name, created_at = excluded.created_at, created_by = excluded.created_by,
+			includes_assignments = excluded.includes_assignments, layout = excluded.layout`,
+		t.ID, t.Name, sqlTime(t.CreatedAt), t.CreatedBy, t.IncludesAssignments, string(layout))
+	if err != nil {
+		return fmt.Errorf("SaveRosterTemplate: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLRosterTemplateRepository) GetRosterTemplate(ctx context.Context, id uuid.UUID) (*models.RosterTemplate, error) {
+	row := r.store.conn(ctx).queryRow("SELECT "+rosterTemplateColumns+" FROM roster_templates WHERE id = ?", id)
+	template, err := scanSQLRosterTemplate(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("GetRosterTemplate: %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetRosterTemplate: %w", err)
+	}
+	return template, nil
+}
+
+func (r *SQLRosterTemplateRepository) LoadAllRosterTemplates(ctx context.Context) ([]*models.RosterTemplate, error) {
+	templates := []*models.RosterTemplate{}
+	query := "SELECT " + rosterTemplateColumns + " FROM roster_templates ORDER BY name"
+	err := scanSQLRows(r.store.conn(ctx), query, nil, func(rows *sql.Rows) error {
+		template, err := scanSQLRosterTemplate(rows)
+		if err != nil {
+			return err
+		}
+		templates = append(templates, template)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("LoadAllRosterTemplates: %w", err)
+	}
+	return templates, nil
+}
+
+func (r *SQLRosterTemplateRepository) DeleteRosterTemplate(ctx context.Context, id uuid.UUID) error {
+	if _, err := r.store.conn(ctx).exec("DELETE FROM roster_templates WHERE id = ?", id); err != nil {
+		return fmt.Errorf("DeleteRosterTemplate: %w", err)
+	}
+	return nil
+}
+
+func scanSQLRosterTemplate(row interface{ Scan(dest ...any) error }) (*models.RosterTemplate, error) {
+	var t models.RosterTemplate
+	var layout string
+	if err := row.Scan(&t.ID, &t.Name, &t.CreatedAt, &t.CreatedBy, &t.IncludesAssignments, &layout); err != nil {
+		return nil, err
+	}
+	var decoded rosterTemplateLayout
+	if err := json.Unmarshal([]byte(layout), &decoded); err != nil {
+		return nil, err
+	}
+	t.Slots = decoded.Slots
+	t.Days = decoded.Days
+	t.CreatedAt = localTime(t.CreatedAt)
+	return &t, nil
+}
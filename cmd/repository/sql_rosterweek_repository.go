@@ -0,0 +1,406 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"roster/cmd/models"
+	"roster/cmd/utils"
+
+	"github.com/google/uuid"
+)
+
+// SQLRosterWeekRepository implements RosterWeekRepository on a SQL database.
+// Weeks are normalised into roster_weeks, roster_week_slots, roster_days,
+// roster_rows and roster_slots.
+type SQLRosterWeekRepository struct {
+	store *sqlStore
+}
+
+func newSQLRosterWeekRepository(store *sqlStore) *SQLRosterWeekRepository {
+	return &SQLRosterWeekRepository{store: store}
+}
+
+// SaveRosterWeek saves a single roster week, replacing its days, rows and
+// slots. The save only succeeds if the stored revision still matches
+// week.Revision, otherwise ErrRevisionConflict is returned. On success
+// week.Revision is incremented.
+func (r *SQLRosterWeekRepository) SaveRosterWeek(ctx context.Context, week *models.RosterWeek) error {
+	updated := *week
+	updated.Revision++
+	err := r.store.withTx(ctx, func(c sqlConn) error {
+		// Claim the row first so concurrent saves of the same revision fail.
+		res, err := c.exec("UPDATE roster_weeks SET revision = revision + 1 WHERE id = ? AND revision = ?", week.ID, week.Revision)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			var count int
+			if err := c.queryRow("SELECT COUNT(*) FROM roster_weeks WHERE id = ?", week.ID).Scan(&count); err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrRevisionConflict
+			}
+		}
+		return saveSQLRosterWeek(c, &updated)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save roster week (id: %v): %w", week.ID, err)
+	}
+	week.Revision = updated.Revision
+	utils.PrintLog("Saved roster week (id: %v, revision: %v)", week.ID, week.Revision)
+	return nil
+}
+
+// SaveAllRosterWeeks saves every given roster week in one transaction without
+// checking revisions.
+func (r *SQLRosterWeekRepository) SaveAllRosterWeeks(ctx context.Context, weeks []*models.RosterWeek) error {
+	err := r.store.withTx(ctx, func(c sqlConn) error {
+		for _, week := range weeks {
+			if err := saveSQLRosterWeek(c, week); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to bulk save roster weeks: %w", err)
+	}
+	utils.PrintLog("Bulk saved %d roster weeks", len(weeks))
+	return nil
+}
+
+// LoadAllRosterWeeks returns all roster weeks from the database.
+func (r *SQLRosterWeekRepository) LoadAllRosterWeeks(ctx context.Context) ([]*models.RosterWeek, error) {
+	weeks, err := r.loadWeeks(ctx, "1 = 1 ORDER BY week_offset")
+	if err != nil {
+		return nil, fmt.Errorf("error executing query for all roster weeks: %w", err)
+	}
+	return weeks, nil
+}
+
+func (r *SQLRosterWeekRepository) LoadRosterWeek(ctx context.Context, weekOffset int) (*models.RosterWeek, error) {
+	weeks, err := r.loadWeeks(ctx, "week_offset = ? LIMIT 1", weekOffset)
+	if err != nil {
+		return nil, fmt.Errorf("error loading roster week: %w", err)
+	}
+	if len(weeks) > 0 {
+		return weeks[0], nil
+	}
+	utils.PrintLog("Creating new roster week")
+	newWeek := newRosterWeek(weekOffset)
+	if err := r.SaveRosterWeek(ctx, &newWeek); err != nil {
+		return nil, fmt.Errorf("failed to save new roster week: %w", err)
+	}
+	return &newWeek, nil
+}
+
+// GetRosterWeek returns the week with the given offset, or ErrNotFound.
+func (r *SQLRosterWeekRepository) GetRosterWeek(ctx context.Context, weekOffset int) (*models.RosterWeek, error) {
+	weeks, err := r.loadWeeks(ctx, "week_offset = ? LIMIT 1", weekOffset)
+	if err != nil {
+		return nil, fmt.Errorf("error loading roster week: %w", err)
+	}
+	if len(weeks) == 0 {
+		return nil, fmt.Errorf("GetRosterWeek: %w", ErrNotFound)
+	}
+	return weeks[0], nil
+}
+
+// ChangeDayRowCount adds ("+") or removes (any other action) the last row of
+// a specific RosterDay in one transaction. Days never shrink below
+// minDayRows. Returns the affected day, the roster week's live status and an
+// error if applicable.
+func (r *SQLRosterWeekRepository) ChangeDayRowCount(ctx context.Context, weekOffset int, dayID uuid.UUID, action string) (*models.RosterDay, bool, error) {
+	current, err := r.LoadRosterWeek(ctx, weekOffset)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load roster week for modifying row count: %w", err)
+	}
+	var week *models.RosterWeek
+	err = r.store.withTx(ctx, func(c sqlConn) error {
+		if _, err := bumpSQLRevision(c, weekOffset); err != nil {
+			return err
+		}
+		var days int
+		err := c.queryRow(`SELECT COUNT(*) FROM roster_days d
+			JOIN roster_weeks w ON w.id = d.week_id
+			WHERE d.id = ? AND w.week_offset = ?`, dayID, weekOffset).Scan(&days)
+		if err != nil {
+			return err
+		}
+		if days == 0 {
+			// Also rolls back the revision bump.
+			return fmt.Errorf("no roster day found with id: %v", dayID)
+		}
+		var count int
+		if err := c.queryRow("SELECT COUNT(*) FROM roster_rows WHERE day_id = ?", dayID).Scan(&count); err != nil {
+			return err
+		}
+		if action == "+" {
+			if err := insertSQLRow(c, dayID, count, models.NewRow(current.Slots)); err != nil {
+				return err
+			}
+		} else if count > minDayRows {
+			_, err := c.exec(`DELETE FROM roster_slots WHERE row_id IN
+				(SELECT id FROM roster_rows WHERE day_id = ? AND position = ?)`, dayID, count-1)
+			if err != nil {
+				return err
+			}
+			if _, err := c.exec("DELETE FROM roster_rows WHERE day_id = ? AND position = ?", dayID, count-1); err != nil {
+				return err
+			}
+		}
+		weeks, err := loadSQLWeeks(c, "week_offset = ? LIMIT 1", weekOffset)
+		if err != nil {
+			return err
+		}
+		week = weeks[0]
+		return nil
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to change day row count: %w", err)
+	}
+	return week.GetDayByID(dayID), week.IsLive, nil
+}
+
+func (r *SQLRosterWeekRepository) UpdateSlotAssignment(ctx context.Context, weekOffset int, slotID uuid.UUID, staffID *uuid.UUID, staffString *string) (int, error) {
+	return r.updateSlot(ctx, weekOffset, slotID, "assigned_staff = ?, staff_string = ?", sqlNullUUID(staffID), sqlNullString(staffString))
+}
+
+func (r *SQLRosterWeekRepository) UpdateSlotStartTime(ctx context.Context, weekOffset int, slotID uuid.UUID, startTime string) (int, error) {
+	return r.updateSlot(ctx, weekOffset, slotID, "start_time = ?", startTime)
+}
+
+func (r *SQLRosterWeekRepository) UpdateSlotDescription(ctx context.Context, weekOffset int, slotID uuid.UUID, description string) (int, error) {
+	return r.updateSlot(ctx, weekOffset, slotID, "description = ?", description)
+}
+
+// updateSlot applies the SET clause to the slot with the given ID and bumps
+// the week's revision in one transaction.
+func (r *SQLRosterWeekRepository) updateSlot(ctx context.Context, weekOffset int, slotID uuid.UUID, set string, args ...any) (int, error) {
+	var revision int
+	err := r.store.withTx(ctx, func(c sqlConn) error {
+		// Bumping the revision first locks the week row for the transaction.
+		var err error
+		if revision, err = bumpSQLRevision(c, weekOffset); err != nil {
+			return err
+		}
+		res, err := c.exec(`UPDATE roster_slots SET `+set+` WHERE id = ? AND row_id IN (
+			SELECT r.id FROM roster_rows r
+			JOIN roster_days d ON d.id = r.day_id
+			JOIN roster_weeks w ON w.id = d.week_id
+			WHERE w.week_offset = ?)`, append(args, slotID, weekOffset)...)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to update slot (id: %v): %w", slotID, err)
+	}
+	utils.PrintLog("Updated slot (id: %v, revision: %v)", slotID, revision)
+	return revision, nil
+}
+
+// bumpSQLRevision increments the revision of the week with the given offset
+// and returns the new value, or ErrNotFound if there is no such week.
+func bumpSQLRevision(c sqlConn, weekOffset int) (int, error) {
+	res, err := c.exec("UPDATE roster_weeks SET revision = revision + 1 WHERE week_offset = ?", weekOffset)
+	if err != nil {
+		return 0, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return 0, err
+	} else if n == 0 {
+		return 0, ErrNotFound
+	}
+	var revision int
+	err = c.queryRow("SELECT revision FROM roster_weeks WHERE week_offset = ?", weekOffset).Scan(&revision)
+	return revision, err
+}
+
+func saveSQLRosterWeek(c sqlConn, week *models.RosterWeek) error {
+	_, err := c.exec(`INSERT INTO roster_weeks (id, start_date, week_offset, is_live, revision) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			start_date = excluded.start_date, week_offset = excluded.week_offset,
+			is_live = excluded.is_live, revision = excluded.revision`,
+		week.ID, sqlDate(week.StartDate), week.WeekOffset, week.IsLive, week.Revision)
+	if err != nil {
+		return err
+	}
+
+	deletes := []string{
+		"DELETE FROM roster_week_slots WHERE week_id = ?",
+		`DELETE FROM roster_slots WHERE row_id IN (SELECT r.id FROM roster_rows r
+			JOIN roster_days d ON d.id = r.day_id WHERE d.week_id = ?)`,
+		"DELETE FROM roster_rows WHERE day_id IN (SELECT id FROM roster_days WHERE week_id = ?)",
+		"DELETE FROM roster_days WHERE week_id = ?",
+	}
+	for _, query := range deletes {
+		if _, err := c.exec(query, week.ID); err != nil {
+			return err
+		}
+	}
+
+	for i, slot := range week.Slots {
+		_, err := c.exec("INSERT INTO roster_week_slots (week_id, position, name, start_time, kitchen) VALUES (?, ?, ?, ?, ?)",
+			week.ID, i, slot.Name, slot.StartTime, slot.Kitchen)
+		if err != nil {
+			return err
+		}
+	}
+	for i, day := range week.Days {
+		_, err := c.exec(`INSERT INTO roster_days (id, week_id, position, day_name, colour, day_offset, is_closed)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			day.ID, week.ID, i, day.DayName, day.Colour, day.Offset, day.IsClosed)
+		if err != nil {
+			return err
+		}
+		for j, row := range day.Rows {
+			if err := insertSQLRow(c, day.ID, j, row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func insertSQLRow(c sqlConn, dayID uuid.UUID, position int, row *models.Row) error {
+	if _, err := c.exec("INSERT INTO roster_rows (id, day_id, position) VALUES (?, ?, ?)", row.ID, dayID, position); err != nil {
+		return err
+	}
+	for i, slot := range row.Slots {
+		_, err := c.exec(`INSERT INTO roster_slots
+			(id, row_id, position, slot_key, start_time, assigned_staff, staff_string, flag, description)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			slot.ID, row.ID, i, slot.Name, slot.StartTime, sqlNullUUID(slot.AssignedStaff),
+			sqlNullString(slot.StaffString), slot.Flag, slot.Description)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadWeeks returns the weeks matching where, fully populated.
+func (r *SQLRosterWeekRepository) loadWeeks(ctx context.Context, where string, args ...any) ([]*models.RosterWeek, error) {
+	return loadSQLWeeks(r.store.conn(ctx), where, args...)
+}
+
+func loadSQLWeeks(c sqlConn, where string, args ...any) ([]*models.RosterWeek, error) {
+	var weeks []*models.RosterWeek
+	err := scanSQLRows(c, "SELECT id, start_date, week_offset, is_live, revision FROM roster_weeks WHERE "+where, args, func(rows *sql.Rows) error {
+		var week models.RosterWeek
+		if err := rows.Scan(&week.ID, &week.StartDate, &week.WeekOffset, &week.IsLive, &week.Revision); err != nil {
+			return err
+		}
+		week.StartDate = localTime(week.StartDate)
+		weeks = append(weeks, &week)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, week := range weeks {
+		if err := loadSQLWeekDays(c, week); err != nil {
+			return nil, err
+		}
+	}
+	return weeks, nil
+}
+
+func loadSQLWeekDays(c sqlConn, week *models.RosterWeek) error {
+	err := scanSQLRows(c, "SELECT name, start_time, kitchen FROM roster_week_slots WHERE week_id = ? ORDER BY position",
+		[]any{week.ID}, func(rows *sql.Rows) error {
+			var slot models.SlotDefinition
+			if err := rows.Scan(&slot.Name, &slot.StartTime, &slot.Kitchen); err != nil {
+				return err
+			}
+			week.Slots = append(week.Slots, slot)
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	days := map[uuid.UUID]*models.RosterDay{}
+	err = scanSQLRows(c, `SELECT id, day_name, colour, day_offset, is_closed FROM roster_days
+		WHERE week_id = ? ORDER BY position`, []any{week.ID}, func(rows *sql.Rows) error {
+		var day models.RosterDay
+		if err := rows.Scan(&day.ID, &day.DayName, &day.Colour, &day.Offset, &day.IsClosed); err != nil {
+			return err
+		}
+		week.Days = append(week.Days, &day)
+		days[day.ID] = &day
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	rowsByID := map[uuid.UUID]*models.Row{}
+	err = scanSQLRows(c, `SELECT r.id, r.day_id FROM roster_rows r
+		JOIN roster_days d ON d.id = r.day_id
+		WHERE d.week_id = ? ORDER BY d.position, r.position`, []any{week.ID}, func(rows *sql.Rows) error {
+		row := models.Row{Slots: []models.Slot{}}
+		var dayID uuid.UUID
+		if err := rows.Scan(&row.ID, &dayID); err != nil {
+			return err
+		}
+		days[dayID].Rows = append(days[dayID].Rows, &row)
+		rowsByID[row.ID] = &row
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return scanSQLRows(c, `SELECT s.row_id, s.slot_key, s.id, s.start_time, s.assigned_staff,
+			s.staff_string, s.flag, s.description
+		FROM roster_slots s
+		JOIN roster_rows r ON r.id = s.row_id
+		JOIN roster_days d ON d.id = r.day_id
+		WHERE d.week_id = ? ORDER BY s.position`, []any{week.ID}, func(rows *sql.Rows) error {
+		var rowID uuid.UUID
+		var slot models.Slot
+		var assigned uuid.NullUUID
+		var staffString sql.NullString
+		err := rows.Scan(&rowID, &slot.Name, &slot.ID, &slot.StartTime, &assigned,
+			&staffString, &slot.Flag, &slot.Description)
+		if err != nil {
+			return err
+		}
+		if assigned.Valid {
+			slot.AssignedStaff = &assigned.UUID
+		}
+		if staffString.Valid {
+			slot.StaffString = &staffString.String
+		}
+		row := rowsByID[rowID]
+		row.Slots = append(row.Slots, slot)
+		return nil
+	})
+}
+
+func sqlNullUUID(id *uuid.UUID) uuid.NullUUID {
+	if id == nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: *id, Valid: true}
+}
+
+func sqlNullString(s *string) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *s, Valid: true}
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"roster/cmd/models"
+
+	"github.com/google/uuid"
+)
+
+// SQLSessionRepository implements SessionRepository on a SQL database.
+type SQLSessionRepository struct {
+	store *sqlStore
+}
+
+func newSQLSessionRepository(store *sqlStore) *SQLSessionRepository {
+	return &SQLSessionRepository{store: store}
+}
+
+const sessionColumns = "id, staff_id, created_at, last_seen, expires_at, user_agent"
+
+func (r *SQLSessionRepository) CreateSession(ctx context.Context, s models.Session) error {
+	_, err := r.store.conn(ctx).exec(`INSERT INTO sessions (`+sessionColumns+`) VALUES (`+sqlPlaceholders(6)+`)`,
+		s.ID, s.StaffID, sqlTime(s.CreatedAt), sqlTime(s.LastSeen), sqlTime(s.ExpiresAt), s.UserAgent)
+	if err != nil {
+		return fmt.Errorf("CreateSession: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLSessionRepository) GetSession(ctx context.Context, id uuid.UUID) (*models.Session, error) {
+	row := r.store.conn(ctx).queryRow("SELECT "+sessionColumns+" FROM sessions WHERE id = ?", id)
+	session, err := scanSQLSession(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("GetSession: %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetSession: %w", err)
+	}
+	return session, nil
+}
+
+func (r *SQLSessionRepository) TouchSession(ctx context.Context, id uuid.UUID, lastSeen time.Time) error {
+	res, err := r.store.conn(ctx).exec("UPDATE sessions SET last_seen = ? WHERE id = ?", sqlTime(lastSeen), id)
+	if err != nil {
+		return fmt.Errorf("TouchSession: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("TouchSession: %w", ErrNotFound)
+	}
+	return nil
+}
+
+func (r *SQLSessionRepository) FindStaffSessions(ctx context.Context, staffID uuid.UUID) ([]*models.Session, error) {
+	sessions := []*models.Session{}
+	query := "SELECT " + sessionColumns + " FROM sessions WHERE staff_id = ? ORDER BY last_seen DESC"
+	err := scanSQLRows(r.store.conn(ctx), query, []any{staffID}, func(rows *sql.Rows) error {
+		session, err := scanSQLSession(rows)
+		if err != nil {
+			return err
+		}
+		sessions = append(sessions, session)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("FindStaffSessions: %w", err)
+	}
+	return sessions, nil
+}
+
+func (r *SQLSessionRepository) DeleteSession(ctx context.Context, id uuid.UUID) error {
+	if _, err := r.store.conn(ctx).exec("DELETE FROM sessions WHERE id = ?", id); err != nil {
+		return fmt.Errorf("DeleteSession: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLSessionRepository) DeleteStaffSessions(ctx context.Context, staffID uuid.UUID) error {
+	if _, err := r.store.conn(ctx).exec("DELETE FROM sessions WHERE staff_id = ?", staffID); err != nil {
+		return fmt.Errorf("DeleteStaffSessions: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLSessionRepository) DeleteExpiredSessions(ctx context.Context, expiredBefore time.Time, idleBefore time.Time) (int64, error) {
+	res, err := r.store.conn(ctx).exec("DELETE FROM sessions WHERE expires_at < ? OR last_seen < ?",
+		sqlTime(expiredBefore), sqlTime(idleBefore))
+	if err != nil {
+		return 0, fmt.Errorf("DeleteExpiredSessions: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func scanSQLSession(row interface{ Scan(dest ...any) error }) (*models.Session, error) {
+	var s models.Session
+	if err := row.Scan(&s.ID, &s.StaffID, &s.CreatedAt, &s.LastSeen, &s.ExpiresAt, &s.UserAgent); err != nil {
+		return nil, err
+	}
+	s.CreatedAt = localTime(s.CreatedAt)
+	s.LastSeen = localTime(s.LastSeen)
+	s.ExpiresAt = localTime(s.ExpiresAt)
+	return &s, nil
+}
@@ -0,0 +1,339 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"roster/cmd/models"
+
+	"github.com/google/uuid"
+)
+
+// SQLStaffRepository implements StaffRepository on a SQL database.
+type SQLStaffRepository struct {
+	store *sqlStore
+}
+
+func newSQLStaffRepository(store *sqlStore) *SQLStaffRepository {
+	return &SQLStaffRepository{store: store}
+}
+
+const staffColumns = `id, is_admin, role, is_trial, is_hidden, is_kitchen, google_id,
+	nick_name, first_name, last_name, email, phone, contact_name, contact_phone,
+	ideal_shifts, last_visit, timesheet_date_offset, roster_date_offset,
+	hide_by_ideal, hide_by_prefs, hide_by_leave, hide_approved, hide_staff_list,
+	show_all, is_deleted, is_minor`
+
+func (repo *SQLStaffRepository) SaveStaffMember(ctx context.Context, staff models.StaffMember) error {
+	err := repo.store.withTx(ctx, func(c sqlConn) error {
+		return saveSQLStaffMember(c, staff)
+	})
+	if err != nil {
+		return fmt.Errorf("SaveStaffMember: %w", err)
+	}
+	return nil
+}
+
+func (repo *SQLStaffRepository) SaveStaffMembers(ctx context.Context, staffMembers []*models.StaffMember) error {
+	err := repo.store.withTx(ctx, func(c sqlConn) error {
+		for _, s := range staffMembers {
+			if err := saveSQLStaffMember(c, *s); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("SaveStaffMembers: %w", err)
+	}
+	return nil
+}
+
+func (repo *SQLStaffRepository) LoadAllStaff(ctx context.Context) ([]*models.StaffMember, error) {
+	// Only include valid records.
+	allStaff, err := repo.loadStaff(ctx, "NOT is_deleted AND first_name <> ''")
+	if err != nil {
+		return nil, fmt.Errorf("LoadAllStaff: %w", err)
+	}
+	sortStaffByName(allStaff)
+	return allStaff, nil
+}
+
+func (repo *SQLStaffRepository) LoadAllStaffRecords(ctx context.Context) ([]*models.StaffMember, error) {
+	allStaff, err := repo.loadStaff(ctx, "1 = 1 ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("LoadAllStaffRecords: %w", err)
+	}
+	return allStaff, nil
+}
+
+func (repo *SQLStaffRepository) GetStaffByIdentity(ctx context.Context, identity models.Identity) (*models.StaffMember, error) {
+	s, err := repo.loadOne(ctx, "id IN (SELECT staff_id FROM staff_identities WHERE provider = ? AND subject = ?) AND NOT is_deleted",
+		identity.Provider, identity.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("GetStaffByIdentity: %w", err)
+	}
+	return s, nil
+}
+
+func (repo *SQLStaffRepository) GetStaffByEmail(ctx context.Context, email string) (*models.StaffMember, error) {
+	s, err := repo.loadOne(ctx, "LOWER(email) = LOWER(?) AND NOT is_deleted", email)
+	if err != nil {
+		return nil, fmt.Errorf("GetStaffByEmail: %w", err)
+	}
+	return s, nil
+}
+
+func (repo *SQLStaffRepository) GetStaffByID(ctx context.Context, id uuid.UUID) (*models.StaffMember, error) {
+	s, err := repo.loadOne(ctx, "id = ? AND NOT is_deleted", id)
+	if err != nil {
+		return nil, fmt.Errorf("GetStaffByID: %w", err)
+	}
+	return s, nil
+}
+
+func (repo *SQLStaffRepository) RefreshStaffConfig(ctx context.Context, staff models.StaffMember) (models.StaffMember, error) {
+	return refreshStaffConfig(ctx, repo, staff)
+}
+
+func (repo *SQLStaffRepository) CreateStaffMember(ctx context.Context, identity models.Identity) (*models.StaffMember, error) {
+	return createStaffMember(ctx, repo, identity)
+}
+
+func (repo *SQLStaffRepository) DeleteLeaveReqByID(ctx context.Context, staff models.StaffMember, leaveReqID uuid.UUID) error {
+	return deleteLeaveReqByID(ctx, repo, staff, leaveReqID)
+}
+
+func (repo *SQLStaffRepository) GetStaffByLeaveReqID(ctx context.Context, leaveReqID uuid.UUID) (*models.StaffMember, error) {
+	s, err := repo.loadOne(ctx, "id IN (SELECT staff_id FROM leave_requests WHERE id = ?) AND NOT is_deleted", leaveReqID)
+	if err != nil {
+		return nil, fmt.Errorf("GetStaffByLeaveReqID: %w", err)
+	}
+	return s, nil
+}
+
+func (repo *SQLStaffRepository) CreateTrial(ctx context.Context, trialName string) error {
+	return createTrial(ctx, repo, trialName)
+}
+
+func (repo *SQLStaffRepository) DeleteStaffByID(ctx context.Context, id uuid.UUID) error {
+	res, err := repo.store.conn(ctx).exec("UPDATE staff SET is_deleted = ? WHERE id = ?", true, id)
+	if err != nil {
+		return fmt.Errorf("DeleteStaffByID: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("DeleteStaffByID: no document found")
+	}
+	return nil
+}
+
+// saveSQLStaffMember upserts the staff row and replaces its child rows.
+func saveSQLStaffMember(c sqlConn, s models.StaffMember) error {
+	cfg := s.Config
+	_, err := c.exec(`INSERT INTO staff (`+staffColumns+`) VALUES (`+sqlPlaceholders(26)+`)
+		ON CONFLICT (id) DO UPDATE SET
+			is_admin = excluded.is_admin, role = excluded.role, is_trial = excluded.is_trial,
+			is_hidden = excluded.is_hidden, is_kitchen = excluded.is_kitchen,
+			google_id = excluded.google_id, nick_name = excluded.nick_name,
+			first_name = excluded.first_name, last_name = excluded.last_name,
+			email = excluded.email, phone = excluded.phone,
+			contact_name = excluded.contact_name, contact_phone = excluded.contact_phone,
+			ideal_shifts = excluded.ideal_shifts, last_visit = excluded.last_visit,
+			timesheet_date_offset = excluded.timesheet_date_offset,
+			roster_date_offset = excluded.roster_date_offset,
+			hide_by_ideal = excluded.hide_by_ideal, hide_by_prefs = excluded.hide_by_prefs,
+			hide_by_leave = excluded.hide_by_leave, hide_approved = excluded.hide_approved,
+			hide_staff_list = excluded.hide_staff_list, show_all = excluded.show_all,
+			is_deleted = excluded.is_deleted, is_minor = excluded.is_minor`,
+		s.ID, s.IsAdmin, s.Role, s.IsTrial, s.IsHidden, s.IsKitchen, s.GoogleID,
+		s.NickName, s.FirstName, s.LastName, s.Email, s.Phone, s.ContactName, s.ContactPhone,
+		s.IdealShifts, sqlTime(cfg.LastVisit), cfg.TimesheetDateOffset, cfg.RosterDateOffset,
+		cfg.HideByIdeal, cfg.HideByPrefs, cfg.HideByLeave, cfg.HideApproved, cfg.HideStaffList,
+		cfg.ShowAll, s.IsDeleted, s.IsMinor)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"staff_tokens", "staff_identities", "staff_availability", "leave_requests"} {
+		if _, err := c.exec("DELETE FROM "+table+" WHERE staff_id = ?", s.ID); err != nil {
+			return err
+		}
+	}
+	for _, token := range s.Tokens {
+		if _, err := c.exec("INSERT INTO staff_tokens (token, staff_id) VALUES (?, ?)", token, s.ID); err != nil {
+			return err
+		}
+	}
+	for i, identity := range s.Identities {
+		_, err := c.exec(`INSERT INTO staff_identities (staff_id, position, provider, subject)
+			VALUES (?, ?, ?, ?)`, s.ID, i, identity.Provider, identity.Subject)
+		if err != nil {
+			return err
+		}
+	}
+	for i, day := range s.Availability {
+		_, err := c.exec(`INSERT INTO staff_availability (staff_id, day_index, name, unavailable)
+			VALUES (?, ?, ?, ?)`, s.ID, i, day.Name, strings.Join(day.Unavailable, ","))
+		if err != nil {
+			return err
+		}
+	}
+	for i, req := range s.LeaveRequests {
+		_, err := c.exec(`INSERT INTO leave_requests
+			(id, staff_id, position, creation_date, reason, start_date, end_date, status)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			req.ID, s.ID, i, sqlNullDate(req.CreationDate), req.Reason,
+			sqlNullDate(req.StartDate), sqlNullDate(req.EndDate), req.Status)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadOne returns the first staff member matching where, or nil.
+func (repo *SQLStaffRepository) loadOne(ctx context.Context, where string, args ...any) (*models.StaffMember, error) {
+	matches, err := repo.loadStaff(ctx, where+" LIMIT 1", args...)
+	if err != nil || len(matches) == 0 {
+		return nil, err
+	}
+	return matches[0], nil
+}
+
+// loadStaff returns the staff matching where, with their tokens, identities,
+// availability and leave requests.
+func (repo *SQLStaffRepository) loadStaff(ctx context.Context, where string, args ...any) ([]*models.StaffMember, error) {
+	c := repo.store.conn(ctx)
+	rows, err := c.query("SELECT "+staffColumns+" FROM staff WHERE "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var allStaff []*models.StaffMember
+	byID := map[uuid.UUID]*models.StaffMember{}
+	for rows.Next() {
+		var s models.StaffMember
+		cfg := &s.Config
+		err := rows.Scan(&s.ID, &s.IsAdmin, &s.Role, &s.IsTrial, &s.IsHidden, &s.IsKitchen, &s.GoogleID,
+			&s.NickName, &s.FirstName, &s.LastName, &s.Email, &s.Phone, &s.ContactName, &s.ContactPhone,
+			&s.IdealShifts, &cfg.LastVisit, &cfg.TimesheetDateOffset, &cfg.RosterDateOffset,
+			&cfg.HideByIdeal, &cfg.HideByPrefs, &cfg.HideByLeave, &cfg.HideApproved, &cfg.HideStaffList,
+			&cfg.ShowAll, &s.IsDeleted, &s.IsMinor)
+		if err != nil {
+			return nil, err
+		}
+		cfg.LastVisit = localTime(cfg.LastVisit)
+		s.LeaveRequests = []models.LeaveRequest{}
+		allStaff = append(allStaff, &s)
+		byID[s.ID] = &s
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if len(allStaff) == 0 {
+		return allStaff, nil
+	}
+
+	ids := make([]any, 0, len(allStaff))
+	for _, s := range allStaff {
+		ids = append(ids, s.ID)
+	}
+	in := "staff_id IN (" + sqlPlaceholders(len(ids)) + ")"
+
+	err = scanSQLRows(c, "SELECT staff_id, token FROM staff_tokens WHERE "+in+" ORDER BY token", ids, func(rows *sql.Rows) error {
+		var staffID, token uuid.UUID
+		if err := rows.Scan(&staffID, &token); err != nil {
+			return err
+		}
+		byID[staffID].Tokens = append(byID[staffID].Tokens, token)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = scanSQLRows(c, "SELECT staff_id, provider, subject FROM staff_identities WHERE "+in+" ORDER BY staff_id, position", ids, func(rows *sql.Rows) error {
+		var staffID uuid.UUID
+		var identity models.Identity
+		if err := rows.Scan(&staffID, &identity.Provider, &identity.Subject); err != nil {
+			return err
+		}
+		byID[staffID].Identities = append(byID[staffID].Identities, identity)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = scanSQLRows(c, "SELECT staff_id, name, unavailable FROM staff_availability WHERE "+in+" ORDER BY staff_id, day_index", ids, func(rows *sql.Rows) error {
+		var staffID uuid.UUID
+		var day models.DayAvailability
+		var unavailable string
+		if err := rows.Scan(&staffID, &day.Name, &unavailable); err != nil {
+			return err
+		}
+		day.Unavailable = models.SlotNameList{}
+		if unavailable != "" {
+			// Shift names can't contain commas.
+			day.Unavailable = strings.Split(unavailable, ",")
+		}
+		byID[staffID].Availability = append(byID[staffID].Availability, day)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = scanSQLRows(c, `SELECT staff_id, id, creation_date, reason, start_date, end_date, status
+		FROM leave_requests WHERE `+in+" ORDER BY staff_id, position", ids, func(rows *sql.Rows) error {
+		var staffID uuid.UUID
+		var req models.LeaveRequest
+		var creation, start, end sql.NullTime
+		if err := rows.Scan(&staffID, &req.ID, &creation, &req.Reason, &start, &end, &req.Status); err != nil {
+			return err
+		}
+		req.CreationDate = customDateFromSQL(creation)
+		req.StartDate = customDateFromSQL(start)
+		req.EndDate = customDateFromSQL(end)
+		byID[staffID].LeaveRequests = append(byID[staffID].LeaveRequests, req)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return allStaff, nil
+}
+
+// scanSQLRows runs query and calls scan for each resulting row.
+func scanSQLRows(c sqlConn, query string, args []any, scan func(rows *sql.Rows) error) error {
+	rows, err := c.query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func sqlNullDate(d models.CustomDate) sql.NullTime {
+	if d.Time == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: sqlDate(*d.Time), Valid: true}
+}
+
+func customDateFromSQL(t sql.NullTime) models.CustomDate {
+	if !t.Valid {
+		return models.CustomDate{}
+	}
+	local := localTime(t.Time)
+	return models.CustomDate{Time: &local}
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"roster/cmd/models"
+	"roster/cmd/utils"
+
+	"github.com/google/uuid"
+)
+
+// SQLTimesheetRepository implements TimesheetRepository on a SQL database.
+type SQLTimesheetRepository struct {
+	store *sqlStore
+}
+
+func newSQLTimesheetRepository(store *sqlStore) *SQLTimesheetRepository {
+	return &SQLTimesheetRepository{store: store}
+}
+
+const timesheetColumns = `id, staff_id, week_offset, day_offset, start_date, shift_start,
+	shift_end, has_break, break_start, break_end, break_length, shift_length,
+	approved, shift_type`
+
+func (repo *SQLTimesheetRepository) SaveTimesheetEntry(ctx context.Context, e TimesheetEntry) error {
+	if err := saveSQLTimesheetEntry(repo.store.conn(ctx), e); err != nil {
+		utils.PrintError(err, "Failed to save timesheet entry")
+		return err
+	}
+	utils.PrintLog("Saved timesheet entry")
+	return nil
+}
+
+func (repo *SQLTimesheetRepository) GetTimesheetEntryByID(ctx context.Context, entryID uuid.UUID) (*models.TimesheetEntry, error) {
+	entries, err := repo.find(ctx, "id = ?", entryID)
+	if err != nil {
+		utils.PrintError(err, "Error getting timesheet entry")
+		return nil, err
+	}
+	if len(entries) == 0 {
+		utils.PrintError(ErrNotFound, "Error getting timesheet entry")
+		return nil, ErrNotFound
+	}
+	return entries[0], nil
+}
+
+func (repo *SQLTimesheetRepository) GetAllTimesheetEntries(ctx context.Context) (*[]*TimesheetEntry, error) {
+	entries, err := repo.find(ctx, "1 = 1")
+	if err != nil {
+		utils.PrintError(err, "Error executing query")
+		return nil, err
+	}
+	entries = SortTimesheetEntries(entries)
+	return &entries, nil
+}
+
+func (repo *SQLTimesheetRepository) SaveAllTimesheetEntries(ctx context.Context, entries []*TimesheetEntry) error {
+	err := repo.store.withTx(ctx, func(c sqlConn) error {
+		for _, entry := range entries {
+			if err := saveSQLTimesheetEntry(c, *entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		utils.PrintError(err, "Failed to save timesheet entries")
+		return err
+	}
+	utils.PrintLog("Saved %v timesheet entries", len(entries))
+	return nil
+}
+
+func (repo *SQLTimesheetRepository) GetStaffTimesheetWeek(ctx context.Context, staffID uuid.UUID, weekOffset int) (*[]*TimesheetEntry, error) {
+	entries, err := repo.find(ctx, "week_offset = ? AND staff_id = ?", weekOffset, staffID)
+	if err != nil {
+		utils.PrintError(err, "Error finding timesheet week")
+		return nil, err
+	}
+	return &entries, nil
+}
+
+func (repo *SQLTimesheetRepository) GetTimesheetWeek(ctx context.Context, weekOffset int) (*[]*TimesheetEntry, error) {
+	entries, err := repo.find(ctx, "week_offset = ?", weekOffset)
+	if err != nil {
+		utils.PrintError(err, "Error finding timesheet week")
+		return nil, err
+	}
+	entries = SortTimesheetEntries(entries)
+	return &entries, nil
+}
+
+func (repo *SQLTimesheetRepository) DeleteTimesheetEntry(ctx context.Context, entryID uuid.UUID) error {
+	_, err := repo.store.conn(ctx).exec("DELETE FROM timesheet_entries WHERE id = ?", entryID)
+	return err
+}
+
+func saveSQLTimesheetEntry(c sqlConn, e TimesheetEntry) error {
+	_, err := c.exec(`INSERT INTO timesheet_entries (`+timesheetColumns+`) VALUES (`+sqlPlaceholders(14)+`)
+		ON CONFLICT (id) DO UPDATE SET
+			staff_id = excluded.staff_id, week_offset = excluded.week_offset,
+			day_offset = excluded.day_offset, start_date = excluded.start_date,
+			shift_start = excluded.shift_start, shift_end = excluded.shift_end,
+			has_break = excluded.has_break, break_start = excluded.break_start,
+			break_end = excluded.break_end, break_length = excluded.break_length,
+			shift_length = excluded.shift_length, approved = excluded.approved,
+			shift_type = excluded.shift_type`,
+		e.ID, e.StaffID, e.WeekOffset, e.DayOffset, sqlDate(e.StartDate), sqlTime(e.ShiftStart),
+		sqlTime(e.ShiftEnd), e.HasBreak, sqlTime(e.BreakStart), sqlTime(e.BreakEnd), e.BreakLength,
+		e.ShiftLength, e.Approved, e.ShiftType)
+	return err
+}
+
+// find returns the entries matching where. The slice is never nil.
+func (repo *SQLTimesheetRepository) find(ctx context.Context, where string, args ...any) ([]*TimesheetEntry, error) {
+	entries := []*TimesheetEntry{}
+	err := scanSQLRows(repo.store.conn(ctx), "SELECT "+timesheetColumns+" FROM timesheet_entries WHERE "+where, args, func(rows *sql.Rows) error {
+		var e TimesheetEntry
+		err := rows.Scan(&e.ID, &e.StaffID, &e.WeekOffset, &e.DayOffset, &e.StartDate, &e.ShiftStart,
+			&e.ShiftEnd, &e.HasBreak, &e.BreakStart, &e.BreakEnd, &e.BreakLength, &e.ShiftLength,
+			&e.Approved, &e.ShiftType)
+		if err != nil {
+			return err
+		}
+		e.StartDate = localTime(e.StartDate)
+		e.ShiftStart = localTime(e.ShiftStart)
+		e.ShiftEnd = localTime(e.ShiftEnd)
+		e.BreakStart = localTime(e.BreakStart)
+		e.BreakEnd = localTime(e.BreakEnd)
+		entries = append(entries, &e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,247 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteMigrations holds the SQLite schema, one entry per version. Only ever
+// append to this list; applied entries must not change.
+var sqliteMigrations = []string{
+	`CREATE TABLE staff (
+		id TEXT PRIMARY KEY,
+		is_admin INTEGER NOT NULL DEFAULT 0,
+		role INTEGER NOT NULL DEFAULT 0,
+		is_trial INTEGER NOT NULL DEFAULT 0,
+		is_hidden INTEGER NOT NULL DEFAULT 0,
+		is_kitchen INTEGER NOT NULL DEFAULT 0,
+		google_id TEXT NOT NULL DEFAULT '',
+		nick_name TEXT NOT NULL DEFAULT '',
+		first_name TEXT NOT NULL DEFAULT '',
+		last_name TEXT NOT NULL DEFAULT '',
+		email TEXT NOT NULL DEFAULT '',
+		phone TEXT NOT NULL DEFAULT '',
+		contact_name TEXT NOT NULL DEFAULT '',
+		contact_phone TEXT NOT NULL DEFAULT '',
+		ideal_shifts INTEGER NOT NULL DEFAULT 0,
+		last_visit TIMESTAMP NOT NULL,
+		timesheet_date_offset INTEGER NOT NULL DEFAULT 0,
+		roster_date_offset INTEGER NOT NULL DEFAULT 0,
+		hide_by_ideal INTEGER NOT NULL DEFAULT 0,
+		hide_by_prefs INTEGER NOT NULL DEFAULT 0,
+		hide_by_leave INTEGER NOT NULL DEFAULT 0,
+		hide_approved INTEGER NOT NULL DEFAULT 0,
+		hide_staff_list INTEGER NOT NULL DEFAULT 0,
+		show_all INTEGER NOT NULL DEFAULT 0,
+		is_deleted INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX staff_google_id ON staff (google_id);
+
+	CREATE TABLE staff_tokens (
+		token TEXT PRIMARY KEY,
+		staff_id TEXT NOT NULL REFERENCES staff (id) ON DELETE CASCADE
+	);
+	CREATE INDEX staff_tokens_staff_id ON staff_tokens (staff_id);
+
+	CREATE TABLE staff_availability (
+		staff_id TEXT NOT NULL REFERENCES staff (id) ON DELETE CASCADE,
+		day_index INTEGER NOT NULL,
+		name TEXT NOT NULL DEFAULT '',
+		early INTEGER NOT NULL DEFAULT 0,
+		mid INTEGER NOT NULL DEFAULT 0,
+		late INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (staff_id, day_index)
+	);
+
+	CREATE TABLE leave_requests (
+		id TEXT PRIMARY KEY,
+		staff_id TEXT NOT NULL REFERENCES staff (id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		creation_date TIMESTAMP,
+		reason TEXT NOT NULL DEFAULT '',
+		start_date TIMESTAMP,
+		end_date TIMESTAMP,
+		status INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX leave_requests_staff_id ON leave_requests (staff_id);
+
+	CREATE TABLE roster_weeks (
+		id TEXT PRIMARY KEY,
+		start_date TIMESTAMP NOT NULL,
+		week_offset INTEGER NOT NULL,
+		is_live INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX roster_weeks_week_offset ON roster_weeks (week_offset);
+
+	CREATE TABLE roster_days (
+		id TEXT PRIMARY KEY,
+		week_id TEXT NOT NULL REFERENCES roster_weeks (id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		day_name TEXT NOT NULL DEFAULT '',
+		colour TEXT NOT NULL DEFAULT '',
+		day_offset INTEGER NOT NULL DEFAULT 0,
+		is_closed INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX roster_days_week_id ON roster_days (week_id);
+
+	CREATE TABLE roster_rows (
+		id TEXT PRIMARY KEY,
+		day_id TEXT NOT NULL REFERENCES roster_days (id) ON DELETE CASCADE,
+		position INTEGER NOT NULL
+	);
+	CREATE INDEX roster_rows_day_id ON roster_rows (day_id);
+
+	CREATE TABLE roster_slots (
+		id TEXT PRIMARY KEY,
+		row_id TEXT NOT NULL REFERENCES roster_rows (id) ON DELETE CASCADE,
+		slot_key TEXT NOT NULL,
+		start_time TEXT NOT NULL DEFAULT '',
+		assigned_staff TEXT,
+		staff_string TEXT,
+		flag INTEGER NOT NULL DEFAULT 0,
+		description TEXT NOT NULL DEFAULT '',
+		UNIQUE (row_id, slot_key)
+	);
+	CREATE INDEX roster_slots_assigned_staff ON roster_slots (assigned_staff);
+
+	CREATE TABLE timesheet_entries (
+		id TEXT PRIMARY KEY,
+		staff_id TEXT NOT NULL,
+		week_offset INTEGER NOT NULL,
+		day_offset INTEGER NOT NULL DEFAULT 0,
+		start_date TIMESTAMP NOT NULL,
+		shift_start TIMESTAMP NOT NULL,
+		shift_end TIMESTAMP NOT NULL,
+		has_break INTEGER NOT NULL DEFAULT 0,
+		break_start TIMESTAMP NOT NULL,
+		break_end TIMESTAMP NOT NULL,
+		break_length REAL NOT NULL DEFAULT 0,
+		shift_length REAL NOT NULL DEFAULT 0,
+		approved INTEGER NOT NULL DEFAULT 0,
+		shift_type INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX timesheet_entries_week ON timesheet_entries (week_offset, staff_id);
+
+	CREATE TABLE config_versions (
+		id TEXT PRIMARY KEY,
+		version INTEGER NOT NULL
+	);`,
+	`ALTER TABLE roster_weeks ADD COLUMN revision INTEGER NOT NULL DEFAULT 0;`,
+	`CREATE TABLE audit_log (
+		id TEXT PRIMARY KEY,
+		timestamp TIMESTAMP NOT NULL,
+		actor_id TEXT NOT NULL,
+		actor_name TEXT NOT NULL DEFAULT '',
+		action TEXT NOT NULL,
+		entity_type TEXT NOT NULL,
+		entity_id TEXT NOT NULL,
+		before_value TEXT NOT NULL DEFAULT '',
+		after_value TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX audit_log_timestamp ON audit_log (timestamp);
+	CREATE INDEX audit_log_entity ON audit_log (entity_type, entity_id);`,
+	`CREATE TABLE sessions (
+		id TEXT PRIMARY KEY,
+		staff_id TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		last_seen TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		user_agent TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX sessions_staff ON sessions (staff_id);`,
+	`CREATE TABLE staff_identities (
+		staff_id TEXT NOT NULL REFERENCES staff (id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		provider TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		PRIMARY KEY (staff_id, position)
+	);
+	CREATE INDEX staff_identities_subject ON staff_identities (provider, subject);`,
+	`CREATE TABLE login_links (
+		token_hash TEXT PRIMARY KEY,
+		purpose TEXT NOT NULL,
+		staff_id TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP NOT NULL
+	);
+	CREATE INDEX login_links_expires_at ON login_links (expires_at);`,
+	`CREATE TABLE api_tokens (
+		id TEXT PRIMARY KEY,
+		staff_id TEXT NOT NULL,
+		name TEXT NOT NULL DEFAULT '',
+		token_hash TEXT NOT NULL UNIQUE,
+		permissions TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL,
+		last_used_at TIMESTAMP
+	);
+	CREATE INDEX api_tokens_staff ON api_tokens (staff_id);`,
+	`ALTER TABLE roster_slots ADD COLUMN position INTEGER NOT NULL DEFAULT 0;
+	UPDATE roster_slots SET
+		position = CASE slot_key WHEN 'mid' THEN 1 WHEN 'late' THEN 2 ELSE 0 END,
+		slot_key = CASE slot_key WHEN 'early' THEN 'Early' WHEN 'mid' THEN 'Mid' WHEN 'late' THEN 'Late' ELSE slot_key END;
+
+	CREATE TABLE roster_week_slots (
+		week_id TEXT NOT NULL REFERENCES roster_weeks (id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		start_time TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (week_id, position)
+	);
+	INSERT INTO roster_week_slots (week_id, position, name) SELECT id, 0, 'Early' FROM roster_weeks;
+	INSERT INTO roster_week_slots (week_id, position, name) SELECT id, 1, 'Mid' FROM roster_weeks;
+	INSERT INTO roster_week_slots (week_id, position, name) SELECT id, 2, 'Late' FROM roster_weeks;
+
+	ALTER TABLE staff_availability ADD COLUMN unavailable TEXT NOT NULL DEFAULT '';
+	UPDATE staff_availability SET unavailable = rtrim(
+			(CASE WHEN early = 0 THEN 'Early,' ELSE '' END) ||
+			(CASE WHEN mid = 0 THEN 'Mid,' ELSE '' END) ||
+			(CASE WHEN late = 0 THEN 'Late,' ELSE '' END), ',');`,
+	`CREATE TABLE roster_templates (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		created_by TEXT NOT NULL,
+		includes_assignments INTEGER NOT NULL DEFAULT 0,
+		layout TEXT NOT NULL
+	);`,
+	`ALTER TABLE staff ADD COLUMN is_minor INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE roster_week_slots ADD COLUMN kitchen INTEGER NOT NULL DEFAULT 0;`,
+}
+
+// OpenSQLite opens (creating if needed) the SQLite database at path and
+// brings its schema up to date.
+func OpenSQLite(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000", path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+	// SQLite only supports one writer; serialising access avoids lock errors.
+	db.SetMaxOpenConns(1)
+	if err := migrateSQLSchema(&sqlStore{db: db, dialect: sqliteDialect}, sqliteMigrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// NewSQLiteRepositories creates the SQLite implementation of every repository
+// on a database returned by OpenSQLite.
+func NewSQLiteRepositories(db *sql.DB) Repositories {
+	return newSQLRepositories(&sqlStore{db: db, dialect: sqliteDialect})
+}
+
+func newSQLRepositories(store *sqlStore) Repositories {
+	return Repositories{
+		Staff:           newSQLStaffRepository(store),
+		RosterWeek:      newSQLRosterWeekRepository(store),
+		Timesheet:       newSQLTimesheetRepository(store),
+		Config:          newSQLConfigRepository(store),
+		Audit:           newSQLAuditRepository(store),
+		Sessions:        newSQLSessionRepository(store),
+		LoginLinks:      newSQLLoginLinkRepository(store),
+		APITokens:       newSQLAPITokenRepository(store),
+		RosterTemplates: newSQLRosterTemplateRepository(store),
+	}
+}
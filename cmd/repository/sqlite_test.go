@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"roster/cmd/models"
+
+	"github.com/google/uuid"
+)
+
+func TestSQLiteRepositories(t *testing.T) {
+	runRepositorySuite(t, func(t *testing.T) Repositories {
+		db, err := OpenSQLite(filepath.Join(t.TempDir(), "roster.db"))
+		if err != nil {
+			t.Fatalf("OpenSQLite: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return NewSQLiteRepositories(db)
+	})
+}
+
+// Reopening a database must not reapply migrations or lose data.
+func TestOpenSQLite_Reopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "roster.db")
+	db, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	if err := NewSQLiteRepositories(db).Staff.CreateTrial(ctx, "Amy"); err != nil {
+		t.Fatalf("CreateTrial: %v", err)
+	}
+	db.Close()
+
+	db, err = OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("OpenSQLite(reopen): %v", err)
+	}
+	defer db.Close()
+	var version int
+	if err := db.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&version); err != nil {
+		t.Fatalf("reading schema version: %v", err)
+	}
+	if version != len(sqliteMigrations) {
+		t.Errorf("schema version = %d; want %d", version, len(sqliteMigrations))
+	}
+	staff, err := NewSQLiteRepositories(db).Staff.LoadAllStaff(ctx)
+	if err != nil || len(staff) != 1 {
+		t.Fatalf("LoadAllStaff = %v, %v; want 1 staff member", staff, err)
+	}
+}
+
+// Roster slots and availability stored before shifts could be configured
+// must load as the early, mid and late shifts.
+func TestOpenSQLite_LegacyShifts(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "roster.db")
+	db, err := sql.Open("sqlite3", "file:"+path+"?_foreign_keys=on")
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	shifts := slices.IndexFunc(sqliteMigrations, func(m string) bool { return strings.Contains(m, "CREATE TABLE roster_week_slots") })
+	legacy := sqliteMigrations[:shifts]
+	if err := migrateSQLSchema(&sqlStore{db: db, dialect: sqliteDialect}, legacy); err != nil {
+		t.Fatalf("migrateSQLSchema: %v", err)
+	}
+	weekID, dayID, rowID, staffID := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	inserts := []string{
+		fmt.Sprintf("INSERT INTO roster_weeks (id, start_date, week_offset) VALUES ('%s', '2024-03-05', 3)", weekID),
+		fmt.Sprintf("INSERT INTO roster_days (id, week_id, position) VALUES ('%s', '%s', 0)", dayID, weekID),
+		fmt.Sprintf("INSERT INTO roster_rows (id, day_id, position) VALUES ('%s', '%s', 0)", rowID, dayID),
+		fmt.Sprintf("INSERT INTO roster_slots (id, row_id, slot_key, description) VALUES ('%s', '%s', 'late', 'Bar')", uuid.New(), rowID),
+		fmt.Sprintf("INSERT INTO roster_slots (id, row_id, slot_key) VALUES ('%s', '%s', 'early')", uuid.New(), rowID),
+		fmt.Sprintf("INSERT INTO staff (id, first_name, last_visit) VALUES ('%s', 'Amy', '2024-03-05')", staffID),
+		fmt.Sprintf("INSERT INTO staff_availability (staff_id, day_index, name, early, mid, late) VALUES ('%s', 0, 'Tuesday', 1, 0, 0)", staffID),
+	}
+	for _, query := range inserts {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+	}
+	db.Close()
+
+	db, err = OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	defer db.Close()
+	repos := NewSQLiteRepositories(db)
+	week, err := repos.RosterWeek.LoadRosterWeek(ctx, 3)
+	if err != nil {
+		t.Fatalf("LoadRosterWeek: %v", err)
+	}
+	if !reflect.DeepEqual(models.SlotNames(week.Slots), models.SlotNames(models.LegacySlots)) {
+		t.Errorf("expected the early, mid and late shifts, got %+v", week.Slots)
+	}
+	slots := week.Days[0].Rows[0].Slots
+	if len(slots) != 2 || slots[0].Name != "Early" || slots[1].Name != "Late" || slots[1].Description != "Bar" {
+		t.Errorf("expected the row's early then late slots, got %+v", slots)
+	}
+	staff, err := repos.Staff.GetStaffByID(ctx, staffID)
+	if err != nil {
+		t.Fatalf("GetStaffByID: %v", err)
+	}
+	if day := staff.Availability[0]; !reflect.DeepEqual(day.Unavailable, models.SlotNameList{"Mid", "Late"}) {
+		t.Errorf("expected unavailable for the mid and late shifts, got %+v", day)
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"slices"
+	"regexp"
 	"sort"
 	"time"
 
@@ -19,19 +19,27 @@ import (
 
 // StaffRepository defines persistence operations for staff members.
 type StaffRepository interface {
-	SaveStaffMember(staff models.StaffMember) error
-	SaveStaffMembers(staff []*models.StaffMember) error
-	LoadAllStaff() ([]*models.StaffMember, error)
-	GetStaffByGoogleID(googleID string) (*models.StaffMember, error)
-	GetStaffByID(id uuid.UUID) (*models.StaffMember, error)
-	GetStaffByToken(token uuid.UUID) (*models.StaffMember, error)
-	RefreshStaffConfig(staff models.StaffMember) (models.StaffMember, error)
-	UpdateStaffToken(staff *models.StaffMember, token uuid.UUID) error
-	CreateStaffMember(googleID string, token uuid.UUID) error
-	DeleteLeaveReqByID(staff models.StaffMember, leaveReqID uuid.UUID) error
-	GetStaffByLeaveReqID(leaveReqID uuid.UUID) (*models.StaffMember, error)
-	CreateTrial(trialName string) error
-	DeleteStaffByID(id uuid.UUID) error
+	SaveStaffMember(ctx context.Context, staff models.StaffMember) error
+	SaveStaffMembers(ctx context.Context, staff []*models.StaffMember) error
+	LoadAllStaff(ctx context.Context) ([]*models.StaffMember, error)
+	// LoadAllStaffRecords returns every stored staff member, including
+	// deleted and unfinished accounts that LoadAllStaff leaves out.
+	LoadAllStaffRecords(ctx context.Context) ([]*models.StaffMember, error)
+	// GetStaffByIdentity returns the staff member who logs in with identity,
+	// or nil if nobody does.
+	GetStaffByIdentity(ctx context.Context, identity models.Identity) (*models.StaffMember, error)
+	// GetStaffByEmail returns the staff member with the given email address,
+	// ignoring case, or nil if nobody has it.
+	GetStaffByEmail(ctx context.Context, email string) (*models.StaffMember, error)
+	GetStaffByID(ctx context.Context, id uuid.UUID) (*models.StaffMember, error)
+	RefreshStaffConfig(ctx context.Context, staff models.StaffMember) (models.StaffMember, error)
+	// CreateStaffMember saves and returns a new, unfinished account that logs
+	// in with identity. The first account created is made an admin.
+	CreateStaffMember(ctx context.Context, identity models.Identity) (*models.StaffMember, error)
+	DeleteLeaveReqByID(ctx context.Context, staff models.StaffMember, leaveReqID uuid.UUID) error
+	GetStaffByLeaveReqID(ctx context.Context, leaveReqID uuid.UUID) (*models.StaffMember, error)
+	CreateTrial(ctx context.Context, trialName string) error
+	DeleteStaffByID(ctx context.Context, id uuid.UUID) error
 }
 
 const ConfigRefreshTime = time.Hour
@@ -39,29 +47,27 @@ const ConfigRefreshTime = time.Hour
 // MongoStaffRepository implements StaffRepository using MongoDB.
 type MongoStaffRepository struct {
 	collection *mongo.Collection
-	ctx        context.Context
 }
 
 // NewMongoStaffRepository creates a new instance of MongoStaffRepository.
-func NewMongoStaffRepository(ctx context.Context, db *mongo.Database) *MongoStaffRepository {
+func NewMongoStaffRepository(db *mongo.Database) *MongoStaffRepository {
 	return &MongoStaffRepository{
 		collection: db.Collection("staff"),
-		ctx:        ctx,
 	}
 }
 
-func (repo *MongoStaffRepository) SaveStaffMember(staff models.StaffMember) error {
+func (repo *MongoStaffRepository) SaveStaffMember(ctx context.Context, staff models.StaffMember) error {
 	filter := bson.M{"id": staff.ID}
 	update := bson.M{"$set": staff}
 	opts := options.Update().SetUpsert(true)
-	_, err := repo.collection.UpdateOne(repo.ctx, filter, update, opts)
+	_, err := repo.collection.UpdateOne(ctx, filter, update, opts)
 	if err != nil {
 		return fmt.Errorf("SaveStaffMember: %w", err)
 	}
 	return nil
 }
 
-func (repo *MongoStaffRepository) SaveStaffMembers(staffMembers []*models.StaffMember) error {
+func (repo *MongoStaffRepository) SaveStaffMembers(ctx context.Context, staffMembers []*models.StaffMember) error {
 	modelsList := make([]mongo.WriteModel, len(staffMembers))
 	for i, s := range staffMembers {
 		filter := bson.M{"id": s.ID}
@@ -69,7 +75,7 @@ func (repo *MongoStaffRepository) SaveStaffMembers(staffMembers []*models.StaffM
 		modelsList[i] = mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(true)
 	}
 	opts := options.BulkWrite().SetOrdered(false)
-	results, err := repo.collection.BulkWrite(repo.ctx, modelsList, opts)
+	results, err := repo.collection.BulkWrite(ctx, modelsList, opts)
 	if err != nil {
 		return fmt.Errorf("SaveStaffMembers: %w", err)
 	}
@@ -77,15 +83,15 @@ func (repo *MongoStaffRepository) SaveStaffMembers(staffMembers []*models.StaffM
 	return nil
 }
 
-func (repo *MongoStaffRepository) LoadAllStaff() ([]*models.StaffMember, error) {
-	cursor, err := repo.collection.Find(repo.ctx, bson.M{"isdeleted": bson.M{"$ne": true}})
+func (repo *MongoStaffRepository) LoadAllStaff(ctx context.Context) ([]*models.StaffMember, error) {
+	cursor, err := repo.collection.Find(ctx, bson.M{"isdeleted": bson.M{"$ne": true}})
 	if err != nil {
 		return nil, fmt.Errorf("LoadAllStaff: %w", err)
 	}
-	defer cursor.Close(repo.ctx)
+	defer cursor.Close(ctx)
 
 	var allStaff []*models.StaffMember
-	for cursor.Next(repo.ctx) {
+	for cursor.Next(ctx) {
 		var s models.StaffMember
 		if err := cursor.Decode(&s); err != nil {
 			utils.PrintError(err, "Error decoding staff member")
@@ -96,37 +102,67 @@ func (repo *MongoStaffRepository) LoadAllStaff() ([]*models.StaffMember, error)
 			allStaff = append(allStaff, &s)
 		}
 	}
-	// Sort by effective name (prefer NickName if set).
-	sort.Slice(allStaff, func(i, j int) bool {
-		name1 := allStaff[i].FirstName
-		if allStaff[i].NickName != "" {
-			name1 = allStaff[i].NickName
-		}
-		name2 := allStaff[j].FirstName
-		if allStaff[j].NickName != "" {
-			name2 = allStaff[j].NickName
+	sortStaffByName(allStaff)
+	return allStaff, nil
+}
+
+func (repo *MongoStaffRepository) LoadAllStaffRecords(ctx context.Context) ([]*models.StaffMember, error) {
+	cursor, err := repo.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("LoadAllStaffRecords: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	allStaff := []*models.StaffMember{}
+	for cursor.Next(ctx) {
+		var s models.StaffMember
+		if err := cursor.Decode(&s); err != nil {
+			return nil, fmt.Errorf("LoadAllStaffRecords: %w", err)
 		}
-		return name1 < name2
-	})
+		allStaff = append(allStaff, &s)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("LoadAllStaffRecords: %w", err)
+	}
 	return allStaff, nil
 }
 
-func (repo *MongoStaffRepository) GetStaffByGoogleID(googleID string) (*models.StaffMember, error) {
-	filter := bson.M{"googleid": googleID, "isdeleted": bson.M{"$ne": true}}
+func (repo *MongoStaffRepository) GetStaffByIdentity(ctx context.Context, identity models.Identity) (*models.StaffMember, error) {
+	filter := bson.M{
+		"identities": bson.M{
+			"$elemMatch": bson.M{"provider": identity.Provider, "subject": identity.Subject},
+		},
+		"isdeleted": bson.M{"$ne": true},
+	}
 	var s models.StaffMember
-	if err := repo.collection.FindOne(repo.ctx, filter).Decode(&s); err != nil {
+	if err := repo.collection.FindOne(ctx, filter).Decode(&s); err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return nil, nil
 		}
-		return nil, fmt.Errorf("GetStaffByGoogleID: %w", err)
+		return nil, fmt.Errorf("GetStaffByIdentity: %w", err)
 	}
 	return &s, nil
 }
 
-func (repo *MongoStaffRepository) GetStaffByID(id uuid.UUID) (*models.StaffMember, error) {
+func (repo *MongoStaffRepository) GetStaffByEmail(ctx context.Context, email string) (*models.StaffMember, error) {
+	filter := bson.M{
+		"email":     bson.M{"$regex": "^" + regexp.QuoteMeta(email) + "$", "$options": "i"},
+		"isdeleted": bson.M{"$ne": true},
+	}
+	var s models.StaffMember
+	if err := repo.collection.FindOne(ctx, filter).Decode(&s); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("GetStaffByEmail: %w", err)
+	}
+	return &s, nil
+}
+
+func (repo *MongoStaffRepository) GetStaffByID(ctx context.Context, id uuid.UUID) (*models.StaffMember, error) {
 	filter := bson.M{"id": id, "isdeleted": bson.M{"$ne": true}}
 	var s models.StaffMember
-	if err := repo.collection.FindOne(repo.ctx, filter).Decode(&s); err != nil {
+	if err := repo.collection.FindOne(ctx, filter).Decode(&s); err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return nil, nil
 		}
@@ -135,47 +171,94 @@ func (repo *MongoStaffRepository) GetStaffByID(id uuid.UUID) (*models.StaffMembe
 	return &s, nil
 }
 
-func (repo *MongoStaffRepository) GetStaffByToken(token uuid.UUID) (*models.StaffMember, error) {
-	filter := bson.M{"tokens": bson.M{"$elemMatch": bson.M{"$eq": token}}, "isdeleted": bson.M{"$ne": true}}
+func (repo *MongoStaffRepository) RefreshStaffConfig(ctx context.Context, staff models.StaffMember) (models.StaffMember, error) {
+	return refreshStaffConfig(ctx, repo, staff)
+}
+
+func (repo *MongoStaffRepository) CreateStaffMember(ctx context.Context, identity models.Identity) (*models.StaffMember, error) {
+	return createStaffMember(ctx, repo, identity)
+}
+
+func (repo *MongoStaffRepository) DeleteLeaveReqByID(ctx context.Context, staff models.StaffMember, leaveReqID uuid.UUID) error {
+	return deleteLeaveReqByID(ctx, repo, staff, leaveReqID)
+}
+
+func (repo *MongoStaffRepository) GetStaffByLeaveReqID(ctx context.Context, leaveReqID uuid.UUID) (*models.StaffMember, error) {
+	// BSON uses lowercased field names by default, so `LeaveRequests` is stored as `leaverequests`.
+	filter := bson.M{
+		"leaverequests": bson.M{
+			"$elemMatch": bson.M{"id": leaveReqID},
+		},
+		"isdeleted": bson.M{"$ne": true},
+	}
 	var s models.StaffMember
-	if err := repo.collection.FindOne(repo.ctx, filter).Decode(&s); err != nil {
-		return nil, fmt.Errorf("GetStaffByToken: %w", err)
+	if err := repo.collection.FindOne(ctx, filter).Decode(&s); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("GetStaffByLeaveReqID: %w", err)
 	}
 	return &s, nil
 }
 
-func (repo *MongoStaffRepository) RefreshStaffConfig(staff models.StaffMember) (models.StaffMember, error) {
+func (repo *MongoStaffRepository) CreateTrial(ctx context.Context, trialName string) error {
+	return createTrial(ctx, repo, trialName)
+}
+
+func (repo *MongoStaffRepository) DeleteStaffByID(ctx context.Context, id uuid.UUID) error {
+	filter := bson.M{"id": id}
+	update := bson.M{"$set": bson.M{"isdeleted": true}}
+	res, err := repo.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("DeleteStaffByID: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("DeleteStaffByID: no document found")
+	}
+	return nil
+}
+
+// -- Shared helpers for StaffRepository implementations --
+
+// sortStaffByName sorts staff by effective name (prefer NickName if set).
+func sortStaffByName(allStaff []*models.StaffMember) {
+	sort.Slice(allStaff, func(i, j int) bool {
+		name1 := allStaff[i].FirstName
+		if allStaff[i].NickName != "" {
+			name1 = allStaff[i].NickName
+		}
+		name2 := allStaff[j].FirstName
+		if allStaff[j].NickName != "" {
+			name2 = allStaff[j].NickName
+		}
+		return name1 < name2
+	})
+}
+
+func refreshStaffConfig(ctx context.Context, repo StaffRepository, staff models.StaffMember) (models.StaffMember, error) {
 	if time.Since(staff.Config.LastVisit) > ConfigRefreshTime {
 		// Use our central time helper to set start dates.
-		staff.Config.RosterDateOffset = utils.WeekOffsetFromDate(utils.GetLastTuesday())
-		staff.Config.TimesheetDateOffset = utils.WeekOffsetFromDate(utils.GetLastTuesday())
+		staff.Config.RosterDateOffset = utils.WeekOffsetFromDate(utils.GetWeekStart())
+		staff.Config.TimesheetDateOffset = utils.WeekOffsetFromDate(utils.GetWeekStart())
 	}
 	staff.Config.LastVisit = time.Now()
-	if err := repo.SaveStaffMember(staff); err != nil {
+	if err := repo.SaveStaffMember(ctx, staff); err != nil {
 		return staff, fmt.Errorf("RefreshStaffConfig: %w", err)
 	}
 	return staff, nil
 }
 
-func (repo *MongoStaffRepository) UpdateStaffToken(staff *models.StaffMember, token uuid.UUID) error {
-	if !slices.Contains(staff.Tokens, token) {
-		staff.Tokens = append(staff.Tokens, token)
-		return repo.SaveStaffMember(*staff)
-	}
-	return nil
-}
-
-func (repo *MongoStaffRepository) CreateStaffMember(googleID string, token uuid.UUID) error {
-	existing, err := repo.GetStaffByGoogleID(googleID)
+func createStaffMember(ctx context.Context, repo StaffRepository, identity models.Identity) (*models.StaffMember, error) {
+	existing, err := repo.GetStaffByIdentity(ctx, identity)
 	if err != nil {
-		return fmt.Errorf("CreateStaffMember: %w", err)
+		return nil, fmt.Errorf("CreateStaffMember: %w", err)
 	}
 	if existing != nil {
-		return errors.New("staff exists")
+		return nil, errors.New("staff exists")
 	}
-	allStaff, err := repo.LoadAllStaff()
+	allStaff, err := repo.LoadAllStaff(ctx)
 	if err != nil {
-		return fmt.Errorf("CreateStaffMember: %w", err)
+		return nil, fmt.Errorf("CreateStaffMember: %w", err)
 	}
 	isFirstUser := len(allStaff) == 0
 	role := models.Staff
@@ -183,24 +266,26 @@ func (repo *MongoStaffRepository) CreateStaffMember(googleID string, token uuid.
 		role = models.AdminRole
 	}
 	newStaff := models.StaffMember{
-		ID:        uuid.New(),
-		GoogleID:  googleID,
-		FirstName: "",
+		ID:         uuid.New(),
+		Identities: []models.Identity{identity},
+		FirstName:  "",
 		// Keep legacy IsAdmin for backwards-compat until handlers/templates are updated.
 		IsAdmin:      isFirstUser,
 		Role:         role,
-		Tokens:       []uuid.UUID{token},
 		Availability: emptyAvailability(),
 		Config: models.StaffConfig{
 			LastVisit:           time.Now(),
-			TimesheetDateOffset: utils.WeekOffsetFromDate(utils.GetLastTuesday()),
-			RosterDateOffset:    utils.WeekOffsetFromDate(utils.GetLastTuesday()),
+			TimesheetDateOffset: utils.WeekOffsetFromDate(utils.GetWeekStart()),
+			RosterDateOffset:    utils.WeekOffsetFromDate(utils.GetWeekStart()),
 		},
 	}
-	return repo.SaveStaffMember(newStaff)
+	if err := repo.SaveStaffMember(ctx, newStaff); err != nil {
+		return nil, err
+	}
+	return &newStaff, nil
 }
 
-func (repo *MongoStaffRepository) DeleteLeaveReqByID(staff models.StaffMember, leaveReqID uuid.UUID) error {
+func deleteLeaveReqByID(ctx context.Context, repo StaffRepository, staff models.StaffMember, leaveReqID uuid.UUID) error {
 	var updated []models.LeaveRequest
 	for _, lr := range staff.LeaveRequests {
 		if lr.ID == leaveReqID {
@@ -209,96 +294,29 @@ func (repo *MongoStaffRepository) DeleteLeaveReqByID(staff models.StaffMember, l
 		updated = append(updated, lr)
 	}
 	staff.LeaveRequests = updated
-	return repo.SaveStaffMember(staff)
+	return repo.SaveStaffMember(ctx, staff)
 }
 
-func (repo *MongoStaffRepository) GetStaffByLeaveReqID(leaveReqID uuid.UUID) (*models.StaffMember, error) {
-	// BSON uses lowercased field names by default, so `LeaveRequests` is stored as `leaverequests`.
-	filter := bson.M{
-		"leaverequests": bson.M{
-			"$elemMatch": bson.M{"id": leaveReqID},
-		},
-		"isdeleted": bson.M{"$ne": true},
-	}
-	var s models.StaffMember
-	if err := repo.collection.FindOne(repo.ctx, filter).Decode(&s); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, nil
-		}
-		return nil, fmt.Errorf("GetStaffByLeaveReqID: %w", err)
-	}
-	return &s, nil
-}
-
-func (repo *MongoStaffRepository) CreateTrial(trialName string) error {
+func createTrial(ctx context.Context, repo StaffRepository, trialName string) error {
 	newStaff := models.StaffMember{
 		ID:           uuid.New(),
-		GoogleID:     "Trial",
 		IsTrial:      true,
 		FirstName:    trialName,
 		Availability: emptyAvailability(),
 		IdealShifts:  7,
 	}
-	return repo.SaveStaffMember(newStaff)
+	return repo.SaveStaffMember(ctx, newStaff)
 }
 
-func (repo *MongoStaffRepository) DeleteStaffByID(id uuid.UUID) error {
-	filter := bson.M{"id": id}
-	update := bson.M{"$set": bson.M{"isdeleted": true}}
-	res, err := repo.collection.UpdateOne(repo.ctx, filter, update)
-	if err != nil {
-		return fmt.Errorf("DeleteStaffByID: %w", err)
-	}
-	if res.MatchedCount == 0 {
-		return fmt.Errorf("DeleteStaffByID: no document found")
-	}
-	return nil
-}
-
-// emptyAvailability returns a default DayAvailability slice.
+// emptyAvailability returns a default DayAvailability slice, available for
+// every shift of every day of the week.
 func emptyAvailability() []models.DayAvailability {
-	return []models.DayAvailability{
-		{
-			Name:  "Tues",
-			Early: true,
-			Mid:   true,
-			Late:  true,
-		},
-		{
-			Name:  "Wed",
-			Early: true,
-			Mid:   true,
-			Late:  true,
-		},
-		{
-			Name:  "Thurs",
-			Early: true,
-			Mid:   true,
-			Late:  true,
-		},
-		{
-			Name:  "Fri",
-			Early: true,
-			Mid:   true,
-			Late:  true,
-		},
-		{
-			Name:  "Sat",
-			Early: true,
-			Mid:   true,
-			Late:  true,
-		},
-		{
-			Name:  "Sun",
-			Early: true,
-			Mid:   true,
-			Late:  true,
-		},
-		{
-			Name:  "Mon",
-			Early: true,
-			Mid:   true,
-			Late:  true,
-		},
+	availability := []models.DayAvailability{}
+	for _, day := range utils.WeekDays() {
+		availability = append(availability, models.DayAvailability{
+			Name:        day.String(),
+			Unavailable: models.SlotNameList{},
+		})
 	}
+	return availability
 }
@@ -15,36 +15,41 @@ import (
 
 // TimesheetRepository defines persistence operations for staff members.
 type TimesheetRepository interface {
-	SaveTimesheetEntry(e TimesheetEntry) error
-	GetTimesheetEntryByID(entryID uuid.UUID) (*models.TimesheetEntry, error)
-	GetAllTimesheetEntries() (*[]*TimesheetEntry, error)
-	SaveAllTimesheetEntries(entries []*TimesheetEntry) error
-	GetStaffTimesheetWeek(staffID uuid.UUID, weekOffset int) (*[]*TimesheetEntry, error)
-	GetTimesheetWeek(weekOffset int) (*[]*TimesheetEntry, error)
-	DeleteTimesheetEntry(entryID uuid.UUID) error
+	SaveTimesheetEntry(ctx context.Context, e TimesheetEntry) error
+	GetTimesheetEntryByID(ctx context.Context, entryID uuid.UUID) (*models.TimesheetEntry, error)
+	GetAllTimesheetEntries(ctx context.Context) (*[]*TimesheetEntry, error)
+	SaveAllTimesheetEntries(ctx context.Context, entries []*TimesheetEntry) error
+	GetStaffTimesheetWeek(ctx context.Context, staffID uuid.UUID, weekOffset int) (*[]*TimesheetEntry, error)
+	GetTimesheetWeek(ctx context.Context, weekOffset int) (*[]*TimesheetEntry, error)
+	DeleteTimesheetEntry(ctx context.Context, entryID uuid.UUID) error
 }
 
 // MongoTimesheetRepository implements TimesheetRepository using MongoDB.
 type MongoTimesheetRepository struct {
 	collection *mongo.Collection
-	ctx        context.Context
 }
 
 // NewMongoTimesheetRepository creates a new instance of MongoTimesheetRepository.
-func NewMongoTimesheetRepository(ctx context.Context, db *mongo.Database) *MongoTimesheetRepository {
+func NewMongoTimesheetRepository(db *mongo.Database) *MongoTimesheetRepository {
 	return &MongoTimesheetRepository{
 		collection: db.Collection("timesheets"),
-		ctx:        ctx,
 	}
 }
 
 type TimesheetEntry = models.TimesheetEntry
 
-func (repo *MongoTimesheetRepository) SaveTimesheetEntry(e TimesheetEntry) error {
+// FieldRenamer is implemented by repositories that store documents whose
+// field names can fall behind the models, so migrations can rename them in
+// place. Stores with an explicit schema don't need it.
+type FieldRenamer interface {
+	RenameField(ctx context.Context, from string, to string, dryRun bool) (int64, error)
+}
+
+func (repo *MongoTimesheetRepository) SaveTimesheetEntry(ctx context.Context, e TimesheetEntry) error {
 	filter := bson.M{"id": e.ID}
 	update := bson.M{"$set": e}
 	opts := options.Update().SetUpsert(true)
-	_, err := repo.collection.UpdateOne(repo.ctx, filter, update, opts)
+	_, err := repo.collection.UpdateOne(ctx, filter, update, opts)
 	if err != nil {
 		utils.PrintError(err, "Failed to save timesheet entry")
 		return err
@@ -53,11 +58,11 @@ func (repo *MongoTimesheetRepository) SaveTimesheetEntry(e TimesheetEntry) error
 	return nil
 }
 
-func (repo *MongoTimesheetRepository) GetTimesheetEntryByID(entryID uuid.UUID) (*models.TimesheetEntry, error) {
+func (repo *MongoTimesheetRepository) GetTimesheetEntryByID(ctx context.Context, entryID uuid.UUID) (*models.TimesheetEntry, error) {
 	filter := bson.M{"id": entryID}
 
 	var timesheetEntry models.TimesheetEntry
-	err := repo.collection.FindOne(repo.ctx, filter).Decode(&timesheetEntry)
+	err := repo.collection.FindOne(ctx, filter).Decode(&timesheetEntry)
 	if err != nil {
 		utils.PrintError(err, "Error getting timesheet entry")
 		return nil, err
@@ -79,15 +84,15 @@ func SortTimesheetEntries(entries []*TimesheetEntry) []*TimesheetEntry {
 	return copiedEntries
 }
 
-func (repo *MongoTimesheetRepository) GetAllTimesheetEntries() (*[]*TimesheetEntry, error) {
-	cursor, err := repo.collection.Find(repo.ctx, bson.M{})
+func (repo *MongoTimesheetRepository) GetAllTimesheetEntries(ctx context.Context) (*[]*TimesheetEntry, error) {
+	cursor, err := repo.collection.Find(ctx, bson.M{})
 	if err != nil {
 		utils.PrintError(err, "Error executing query")
 		return nil, err
 	}
-	defer cursor.Close(repo.ctx)
+	defer cursor.Close(ctx)
 	var entries []*TimesheetEntry
-	if err = cursor.All(repo.ctx, &entries); err != nil {
+	if err = cursor.All(ctx, &entries); err != nil {
 		utils.PrintError(err, "Error decoding timesheet entries")
 		return nil, err
 	}
@@ -95,7 +100,7 @@ func (repo *MongoTimesheetRepository) GetAllTimesheetEntries() (*[]*TimesheetEnt
 	return &entries, nil
 }
 
-func (repo *MongoTimesheetRepository) SaveAllTimesheetEntries(entries []*TimesheetEntry) error {
+func (repo *MongoTimesheetRepository) SaveAllTimesheetEntries(ctx context.Context, entries []*TimesheetEntry) error {
 	bulkWriteModels := make([]mongo.WriteModel, len(entries))
 	for i, entry := range entries {
 		filter := bson.M{"id": entry.ID}
@@ -104,7 +109,7 @@ func (repo *MongoTimesheetRepository) SaveAllTimesheetEntries(entries []*Timeshe
 	}
 
 	opts := options.BulkWrite().SetOrdered(false)
-	results, err := repo.collection.BulkWrite(repo.ctx, bulkWriteModels, opts)
+	results, err := repo.collection.BulkWrite(ctx, bulkWriteModels, opts)
 	if err != nil {
 		utils.PrintError(err, "Failed to save timesheet entries")
 		return err
@@ -113,38 +118,37 @@ func (repo *MongoTimesheetRepository) SaveAllTimesheetEntries(entries []*Timeshe
 	return nil
 }
 
-func (repo *MongoTimesheetRepository) GetStaffTimesheetWeek(staffID uuid.UUID, weekOffset int) (*[]*TimesheetEntry, error) {
+func (repo *MongoTimesheetRepository) GetStaffTimesheetWeek(ctx context.Context, staffID uuid.UUID, weekOffset int) (*[]*TimesheetEntry, error) {
 	filter := bson.M{
 		"weekOffset": weekOffset,
-		// TODO: Fucked up the bson name
-		"days": staffID,
+		"staffId":    staffID,
 	}
 
-	cursor, err := repo.collection.Find(repo.ctx, filter)
+	cursor, err := repo.collection.Find(ctx, filter)
 	if err != nil {
 		utils.PrintError(err, "Error finding timesheet week")
 		return nil, err
 	}
-	defer cursor.Close(repo.ctx)
+	defer cursor.Close(ctx)
 	var entries []*TimesheetEntry
-	if err = cursor.All(repo.ctx, &entries); err != nil {
+	if err = cursor.All(ctx, &entries); err != nil {
 		utils.PrintError(err, "Error decoding timesheet weeks")
 		return nil, err
 	}
 	return &entries, nil
 }
 
-func (repo *MongoTimesheetRepository) GetTimesheetWeek(weekOffset int) (*[]*TimesheetEntry, error) {
+func (repo *MongoTimesheetRepository) GetTimesheetWeek(ctx context.Context, weekOffset int) (*[]*TimesheetEntry, error) {
 	filter := bson.M{"weekOffset": weekOffset}
 
-	cursor, err := repo.collection.Find(repo.ctx, filter)
+	cursor, err := repo.collection.Find(ctx, filter)
 	if err != nil {
 		utils.PrintError(err, "Error finding timesheet week")
 		return nil, err
 	}
-	defer cursor.Close(repo.ctx)
+	defer cursor.Close(ctx)
 	var entries []*TimesheetEntry
-	if err = cursor.All(repo.ctx, &entries); err != nil {
+	if err = cursor.All(ctx, &entries); err != nil {
 		utils.PrintError(err, "Error decoding timesheet weeks")
 		return nil, err
 	}
@@ -152,9 +156,24 @@ func (repo *MongoTimesheetRepository) GetTimesheetWeek(weekOffset int) (*[]*Time
 	return &entries, nil
 }
 
-func (repo *MongoTimesheetRepository) DeleteTimesheetEntry(entryID uuid.UUID) error {
+// RenameField renames the stored field from to to on every timesheet entry
+// that still has it, returning how many entries were changed. With dryRun
+// set the entries are only counted.
+func (repo *MongoTimesheetRepository) RenameField(ctx context.Context, from string, to string, dryRun bool) (int64, error) {
+	filter := bson.M{from: bson.M{"$exists": true}}
+	if dryRun {
+		return repo.collection.CountDocuments(ctx, filter)
+	}
+	result, err := repo.collection.UpdateMany(ctx, filter, bson.M{"$rename": bson.M{from: to}})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+func (repo *MongoTimesheetRepository) DeleteTimesheetEntry(ctx context.Context, entryID uuid.UUID) error {
 	filter := bson.M{"id": entryID}
-	_, err := repo.collection.DeleteOne(repo.ctx, filter)
+	_, err := repo.collection.DeleteOne(ctx, filter)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,253 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"roster/cmd/models"
+	"roster/cmd/utils"
+
+	"github.com/google/uuid"
+)
+
+// API_TOKEN_KEY holds the API token a request was made with, in place of a
+// session.
+const API_TOKEN_KEY = "apiToken"
+
+// bearerToken returns the token from r's Authorization header, if it has
+// one.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// apiTokenFromContext returns the API token VerifySession attached to the
+// request.
+func apiTokenFromContext(ctx context.Context) (models.APIToken, bool) {
+	token, ok := ctx.Value(API_TOKEN_KEY).(models.APIToken)
+	return token, ok
+}
+
+// verifyAPIToken serves a request authenticated by an API token instead of a
+// session cookie. Scripts get a 401 rather than being sent to log in.
+func (s *Server) verifyAPIToken(w http.ResponseWriter, r *http.Request, secret string, handler http.HandlerFunc) {
+	ctx := r.Context()
+	token, err := s.Repos.APITokens.GetAPITokenByHash(ctx, models.HashAPIToken(secret))
+	if err != nil {
+		utils.PrintError(err, "Invalid API token")
+		w.Header().Set("WWW-Authenticate", `Bearer realm="roster"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	staffMember, err := s.Repos.Staff.GetStaffByID(ctx, token.StaffID)
+	if err != nil || staffMember == nil || staffMember.IsDeleted {
+		utils.PrintError(err, "No staff member for API token")
+		w.Header().Set("WWW-Authenticate", `Bearer realm="roster"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	now := time.Now()
+	if now.Sub(token.LastUsedAt) > sessionTouchInterval {
+		if err := s.Repos.APITokens.TouchAPIToken(ctx, token.ID, now); err != nil {
+			utils.PrintError(err, "Failed to update API token")
+		}
+		token.LastUsedAt = now
+	}
+	handler(w, r.WithContext(context.WithValue(ctx, API_TOKEN_KEY, *token)))
+}
+
+// formList is a form field that htmx sends as a string when one value is
+// chosen and as a list when several are.
+type formList []string
+
+func (l *formList) UnmarshalJSON(data []byte) error {
+	var values []string
+	if err := json.Unmarshal(data, &values); err == nil {
+		*l = values
+		return nil
+	}
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*l = formList{value}
+	return nil
+}
+
+type APITokensData struct {
+	models.StaffMember
+	Tokens []*models.APIToken
+	// Permissions are the ones a new token for the staff member can have.
+	Permissions []models.Permission
+	// NewToken is the token just created, which is only ever shown once.
+	NewToken string
+}
+
+// apiTokenPermissions lists the permissions a token for staff can be given:
+// those of their role, except making more tokens.
+func apiTokenPermissions(staff models.StaffMember) []models.Permission {
+	perms := []models.Permission{}
+	for _, perm := range models.AllPermissions {
+		if perm != models.PermAPITokensManage && staff.Role.Has(perm) {
+			perms = append(perms, perm)
+		}
+	}
+	return perms
+}
+
+func (s *Server) makeAPITokensData(ctx context.Context, staff models.StaffMember) (*APITokensData, error) {
+	tokens, err := s.Repos.APITokens.FindStaffAPITokens(ctx, staff.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &APITokensData{
+		StaffMember: staff,
+		Tokens:      tokens,
+		Permissions: apiTokenPermissions(staff),
+	}, nil
+}
+
+func (s *Server) renderAPITokens(w http.ResponseWriter, r *http.Request, staffID uuid.UUID, newToken string) {
+	staffMember, err := s.Repos.Staff.GetStaffByID(r.Context(), staffID)
+	if err != nil || staffMember == nil {
+		utils.PrintError(err, "Failed to get staff by ID")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	data, err := s.makeAPITokensData(r.Context(), *staffMember)
+	if err != nil {
+		utils.PrintError(err, "Failed to load API tokens")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	data.NewToken = newToken
+	s.renderTemplate(w, "apiTokens", data)
+}
+
+// auditAPIToken is what the audit log records about a token, leaving out its
+// hash.
+func auditAPIToken(token models.APIToken) models.APIToken {
+	token.TokenHash = ""
+	return token
+}
+
+type CreateAPITokenBody struct {
+	StaffID     string   `json:"staffID"`
+	Name        string   `json:"name"`
+	Permissions formList `json:"permissions"`
+}
+
+// HandleCreateAPIToken makes a personal API token for a staff member, scoped
+// to some of their role's permissions.
+func (s *Server) HandleCreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	var reqBody CreateAPITokenBody
+	if err := ReadAndUnmarshal(w, r, &reqBody); err != nil {
+		return
+	}
+	staffID, err := uuid.Parse(reqBody.StaffID)
+	if err != nil {
+		utils.PrintError(err, "Invalid staff ID")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	thisStaff := s.GetSessionUser(w, r)
+	if thisStaff == nil {
+		return
+	}
+	ctx := r.Context()
+	staffMember, err := s.Repos.Staff.GetStaffByID(ctx, staffID)
+	if err != nil || staffMember == nil {
+		utils.PrintError(err, "Failed to get staff by ID")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	allowed := apiTokenPermissions(*staffMember)
+	perms := []models.Permission{}
+	for _, name := range reqBody.Permissions {
+		perm := models.Permission(name)
+		if !slices.Contains(allowed, perm) {
+			utils.PrintLog("Can't give %v's API token %v", staffID, perm)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if !slices.Contains(perms, perm) {
+			perms = append(perms, perm)
+		}
+	}
+	secret, hash, err := models.NewAPITokenSecret()
+	if err != nil {
+		utils.PrintError(err, "Failed to make API token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	token := models.APIToken{
+		ID:          uuid.New(),
+		StaffID:     staffID,
+		Name:        strings.TrimSpace(reqBody.Name),
+		TokenHash:   hash,
+		Permissions: perms,
+		CreatedAt:   time.Now(),
+	}
+	if err := s.Repos.APITokens.CreateAPIToken(ctx, token); err != nil {
+		utils.PrintError(err, "Failed to save API token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	s.recordAudit(ctx, *thisStaff, models.AuditCreateAPIToken, models.AuditEntityStaff, staffID, nil, auditAPIToken(token))
+	s.renderAPITokens(w, r, staffID, secret)
+}
+
+type RevokeAPITokenBody struct {
+	StaffID string `json:"staffID"`
+	TokenID string `json:"tokenID"`
+}
+
+// HandleRevokeAPIToken deletes one of a staff member's API tokens.
+func (s *Server) HandleRevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	var reqBody RevokeAPITokenBody
+	if err := ReadAndUnmarshal(w, r, &reqBody); err != nil {
+		return
+	}
+	staffID, err := uuid.Parse(reqBody.StaffID)
+	if err != nil {
+		utils.PrintError(err, "Invalid staff ID")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	tokenID, err := uuid.Parse(reqBody.TokenID)
+	if err != nil {
+		utils.PrintError(err, "Invalid token ID")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	thisStaff := s.GetSessionUser(w, r)
+	if thisStaff == nil {
+		return
+	}
+	ctx := r.Context()
+	tokens, err := s.Repos.APITokens.FindStaffAPITokens(ctx, staffID)
+	if err != nil {
+		utils.PrintError(err, "Failed to load API tokens")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	i := slices.IndexFunc(tokens, func(t *models.APIToken) bool { return t.ID == tokenID })
+	if i < 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err := s.Repos.APITokens.DeleteAPIToken(ctx, tokenID); err != nil {
+		utils.PrintError(err, "Failed to revoke API token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	s.recordAudit(ctx, *thisStaff, models.AuditRevokeAPIToken, models.AuditEntityStaff, staffID, auditAPIToken(*tokens[i]), nil)
+	s.renderAPITokens(w, r, staffID, "")
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"roster/cmd/models"
+	"roster/cmd/repository"
+
+	"github.com/google/uuid"
+)
+
+var apiTokenPattern = regexp.MustCompile(`value="(rst_[\w-]+)"`)
+
+// serveWithAPIToken runs handler with token as the bearer token and no
+// cookies.
+func serveWithAPIToken(handler http.HandlerFunc, method string, target string, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+// Test an admin can give a manager a token that only exports reports, and
+// revoke it again.
+func TestAPIToken_ScopedToPermissions(t *testing.T) {
+	s := newMemoryServer(t)
+	_, adminToken := newTestSession(t, s)
+	ctx := context.Background()
+	manager := models.StaffMember{ID: uuid.New(), FirstName: "Mia", Role: models.Manager}
+	if err := s.Repos.Staff.SaveStaffMember(ctx, manager); err != nil {
+		t.Fatalf("SaveStaffMember: %v", err)
+	}
+
+	rec := serveWithSession(s, s.HandleProfileIndex, "GET", "/profile?editStaffId="+manager.ID.String(), "", adminToken)
+	if !strings.Contains(rec.Body.String(), `hx-post="/createAPIToken"`) {
+		t.Error("expected the manager's profile to offer API tokens")
+	}
+	rec = serveWithSession(s, s.HandleCreateAPIToken, "POST", "/createAPIToken", `{"staffID":"`+manager.ID.String()+`","name":"reports","permissions":"backup.manage"}`, adminToken)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a permission the manager lacks to be refused, got %d", rec.Code)
+	}
+	rec = serveWithSession(s, s.HandleCreateAPIToken, "POST", "/createAPIToken", `{"staffID":"`+manager.ID.String()+`","name":"reports","permissions":"reports.export"}`, adminToken)
+	match := apiTokenPattern.FindStringSubmatch(rec.Body.String())
+	if rec.Code != http.StatusOK || match == nil {
+		t.Fatalf("expected a new token, got %d", rec.Code)
+	}
+	secret := match[1]
+	tokens, _ := s.Repos.APITokens.FindStaffAPITokens(ctx, manager.ID)
+	if len(tokens) != 1 || tokens[0].TokenHash == secret || !tokens[0].LastUsedAt.IsZero() {
+		t.Fatalf("expected one hashed, unused token, got %+v", tokens)
+	}
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+	export := s.VerifyPermission(ok, models.PermReportsExport)
+	if rec := serveWithAPIToken(export, "POST", "/exportWageReport", secret); rec.Code != http.StatusNoContent {
+		t.Errorf("expected the token to export reports without a CSRF token, got %d", rec.Code)
+	}
+	if rec := serveWithAPIToken(s.VerifyPermission(ok, models.PermRosterEdit), "GET", "/modifySlot", secret); rec.Code != http.StatusForbidden {
+		t.Errorf("expected the token to be refused outside its scope, got %d", rec.Code)
+	}
+	if rec := serveWithAPIToken(s.VerifySession(ok), "POST", "/submitLeave", secret); rec.Code != http.StatusForbidden {
+		t.Errorf("expected the token to be refused on a route without a permission, got %d", rec.Code)
+	}
+	if rec := serveWithAPIToken(export, "GET", "/exportWageReport", "rst_wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected an unknown token to be refused, got %d", rec.Code)
+	}
+	tokens, _ = s.Repos.APITokens.FindStaffAPITokens(ctx, manager.ID)
+	if tokens[0].LastUsedAt.IsZero() {
+		t.Error("expected the token's use to be recorded")
+	}
+
+	rec = serveWithSession(s, s.HandleRevokeAPIToken, "POST", "/revokeAPIToken", `{"staffID":"`+manager.ID.String()+`","tokenID":"`+tokens[0].ID.String()+`"}`, adminToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the token to be revoked, got %d", rec.Code)
+	}
+	if rec := serveWithAPIToken(export, "GET", "/exportWageReport", secret); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected a revoked token to be refused, got %d", rec.Code)
+	}
+	for _, action := range []string{models.AuditCreateAPIToken, models.AuditRevokeAPIToken} {
+		entries, err := s.Repos.Audit.FindAuditEntries(ctx, repository.AuditFilter{Action: action})
+		if err != nil || len(entries) != 1 {
+			t.Errorf("expected %q to be audited, got %+v, %v", action, entries, err)
+		}
+	}
+}
+
+// Test a token can't be used to make more tokens, even for an admin.
+func TestAPIToken_CantManageTokens(t *testing.T) {
+	s := newMemoryServer(t)
+	admin, adminToken := newTestSession(t, s)
+	rec := serveWithSession(s, s.HandleCreateAPIToken, "POST", "/createAPIToken", `{"staffID":"`+admin.ID.String()+`","name":"all","permissions":"apitokens.manage"}`, adminToken)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a token that manages tokens to be refused, got %d", rec.Code)
+	}
+	rec = serveWithSession(s, s.HandleCreateAPIToken, "POST", "/createAPIToken", `{"staffID":"`+admin.ID.String()+`","name":"all","permissions":["staff.manage","audit.view"]}`, adminToken)
+	match := apiTokenPattern.FindStringSubmatch(rec.Body.String())
+	if rec.Code != http.StatusOK || match == nil {
+		t.Fatalf("expected a new token, got %d", rec.Code)
+	}
+	create := s.VerifyPermission(s.HandleCreateAPIToken, models.PermAPITokensManage)
+	if rec := serveWithAPIToken(create, "POST", "/createAPIToken", match[1]); rec.Code != http.StatusForbidden {
+		t.Errorf("expected the token to be refused, got %d", rec.Code)
+	}
+}
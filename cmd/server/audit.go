@@ -0,0 +1,239 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"time"
+
+	"roster/cmd/models"
+	"roster/cmd/repository"
+	"roster/cmd/utils"
+
+	"github.com/google/uuid"
+)
+
+// auditPageLimit caps how many entries the audit page shows at once.
+const auditPageLimit = 200
+
+// recordAudit appends a change made by actor to the audit log. before and
+// after are stored as JSON; pass nil (or a nil pointer) for a side where the
+// entity did not exist. Failures are logged rather than returned so that
+// auditing never undoes or blocks a change that has already been saved.
+func (s *Server) recordAudit(ctx context.Context, actor models.StaffMember, action string, entityType string, entityID uuid.UUID, before any, after any) {
+	name := actor.FirstName
+	if actor.NickName != "" {
+		name = actor.NickName
+	}
+	entry := models.AuditEntry{
+		ID:         uuid.New(),
+		Timestamp:  time.Now(),
+		ActorID:    actor.ID,
+		ActorName:  name,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Before:     auditJSON(before),
+		After:      auditJSON(after),
+	}
+	if err := s.Repos.Audit.RecordAudit(ctx, entry); err != nil {
+		utils.PrintError(err, "Failed to record audit entry")
+	}
+}
+
+func auditJSON(v any) string {
+	if v == nil {
+		return ""
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		utils.PrintError(err, "Failed to marshal audit value")
+		return ""
+	}
+	return string(data)
+}
+
+// auditStaff is the part of a staff member kept in the audit log. Session
+// tokens, leave requests and personal view settings are left out.
+type auditStaff struct {
+	Role         string
+	IsTrial      bool
+	IsHidden     bool
+	IsKitchen    bool
+	IsMinor      bool
+	NickName     string
+	FirstName    string
+	LastName     string
+	Email        string
+	Phone        string
+	ContactName  string
+	ContactPhone string
+	IdealShifts  int
+	Availability []models.DayAvailability
+	IsDeleted    bool
+}
+
+func makeAuditStaff(staff models.StaffMember) auditStaff {
+	return auditStaff{
+		Role:         staff.RoleLabel(),
+		IsTrial:      staff.IsTrial,
+		IsHidden:     staff.IsHidden,
+		IsKitchen:    staff.IsKitchen,
+		IsMinor:      staff.IsMinor,
+		NickName:     staff.NickName,
+		FirstName:    staff.FirstName,
+		LastName:     staff.LastName,
+		Email:        staff.Email,
+		Phone:        staff.Phone,
+		ContactName:  staff.ContactName,
+		ContactPhone: staff.ContactPhone,
+		IdealShifts:  staff.IdealShifts,
+		Availability: staff.Availability,
+		IsDeleted:    staff.IsDeleted,
+	}
+}
+
+// auditLeave is a leave request as kept in the audit log.
+type auditLeave struct {
+	StaffID   uuid.UUID
+	Reason    string
+	StartDate *time.Time
+	EndDate   *time.Time
+	Status    string
+}
+
+func makeAuditLeave(staffID uuid.UUID, req models.LeaveRequest) auditLeave {
+	return auditLeave{
+		StaffID:   staffID,
+		Reason:    req.Reason,
+		StartDate: req.StartDate.Time,
+		EndDate:   req.EndDate.Time,
+		Status:    req.Status.String(),
+	}
+}
+
+// loadAuditSlot returns a copy of the slot with the given ID in the week at
+// weekOffset, or nil if there is no such slot.
+func (s *Server) loadAuditSlot(ctx context.Context, weekOffset int, slotID uuid.UUID) *models.Slot {
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(ctx, weekOffset)
+	if err != nil {
+		utils.PrintError(err, "Failed to load roster week for audit")
+		return nil
+	}
+	slot := week.GetSlotByID(slotID)
+	if slot == nil {
+		return nil
+	}
+	before := *slot
+	return &before
+}
+
+type AuditQuery struct {
+	ActorID    string
+	EntityType string
+	Action     string
+	From       string
+	To         string
+}
+
+type AuditData struct {
+	CacheBust   string
+	CSRFToken   string
+	StaffMember models.StaffMember
+	RosterLive  bool
+	AllStaff    []*models.StaffMember
+	Query       AuditQuery
+	Entries     []*models.AuditEntry
+	EntityTypes []string
+	Actions     []string
+}
+
+// parseAuditQuery reads the audit page's filters from the URL. Invalid
+// values are ignored rather than rejected so a bad date can't break the page.
+func parseAuditQuery(r *http.Request) (AuditQuery, repository.AuditFilter) {
+	values := r.URL.Query()
+	query := AuditQuery{
+		ActorID:    values.Get("actorID"),
+		EntityType: values.Get("entityType"),
+		Action:     values.Get("action"),
+		From:       values.Get("from"),
+		To:         values.Get("to"),
+	}
+	filter := repository.AuditFilter{
+		EntityType: query.EntityType,
+		Action:     query.Action,
+		Limit:      auditPageLimit,
+	}
+	if actorID, err := uuid.Parse(query.ActorID); err == nil {
+		filter.ActorID = &actorID
+	}
+	if from, err := time.ParseInLocation("2006-01-02", query.From, time.Local); err == nil {
+		filter.From = from
+	}
+	if to, err := time.ParseInLocation("2006-01-02", query.To, time.Local); err == nil {
+		// The end date is inclusive.
+		filter.To = to.AddDate(0, 0, 1)
+	}
+	return query, filter
+}
+
+func (s *Server) makeAuditData(r *http.Request, activeStaff models.StaffMember) (AuditData, error) {
+	query, filter := parseAuditQuery(r)
+	entries, err := s.Repos.Audit.FindAuditEntries(r.Context(), filter)
+	if err != nil {
+		return AuditData{}, err
+	}
+	allStaff, err := s.Repos.Staff.LoadAllStaff(r.Context())
+	if err != nil {
+		return AuditData{}, err
+	}
+	return AuditData{
+		CacheBust:   s.CacheBust,
+		CSRFToken:   s.csrfToken(r.Context()),
+		StaffMember: activeStaff,
+		AllStaff:    allStaff,
+		Query:       query,
+		Entries:     entries,
+		EntityTypes: models.AuditEntityTypes,
+		Actions:     models.AuditActions,
+	}, nil
+}
+
+func (s *Server) HandleAudit(w http.ResponseWriter, r *http.Request) {
+	thisStaff := s.GetSessionUser(w, r)
+	if thisStaff == nil {
+		return
+	}
+	data, err := s.makeAuditData(r, *thisStaff)
+	if err != nil {
+		utils.PrintError(err, "Failed to load audit log")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(r.Context(), thisStaff.Config.RosterDateOffset)
+	if err != nil {
+		utils.PrintError(err, "Failed to load roster week")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	data.RosterLive = week.IsLive
+	s.renderTemplate(w, "audit", data)
+}
+
+func (s *Server) HandleAuditTable(w http.ResponseWriter, r *http.Request) {
+	thisStaff := s.GetSessionUser(w, r)
+	if thisStaff == nil {
+		return
+	}
+	data, err := s.makeAuditData(r, *thisStaff)
+	if err != nil {
+		utils.PrintError(err, "Failed to load audit log")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	s.renderTemplate(w, "auditTable", data)
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"roster/cmd/models"
+	"roster/cmd/repository"
+
+	"github.com/google/uuid"
+)
+
+// Test a slot edit records who made it and the slot before and after.
+func TestHandleModifyDescriptionSlot_RecordsAudit(t *testing.T) {
+	s := newMemoryServer(t)
+	staff, token := newTestSession(t, s)
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(context.Background(), staff.Config.RosterDateOffset)
+	if err != nil {
+		t.Fatalf("LoadRosterWeek: %v", err)
+	}
+	slotID := week.Days[0].Rows[0].Slots[0].ID
+
+	if rec := modifyDescription(s, token, slotID, week.Revision); rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	entries, err := s.Repos.Audit.FindAuditEntries(context.Background(), repository.AuditFilter{})
+	if err != nil {
+		t.Fatalf("FindAuditEntries: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 audit entry, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.ActorID != staff.ID || e.ActorName != "Alice" {
+		t.Errorf("expected Alice as the actor, got %v (%q)", e.ActorID, e.ActorName)
+	}
+	if e.Action != models.AuditSlotDescription || e.EntityType != models.AuditEntityRoster || e.EntityID != slotID {
+		t.Errorf("unexpected audit entry %+v", e)
+	}
+	if !strings.Contains(e.Before, `"Description":""`) || !strings.Contains(e.After, `"Description":"Bar"`) {
+		t.Errorf("expected description change in before/after, got %q -> %q", e.Before, e.After)
+	}
+}
+
+// Test approving a timesheet entry records the approval.
+func TestHandleToggleApproved_RecordsAudit(t *testing.T) {
+	s := newMemoryServer(t)
+	staff, token := newTestSession(t, s)
+	entry := MakeEmptyTimesheetEntry(0, 0, staff.ID)
+	if err := s.Repos.Timesheet.SaveTimesheetEntry(context.Background(), entry); err != nil {
+		t.Fatalf("SaveTimesheetEntry: %v", err)
+	}
+
+	body := strings.NewReader(`{"EntryID":"` + entry.ID.String() + `"}`)
+	req := httptest.NewRequest("POST", "/toggleApproved", body)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: token.String()})
+	req.Header.Set(CSRF_HEADER, s.sessionCSRFToken(token))
+	rec := httptest.NewRecorder()
+	s.VerifySession(s.HandleToggleApproved)(rec, req)
+
+	entries, err := s.Repos.Audit.FindAuditEntries(context.Background(), repository.AuditFilter{
+		Action: models.AuditToggleApproved,
+	})
+	if err != nil {
+		t.Fatalf("FindAuditEntries: %v", err)
+	}
+	if len(entries) != 1 || entries[0].EntityID != entry.ID {
+		t.Fatalf("expected the approval to be recorded, got %+v", entries)
+	}
+	if !strings.Contains(entries[0].Before, `"approved":false`) || !strings.Contains(entries[0].After, `"approved":true`) {
+		t.Errorf("expected approval change in before/after, got %q -> %q", entries[0].Before, entries[0].After)
+	}
+}
+
+// Test the audit table only lists entries matching the filters.
+func TestHandleAuditTable_Filters(t *testing.T) {
+	s := newMemoryServer(t)
+	staff, token := newTestSession(t, s)
+	ctx := context.Background()
+	s.recordAudit(ctx, *staff, models.AuditSetRole, models.AuditEntityStaff, uuid.New(), nil, map[string]string{"Role": "Manager"})
+	s.recordAudit(ctx, *staff, models.AuditToggleLive, models.AuditEntityRoster, uuid.New(), nil, map[string]bool{"IsLive": true})
+
+	req := httptest.NewRequest("GET", "/auditTable?entityType=staff", nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: token.String()})
+	rec := httptest.NewRecorder()
+	s.VerifySession(s.HandleAuditTable)(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, models.AuditSetRole) {
+		t.Error("expected the role change to be listed")
+	}
+	if strings.Contains(body, models.AuditToggleLive) {
+		t.Error("expected entries for other entity types to be filtered out")
+	}
+
+	req = httptest.NewRequest("GET", "/audit?entityType=staff", nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: token.String()})
+	rec = httptest.NewRecorder()
+	s.VerifySession(s.HandleAudit)(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `<option value="staff" selected>`) {
+		t.Errorf("expected audit page with the entity filter selected, got %d", rec.Code)
+	}
+}
+
+// Test the end date filter includes the whole of that day.
+func TestParseAuditQuery_InclusiveEndDate(t *testing.T) {
+	req := httptest.NewRequest("GET", "/audit?from=2024-05-01&to=2024-05-07&actorID=bad", nil)
+	query, filter := parseAuditQuery(req)
+	if query.To != "2024-05-07" {
+		t.Errorf("expected query to keep the raw date, got %q", query.To)
+	}
+	if filter.ActorID != nil {
+		t.Error("expected an invalid actor ID to be ignored")
+	}
+	want := time.Date(2024, 5, 8, 0, 0, 0, 0, time.Local)
+	if !filter.To.Equal(want) {
+		t.Errorf("filter.To = %v; want %v", filter.To, want)
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"roster/cmd/autoroster"
+	"roster/cmd/models"
+	"roster/cmd/utils"
+)
+
+type AutoRosterBody struct {
+	KeepAssignments string `json:"keepAssignments"`
+}
+
+// HandleAutoRoster fills the empty slots of the draft week being viewed,
+// listing any it couldn't fill and why.
+func (s *Server) HandleAutoRoster(w http.ResponseWriter, r *http.Request) {
+	var reqBody AutoRosterBody
+	if err := ReadAndUnmarshal(w, r, &reqBody); err != nil {
+		return
+	}
+	thisStaff := s.GetSessionUser(w, r)
+	if thisStaff == nil {
+		return
+	}
+	ctx := r.Context()
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(ctx, thisStaff.Config.RosterDateOffset)
+	if err != nil {
+		utils.PrintError(err, "Failed to load roster week")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if week.IsLive {
+		root := s.MakeRootStruct(ctx, *thisStaff, *week)
+		root.Notice = "Only draft weeks can be filled automatically. Make the week private first."
+		s.renderTemplate(w, "rosterMainContainer", root)
+		return
+	}
+	allStaff, err := s.Repos.Staff.LoadAllStaff(ctx)
+	if err != nil {
+		utils.PrintError(err, "Failed to load all staff")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// Fill changes the week in place, so load a copy to audit.
+	before, err := s.Repos.RosterWeek.LoadRosterWeek(ctx, thisStaff.Config.RosterDateOffset)
+	if err != nil {
+		utils.PrintError(err, "Failed to load roster week")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	previous, next, err := s.loadNeighbours(ctx, week.WeekOffset)
+	if err != nil {
+		utils.PrintError(err, "Failed to load neighbouring roster weeks")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	result := autoroster.Fill(week, allStaff, autoroster.Options{
+		KeepAssignments: reqBody.KeepAssignments == "on",
+		Previous:        previous,
+		Next:            next,
+	})
+	if !s.saveClientRosterWeek(w, r, *thisStaff, week) {
+		return
+	}
+	s.recordAudit(ctx, *thisStaff, models.AuditAutoRoster, models.AuditEntityRoster, week.ID, before, week)
+	root := s.MakeRootStruct(ctx, *thisStaff, *week)
+	root.Notice = fmt.Sprintf("Filled %d slots automatically.", result.Filled)
+	if len(result.Unfilled) > 0 {
+		root.Notice += fmt.Sprintf(" %d couldn't be filled.", len(result.Unfilled))
+	}
+	root.Unfilled = result.Unfilled
+	s.renderTemplate(w, "rosterMainContainer", root)
+}
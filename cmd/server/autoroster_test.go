@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"roster/cmd/models"
+
+	"github.com/google/uuid"
+)
+
+// Test filling a draft week rosters available staff, lists the slots left
+// empty, and leaves live weeks alone.
+func TestHandleAutoRoster(t *testing.T) {
+	s := newMemoryServer(t)
+	staff, token := newTestSession(t, s)
+	ctx := context.Background()
+	sam := models.StaffMember{ID: uuid.New(), FirstName: "Sam", IdealShifts: 2}
+	for i := 0; i < 7; i++ {
+		sam.Availability = append(sam.Availability, models.DayAvailability{Unavailable: models.SlotNameList{}})
+	}
+	if err := s.Repos.Staff.SaveStaffMember(ctx, sam); err != nil {
+		t.Fatalf("SaveStaffMember: %v", err)
+	}
+	handler := s.VerifyPermission(s.HandleAutoRoster, models.PermRosterEdit)
+
+	rec := serveWithSession(s, handler, "POST", "/autoRoster", `{"keepAssignments":"on"}`, token)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Filled 2 slots automatically.") {
+		t.Fatalf("expected Sam's two shifts to be filled, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "at their ideal shifts") {
+		t.Error("expected the empty slots to be explained")
+	}
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(ctx, staff.Config.RosterDateOffset)
+	if err != nil {
+		t.Fatalf("LoadRosterWeek: %v", err)
+	}
+	if n := week.CountShiftsForStaff(sam.ID); n != 2 {
+		t.Errorf("expected Sam to be rostered twice, got %d", n)
+	}
+
+	week.IsLive = true
+	if err := s.Repos.RosterWeek.SaveRosterWeek(ctx, week); err != nil {
+		t.Fatalf("SaveRosterWeek: %v", err)
+	}
+	rec = serveWithSession(s, handler, "POST", "/autoRoster", `{}`, token)
+	if !strings.Contains(rec.Body.String(), "Only draft weeks") {
+		t.Errorf("expected a live week not to be filled, got %s", rec.Body.String())
+	}
+	if live, _ := s.Repos.RosterWeek.LoadRosterWeek(ctx, staff.Config.RosterDateOffset); live.CountShiftsForStaff(sam.ID) != 2 {
+		t.Error("expected the live week to be unchanged")
+	}
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"roster/cmd/backup"
+	"roster/cmd/models"
+	"roster/cmd/utils"
+
+	"github.com/google/uuid"
+)
+
+// maxRestoreSize caps the size of an uploaded backup archive.
+const maxRestoreSize = 64 << 20
+
+// backupTimeout bounds creating or restoring a backup in place of the
+// request timeout, which a large archive can outlast. Restore isn't atomic,
+// so stopping it part way would leave the database half restored.
+const backupTimeout = 10 * time.Minute
+
+// backupContext returns a context with r's values but backupTimeout in place
+// of its deadline.
+func backupContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(r.Context()), backupTimeout)
+}
+
+// HandleBackup downloads a backup archive of all roster data.
+func (s *Server) HandleBackup(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := backupContext(r)
+	defer cancel()
+	archive, err := backup.Create(ctx, s.Repos)
+	if err != nil {
+		utils.PrintError(err, "Failed to create backup")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	filename := fmt.Sprintf("roster-backup-%s.json", archive.CreatedAt.Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+	if err := backup.Write(w, archive); err != nil {
+		utils.PrintError(err, "Failed to write backup")
+	}
+}
+
+// HandleRestore loads an uploaded backup archive, sent either as the
+// "archive" file of a multipart form or as the raw request body. Stored
+// records are only replaced if the "replace" field or query parameter is set.
+func (s *Server) HandleRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	thisStaff := s.GetSessionUser(w, r)
+	if thisStaff == nil {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRestoreSize)
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("archive")
+		if err != nil {
+			utils.PrintError(err, "Failed to read uploaded backup")
+			http.Error(w, "No backup file uploaded", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+	opts := backup.Options{Replace: r.FormValue("replace") != ""}
+	archive, err := backup.Read(body)
+	if err != nil {
+		utils.PrintError(err, "Rejected backup archive")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := backupContext(r)
+	defer cancel()
+	summary, err := backup.Restore(ctx, s.Repos, archive, opts)
+	if errors.Is(err, backup.ErrNotEmpty) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		utils.PrintError(err, "Failed to restore backup")
+		http.Error(w, "Failed to restore backup", http.StatusInternalServerError)
+		return
+	}
+	s.recordAudit(ctx, *thisStaff, models.AuditRestoreBackup, models.AuditEntityBackup, uuid.Nil, nil, map[string]any{
+		"CreatedAt": archive.CreatedAt.Format(time.RFC3339),
+		"Summary":   summary,
+	})
+	fmt.Fprintf(w, "Restored %v", summary)
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"roster/cmd/models"
+	"roster/cmd/repository"
+)
+
+// Test a downloaded backup can be uploaded again and the restore is audited.
+func TestHandleBackup_Restore(t *testing.T) {
+	s := newMemoryServer(t)
+	staff, token := newTestSession(t, s)
+
+	req := httptest.NewRequest("GET", "/backup", nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: token.String()})
+	rec := httptest.NewRecorder()
+	s.VerifySession(s.HandleBackup)(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Disposition"), "attachment;") {
+		t.Error("expected the backup to download as an attachment")
+	}
+	archive := rec.Body.String()
+	if !strings.Contains(archive, staff.ID.String()) {
+		t.Fatal("expected the backup to include the session user")
+	}
+
+	req = httptest.NewRequest("POST", "/restore", strings.NewReader(archive))
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: token.String()})
+	req.Header.Set(CSRF_HEADER, s.sessionCSRFToken(token))
+	rec = httptest.NewRecorder()
+	s.VerifySession(s.HandleRestore)(rec, req)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected restoring over stored records without replace to be refused, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest("POST", "/restore?replace=on", strings.NewReader(archive))
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: token.String()})
+	req.Header.Set(CSRF_HEADER, s.sessionCSRFToken(token))
+	rec = httptest.NewRecorder()
+	s.VerifySession(s.HandleRestore)(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Restored 1 staff") {
+		t.Fatalf("expected restore to succeed, got %d %q", rec.Code, rec.Body.String())
+	}
+	entries, err := s.Repos.Audit.FindAuditEntries(context.Background(), repository.AuditFilter{
+		Action: models.AuditRestoreBackup,
+	})
+	if err != nil {
+		t.Fatalf("FindAuditEntries: %v", err)
+	}
+	if len(entries) != 1 || entries[0].ActorID != staff.ID {
+		t.Errorf("expected the restore to be audited, got %+v", entries)
+	}
+
+	req = httptest.NewRequest("POST", "/restore", strings.NewReader(`{"format": "other"}`))
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: token.String()})
+	req.Header.Set(CSRF_HEADER, s.sessionCSRFToken(token))
+	rec = httptest.NewRecorder()
+	s.VerifySession(s.HandleRestore)(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected an invalid archive to be rejected with %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+// Test a backup isn't cut short by the request's deadline but keeps its
+// session.
+func TestBackupContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), SESSION_KEY, "session"), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	req := httptest.NewRequest("POST", "/restore", nil).WithContext(ctx)
+
+	backupCtx, cancelBackup := backupContext(req)
+	defer cancelBackup()
+	if err := backupCtx.Err(); err != nil {
+		t.Errorf("expected the backup to outlast the request deadline, got %v", err)
+	}
+	if deadline, ok := backupCtx.Deadline(); !ok || time.Until(deadline) < backupTimeout-time.Minute {
+		t.Errorf("expected a deadline of %v, got %v", backupTimeout, deadline)
+	}
+	if backupCtx.Value(SESSION_KEY) != "session" {
+		t.Error("expected the request's values to be kept")
+	}
+}
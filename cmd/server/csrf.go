@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+
+	"roster/cmd/utils"
+
+	"github.com/google/uuid"
+)
+
+// CSRF_HEADER carries the session's CSRF token on requests that change
+// anything. Pages send it with every HTMX request via hx-headers on <body>.
+const CSRF_HEADER = "X-CSRF-Token"
+
+// sessionCSRFToken derives the CSRF token for a session, so it doesn't need
+// storing and changes whenever the user logs in again.
+func (s *Server) sessionCSRFToken(sessionID uuid.UUID) string {
+	mac := hmac.New(sha256.New, s.CookieSecret)
+	mac.Write([]byte("csrf:"))
+	mac.Write(sessionID[:])
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// csrfToken returns the CSRF token for the session VerifySession attached to
+// ctx, for rendering into pages.
+func (s *Server) csrfToken(ctx context.Context) string {
+	session, ok := sessionFromContext(ctx)
+	if !ok {
+		return ""
+	}
+	return s.sessionCSRFToken(session.ID)
+}
+
+// validCSRFToken reports whether r carries the CSRF token for session.
+func (s *Server) validCSRFToken(r *http.Request, sessionID uuid.UUID) bool {
+	token := r.Header.Get(CSRF_HEADER)
+	return token != "" && hmac.Equal([]byte(token), []byte(s.sessionCSRFToken(sessionID)))
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// RequirePost rejects anything but a POST to handler, so that state can't be
+// changed by following a link or loading an image.
+func RequirePost(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.PrintLog("Rejected %v %v", r.Method, r.URL.Path)
+			w.Header().Set("Allow", http.MethodPost)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		handler(w, r)
+	}
+}
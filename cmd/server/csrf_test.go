@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// Test pages carry the session's CSRF token for HTMX to send back.
+func TestHandleIndex_RendersCSRFToken(t *testing.T) {
+	s := newMemoryServer(t)
+	_, token := newTestSession(t, s)
+
+	rec := serveWithSession(s, s.HandleIndex, "GET", "/", "", token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), s.sessionCSRFToken(token)) {
+		t.Error("expected the page to include the CSRF token")
+	}
+	if s.sessionCSRFToken(token) == s.sessionCSRFToken(uuid.New()) {
+		t.Error("expected each session to get its own token")
+	}
+}
+
+// Test changes without the session's CSRF token are refused before reaching
+// the handler.
+func TestVerifySession_RequiresCSRFToken(t *testing.T) {
+	s := newMemoryServer(t)
+	staff, token := newTestSession(t, s)
+	tokens := map[string]string{
+		"missing":       "",
+		"other session": s.sessionCSRFToken(uuid.New()),
+	}
+	for name, csrf := range tokens {
+		req := httptest.NewRequest("POST", "/toggleHideByIdeal", nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: token.String()})
+		if csrf != "" {
+			req.Header.Set(CSRF_HEADER, csrf)
+		}
+		rec := httptest.NewRecorder()
+		s.VerifySession(s.HandleToggleHideByIdeal)(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s: expected status %d, got %d", name, http.StatusForbidden, rec.Code)
+		}
+	}
+	saved, err := s.Repos.Staff.GetStaffByID(context.Background(), staff.ID)
+	if err != nil {
+		t.Fatalf("GetStaffByID: %v", err)
+	}
+	if saved.Config.HideByIdeal != staff.Config.HideByIdeal {
+		t.Error("expected the rejected requests to change nothing")
+	}
+
+	rec := serveWithSession(s, s.HandleToggleHideByIdeal, "POST", "/toggleHideByIdeal", "", token)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status %d with the token, got %d", http.StatusOK, rec.Code)
+	}
+}
+
+// Test mutating endpoints only accept POST.
+func TestRequirePost(t *testing.T) {
+	called := false
+	handler := RequirePost(func(w http.ResponseWriter, r *http.Request) { called = true })
+	for _, method := range []string{"GET", "PUT", "DELETE"} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(method, "/toggleLive", nil))
+		if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "POST" {
+			t.Errorf("%s: expected status %d, got %d", method, http.StatusMethodNotAllowed, rec.Code)
+		}
+	}
+	if called {
+		t.Error("expected the handler not to run")
+	}
+	handler(httptest.NewRecorder(), httptest.NewRequest("POST", "/toggleLive", nil))
+	if !called {
+		t.Error("expected POST to reach the handler")
+	}
+}
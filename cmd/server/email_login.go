@@ -0,0 +1,169 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"roster/cmd/auth"
+	"roster/cmd/mail"
+	"roster/cmd/models"
+	"roster/cmd/repository"
+	"roster/cmd/utils"
+
+	"github.com/google/uuid"
+)
+
+// loginLinkTTL is how long an emailed login link can be used for.
+const loginLinkTTL = 15 * time.Minute
+
+type EmailLoginData struct {
+	CacheBust string
+	Sent      bool
+}
+
+type EmailLoginConfirmData struct {
+	CacheBust string
+	State     string
+	Token     string
+}
+
+// emailProvider returns the email login provider, or false if logging in by
+// email isn't enabled.
+func (s *Server) emailProvider() (auth.EmailProvider, bool) {
+	provider, ok := s.provider(auth.EmailProviderName).(auth.EmailProvider)
+	return provider, ok
+}
+
+// HandleEmailLogin asks for an email address and sends a login link to the
+// staff member it belongs to. The same page is shown whether or not anyone
+// has the address, so it can't be used to find out who works here.
+func (s *Server) HandleEmailLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := s.emailProvider()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		s.renderTemplate(w, "emailLogin", EmailLoginData{CacheBust: s.CacheBust})
+		return
+	}
+	email := strings.TrimSpace(r.FormValue("email"))
+	if email == "" {
+		http.Redirect(w, r, "/auth/email", http.StatusSeeOther)
+		return
+	}
+	if err := s.sendLoginLink(r, provider, email); err != nil {
+		utils.PrintError(err, "Failed to send login link")
+	}
+	s.renderTemplate(w, "emailLogin", EmailLoginData{CacheBust: s.CacheBust, Sent: true})
+}
+
+// sendLoginLink emails a new login link to the staff member with email, if
+// there is one.
+func (s *Server) sendLoginLink(r *http.Request, provider auth.EmailProvider, email string) error {
+	ctx := r.Context()
+	staffMember, err := s.Repos.Staff.GetStaffByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if staffMember == nil {
+		utils.PrintLog("Login link requested for unknown email")
+		return nil
+	}
+	token, hash, err := models.NewLoginLinkToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	link := models.LoginLink{
+		TokenHash: hash,
+		Purpose:   models.LoginLinkEmail,
+		StaffID:   staffMember.ID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(loginLinkTTL),
+	}
+	if err := s.Repos.LoginLinks.CreateLoginLink(ctx, link); err != nil {
+		return err
+	}
+	msg := mail.Message{
+		To:      staffMember.Email,
+		Subject: "Your Retreat Roster login link",
+		Body: fmt.Sprintf("Hi %s,\n\nUse this link to log in to the roster:\n\n%s\n\n"+
+			"It works once and expires in %d minutes. If you didn't ask to log in, you can ignore this email.\n",
+			staffMember.FirstName, provider.LinkURL(token), int(loginLinkTTL.Minutes())),
+	}
+	if err := s.Mailer.Send(ctx, msg); err != nil {
+		return err
+	}
+
+	// Opportunistically clear out links nobody can use any more.
+	removed, err := s.Repos.LoginLinks.DeleteExpiredLoginLinks(ctx, now)
+	if err != nil {
+		utils.PrintError(err, "Failed to delete expired login links")
+	} else if removed > 0 {
+		utils.PrintLog("Deleted %d expired login links", removed)
+	}
+	return nil
+}
+
+// HandleEmailLoginVerify logs in with an emailed link. Opening the link only
+// shows a button to log in, since mail scanners that follow links would
+// otherwise use it up; the button's POST then consumes the link. The login
+// state cookie ties the POST to this browser having opened the link.
+func (s *Server) HandleEmailLoginVerify(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.emailProvider(); !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		attempt, err := newOAuthAttempt(auth.EmailProviderName, uuid.Nil)
+		if err == nil {
+			err = s.setOAuthAttemptCookie(w, attempt)
+		}
+		if err != nil {
+			utils.PrintError(err, "Failed to start email login")
+			s.renderLoginError(w, http.StatusInternalServerError, "Something went wrong starting your login.")
+			return
+		}
+		s.renderTemplate(w, "emailLoginConfirm", EmailLoginConfirmData{
+			CacheBust: s.CacheBust,
+			State:     attempt.State,
+			Token:     r.URL.Query().Get("token"),
+		})
+		return
+	}
+
+	clearOAuthAttemptCookie(w)
+	attempt, err := s.checkOAuthAttempt(r)
+	if err != nil || attempt.Provider != auth.EmailProviderName {
+		utils.PrintError(err, "Rejected email login")
+		s.renderLoginError(w, http.StatusBadRequest, "Open the link from your email again to log in.")
+		return
+	}
+	ctx := r.Context()
+	link, err := s.Repos.LoginLinks.ConsumeLoginLink(ctx, models.LoginLinkEmail, models.HashLoginLinkToken(r.FormValue("token")))
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && time.Now().After(link.ExpiresAt)) {
+		s.renderLoginError(w, http.StatusBadRequest, "That login link has expired or already been used.")
+		return
+	}
+	if err != nil {
+		utils.PrintError(err, "Failed to check login link")
+		s.renderLoginError(w, http.StatusInternalServerError, "Couldn't check your login link.")
+		return
+	}
+	staffMember, err := s.Repos.Staff.GetStaffByID(ctx, link.StaffID)
+	if err != nil || staffMember == nil {
+		utils.PrintError(err, "Failed to load staff for login link")
+		s.renderLoginError(w, http.StatusBadRequest, "That login link is for an account that no longer exists.")
+		return
+	}
+	if err := s.startSession(w, r, staffMember.ID); err != nil {
+		utils.PrintError(err, "Error logging in")
+		s.renderLoginError(w, http.StatusInternalServerError, "Something went wrong logging you in.")
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
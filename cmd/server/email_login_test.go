@@ -0,0 +1,155 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"roster/cmd/auth"
+	"roster/cmd/mail"
+	"roster/cmd/models"
+
+	"github.com/google/uuid"
+)
+
+var (
+	loginLinkPattern  = regexp.MustCompile(`https://roster\.test/auth/email/verify\?token=([\w-]+)`)
+	loginStatePattern = regexp.MustCompile(`state=([\w-]+)`)
+)
+
+// newEmailLoginServer returns a server offering email login that writes its
+// mail to the returned buffer, and a staff member it can log in.
+func newEmailLoginServer(t *testing.T) (*Server, *bytes.Buffer, models.StaffMember) {
+	t.Helper()
+	s := newLoginServer(t, auth.NewEmail("https://roster.test/"))
+	outbox := &bytes.Buffer{}
+	s.Mailer = mail.NewLog(outbox)
+	staff := models.StaffMember{ID: uuid.New(), FirstName: "Casey", Email: "Casey@Example.com"}
+	if err := s.Repos.Staff.SaveStaffMember(context.Background(), staff); err != nil {
+		t.Fatalf("SaveStaffMember: %v", err)
+	}
+	return s, outbox, staff
+}
+
+// requestLoginLink asks for a login link for email.
+func requestLoginLink(s *Server, email string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/auth/email", strings.NewReader(url.Values{"email": {email}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	s.HandleEmailLogin(rec, req)
+	return rec
+}
+
+// useLoginLink opens the login link for token and presses its button.
+func useLoginLink(t *testing.T, s *Server, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.HandleEmailLoginVerify(rec, httptest.NewRequest("GET", "/auth/email/verify?token="+token, nil))
+	state := loginStatePattern.FindStringSubmatch(rec.Body.String())
+	if rec.Code != http.StatusOK || state == nil {
+		t.Fatalf("expected the confirm page, got %d", rec.Code)
+	}
+	req := httptest.NewRequest("POST", "/auth/email/verify?state="+state[1], strings.NewReader(url.Values{"token": {token}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	rec = httptest.NewRecorder()
+	s.HandleEmailLoginVerify(rec, req)
+	return rec
+}
+
+// Test staff can log in with a link emailed to their address, and only once.
+func TestEmailLogin(t *testing.T) {
+	s, outbox, staff := newEmailLoginServer(t)
+	ctx := context.Background()
+
+	rec := requestLoginLink(s, " casey@example.com ")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `id="login-link-sent"`) {
+		t.Fatalf("expected the link sent page, got %d", rec.Code)
+	}
+	if !strings.Contains(outbox.String(), "To: Casey@Example.com") {
+		t.Errorf("expected mail to Casey, got %q", outbox.String())
+	}
+	link := loginLinkPattern.FindStringSubmatch(outbox.String())
+	if link == nil {
+		t.Fatalf("expected a login link in %q", outbox.String())
+	}
+
+	// Opening the link alone doesn't log in.
+	s.HandleEmailLoginVerify(httptest.NewRecorder(), httptest.NewRequest("GET", "/auth/email/verify?token="+link[1], nil))
+	if sessions, _ := s.Repos.Sessions.FindStaffSessions(ctx, staff.ID); len(sessions) != 0 {
+		t.Fatalf("expected no session before confirming, got %d", len(sessions))
+	}
+
+	rec = useLoginLink(t, s, link[1])
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/" {
+		t.Fatalf("expected Casey to be logged in, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if sessions, _ := s.Repos.Sessions.FindStaffSessions(ctx, staff.ID); len(sessions) != 1 {
+		t.Errorf("expected a session for Casey, got %d", len(sessions))
+	}
+
+	if rec := useLoginLink(t, s, link[1]); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a used link to be refused, got %d", rec.Code)
+	}
+}
+
+// Test unknown addresses see the same page but get no mail.
+func TestEmailLogin_UnknownEmail(t *testing.T) {
+	s, outbox, _ := newEmailLoginServer(t)
+	rec := requestLoginLink(s, "nobody@example.com")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `id="login-link-sent"`) {
+		t.Errorf("expected the link sent page, got %d", rec.Code)
+	}
+	if outbox.Len() != 0 {
+		t.Errorf("expected no mail, got %q", outbox.String())
+	}
+}
+
+// Test expired links, and links confirmed without opening them in this
+// browser, are refused.
+func TestEmailLoginVerify_Rejects(t *testing.T) {
+	s, _, staff := newEmailLoginServer(t)
+	ctx := context.Background()
+	token, hash, err := models.NewLoginLinkToken()
+	if err != nil {
+		t.Fatalf("NewLoginLinkToken: %v", err)
+	}
+	expired := models.LoginLink{TokenHash: hash, Purpose: models.LoginLinkEmail, StaffID: staff.ID,
+		CreatedAt: time.Now().Add(-time.Hour), ExpiresAt: time.Now().Add(-time.Minute)}
+	if err := s.Repos.LoginLinks.CreateLoginLink(ctx, expired); err != nil {
+		t.Fatalf("CreateLoginLink: %v", err)
+	}
+	if rec := useLoginLink(t, s, token); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected an expired link to be refused, got %d", rec.Code)
+	}
+
+	requestLoginLink(s, staff.Email)
+	req := httptest.NewRequest("POST", "/auth/email/verify?state=abc", strings.NewReader("token=whatever"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	s.HandleEmailLoginVerify(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a confirmation from another site to be refused, got %d", rec.Code)
+	}
+	if sessions, _ := s.Repos.Sessions.FindStaffSessions(ctx, staff.ID); len(sessions) != 0 {
+		t.Errorf("expected no sessions, got %d", len(sessions))
+	}
+}
+
+// Test the email pages only exist when email login is configured.
+func TestEmailLogin_Disabled(t *testing.T) {
+	s := newLoginServer(t)
+	rec := httptest.NewRecorder()
+	s.HandleEmailLogin(rec, httptest.NewRequest("GET", "/auth/email", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"roster/cmd/auth"
+	"roster/cmd/models"
+	"roster/cmd/repository"
+	"roster/cmd/utils"
+
+	"github.com/google/uuid"
+)
+
+// inviteTTL is how long a staff member has to accept an invite.
+const inviteTTL = 7 * 24 * time.Hour
+
+type CreateInviteBody struct {
+	ID string `json:"id"`
+}
+
+type InviteLinkData struct {
+	URL     string
+	Expires time.Time
+}
+
+type InviteData struct {
+	CacheBust string
+	Token     string
+	Providers []auth.Provider
+}
+
+// baseURL returns the address links to the server should start with.
+func (s *Server) baseURL(r *http.Request) string {
+	if s.BaseURL != "" {
+		return strings.TrimSuffix(s.BaseURL, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// HandleCreateInvite makes a link for a trial or pre-created staff member to
+// log in with for the first time, so their login is added to the existing
+// record instead of a new account being made.
+func (s *Server) HandleCreateInvite(w http.ResponseWriter, r *http.Request) {
+	var reqBody CreateInviteBody
+	if err := ReadAndUnmarshal(w, r, &reqBody); err != nil {
+		return
+	}
+	staffID, err := uuid.Parse(reqBody.ID)
+	if err != nil {
+		utils.PrintError(err, "Invalid staff ID")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	thisStaff := s.GetSessionUser(w, r)
+	if thisStaff == nil {
+		return
+	}
+	ctx := r.Context()
+	staffMember, err := s.Repos.Staff.GetStaffByID(ctx, staffID)
+	if err != nil || staffMember == nil {
+		utils.PrintError(err, "Failed to get staff by ID")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if len(staffMember.Identities) > 0 {
+		utils.PrintLog("Staff member %s can already log in", staffMember.ID)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	token, hash, err := models.NewLoginLinkToken()
+	if err != nil {
+		utils.PrintError(err, "Failed to make invite token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	link := models.LoginLink{
+		TokenHash: hash,
+		Purpose:   models.LoginLinkInvite,
+		StaffID:   staffMember.ID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(inviteTTL),
+	}
+	if err := s.Repos.LoginLinks.CreateLoginLink(ctx, link); err != nil {
+		utils.PrintError(err, "Failed to save invite")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	s.recordAudit(ctx, *thisStaff, models.AuditCreateInvite, models.AuditEntityStaff, staffMember.ID, nil, nil)
+	s.renderTemplate(w, "inviteLink", InviteLinkData{
+		URL:     s.baseURL(r) + "/auth/invite?token=" + token,
+		Expires: link.ExpiresAt,
+	})
+}
+
+// HandleInvite lets an invited staff member pick a provider to log in with.
+// The invite is only used up once the provider has identified them, so
+// opening the link alone changes nothing.
+func (s *Server) HandleInvite(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	token := query.Get("token")
+	if token == "" {
+		s.renderLoginError(w, http.StatusBadRequest, "That invite link is incomplete.")
+		return
+	}
+	if name := query.Get("provider"); name != "" {
+		if _, ok := s.provider(name).(auth.Identifier); !ok {
+			utils.PrintLog("Can't accept an invite with login provider %q", name)
+			s.renderLoginError(w, http.StatusBadRequest, "That login method can't be used with an invite.")
+			return
+		}
+		s.startLogin(w, r, name, uuid.Nil, models.HashLoginLinkToken(token))
+		return
+	}
+	data := InviteData{CacheBust: s.CacheBust, Token: token}
+	for _, provider := range s.Providers {
+		if _, ok := provider.(auth.Identifier); ok {
+			data.Providers = append(data.Providers, provider)
+		}
+	}
+	s.renderTemplate(w, "invite", data)
+}
+
+// acceptInvite binds identity to the staff member the invite was made for
+// and logs them in. The staff member keeps their ID, so their roster and
+// timesheet history stays with them.
+func (s *Server) acceptInvite(w http.ResponseWriter, r *http.Request, inviteHash string, identity models.Identity) {
+	ctx := r.Context()
+	existing, err := s.Repos.Staff.GetStaffByIdentity(ctx, identity)
+	if err != nil {
+		utils.PrintError(err, "Failed to get staff by identity")
+		s.renderLoginError(w, http.StatusInternalServerError, "Couldn't accept your invite.")
+		return
+	}
+	if existing != nil {
+		// Leave the invite unused so it can be accepted with another login.
+		s.renderLoginError(w, http.StatusConflict, "That login already belongs to another account. Open the invite again and pick a different login.")
+		return
+	}
+	link, err := s.Repos.LoginLinks.ConsumeLoginLink(ctx, models.LoginLinkInvite, inviteHash)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && time.Now().After(link.ExpiresAt)) {
+		s.renderLoginError(w, http.StatusBadRequest, "That invite has expired or already been used. Ask a manager for a new one.")
+		return
+	}
+	if err != nil {
+		utils.PrintError(err, "Failed to check invite")
+		s.renderLoginError(w, http.StatusInternalServerError, "Couldn't accept your invite.")
+		return
+	}
+	staffMember, err := s.Repos.Staff.GetStaffByID(ctx, link.StaffID)
+	if err != nil || staffMember == nil {
+		utils.PrintError(err, "Failed to load invited staff")
+		s.renderLoginError(w, http.StatusBadRequest, "That invite is for an account that no longer exists.")
+		return
+	}
+	if len(staffMember.Identities) > 0 {
+		s.renderLoginError(w, http.StatusConflict, "That account can already be logged in to.")
+		return
+	}
+	before := *staffMember
+	staffMember.Identities = []models.Identity{identity}
+	staffMember.IsTrial = false
+	if err := s.Repos.Staff.SaveStaffMember(ctx, *staffMember); err != nil {
+		utils.PrintError(err, "Failed to save invited staff")
+		s.renderLoginError(w, http.StatusInternalServerError, "Couldn't accept your invite.")
+		return
+	}
+	s.recordAudit(ctx, *staffMember, models.AuditAcceptInvite, models.AuditEntityStaff, staffMember.ID, makeAuditStaff(before), makeAuditStaff(*staffMember))
+	if err := s.startSession(w, r, staffMember.ID); err != nil {
+		utils.PrintError(err, "Error logging in")
+		s.renderLoginError(w, http.StatusInternalServerError, "Something went wrong logging you in.")
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
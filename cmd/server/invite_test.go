@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"roster/cmd/auth"
+	"roster/cmd/models"
+	"roster/cmd/repository"
+
+	"github.com/google/uuid"
+)
+
+var inviteLinkPattern = regexp.MustCompile(`https://roster\.test/auth/invite\?token=([\w-]+)`)
+
+// createInvite has the manager with token make an invite for the staff
+// member and returns the invite's token.
+func createInvite(t *testing.T, s *Server, managerToken uuid.UUID, staffID uuid.UUID) string {
+	t.Helper()
+	rec := serveWithSession(s, s.HandleCreateInvite, "POST", "/createInvite", `{"id":"`+staffID.String()+`"}`, managerToken)
+	link := inviteLinkPattern.FindStringSubmatch(rec.Body.String())
+	if rec.Code != http.StatusOK || link == nil {
+		t.Fatalf("expected an invite link, got %d", rec.Code)
+	}
+	return link[1]
+}
+
+// acceptInviteAs opens the invite for token and logs in with the dev provider
+// as subject.
+func acceptInviteAs(t *testing.T, s *Server, token string, subject string) *httptest.ResponseRecorder {
+	t.Helper()
+	query := url.Values{"token": {token}, "provider": {auth.DevProviderName}}
+	location, cookie := beginLogin(t, s, s.HandleInvite, "/auth/invite?"+query.Encode())
+	return devCallback(s, location.Query().Get("state"), cookie, "", subject)
+}
+
+// Test a trial accepting an invite keeps their record, and the invite only
+// works once.
+func TestInvite_ConvertsTrial(t *testing.T) {
+	s := newLoginServer(t, auth.NewDev())
+	s.BaseURL = "https://roster.test/"
+	_, managerToken := newTestSession(t, s)
+	ctx := context.Background()
+	if err := s.Repos.Staff.CreateTrial(ctx, "Tess"); err != nil {
+		t.Fatalf("CreateTrial: %v", err)
+	}
+	all, _ := s.Repos.Staff.LoadAllStaff(ctx)
+	var trial models.StaffMember
+	for _, staff := range all {
+		if staff.IsTrial {
+			trial = *staff
+		}
+	}
+
+	rec := serveWithSession(s, s.HandleProfileIndex, "GET", "/profile?editStaffId="+trial.ID.String(), "", managerToken)
+	if !strings.Contains(rec.Body.String(), `hx-post="/createInvite"`) {
+		t.Error("expected the trial's profile to offer an invite")
+	}
+	token := createInvite(t, s, managerToken, trial.ID)
+
+	rec = httptest.NewRecorder()
+	s.HandleInvite(rec, httptest.NewRequest("GET", "/auth/invite?token="+token, nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "provider=dev") {
+		t.Fatalf("expected a choice of providers, got %d", rec.Code)
+	}
+
+	rec = acceptInviteAs(t, s, token, "tess")
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/" {
+		t.Fatalf("expected Tess to be logged in, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	tess, err := s.Repos.Staff.GetStaffByIdentity(ctx, models.Identity{Provider: auth.DevProviderName, Subject: "tess"})
+	if err != nil || tess == nil || tess.ID != trial.ID || tess.IsTrial {
+		t.Fatalf("expected the trial record to be converted, got %+v, %v", tess, err)
+	}
+	if sessions, _ := s.Repos.Sessions.FindStaffSessions(ctx, trial.ID); len(sessions) != 1 {
+		t.Errorf("expected a session for Tess, got %d", len(sessions))
+	}
+	entries, err := s.Repos.Audit.FindAuditEntries(ctx, repository.AuditFilter{Action: models.AuditAcceptInvite})
+	if err != nil || len(entries) != 1 {
+		t.Errorf("expected the invite to be audited, got %+v, %v", entries, err)
+	}
+
+	if rec := acceptInviteAs(t, s, token, "someone"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a used invite to be refused, got %d", rec.Code)
+	}
+	rec = serveWithSession(s, s.HandleCreateInvite, "POST", "/createInvite", `{"id":"`+trial.ID.String()+`"}`, managerToken)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected no invites for staff who can log in, got %d", rec.Code)
+	}
+}
+
+// Test an invite accepted with a login that already has an account is left
+// for another try.
+func TestInvite_IdentityInUse(t *testing.T) {
+	s := newLoginServer(t, auth.NewDev())
+	s.BaseURL = "https://roster.test"
+	_, managerToken := newTestSession(t, s)
+	ctx := context.Background()
+	if _, err := s.Repos.Staff.CreateStaffMember(ctx, models.Identity{Provider: auth.DevProviderName, Subject: "bob"}); err != nil {
+		t.Fatalf("CreateStaffMember: %v", err)
+	}
+	carol := models.StaffMember{ID: uuid.New(), FirstName: "Carol"}
+	if err := s.Repos.Staff.SaveStaffMember(ctx, carol); err != nil {
+		t.Fatalf("SaveStaffMember: %v", err)
+	}
+	token := createInvite(t, s, managerToken, carol.ID)
+
+	if rec := acceptInviteAs(t, s, token, "bob"); rec.Code != http.StatusConflict {
+		t.Fatalf("expected Bob's login to be refused, got %d", rec.Code)
+	}
+	if rec := acceptInviteAs(t, s, token, "carol"); rec.Code != http.StatusSeeOther {
+		t.Errorf("expected the invite to still work, got %d", rec.Code)
+	}
+}
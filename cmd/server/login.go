@@ -0,0 +1,402 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"roster/cmd/auth"
+	"roster/cmd/models"
+	"roster/cmd/utils"
+
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+)
+
+const oauthStateCookie = "oauth_state"
+
+// oauthStateTTL is how long a user has to finish logging in with a provider.
+const oauthStateTTL = 10 * time.Minute
+
+var (
+	errNoLoginAttempt   = errors.New("no login in progress")
+	errBadLoginAttempt  = errors.New("login attempt has been tampered with")
+	errLoginExpired     = errors.New("login attempt expired")
+	errLoginStateChange = errors.New("login state does not match")
+)
+
+// oauthAttempt is what the login flow remembers between sending a user to
+// an identity provider and their return, kept in a signed cookie.
+type oauthAttempt struct {
+	State    string `json:"state"`
+	Verifier string `json:"verifier"`
+	Provider string `json:"provider"`
+	// LinkStaffID is set when the attempt links another identity to an
+	// existing account rather than logging in.
+	LinkStaffID uuid.UUID `json:"linkStaffId"`
+	// InviteHash is set when the attempt accepts an invite, binding the
+	// identity to the invited staff member.
+	InviteHash string `json:"inviteHash,omitempty"`
+	Expires    int64  `json:"expires"`
+}
+
+// newOAuthAttempt starts a login with the provider with a fresh random state
+// and PKCE verifier.
+func newOAuthAttempt(provider string, linkStaffID uuid.UUID) (oauthAttempt, error) {
+	state := make([]byte, 32)
+	if _, err := rand.Read(state); err != nil {
+		return oauthAttempt{}, err
+	}
+	return oauthAttempt{
+		State:       base64.RawURLEncoding.EncodeToString(state),
+		Verifier:    oauth2.GenerateVerifier(),
+		Provider:    provider,
+		LinkStaffID: linkStaffID,
+		Expires:     time.Now().Add(oauthStateTTL).Unix(),
+	}, nil
+}
+
+// newCookieSecret returns a random key for signing cookies.
+func newCookieSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic("failed to generate cookie secret: " + err.Error())
+	}
+	return secret
+}
+
+func (s *Server) signCookieValue(payload []byte) string {
+	mac := hmac.New(sha256.New, s.CookieSecret)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyCookieValue returns the payload of a value made by signCookieValue,
+// or an error if it wasn't signed with this server's secret.
+func (s *Server) verifyCookieValue(value string) ([]byte, error) {
+	encodedPayload, encodedSig, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, errBadLoginAttempt
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, errBadLoginAttempt
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil {
+		return nil, errBadLoginAttempt
+	}
+	mac := hmac.New(sha256.New, s.CookieSecret)
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, errBadLoginAttempt
+	}
+	return payload, nil
+}
+
+func (s *Server) setOAuthAttemptCookie(w http.ResponseWriter, attempt oauthAttempt) error {
+	payload, err := json.Marshal(attempt)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    s.signCookieValue(payload),
+		Path:     "/auth",
+		MaxAge:   int(oauthStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		// Lax so the cookie comes back on Google's redirect to the callback.
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+func clearOAuthAttemptCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    "",
+		Path:     "/auth",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// checkOAuthAttempt returns the login attempt the callback request belongs
+// to, making sure it was started by this browser and hasn't expired.
+func (s *Server) checkOAuthAttempt(r *http.Request) (oauthAttempt, error) {
+	cookie, err := r.Cookie(oauthStateCookie)
+	if err != nil {
+		return oauthAttempt{}, errNoLoginAttempt
+	}
+	payload, err := s.verifyCookieValue(cookie.Value)
+	if err != nil {
+		return oauthAttempt{}, err
+	}
+	var attempt oauthAttempt
+	if err := json.Unmarshal(payload, &attempt); err != nil {
+		return oauthAttempt{}, errBadLoginAttempt
+	}
+	if time.Now().Unix() > attempt.Expires {
+		return oauthAttempt{}, errLoginExpired
+	}
+	state := r.URL.Query().Get("state")
+	if subtle.ConstantTimeCompare([]byte(state), []byte(attempt.State)) != 1 {
+		return oauthAttempt{}, errLoginStateChange
+	}
+	return attempt, nil
+}
+
+type LoginErrorData struct {
+	CacheBust string
+	Message   string
+}
+
+// renderLoginError shows a login failure with a link to try again. The
+// landing page can't be used as it starts a new login straight away.
+func (s *Server) renderLoginError(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	s.renderTemplate(w, "loginError", LoginErrorData{CacheBust: s.CacheBust, Message: message})
+}
+
+// provider returns the configured identity provider with the given name, or
+// nil.
+func (s *Server) provider(name string) auth.Provider {
+	for _, provider := range s.Providers {
+		if provider.Name() == name {
+			return provider
+		}
+	}
+	return nil
+}
+
+type LoginData struct {
+	CacheBust string
+	Providers []auth.Provider
+}
+
+// HandleLogin sends the user to log in with the provider named in the query.
+// With several providers and none named, it lets the user pick one.
+func (s *Server) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("provider")
+	if name == "" {
+		switch len(s.Providers) {
+		case 0:
+			utils.PrintLog("No login providers are configured")
+			s.renderLoginError(w, http.StatusInternalServerError, "Logging in isn't set up yet.")
+			return
+		case 1:
+			name = s.Providers[0].Name()
+		default:
+			s.renderTemplate(w, "login", LoginData{CacheBust: s.CacheBust, Providers: s.Providers})
+			return
+		}
+	}
+	s.startLogin(w, r, name, uuid.Nil, "")
+}
+
+// HandleLinkIdentity sends the user to log in with another provider, adding
+// the identity to their account rather than logging in with it.
+func (s *Server) HandleLinkIdentity(w http.ResponseWriter, r *http.Request) {
+	thisStaff := s.GetSessionUser(w, r)
+	if thisStaff == nil {
+		return
+	}
+	name := r.URL.Query().Get("provider")
+	if _, ok := s.provider(name).(auth.Identifier); !ok {
+		utils.PrintLog("Can't link login provider %q", name)
+		s.renderLoginError(w, http.StatusBadRequest, "That login method can't be linked.")
+		return
+	}
+	s.startLogin(w, r, name, thisStaff.ID, "")
+}
+
+func (s *Server) startLogin(w http.ResponseWriter, r *http.Request, name string, linkStaffID uuid.UUID, inviteHash string) {
+	provider := s.provider(name)
+	if provider == nil {
+		utils.PrintLog("Unknown login provider %q", name)
+		s.renderLoginError(w, http.StatusBadRequest, "That login method isn't available.")
+		return
+	}
+	attempt, err := newOAuthAttempt(provider.Name(), linkStaffID)
+	if err != nil {
+		utils.PrintError(err, "Failed to start login")
+		s.renderLoginError(w, http.StatusInternalServerError, "Something went wrong starting your login.")
+		return
+	}
+	attempt.InviteHash = inviteHash
+	if err := s.setOAuthAttemptCookie(w, attempt); err != nil {
+		utils.PrintError(err, "Failed to save login state")
+		s.renderLoginError(w, http.StatusInternalServerError, "Something went wrong starting your login.")
+		return
+	}
+	http.Redirect(w, r, provider.LoginURL(attempt.State, attempt.Verifier), http.StatusTemporaryRedirect)
+}
+
+// HandleLoginCallback finishes a login once the provider sends the user back,
+// creating an account for identities nobody has logged in with before.
+func (s *Server) HandleLoginCallback(w http.ResponseWriter, r *http.Request) {
+	// Whatever happens, this login attempt is finished with.
+	clearOAuthAttemptCookie(w)
+	attempt, err := s.checkOAuthAttempt(r)
+	if err != nil {
+		utils.PrintError(err, "Rejected login callback")
+		message := "This login link doesn't match the login started in this browser."
+		if errors.Is(err, errLoginExpired) || errors.Is(err, errNoLoginAttempt) {
+			message = "Your login took too long or was started in another browser."
+		}
+		s.renderLoginError(w, http.StatusBadRequest, message)
+		return
+	}
+	provider, ok := s.provider(attempt.Provider).(auth.Identifier)
+	if !ok {
+		utils.PrintLog("Login callback for unknown provider %q", attempt.Provider)
+		s.renderLoginError(w, http.StatusBadRequest, "That login method isn't available.")
+		return
+	}
+	identity, err := provider.Identify(r.Context(), r, attempt.Verifier)
+	if errors.Is(err, auth.ErrDenied) {
+		utils.PrintError(err, "Login denied")
+		s.renderLoginError(w, http.StatusBadRequest, provider.Label()+" didn't sign you in. Please try again.")
+		return
+	}
+	if err != nil {
+		utils.PrintError(err, "Failed to identify user")
+		s.renderLoginError(w, http.StatusBadGateway, provider.Label()+" couldn't confirm your login.")
+		return
+	}
+	if attempt.LinkStaffID != uuid.Nil {
+		s.linkIdentity(w, r, attempt.LinkStaffID, identity)
+		return
+	}
+	if attempt.InviteHash != "" {
+		s.acceptInvite(w, r, attempt.InviteHash, identity)
+		return
+	}
+
+	staffMember, err := s.Repos.Staff.GetStaffByIdentity(r.Context(), identity)
+	if err != nil {
+		utils.PrintError(err, "Failed to get staff by identity")
+		http.Redirect(w, r, "/landing", http.StatusSeeOther)
+		return
+	}
+	redirect := "/"
+	if staffMember == nil {
+		utils.PrintLog("Creating new staff member")
+		staffMember, err = s.Repos.Staff.CreateStaffMember(r.Context(), identity)
+		if err != nil {
+			utils.PrintError(err, "Error creating staff member")
+			http.Redirect(w, r, "/landing", http.StatusSeeOther)
+			return
+		}
+		redirect = "/newAccount"
+	}
+	if err := s.startSession(w, r, staffMember.ID); err != nil {
+		utils.PrintError(err, "Error logging in")
+		http.Redirect(w, r, "/landing", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+// linkIdentity adds identity to the staff member's account, as long as the
+// browser is still logged in as them and nobody else uses the identity.
+func (s *Server) linkIdentity(w http.ResponseWriter, r *http.Request, staffID uuid.UUID, identity models.Identity) {
+	ctx := r.Context()
+	sessionToken := GetTokenFromCookies(r)
+	if sessionToken == nil {
+		s.renderLoginError(w, http.StatusForbidden, "Log in again before linking another login.")
+		return
+	}
+	session, err := s.activeSession(ctx, *sessionToken)
+	if err != nil || session.StaffID != staffID {
+		utils.PrintError(err, "No session for linking identity")
+		s.renderLoginError(w, http.StatusForbidden, "Log in again before linking another login.")
+		return
+	}
+	existing, err := s.Repos.Staff.GetStaffByIdentity(ctx, identity)
+	if err != nil {
+		utils.PrintError(err, "Failed to get staff by identity")
+		s.renderLoginError(w, http.StatusInternalServerError, "Couldn't link that login.")
+		return
+	}
+	if existing != nil && existing.ID != staffID {
+		s.renderLoginError(w, http.StatusConflict, "That login already belongs to another account.")
+		return
+	}
+	staffMember, err := s.Repos.Staff.GetStaffByID(ctx, staffID)
+	if err != nil || staffMember == nil {
+		utils.PrintError(err, "Failed to load staff for linking identity")
+		s.renderLoginError(w, http.StatusInternalServerError, "Couldn't link that login.")
+		return
+	}
+	if !staffMember.HasIdentity(identity) {
+		staffMember.Identities = append(staffMember.Identities, identity)
+		if err := s.Repos.Staff.SaveStaffMember(ctx, *staffMember); err != nil {
+			utils.PrintError(err, "Failed to save linked identity")
+			s.renderLoginError(w, http.StatusInternalServerError, "Couldn't link that login.")
+			return
+		}
+		s.recordAudit(ctx, *staffMember, models.AuditLinkIdentity, models.AuditEntityStaff, staffMember.ID, nil, identity)
+	}
+	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+}
+
+// HandleLogout revokes the current session and sends the browser back to
+// the landing page.
+func (s *Server) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	s.endSession(w, r)
+	w.Header().Set("HX-Redirect", "/landing")
+	w.WriteHeader(http.StatusOK)
+}
+
+// endSession revokes the session VerifySession attached to r and clears its
+// cookie.
+func (s *Server) endSession(w http.ResponseWriter, r *http.Request) {
+	clearSessionCookie(w)
+	if session, ok := sessionFromContext(r.Context()); ok {
+		if err := s.Repos.Sessions.DeleteSession(r.Context(), session.ID); err != nil {
+			utils.PrintError(err, "Failed to revoke session")
+		}
+	}
+}
+
+type DevLoginData struct {
+	CacheBust string
+	State     string
+	Staff     []*models.StaffMember
+}
+
+// HandleDevLogin lists the staff to log in as with the dev provider.
+func (s *Server) HandleDevLogin(w http.ResponseWriter, r *http.Request) {
+	if s.provider(auth.DevProviderName) == nil {
+		http.NotFound(w, r)
+		return
+	}
+	allStaff, err := s.Repos.Staff.LoadAllStaff(r.Context())
+	if err != nil {
+		utils.PrintError(err, "Failed to load staff")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	staff := []*models.StaffMember{}
+	for _, staffMember := range allStaff {
+		if len(staffMember.Identities) > 0 {
+			staff = append(staff, staffMember)
+		}
+	}
+	s.renderTemplate(w, "devLogin", DevLoginData{
+		CacheBust: s.CacheBust,
+		State:     r.URL.Query().Get("state"),
+		Staff:     staff,
+	})
+}
@@ -0,0 +1,262 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"roster/cmd/auth"
+	"roster/cmd/models"
+	"roster/cmd/repository"
+
+	"github.com/google/uuid"
+)
+
+// newLoginServer returns a memory server offering the given providers, or
+// Google if none are given.
+func newLoginServer(t *testing.T, providers ...auth.Provider) *Server {
+	t.Helper()
+	s := newMemoryServer(t)
+	if len(providers) == 0 {
+		providers = []auth.Provider{auth.NewGoogle("client-id", "client-secret", "https://roster.test/auth/callback")}
+	}
+	s.Providers = providers
+	return s
+}
+
+// beginLogin runs the login handler for target and returns where it sent
+// the user along with the cookie remembering the attempt.
+func beginLogin(t *testing.T, s *Server, handler http.HandlerFunc, target string) (*url.URL, *http.Cookie) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", target, nil))
+	if rec.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("expected status %d, got %d", http.StatusTemporaryRedirect, rec.Code)
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("bad redirect: %v", err)
+	}
+	var cookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == oauthStateCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatal("expected a login state cookie")
+	}
+	return location, cookie
+}
+
+// devCallback finishes a dev provider login as the given identity.
+func devCallback(s *Server, state string, cookie *http.Cookie, provider string, subject string, extra ...*http.Cookie) *httptest.ResponseRecorder {
+	query := url.Values{"state": {state}, "provider": {provider}, "subject": {subject}}
+	req := httptest.NewRequest("GET", "/auth/callback?"+query.Encode(), nil)
+	req.AddCookie(cookie)
+	for _, c := range extra {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	s.HandleLoginCallback(rec, req)
+	return rec
+}
+
+// Test each login gets its own state and a PKCE challenge.
+func TestHandleLogin_StateAndPKCE(t *testing.T) {
+	s := newLoginServer(t)
+	location, _ := beginLogin(t, s, s.HandleLogin, "/auth/login")
+	query := location.Query()
+	if query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256" {
+		t.Errorf("expected a S256 code challenge, got %q", location.RawQuery)
+	}
+
+	first, _ := beginLogin(t, s, s.HandleLogin, "/auth/login")
+	second, _ := beginLogin(t, s, s.HandleLogin, "/auth/login")
+	if first.Query().Get("state") == "" || first.Query().Get("state") == second.Query().Get("state") {
+		t.Errorf("expected a fresh random state per login, got %q and %q", first.Query().Get("state"), second.Query().Get("state"))
+	}
+}
+
+// Test several providers are offered to choose from, and unknown ones are
+// refused.
+func TestHandleLogin_ChoosesProvider(t *testing.T) {
+	s := newLoginServer(t, auth.NewGoogle("client-id", "", ""), auth.NewDev())
+
+	rec := httptest.NewRecorder()
+	s.HandleLogin(rec, httptest.NewRequest("GET", "/auth/login", nil))
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.Contains(body, "provider=google") || !strings.Contains(body, "provider=dev") {
+		t.Fatalf("expected a choice of providers, got %d", rec.Code)
+	}
+
+	location, _ := beginLogin(t, s, s.HandleLogin, "/auth/login?provider=dev")
+	if location.Path != "/auth/dev" {
+		t.Errorf("expected the dev login page, got %v", location)
+	}
+
+	rec = httptest.NewRecorder()
+	s.HandleLogin(rec, httptest.NewRequest("GET", "/auth/login?provider=other", nil))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `id="login-error"`) {
+		t.Errorf("expected an unknown provider to be refused, got %d", rec.Code)
+	}
+}
+
+// Test the callback turns away requests that don't belong to a login this
+// browser started.
+func TestHandleLoginCallback_RejectsBadState(t *testing.T) {
+	s := newLoginServer(t)
+	location, cookie := beginLogin(t, s, s.HandleLogin, "/auth/login")
+	state := location.Query().Get("state")
+	tampered := *cookie
+	tampered.Value = strings.Replace(cookie.Value, ".", ".x", 1)
+	other := newLoginServer(t)
+	_, foreign := beginLogin(t, other, other.HandleLogin, "/auth/login")
+
+	tests := map[string]struct {
+		state  string
+		cookie *http.Cookie
+	}{
+		"no cookie":       {state: state},
+		"wrong state":     {state: "attacker", cookie: cookie},
+		"tampered cookie": {state: state, cookie: &tampered},
+		"other secret":    {state: state, cookie: foreign},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest("GET", "/auth/callback?code=abc&state="+url.QueryEscape(tt.state), nil)
+		if tt.cookie != nil {
+			req.AddCookie(tt.cookie)
+		}
+		rec := httptest.NewRecorder()
+		s.HandleLoginCallback(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", name, http.StatusBadRequest, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), `id="login-error"`) {
+			t.Errorf("%s: expected the login error page", name)
+		}
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == "session_token" && c.Value != "" {
+				t.Errorf("%s: expected no session to be started", name)
+			}
+		}
+	}
+}
+
+// Test the dev provider creates an account for a new identity and logs
+// existing staff back in.
+func TestHandleLoginCallback_DevProvider(t *testing.T) {
+	s := newLoginServer(t, auth.NewDev())
+	ctx := context.Background()
+
+	location, cookie := beginLogin(t, s, s.HandleLogin, "/auth/login")
+	rec := devCallback(s, location.Query().Get("state"), cookie, "", "alice")
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/newAccount" {
+		t.Fatalf("expected a new account, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	identity := models.Identity{Provider: auth.DevProviderName, Subject: "alice"}
+	alice, err := s.Repos.Staff.GetStaffByIdentity(ctx, identity)
+	if err != nil || alice == nil {
+		t.Fatalf("GetStaffByIdentity = %+v, %v", alice, err)
+	}
+	alice.FirstName = "Alice"
+	if err := s.Repos.Staff.SaveStaffMember(ctx, *alice); err != nil {
+		t.Fatalf("SaveStaffMember: %v", err)
+	}
+
+	// Alice now appears on the dev login page.
+	location, cookie = beginLogin(t, s, s.HandleLogin, "/auth/login")
+	rec = httptest.NewRecorder()
+	s.HandleDevLogin(rec, httptest.NewRequest("GET", location.String(), nil))
+	if !strings.Contains(rec.Body.String(), "Alice") {
+		t.Error("expected the dev login page to list Alice")
+	}
+	rec = devCallback(s, location.Query().Get("state"), cookie, auth.DevProviderName, "alice")
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/" {
+		t.Fatalf("expected Alice to be logged in, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if sessions, _ := s.Repos.Sessions.FindStaffSessions(ctx, alice.ID); len(sessions) != 2 {
+		t.Errorf("expected a session per login, got %d", len(sessions))
+	}
+}
+
+// Test the dev login page only exists when the dev provider is configured.
+func TestHandleDevLogin_Disabled(t *testing.T) {
+	s := newLoginServer(t)
+	rec := httptest.NewRecorder()
+	s.HandleDevLogin(rec, httptest.NewRequest("GET", "/auth/dev?state=abc", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+// Test staff can link another provider's identity to their account, but not
+// one that belongs to someone else.
+func TestHandleLinkIdentity(t *testing.T) {
+	s := newLoginServer(t, auth.NewGoogle("client-id", "", ""), auth.NewDev())
+	staff, token := newTestSession(t, s)
+	ctx := context.Background()
+	sessionCookie := &http.Cookie{Name: "session_token", Value: token.String()}
+	bob := models.StaffMember{ID: uuid.New(), FirstName: "Bob",
+		Identities: []models.Identity{{Provider: auth.DevProviderName, Subject: "bob"}}}
+	if err := s.Repos.Staff.SaveStaffMember(ctx, bob); err != nil {
+		t.Fatalf("SaveStaffMember: %v", err)
+	}
+
+	rec := serveWithSession(s, s.HandleProfileIndex, "GET", "/profile", "", token)
+	if !strings.Contains(rec.Body.String(), "/auth/link?provider=dev") {
+		t.Error("expected the profile to offer linking the dev provider")
+	}
+
+	link := func(subject string) *httptest.ResponseRecorder {
+		linkReq := httptest.NewRequest("GET", "/auth/link?provider=dev", nil)
+		linkReq.AddCookie(sessionCookie)
+		linkRec := httptest.NewRecorder()
+		s.VerifySession(s.HandleLinkIdentity)(linkRec, linkReq)
+		location, err := url.Parse(linkRec.Header().Get("Location"))
+		if err != nil || linkRec.Code != http.StatusTemporaryRedirect {
+			t.Fatalf("expected a redirect to log in, got %d", linkRec.Code)
+		}
+		var cookie *http.Cookie
+		for _, c := range linkRec.Result().Cookies() {
+			if c.Name == oauthStateCookie {
+				cookie = c
+			}
+		}
+		return devCallback(s, location.Query().Get("state"), cookie, "", subject, sessionCookie)
+	}
+
+	if rec := link("bob"); rec.Code != http.StatusConflict {
+		t.Errorf("expected linking Bob's identity to fail, got %d", rec.Code)
+	}
+	if rec := link("alice"); rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/profile" {
+		t.Fatalf("expected linking to succeed, got %d", rec.Code)
+	}
+	linked, err := s.Repos.Staff.GetStaffByIdentity(ctx, models.Identity{Provider: auth.DevProviderName, Subject: "alice"})
+	if err != nil || linked == nil || linked.ID != staff.ID || len(linked.Identities) != 2 {
+		t.Fatalf("GetStaffByIdentity = %+v, %v", linked, err)
+	}
+	entries, err := s.Repos.Audit.FindAuditEntries(ctx, repository.AuditFilter{Action: models.AuditLinkIdentity})
+	if err != nil || len(entries) != 1 {
+		t.Errorf("expected the link to be audited, got %+v, %v", entries, err)
+	}
+}
+
+// Test a login state cookie only verifies with the secret that signed it.
+func TestVerifyCookieValue(t *testing.T) {
+	s := newMemoryServer(t)
+	signed := s.signCookieValue([]byte("payload"))
+	payload, err := s.verifyCookieValue(signed)
+	if err != nil || string(payload) != "payload" {
+		t.Fatalf("expected the payload back, got %q, %v", payload, err)
+	}
+	if _, err := newMemoryServer(t).verifyCookieValue(signed); err == nil {
+		t.Error("expected a value signed with another secret to be rejected")
+	}
+	if _, err := s.verifyCookieValue("payload"); err == nil {
+		t.Error("expected an unsigned value to be rejected")
+	}
+}
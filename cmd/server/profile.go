@@ -1,13 +1,16 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
+	"roster/cmd/auth"
 	"roster/cmd/models"
 	"roster/cmd/utils"
 
@@ -20,16 +23,36 @@ type ProfileIndexBody struct {
 
 type ProfileIndexData struct {
 	CacheBust    string
+	CSRFToken    string
 	RosterLive   bool
 	AdminRights  bool
 	DeleteRights bool
+	RoleRights   bool
+	AuditRights  bool
 	models.StaffMember
+	// Sessions lists the user's signed in browsers when they are viewing
+	// their own profile.
+	Sessions []SessionData
+	// LinkProviders are the providers the user can link another login from
+	// when viewing their own profile.
+	LinkProviders []auth.Provider
+	// CanInvite is set when a manager views a staff member who can't log in
+	// yet, such as a trial.
+	CanInvite bool
+	// APITokens lists the staff member's API tokens for admins who can
+	// manage them.
+	APITokens *APITokensData
+	// CanViewAs is set when an admin views someone else's profile and can
+	// see the site as them.
+	CanViewAs bool
+	ViewAs    *ViewAsBanner
 }
 
 type ProfileData struct {
 	models.StaffMember
 	AdminRights       bool
 	DeleteRights      bool
+	RoleRights        bool
 	RosterLive        bool
 	ShowUpdateSuccess bool
 	ShowUpdateError   bool
@@ -37,11 +60,12 @@ type ProfileData struct {
 	ShowLeaveError    bool
 }
 
-func MakeProfileStruct(rosterLive bool, staffMember models.StaffMember, adminRights bool, deleteRights bool) ProfileData {
+func MakeProfileStruct(rosterLive bool, staffMember models.StaffMember, adminRights bool, deleteRights bool, roleRights bool) ProfileData {
 	return ProfileData{
 		StaffMember:  staffMember,
 		AdminRights:  adminRights,
 		DeleteRights: deleteRights,
+		RoleRights:   roleRights,
 		RosterLive:   rosterLive,
 	}
 }
@@ -87,8 +111,9 @@ func (s *Server) HandleGetStaffProfileModal(w http.ResponseWriter, r *http.Reque
 		http.Redirect(w, r, "/landing", http.StatusSeeOther)
 		return
 	}
-	adminRights := activeStaff.IsManagerRole()
-	deleteRights := activeStaff.IsAdminRole()
+	adminRights := activeStaff.Can(models.PermStaffManage)
+	deleteRights := activeStaff.Can(models.PermStaffDelete)
+	roleRights := activeStaff.Can(models.PermStaffRoles)
 
 	if r.Method != http.MethodGet {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -109,7 +134,7 @@ func (s *Server) HandleGetStaffProfileModal(w http.ResponseWriter, r *http.Reque
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	staff, err := s.Repos.Staff.GetStaffByID(editStaffId)
+	staff, err := s.Repos.Staff.GetStaffByID(r.Context(), editStaffId)
 	if err != nil {
 		utils.PrintError(err, "Failed to get staff by ID")
 		w.WriteHeader(http.StatusNotFound)
@@ -120,6 +145,7 @@ func (s *Server) HandleGetStaffProfileModal(w http.ResponseWriter, r *http.Reque
 		StaffMember:  *staff,
 		AdminRights:  adminRights,
 		DeleteRights: deleteRights,
+		RoleRights:   roleRights,
 		RosterLive:   false,
 	}
 	s.renderTemplate(w, "staffProfileModal", data)
@@ -131,8 +157,13 @@ func (s *Server) HandleProfileIndex(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/landing", http.StatusSeeOther)
 		return
 	}
-	adminRights := editStaff.IsManagerRole()
-	deleteRights := editStaff.IsAdminRole()
+	thisStaffID := editStaff.ID
+	adminRights := editStaff.Can(models.PermStaffManage)
+	deleteRights := editStaff.Can(models.PermStaffDelete)
+	roleRights := editStaff.Can(models.PermStaffRoles)
+	auditRights := editStaff.Can(models.PermAuditView)
+	apiTokenRights := editStaff.Can(models.PermAPITokensManage)
+	viewAsRights := editStaff.Can(models.PermStaffImpersonate)
 
 	if r.Method == http.MethodGet {
 		editStaffIdParam := r.URL.Query().Get("editStaffId")
@@ -147,7 +178,7 @@ func (s *Server) HandleProfileIndex(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(http.StatusBadRequest)
 				return
 			}
-			staff, err := s.Repos.Staff.GetStaffByID(editStaffId)
+			staff, err := s.Repos.Staff.GetStaffByID(r.Context(), editStaffId)
 			if err != nil {
 				utils.PrintError(err, "Failed to get staff by ID")
 				w.WriteHeader(http.StatusNotFound)
@@ -161,7 +192,7 @@ func (s *Server) HandleProfileIndex(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rosterWeek, err := s.Repos.RosterWeek.LoadRosterWeek(editStaff.Config.RosterDateOffset)
+	rosterWeek, err := s.Repos.RosterWeek.LoadRosterWeek(r.Context(), editStaff.Config.RosterDateOffset)
 	if err != nil {
 		utils.PrintError(err, "Failed to load roster week")
 		w.WriteHeader(http.StatusNotFound)
@@ -170,10 +201,38 @@ func (s *Server) HandleProfileIndex(w http.ResponseWriter, r *http.Request) {
 
 	data := ProfileIndexData{
 		CacheBust:    s.CacheBust,
+		CSRFToken:    s.csrfToken(r.Context()),
 		StaffMember:  *editStaff,
 		AdminRights:  adminRights,
 		DeleteRights: deleteRights,
+		RoleRights:   roleRights,
+		AuditRights:  auditRights,
 		RosterLive:   rosterWeek.IsLive,
+		CanViewAs:    viewAsRights && editStaff.ID != thisStaffID,
+		ViewAs:       s.viewAsBanner(r.Context()),
+	}
+	// Sessions and API tokens are credentials, so they aren't shown to an
+	// admin viewing as someone else.
+	viewingAs := data.ViewAs != nil
+	if editStaff.ID == thisStaffID && !viewingAs {
+		current, _ := sessionFromContext(r.Context())
+		data.Sessions, err = s.makeSessionsData(r.Context(), thisStaffID, current.ID)
+		if err != nil {
+			utils.PrintError(err, "Failed to load sessions")
+		}
+		for _, provider := range s.Providers {
+			if _, ok := provider.(auth.Identifier); ok && !editStaff.HasProvider(provider.Name()) {
+				data.LinkProviders = append(data.LinkProviders, provider)
+			}
+		}
+	} else if editStaff.ID != thisStaffID {
+		data.CanInvite = adminRights && len(editStaff.Identities) == 0
+	}
+	if apiTokenRights && !viewingAs {
+		data.APITokens, err = s.makeAPITokensData(r.Context(), *editStaff)
+		if err != nil {
+			utils.PrintError(err, "Failed to load API tokens")
+		}
 	}
 
 	err = s.Templates.ExecuteTemplate(w, "profileIndex", data)
@@ -188,15 +247,16 @@ func (s *Server) HandleProfile(w http.ResponseWriter, r *http.Request) {
 	if staff == nil {
 		return
 	}
-	rosterWeek, err := s.Repos.RosterWeek.LoadRosterWeek(staff.Config.RosterDateOffset)
+	rosterWeek, err := s.Repos.RosterWeek.LoadRosterWeek(r.Context(), staff.Config.RosterDateOffset)
 	if err != nil {
 		utils.PrintError(err, "Failed to load roster week")
 		return
 	}
 
 	data := ProfileData{
-		AdminRights:  staff.IsManagerRole(),
-		DeleteRights: staff.IsAdminRole(),
+		AdminRights:  staff.Can(models.PermStaffManage),
+		DeleteRights: staff.Can(models.PermStaffDelete),
+		RoleRights:   staff.Can(models.PermStaffRoles),
 		StaffMember:  *staff,
 		RosterLive:   rosterWeek.IsLive,
 	}
@@ -223,7 +283,9 @@ func (s *Server) HandleSubmitLeave(w http.ResponseWriter, r *http.Request) {
 	} else {
 		showLeaveSuccess = true
 		staff.LeaveRequests = append(staff.LeaveRequests, reqBody)
-		s.Repos.Staff.SaveStaffMember(*staff)
+		if err := s.Repos.Staff.SaveStaffMember(r.Context(), *staff); err == nil {
+			s.recordAudit(r.Context(), *staff, models.AuditSubmitLeave, models.AuditEntityLeave, reqBody.ID, nil, makeAuditLeave(staff.ID, reqBody))
+		}
 	}
 	data := MakeLeaveReqStruct(*staff, showLeaveSuccess, showLeaveError)
 	data.StaffMember = *staff
@@ -243,30 +305,60 @@ type ModifyProfileBody struct {
 	Role         string `json:"role"`
 	IsHidden     string `json:"isHidden"`
 	IsKitchen    string `json:"isKitchen"`
-	TuesEarly    string `json:"Tuesday-early-avail"`
-	TuesMid      string `json:"Tuesday-mid-avail"`
-	TuesLate     string `json:"Tuesday-late-avail"`
-	WedEarly     string `json:"Wednesday-early-avail"`
-	WedMid       string `json:"Wednesday-mid-avail"`
-	WedLate      string `json:"Wednesday-late-avail"`
-	ThursEarly   string `json:"Thursday-early-avail"`
-	ThursMid     string `json:"Thursday-mid-avail"`
-	ThursLate    string `json:"Thursday-late-avail"`
-	FriEarly     string `json:"Friday-early-avail"`
-	FriMid       string `json:"Friday-mid-avail"`
-	FriLate      string `json:"Friday-late-avail"`
-	SatEarly     string `json:"Saturday-early-avail"`
-	SatMid       string `json:"Saturday-mid-avail"`
-	SatLate      string `json:"Saturday-late-avail"`
-	SunEarly     string `json:"Sunday-early-avail"`
-	SunMid       string `json:"Sunday-mid-avail"`
-	SunLate      string `json:"Sunday-late-avail"`
-	MonEarly     string `json:"Monday-early-avail"`
-	MonMid       string `json:"Monday-mid-avail"`
-	MonLate      string `json:"Monday-late-avail"`
+	IsMinor      string `json:"isMinor"`
+	// Availability holds the "<day>-<shift>-avail" checkboxes ticked in the
+	// form, keyed in lower case.
+	Availability map[string]string `json:"-"`
+}
+
+// UnmarshalJSON reads the form's fields along with an availability checkbox
+// for each day and shift, since the shifts are configured per venue.
+func (b *ModifyProfileBody) UnmarshalJSON(data []byte) error {
+	type Alias ModifyProfileBody
+	if err := json.Unmarshal(data, (*Alias)(b)); err != nil {
+		return err
+	}
+	fields := map[string]any{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	b.Availability = map[string]string{}
+	for key, value := range fields {
+		if ticked, ok := value.(string); ok && strings.HasSuffix(key, "-avail") {
+			b.Availability[strings.ToLower(key)] = ticked
+		}
+	}
+	return nil
+}
+
+// dayAvailability returns the availability ticked in the form for day.
+func (b ModifyProfileBody) dayAvailability(day time.Weekday) models.DayAvailability {
+	availability := models.DayAvailability{Name: day.String(), Unavailable: models.SlotNameList{}}
+	for _, shift := range models.SlotNames(models.DefaultSlots()) {
+		if b.Availability[strings.ToLower(fmt.Sprintf("%v-%v-avail", day, shift))] != "on" {
+			availability.Unavailable = append(availability.Unavailable, shift)
+		}
+	}
+	return availability
+}
+
+// ShiftButtonClass returns the class of the button for the shift at index
+// in a group of count, rounding the ends of the group.
+func ShiftButtonClass(index int, count int) string {
+	switch {
+	case count == 1:
+		return "shiftButtonL shiftButtonR"
+	case index == 0:
+		return "shiftButtonL"
+	case index == count-1:
+		return "shiftButtonR"
+	}
+	return "shiftButtonM"
 }
 
-func (s *Server) ApplyModifyProfileBody(reqBody ModifyProfileBody, staffMember models.StaffMember, adminRights bool) models.StaffMember {
+// ApplyModifyProfileBody returns staffMember updated from reqBody. Fields only
+// managers can change are applied when editor has the permission to.
+func (s *Server) ApplyModifyProfileBody(reqBody ModifyProfileBody, staffMember models.StaffMember, editor models.StaffMember) models.StaffMember {
 	staffMember.NickName = reqBody.NickName
 	staffMember.FirstName = reqBody.FirstName
 	staffMember.LastName = reqBody.LastName
@@ -277,62 +369,22 @@ func (s *Server) ApplyModifyProfileBody(reqBody ModifyProfileBody, staffMember m
 	// This can fail but not from me
 	staffMember.IdealShifts, _ = strconv.Atoi(reqBody.IdealShifts)
 
-	// Admin fields - only apply if user has admin rights
-	if adminRights {
-		if reqBody.Role != "" {
-			roleInt, err := strconv.Atoi(reqBody.Role)
-			if err == nil && roleInt >= 0 && roleInt <= 2 {
-				staffMember.Role = models.StaffRole(roleInt)
-				staffMember.IsAdmin = staffMember.Role >= models.Manager
-			}
+	if editor.Can(models.PermStaffRoles) && reqBody.Role != "" {
+		roleInt, err := strconv.Atoi(reqBody.Role)
+		if _, ok := models.StaffRole(roleInt).Role(); err == nil && ok {
+			staffMember.Role = models.StaffRole(roleInt)
+			staffMember.IsAdmin = staffMember.Can(models.PermStaffManage)
 		}
+	}
+	if editor.Can(models.PermStaffManage) {
 		staffMember.IsHidden = reqBody.IsHidden == "on"
 		staffMember.IsKitchen = reqBody.IsKitchen == "on"
+		staffMember.IsMinor = reqBody.IsMinor == "on"
 	}
 
-	staffMember.Availability = []models.DayAvailability{
-		{
-			Name:  "Tuesday",
-			Early: reqBody.TuesEarly == "on",
-			Mid:   reqBody.TuesMid == "on",
-			Late:  reqBody.TuesLate == "on",
-		},
-		{
-			Name:  "Wednesday",
-			Early: reqBody.WedEarly == "on",
-			Mid:   reqBody.WedMid == "on",
-			Late:  reqBody.WedLate == "on",
-		},
-		{
-			Name:  "Thursday",
-			Early: reqBody.ThursEarly == "on",
-			Mid:   reqBody.ThursMid == "on",
-			Late:  reqBody.ThursLate == "on",
-		},
-		{
-			Name:  "Friday",
-			Early: reqBody.FriEarly == "on",
-			Mid:   reqBody.FriMid == "on",
-			Late:  reqBody.FriLate == "on",
-		},
-		{
-			Name:  "Saturday",
-			Early: reqBody.SatEarly == "on",
-			Mid:   reqBody.SatMid == "on",
-			Late:  reqBody.SatLate == "on",
-		},
-		{
-			Name:  "Sunday",
-			Early: reqBody.SunEarly == "on",
-			Mid:   reqBody.SunMid == "on",
-			Late:  reqBody.SunLate == "on",
-		},
-		{
-			Name:  "Monday",
-			Early: reqBody.MonEarly == "on",
-			Mid:   reqBody.MonMid == "on",
-			Late:  reqBody.MonLate == "on",
-		},
+	staffMember.Availability = []models.DayAvailability{}
+	for _, day := range utils.WeekDays() {
+		staffMember.Availability = append(staffMember.Availability, reqBody.dayAvailability(day))
 	}
 	return staffMember
 }
@@ -348,7 +400,7 @@ func (s *Server) HandleModifyProfile(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	staff, err := s.Repos.Staff.GetStaffByID(staffID)
+	staff, err := s.Repos.Staff.GetStaffByID(r.Context(), staffID)
 	if err != nil {
 		return
 	}
@@ -356,14 +408,15 @@ func (s *Server) HandleModifyProfile(w http.ResponseWriter, r *http.Request) {
 	if activeStaff == nil {
 		return
 	}
-	if activeStaff.ID != staff.ID && !activeStaff.IsManagerRole() {
+	if activeStaff.ID != staff.ID && !activeStaff.Can(models.PermStaffManage) {
 		utils.PrintError(err, "Insufficient privilledges")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	adminRights := activeStaff.IsManagerRole()
-	updatedStaff := s.ApplyModifyProfileBody(reqBody, *staff, adminRights)
-	s.Repos.Staff.SaveStaffMember(updatedStaff)
+	updatedStaff := s.ApplyModifyProfileBody(reqBody, *staff, *activeStaff)
+	if err := s.Repos.Staff.SaveStaffMember(r.Context(), updatedStaff); err == nil {
+		s.recordAudit(r.Context(), *activeStaff, models.AuditModifyProfile, models.AuditEntityStaff, staff.ID, makeAuditStaff(*staff), makeAuditStaff(updatedStaff))
+	}
 	w.Header().Set("HX-Redirect", "/")
 	w.WriteHeader(http.StatusOK)
 }
@@ -396,48 +449,55 @@ func (s *Server) HandleDeleteLeaveReq(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rosterWeek, err := s.Repos.RosterWeek.LoadRosterWeek(thisStaff.Config.RosterDateOffset)
+	rosterWeek, err := s.Repos.RosterWeek.LoadRosterWeek(r.Context(), thisStaff.Config.RosterDateOffset)
 	if err != nil {
 		utils.PrintError(err, "Failed to load roster week")
 		return
 	}
 
-	staffMember, err := s.Repos.Staff.GetStaffByID(staffID)
+	staffMember, err := s.Repos.Staff.GetStaffByID(r.Context(), staffID)
 	if err != nil || staffMember == nil {
 		utils.PrintError(err, "Failed to load staff member")
-		s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(*thisStaff, *rosterWeek))
+		s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(r.Context(), *thisStaff, *rosterWeek))
 		return
 	}
 
-	// Only admins can delete requests that are not their own
-	if thisStaff.ID != staffMember.ID && !thisStaff.IsAdminRole() {
+	// Only leave approvers can delete requests that are not their own
+	if thisStaff.ID != staffMember.ID && !thisStaff.Can(models.PermLeaveApprove) {
 		w.WriteHeader(http.StatusForbidden)
 		if reqBody.Page == "root" {
-			s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(*thisStaff, *rosterWeek))
+			s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(r.Context(), *thisStaff, *rosterWeek))
 			return
 		}
 		data := ProfileData{
 			StaffMember:  *thisStaff,
-			AdminRights:  thisStaff.IsManagerRole(),
-			DeleteRights: thisStaff.IsAdminRole(),
+			AdminRights:  thisStaff.Can(models.PermStaffManage),
+			DeleteRights: thisStaff.Can(models.PermStaffDelete),
+			RoleRights:   thisStaff.Can(models.PermStaffRoles),
 			RosterLive:   rosterWeek.IsLive,
 		}
 		s.renderTemplate(w, "profile", data)
 		return
 	}
 
-	err = s.Repos.Staff.DeleteLeaveReqByID(*staffMember, leaveID)
+	err = s.Repos.Staff.DeleteLeaveReqByID(r.Context(), *staffMember, leaveID)
 	if err != nil {
 		utils.PrintError(err, "Failed delete leave request")
 		return
 	}
+	for _, req := range staffMember.LeaveRequests {
+		if req.ID == leaveID {
+			s.recordAudit(r.Context(), *thisStaff, models.AuditDeleteLeave, models.AuditEntityLeave, leaveID, makeAuditLeave(staffMember.ID, req), nil)
+		}
+	}
 	if reqBody.Page == "root" {
-		s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(*thisStaff, *rosterWeek))
+		s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(r.Context(), *thisStaff, *rosterWeek))
 	} else {
 		data := ProfileData{
 			StaffMember:  *thisStaff,
-			AdminRights:  thisStaff.IsManagerRole(),
-			DeleteRights: thisStaff.IsAdminRole(),
+			AdminRights:  thisStaff.Can(models.PermStaffManage),
+			DeleteRights: thisStaff.Can(models.PermStaffDelete),
+			RoleRights:   thisStaff.Can(models.PermStaffRoles),
 			RosterLive:   rosterWeek.IsLive,
 		}
 		s.renderTemplate(w, "profile", data)
@@ -469,28 +529,30 @@ func (s *Server) HandleSetLeaveStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	staffMember, err := s.Repos.Staff.GetStaffByLeaveReqID(leaveID)
+	staffMember, err := s.Repos.Staff.GetStaffByLeaveReqID(r.Context(), leaveID)
 	if err != nil || staffMember == nil {
 		utils.PrintError(err, "Failed to load staff member by leave ID")
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	updated := false
+	var before, after *models.LeaveRequest
 	for i := range staffMember.LeaveRequests {
 		if staffMember.LeaveRequests[i].ID != leaveID {
 			continue
 		}
+		req := staffMember.LeaveRequests[i]
+		before = &req
 		staffMember.LeaveRequests[i].Status = models.LeaveStatus(reqBody.Status)
-		updated = true
+		after = &staffMember.LeaveRequests[i]
 		break
 	}
-	if !updated {
+	if after == nil {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	if err := s.Repos.Staff.SaveStaffMember(*staffMember); err != nil {
+	if err := s.Repos.Staff.SaveStaffMember(r.Context(), *staffMember); err != nil {
 		utils.PrintError(err, "Failed to update leave request")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -501,12 +563,14 @@ func (s *Server) HandleSetLeaveStatus(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Couldn't find session user")
 		return
 	}
-	rosterWeek, err := s.Repos.RosterWeek.LoadRosterWeek(thisStaff.Config.RosterDateOffset)
+	s.recordAudit(r.Context(), *thisStaff, models.AuditSetLeaveStatus, models.AuditEntityLeave, leaveID,
+		makeAuditLeave(staffMember.ID, *before), makeAuditLeave(staffMember.ID, *after))
+	rosterWeek, err := s.Repos.RosterWeek.LoadRosterWeek(r.Context(), thisStaff.Config.RosterDateOffset)
 	if err != nil {
 		utils.PrintError(err, "Failed to load roster week")
 		return
 	}
-	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(*thisStaff, *rosterWeek))
+	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(r.Context(), *thisStaff, *rosterWeek))
 }
 
 type DeleteAccountBody struct {
@@ -526,19 +590,30 @@ func (s *Server) HandleDeleteAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.Repos.Staff.DeleteStaffByID(accID); err != nil {
+	deleted, err := s.Repos.Staff.GetStaffByID(r.Context(), accID)
+	if err != nil {
+		utils.PrintError(err, "Failed to get staff by ID")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err := s.Repos.Staff.DeleteStaffByID(r.Context(), accID); err != nil {
 		utils.PrintError(err, "Failed to delete staff")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	if err := s.Repos.Sessions.DeleteStaffSessions(r.Context(), accID); err != nil {
+		utils.PrintError(err, "Failed to revoke deleted staff's sessions")
+	}
+	s.recordAudit(r.Context(), *thisStaff, models.AuditDeleteAccount, models.AuditEntityStaff, accID, makeAuditStaff(*deleted), nil)
 	selfDelete := thisStaff.ID == accID
 
 	if selfDelete {
-		s.HandleGoogleLogout(w, r)
+		s.endSession(w, r)
+		w.Header().Set("HX-Redirect", "/landing")
 	} else {
 		w.Header().Set("HX-Redirect", "/")
-		w.WriteHeader(http.StatusOK)
 	}
+	w.WriteHeader(http.StatusOK)
 }
 
 type LeaveReqData struct {
@@ -599,7 +674,7 @@ func (s *Server) HandleDeleteExpiredLeaveRequests(w http.ResponseWriter, r *http
 		return
 	}
 
-	allStaff, err := s.Repos.Staff.LoadAllStaff()
+	allStaff, err := s.Repos.Staff.LoadAllStaff(r.Context())
 	if err != nil {
 		utils.PrintError(err, "Failed to load all staff")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -610,27 +685,31 @@ func (s *Server) HandleDeleteExpiredLeaveRequests(w http.ResponseWriter, r *http
 
 	for _, staff := range allStaff {
 		updatedRequests := []models.LeaveRequest{}
-		modified := false
+		expired := []models.LeaveRequest{}
 		for _, req := range staff.LeaveRequests {
 			if req.EndDate.After(now) {
 				updatedRequests = append(updatedRequests, req)
 			} else {
-				modified = true
+				expired = append(expired, req)
 			}
 		}
 
-		if modified {
+		if len(expired) > 0 {
 			staff.LeaveRequests = updatedRequests
-			if err := s.Repos.Staff.SaveStaffMember(*staff); err != nil {
+			if err := s.Repos.Staff.SaveStaffMember(r.Context(), *staff); err != nil {
 				utils.PrintError(err, "Failed to save staff member")
+				continue
+			}
+			for _, req := range expired {
+				s.recordAudit(r.Context(), *thisStaff, models.AuditDeleteLeave, models.AuditEntityLeave, req.ID, makeAuditLeave(staff.ID, req), nil)
 			}
 		}
 	}
 
-	rosterWeek, err := s.Repos.RosterWeek.LoadRosterWeek(thisStaff.Config.RosterDateOffset)
+	rosterWeek, err := s.Repos.RosterWeek.LoadRosterWeek(r.Context(), thisStaff.Config.RosterDateOffset)
 	if err != nil {
 		utils.PrintError(err, "Failed to load roster week")
 		return
 	}
-	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(*thisStaff, *rosterWeek))
+	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(r.Context(), *thisStaff, *rosterWeek))
 }
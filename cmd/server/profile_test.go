@@ -1,6 +1,8 @@
 package server
 
 import (
+	"context"
+	"net/http"
 	"testing"
 	"time"
 
@@ -11,7 +13,7 @@ import (
 
 func TestMakeProfileStruct(t *testing.T) {
 	staff := models.StaffMember{ID: uuid.New(), FirstName: "Test", Role: models.AdminRole}
-	data := MakeProfileStruct(true, staff, false, false)
+	data := MakeProfileStruct(true, staff, false, false, false)
 	if data.StaffMember.ID != staff.ID {
 		t.Errorf("MakeProfileStruct: StaffMember.ID = %v; want %v", data.StaffMember.ID, staff.ID)
 	}
@@ -89,3 +91,38 @@ func TestGetSortedLeaveReqs(t *testing.T) {
 		t.Errorf("GetSortedLeaveReqs: expected order [s2, s1], got [%v, %v]", list[0].StaffID, list[1].StaffID)
 	}
 }
+
+// Test availability is read from a checkbox per day and configured shift,
+// and anything left unticked is saved as unavailable.
+func TestHandleModifyProfile_Availability(t *testing.T) {
+	models.SetDefaultSlots([]models.SlotDefinition{{Name: "Brunch"}, {Name: "Dinner"}})
+	t.Cleanup(func() { models.SetDefaultSlots(models.LegacySlots) })
+	s := newMemoryServer(t)
+	staff, token := newTestSession(t, s)
+
+	body := `{"id":"` + staff.ID.String() + `","firstName":"Alice","Tuesday-Brunch-avail":"on","friday-dinner-avail":"on"}`
+	rec := serveWithSession(s, s.HandleModifyProfile, "POST", "/modifyProfile", body, token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	saved, err := s.Repos.Staff.GetStaffByID(context.Background(), staff.ID)
+	if err != nil {
+		t.Fatalf("GetStaffByID: %v", err)
+	}
+	for _, day := range saved.Availability {
+		switch day.Name {
+		case "Tuesday":
+			if !day.IsAvailable("Brunch") || day.IsAvailable("Dinner") {
+				t.Errorf("expected Tuesday brunch only, got %+v", day)
+			}
+		case "Friday":
+			if day.IsAvailable("Brunch") || !day.IsAvailable("Dinner") {
+				t.Errorf("expected Friday dinner only, got %+v", day)
+			}
+		default:
+			if day.IsAvailable("Brunch") || day.IsAvailable("Dinner") {
+				t.Errorf("expected %s to be unavailable, got %+v", day.Name, day)
+			}
+		}
+	}
+}
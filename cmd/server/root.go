@@ -3,23 +3,22 @@ package server
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"encoding/csv"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"roster/cmd/autoroster"
 	"roster/cmd/models"
 	"roster/cmd/repository"
 	"roster/cmd/utils"
 
 	"github.com/google/uuid"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 )
 
 type RootStruct struct {
@@ -28,14 +27,53 @@ type RootStruct struct {
 	models.RosterWeek
 	Staff           []*models.StaffMember
 	StaffShiftCount map[uuid.UUID]int
+	// Notice is shown above the roster, e.g. after a conflicting edit.
+	Notice string
+	// Unfilled are the slots the last auto roster run left empty.
+	Unfilled []autoroster.Unfilled
+	// Ctx bounds the repository calls made while rendering.
+	Ctx context.Context
 }
 
-func (s *Server) MakeRootStruct(activeStaff models.StaffMember, week models.RosterWeek) RootStruct {
-	allStaff, err := s.Repos.Staff.LoadAllStaff()
+// CSRFToken is the token the page must send back with its requests.
+func (rs RootStruct) CSRFToken() string {
+	return rs.Server.csrfToken(rs.Ctx)
+}
+
+// ViewAs is the banner to show when an admin is viewing as ActiveStaff.
+func (rs RootStruct) ViewAs() *ViewAsBanner {
+	return rs.Server.viewAsBanner(rs.Ctx)
+}
+
+// RosterIssue is a rule broken by one of the week's slots.
+type RosterIssue struct {
+	SlotID   uuid.UUID
+	SlotName string
+	models.Violation
+}
+
+// Issues lists every rule broken by the week's slots, in roster order.
+func (rs RootStruct) Issues() []RosterIssue {
+	issues := []RosterIssue{}
+	for _, day := range rs.Days {
+		for _, row := range day.Rows {
+			for _, slot := range row.Slots {
+				for _, v := range slot.Violations {
+					issues = append(issues, RosterIssue{SlotID: slot.ID, SlotName: slot.Name, Violation: v})
+				}
+			}
+		}
+	}
+	return issues
+}
+
+func (s *Server) MakeRootStruct(ctx context.Context, activeStaff models.StaffMember, week models.RosterWeek) RootStruct {
+	allStaff, err := s.Repos.Staff.LoadAllStaff(ctx)
 	if err != nil {
 		utils.PrintError(err, "Failed to load all staff")
 		allStaff = []*models.StaffMember{}
 	}
+	s.checkRosterRules(ctx, &week, allStaff)
 
 	// Calculate shift counts for each staff member (once per week)
 	staffShiftCount := make(map[uuid.UUID]int)
@@ -49,7 +87,123 @@ func (s *Server) MakeRootStruct(activeStaff models.StaffMember, week models.Rost
 		week,
 		allStaff,
 		staffShiftCount,
+		"",
+		nil,
+		ctx,
+	}
+}
+
+// checkRosterRules sets the violations of week's slots, looking across to the
+// weeks either side if they have been rostered.
+func (s *Server) checkRosterRules(ctx context.Context, week *models.RosterWeek, allStaff []*models.StaffMember) {
+	previous, next, err := s.loadNeighbours(ctx, week.WeekOffset)
+	if err != nil {
+		utils.PrintError(err, "Failed to load neighbouring roster week")
+	}
+	week.CheckRules(allStaff, previous, next)
+}
+
+// loadNeighbours returns the weeks either side of offset, leaving either nil
+// if it hasn't been rostered yet.
+func (s *Server) loadNeighbours(ctx context.Context, offset int) (previous *models.RosterWeek, next *models.RosterWeek, err error) {
+	previous, prevErr := s.Repos.RosterWeek.GetRosterWeek(ctx, offset-1)
+	if errors.Is(prevErr, repository.ErrNotFound) {
+		prevErr = nil
+	}
+	next, nextErr := s.Repos.RosterWeek.GetRosterWeek(ctx, offset+1)
+	if errors.Is(nextErr, repository.ErrNotFound) {
+		nextErr = nil
+	}
+	return previous, next, errors.Join(prevErr, nextErr)
+}
+
+// RosterRevisionHeader carries the roster week revision the client last
+// rendered, so edits made against a stale roster can be rejected.
+const RosterRevisionHeader = "X-Roster-Revision"
+
+const rosterConflictNotice = "The roster was changed by someone else and has been reloaded. Your last change was not saved."
+
+// saveClientRosterWeek saves a week edited by the client, first checking the
+// client was looking at the latest revision. It writes the response and
+// returns false if the edit could not be saved.
+func (s *Server) saveClientRosterWeek(w http.ResponseWriter, r *http.Request, activeStaff models.StaffMember, week *models.RosterWeek) bool {
+	if isStaleRevision(r, week) {
+		s.renderRosterConflict(w, r, activeStaff)
+		return false
+	}
+	return s.saveRosterWeek(w, r, activeStaff, week)
+}
+
+// respondToSlotUpdate writes the response to a single slot update that
+// returned revision and err.
+func (s *Server) respondToSlotUpdate(w http.ResponseWriter, r *http.Request, revision int, err error) {
+	if errors.Is(err, repository.ErrNotFound) {
+		utils.PrintError(err, "Invalid slotID")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		utils.PrintError(err, "Failed to update slot")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	s.renderRevisionIfCurrent(w, r, revision)
+}
+
+// renderRevisionIfCurrent moves the client on to revision after an atomic
+// edit. Atomic edits can't lose other changes so they are never rejected as
+// stale, but only a client that was up to date beforehand is moved on;
+// anyone else must still reload before whole-week edits are accepted.
+func (s *Server) renderRevisionIfCurrent(w http.ResponseWriter, r *http.Request, revision int) {
+	if rev, err := strconv.Atoi(r.Header.Get(RosterRevisionHeader)); err == nil && rev == revision-1 {
+		s.renderTemplate(w, "rosterRevisionOOB", revision)
+	}
+}
+
+// isStaleRevision reports whether the request was made against an older
+// revision of week. Requests without a revision header are never stale.
+func isStaleRevision(r *http.Request, week *models.RosterWeek) bool {
+	rev, err := strconv.Atoi(r.Header.Get(RosterRevisionHeader))
+	if err != nil || rev == week.Revision {
+		return false
+	}
+	utils.PrintLog("Rejecting edit to roster week %v: client revision %v, current %v", week.ID, rev, week.Revision)
+	return true
+}
+
+// saveRosterWeek saves week, rendering a reloaded roster if it was changed
+// concurrently. It writes the response and returns false on failure.
+func (s *Server) saveRosterWeek(w http.ResponseWriter, r *http.Request, activeStaff models.StaffMember, week *models.RosterWeek) bool {
+	err := s.Repos.RosterWeek.SaveRosterWeek(r.Context(), week)
+	if errors.Is(err, repository.ErrRevisionConflict) {
+		utils.PrintError(err, "Conflicting roster week save")
+		s.renderRosterConflict(w, r, activeStaff)
+		return false
+	}
+	if err != nil {
+		utils.PrintError(err, "Failed to save roster week")
+		w.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// renderRosterConflict responds with the latest roster and a notice that the
+// client's change was not saved. The response replaces the whole roster
+// whichever element made the request.
+func (s *Server) renderRosterConflict(w http.ResponseWriter, r *http.Request, activeStaff models.StaffMember) {
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(r.Context(), activeStaff.Config.RosterDateOffset)
+	if err != nil {
+		utils.PrintError(err, "Failed to reload roster week")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
+	root := s.MakeRootStruct(r.Context(), activeStaff, *week)
+	root.Notice = rosterConflictNotice
+	w.Header().Set("HX-Retarget", "#roster-main-container")
+	w.Header().Set("HX-Reswap", "outerHTML")
+	w.WriteHeader(http.StatusConflict)
+	s.renderTemplate(w, "rosterMainContainer", root)
 }
 
 type DayStruct struct {
@@ -60,9 +214,9 @@ type DayStruct struct {
 	ActiveStaff models.StaffMember
 }
 
-func MakeDayStruct(isLive bool, day models.RosterDay, s *Server, activeStaff models.StaffMember) DayStruct {
+func MakeDayStruct(ctx context.Context, isLive bool, day models.RosterDay, s *Server, activeStaff models.StaffMember) DayStruct {
 	date := utils.WeekStartFromOffset(activeStaff.Config.RosterDateOffset).AddDate(0, 0, day.Offset)
-	allStaff, err := s.Repos.Staff.LoadAllStaff()
+	allStaff, err := s.Repos.Staff.LoadAllStaff(ctx)
 	if err != nil {
 		utils.PrintError(err, "Failed to load all staff")
 		allStaff = []*models.StaffMember{}
@@ -86,119 +240,18 @@ func MemberIsAssigned(activeID uuid.UUID, assignedID *uuid.UUID) bool {
 func (s *Server) HandleIndex(w http.ResponseWriter, r *http.Request) {
 	thisStaff := s.GetSessionUser(w, r)
 	if thisStaff == nil {
-		s.HandleGoogleLogout(w, r)
+		// Most likely the staff member being viewed as has gone. A GET must
+		// not log anyone out, so only stop viewing as them.
 		utils.PrintLog("Couldn't find staff member")
+		clearViewAsCookie(w)
+		http.Redirect(w, r, "/landing", http.StatusSeeOther)
 		return
 	}
-	week, err := s.Repos.RosterWeek.LoadRosterWeek(thisStaff.Config.RosterDateOffset)
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(r.Context(), thisStaff.Config.RosterDateOffset)
 	if err != nil {
 		utils.PrintError(err, "Error creating staff member")
 	}
-	s.renderTemplate(w, "root", s.MakeRootStruct(*thisStaff, *week))
-}
-
-func googleOauthConfig() *oauth2.Config {
-	return &oauth2.Config{
-		ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
-		ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
-		RedirectURL:  os.Getenv("REDIRECT_URL"),
-		Scopes:       []string{"https://www.googleapis.com/auth/userinfo.email"},
-		Endpoint:     google.Endpoint,
-	}
-}
-
-func (s *Server) HandleGoogleLogin(w http.ResponseWriter, r *http.Request) {
-	if DEV_MODE {
-		s.HandleGoogleCallback(w, r)
-	} else {
-		url := googleOauthConfig().AuthCodeURL("state", oauth2.AccessTypeOffline, oauth2.ApprovalForce, oauth2.SetAuthURLParam("prompt", "select_account"))
-		http.Redirect(w, r, url, http.StatusTemporaryRedirect)
-	}
-}
-
-func (s *Server) HandleGoogleLogout(w http.ResponseWriter, r *http.Request) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    "",
-		Path:     "/",
-		Expires:  time.Unix(0, 0),
-		MaxAge:   -1,
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteLaxMode,
-	})
-
-	staff := s.GetSessionUser(w, r)
-	if staff != nil {
-		staff.Tokens = []uuid.UUID{}
-	}
-	http.Redirect(w, r, "/landing", http.StatusSeeOther)
-}
-
-type GoogleCallbackBody struct {
-	ID string `json:"id"`
-}
-
-func (s *Server) HandleGoogleCallback(w http.ResponseWriter, r *http.Request) {
-	var userInfo GoogleCallbackBody
-	if !DEV_MODE {
-		ctx := r.Context()
-		code := r.URL.Query().Get("code")
-		token, err := googleOauthConfig().Exchange(ctx, code)
-		if err != nil {
-			http.Error(w, "Failed to exchange token: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		response, err := http.Get("https://www.googleapis.com/oauth2/v2/userinfo?access_token=" + token.AccessToken)
-		if err != nil {
-			http.Error(w, "Failed to login: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		if err = json.NewDecoder(response.Body).Decode(&userInfo); err != nil {
-			http.Error(w, "Error decoding user information: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-	} else {
-		userInfo = GoogleCallbackBody{
-			ID: "DEV",
-		}
-	}
-
-	sessionToken := uuid.New()
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    sessionToken.String(),
-		Expires:  time.Now().AddDate(10, 0, 0),
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteLaxMode,
-		Path:     "/",
-	})
-
-	staffMember, err := s.Repos.Staff.GetStaffByGoogleID(userInfo.ID)
-	if err != nil {
-		utils.PrintError(err, "Failed to get staff by google id")
-		http.Redirect(w, r, "/landing", http.StatusSeeOther)
-		return
-	} else if staffMember == nil {
-		utils.PrintLog("Creating new staff member")
-		err := s.Repos.Staff.CreateStaffMember(userInfo.ID, sessionToken)
-		if err != nil {
-			utils.PrintError(err, "Error creating staff member")
-			http.Redirect(w, r, "/landing", http.StatusSeeOther)
-			return
-		}
-		http.Redirect(w, r, "/newAccount", http.StatusSeeOther)
-	} else {
-		utils.PrintLog("Updating staff token ID")
-		err := s.Repos.Staff.UpdateStaffToken(staffMember, sessionToken)
-		if err != nil {
-			utils.PrintError(err, "Error logging in with google")
-		}
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-	}
+	s.renderTemplate(w, "root", s.MakeRootStruct(r.Context(), *thisStaff, *week))
 }
 
 func (s *Server) HandleCreateAccount(w http.ResponseWriter, r *http.Request) {
@@ -214,12 +267,14 @@ func (s *Server) HandleCreateAccount(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/landing", http.StatusSeeOther)
 		return
 	}
-	updatedStaff := s.ApplyModifyProfileBody(reqBody, *thisStaff, false)
-	if err := s.Repos.Staff.SaveStaffMember(updatedStaff); err != nil {
+	// New accounts can't give themselves a role, so apply it as plain staff.
+	updatedStaff := s.ApplyModifyProfileBody(reqBody, *thisStaff, models.StaffMember{Role: models.Staff})
+	if err := s.Repos.Staff.SaveStaffMember(r.Context(), updatedStaff); err != nil {
 		utils.PrintError(err, "Error creating staff member")
 		http.Redirect(w, r, "/landing", http.StatusSeeOther)
 		return
 	}
+	s.recordAudit(r.Context(), updatedStaff, models.AuditCreateAccount, models.AuditEntityStaff, updatedStaff.ID, nil, makeAuditStaff(updatedStaff))
 	w.Header().Set("HX-Redirect", "/")
 	w.WriteHeader(http.StatusOK)
 }
@@ -245,8 +300,9 @@ func (s *Server) HandleNewAccount(w http.ResponseWriter, r *http.Request) {
 
 	data := ProfileIndexData{
 		CacheBust:   s.CacheBust,
+		CSRFToken:   s.csrfToken(r.Context()),
 		StaffMember: *thisStaff,
-		AdminRights: thisStaff.IsManagerRole(),
+		AdminRights: thisStaff.Can(models.PermStaffManage),
 		RosterLive:  false,
 	}
 	s.renderTemplate(w, "newAccount", data)
@@ -270,20 +326,14 @@ func (s *Server) HandleModifyDescriptionSlot(w http.ResponseWriter, r *http.Requ
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	week, err := s.Repos.RosterWeek.LoadRosterWeek(thisStaff.Config.RosterDateOffset)
-	if err != nil {
-		utils.PrintError(err, "Failed to get roster week")
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+	before := s.loadAuditSlot(r.Context(), thisStaff.Config.RosterDateOffset, slotID)
+	revision, err := s.Repos.RosterWeek.UpdateSlotDescription(r.Context(), thisStaff.Config.RosterDateOffset, slotID, descVal)
+	if err == nil && before != nil {
+		after := *before
+		after.Description = descVal
+		s.recordAudit(r.Context(), *thisStaff, models.AuditSlotDescription, models.AuditEntityRoster, slotID, before, after)
 	}
-	slot := week.GetSlotByID(slotID)
-	if slot == nil {
-		utils.PrintError(err, "Invalid slotID")
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
-
-	slot.Description = descVal
-	s.Repos.RosterWeek.SaveRosterWeek(week)
+	s.respondToSlotUpdate(w, r, revision, err)
 }
 
 func (s *Server) HandleModifyTimeSlot(w http.ResponseWriter, r *http.Request) {
@@ -305,21 +355,14 @@ func (s *Server) HandleModifyTimeSlot(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	utils.PrintLog("Modify %v timeslot id: %v", slotID, timeVal)
-	week, err := s.Repos.RosterWeek.LoadRosterWeek(thisStaff.Config.RosterDateOffset)
-	if err != nil {
-		utils.PrintError(err, "Failed to load roster week")
-		return
-	}
-
-	slot := week.GetSlotByID(slotID)
-	if slot == nil {
-		utils.PrintError(err, "Invalid slotID")
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
-
-	slot.StartTime = timeVal
-	s.Repos.RosterWeek.SaveRosterWeek(week)
+	before := s.loadAuditSlot(r.Context(), thisStaff.Config.RosterDateOffset, slotID)
+	revision, err := s.Repos.RosterWeek.UpdateSlotStartTime(r.Context(), thisStaff.Config.RosterDateOffset, slotID, timeVal)
+	if err == nil && before != nil {
+		after := *before
+		after.StartTime = timeVal
+		s.recordAudit(r.Context(), *thisStaff, models.AuditSlotStartTime, models.AuditEntityRoster, slotID, before, after)
+	}
+	s.respondToSlotUpdate(w, r, revision, err)
 }
 
 func (s *Server) HandleModifySlot(w http.ResponseWriter, r *http.Request) {
@@ -341,49 +384,49 @@ func (s *Server) HandleModifySlot(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	week, err := s.Repos.RosterWeek.LoadRosterWeek(thisStaff.Config.RosterDateOffset)
-	if err != nil {
-		utils.PrintError(err, "Failed to load roster week")
-		return
+	var assignedStaff *uuid.UUID
+	var staffString *string
+	staffID, err := uuid.Parse(staffIDStr)
+	if err == nil {
+		utils.PrintLog("Modify %v slot id: %v, staffid: %v", slotID, slotID, staffID)
+		member, err := s.Repos.Staff.GetStaffByID(r.Context(), staffID)
+		if err != nil {
+			utils.PrintError(err, "failed to get staff by ID")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if member == nil {
+			utils.PrintLog("No staff member with ID %v", staffID)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		assignedStaff = &member.ID
+		name := member.RosterName()
+		staffString = &name
 	}
-	slot := week.GetSlotByID(slotID)
-	if slot == nil {
+	before := s.loadAuditSlot(r.Context(), thisStaff.Config.RosterDateOffset, slotID)
+	_, err = s.Repos.RosterWeek.UpdateSlotAssignment(r.Context(), thisStaff.Config.RosterDateOffset, slotID, assignedStaff, staffString)
+	if errors.Is(err, repository.ErrNotFound) {
 		utils.PrintError(err, "Invalid slotID")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-
-	staffID, err := uuid.Parse(staffIDStr)
 	if err != nil {
-		slot.AssignedStaff = nil
-		slot.StaffString = nil
-	} else {
-		utils.PrintLog("Modify %v slot id: %v, staffid: %v", slotID, slotID, staffID)
-		member, err := s.Repos.Staff.GetStaffByID(staffID)
-		if err != nil {
-			utils.PrintError(err, "failed to get staff by ID")
-		} else {
-			slot.AssignedStaff = &member.ID
-			if member.NickName != "" {
-				slot.StaffString = &member.NickName
-			} else {
-				slot.StaffString = &member.FirstName
-			}
-		}
+		utils.PrintError(err, "Failed to update slot assignment")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
-	// TODO: Make the flags check here
-	allStaff, err := s.Repos.Staff.LoadAllStaff()
+	// Flags are recomputed from the latest revision when the week is
+	// rendered, so there's nothing more to save.
+	week, err := s.Repos.RosterWeek.GetRosterWeek(r.Context(), thisStaff.Config.RosterDateOffset)
 	if err != nil {
-		utils.PrintError(err, "Failed to load all staff")
+		utils.PrintError(err, "Failed to reload roster week")
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-
-	checkedWeek := week.CheckFlags(allStaff)
-	week = &checkedWeek
-
-	s.Repos.RosterWeek.SaveRosterWeek(week)
-	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(*thisStaff, *week))
+	s.recordAudit(r.Context(), *thisStaff, models.AuditAssignSlot, models.AuditEntityRoster, slotID, before, week.GetSlotByID(slotID))
+	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(r.Context(), *thisStaff, *week))
 }
 
 // TODO: Make these toggles consolidated
@@ -403,24 +446,30 @@ func (s *Server) HandleToggleKitchen(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	staffMember, err := s.Repos.Staff.GetStaffByID(accID)
+	staffMember, err := s.Repos.Staff.GetStaffByID(r.Context(), accID)
+	var before models.StaffMember
+	saved := false
 	if err != nil {
 		utils.PrintError(err, "failed to get staff by ID")
 	} else {
+		before = *staffMember
 		staffMember.IsKitchen = !staffMember.IsKitchen
-		s.Repos.Staff.SaveStaffMember(*staffMember)
+		saved = s.Repos.Staff.SaveStaffMember(r.Context(), *staffMember) == nil
 	}
 	thisStaff := s.GetSessionUser(w, r)
 	if thisStaff == nil {
 		utils.PrintLog("Couldn't find staff")
 		return
 	}
-	week, err := s.Repos.RosterWeek.LoadRosterWeek(thisStaff.Config.RosterDateOffset)
+	if saved {
+		s.recordAudit(r.Context(), *thisStaff, models.AuditToggleKitchen, models.AuditEntityStaff, accID, makeAuditStaff(before), makeAuditStaff(*staffMember))
+	}
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(r.Context(), thisStaff.Config.RosterDateOffset)
 	if err != nil {
 		utils.PrintError(err, "Failed to load roster week")
 		return
 	}
-	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(*thisStaff, *week))
+	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(r.Context(), *thisStaff, *week))
 }
 
 type SetRoleBody struct {
@@ -439,32 +488,38 @@ func (s *Server) HandleSetRole(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	if reqBody.Role < int(models.Staff) || reqBody.Role > int(models.AdminRole) {
+	if _, ok := models.StaffRole(reqBody.Role).Role(); !ok {
 		utils.PrintError(fmt.Errorf("invalid role"), "Invalid role value")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	staffMember, err := s.Repos.Staff.GetStaffByID(accID)
+	staffMember, err := s.Repos.Staff.GetStaffByID(r.Context(), accID)
 	if err != nil || staffMember == nil {
 		utils.PrintError(err, "failed to get staff by ID")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	before := *staffMember
 	staffMember.Role = models.StaffRole(reqBody.Role)
 	// Keep legacy flag aligned until templates are updated
-	staffMember.IsAdmin = staffMember.Role >= models.Manager
-	s.Repos.Staff.SaveStaffMember(*staffMember)
+	staffMember.IsAdmin = staffMember.Can(models.PermStaffManage)
+	if err := s.Repos.Staff.SaveStaffMember(r.Context(), *staffMember); err != nil {
+		utils.PrintError(err, "Failed to save staff role")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
 	thisStaff := s.GetSessionUser(w, r)
 	if thisStaff == nil {
 		return
 	}
-	week, err := s.Repos.RosterWeek.LoadRosterWeek(thisStaff.Config.RosterDateOffset)
+	s.recordAudit(r.Context(), *thisStaff, models.AuditSetRole, models.AuditEntityStaff, accID, makeAuditStaff(before), makeAuditStaff(*staffMember))
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(r.Context(), thisStaff.Config.RosterDateOffset)
 	if err != nil {
 		utils.PrintError(err, "Failed to load roster week")
 		return
 	}
-	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(*thisStaff, *week))
+	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(r.Context(), *thisStaff, *week))
 }
 
 type ToggleHiddenBody struct {
@@ -482,41 +537,45 @@ func (s *Server) HandleToggleHidden(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	staffMember, err := s.Repos.Staff.GetStaffByID(accID)
+	staffMember, err := s.Repos.Staff.GetStaffByID(r.Context(), accID)
+	var before models.StaffMember
+	saved := false
 	if err != nil {
 		utils.PrintError(err, "failed to get staff by ID")
 	} else {
+		before = *staffMember
 		staffMember.IsHidden = !staffMember.IsHidden
-		s.Repos.Staff.SaveStaffMember(*staffMember)
+		saved = s.Repos.Staff.SaveStaffMember(r.Context(), *staffMember) == nil
 	}
 	thisStaff := s.GetSessionUser(w, r)
 	if thisStaff == nil {
 		return
 	}
-	week, err := s.Repos.RosterWeek.LoadRosterWeek(thisStaff.Config.RosterDateOffset)
+	if saved {
+		s.recordAudit(r.Context(), *thisStaff, models.AuditToggleHidden, models.AuditEntityStaff, accID, makeAuditStaff(before), makeAuditStaff(*staffMember))
+	}
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(r.Context(), thisStaff.Config.RosterDateOffset)
 	if err != nil {
 		utils.PrintError(err, "Failed to load roster week")
 		return
 	}
 	for _, day := range week.Days {
 		for _, row := range day.Rows {
-			if row.Early.AssignedStaff != nil && *row.Early.AssignedStaff == accID {
-				row.Early.AssignedStaff = nil
-				row.Early.StaffString = nil
-			}
-			if row.Mid.AssignedStaff != nil && *row.Mid.AssignedStaff == accID {
-				row.Mid.AssignedStaff = nil
-				row.Mid.StaffString = nil
-			}
-			if row.Late.AssignedStaff != nil && *row.Late.AssignedStaff == accID {
-				row.Late.AssignedStaff = nil
-				row.Late.StaffString = nil
+			for i := range row.Slots {
+				if row.Slots[i].HasThisStaff(accID) {
+					row.Slots[i].AssignedStaff = nil
+					row.Slots[i].StaffString = nil
+				}
 			}
 		}
 	}
 
-	s.Repos.RosterWeek.SaveRosterWeek(week)
-	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(*thisStaff, *week))
+	// Hiding applies to whatever is currently rostered, so the client's
+	// revision is not checked here.
+	if !s.saveRosterWeek(w, r, *thisStaff, week) {
+		return
+	}
+	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(r.Context(), *thisStaff, *week))
 }
 
 func (s *Server) HandleToggleHideByIdeal(w http.ResponseWriter, r *http.Request) {
@@ -525,13 +584,13 @@ func (s *Server) HandleToggleHideByIdeal(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	thisStaff.Config.HideByIdeal = !thisStaff.Config.HideByIdeal
-	s.Repos.Staff.SaveStaffMember(*thisStaff)
-	week, err := s.Repos.RosterWeek.LoadRosterWeek(thisStaff.Config.RosterDateOffset)
+	s.Repos.Staff.SaveStaffMember(r.Context(), *thisStaff)
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(r.Context(), thisStaff.Config.RosterDateOffset)
 	if err != nil {
 		utils.PrintError(err, "Failed to load roster week")
 		return
 	}
-	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(*thisStaff, *week))
+	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(r.Context(), *thisStaff, *week))
 }
 
 func (s *Server) HandleToggleHideByPreferences(w http.ResponseWriter, r *http.Request) {
@@ -540,13 +599,13 @@ func (s *Server) HandleToggleHideByPreferences(w http.ResponseWriter, r *http.Re
 		return
 	}
 	thisStaff.Config.HideByPrefs = !thisStaff.Config.HideByPrefs
-	s.Repos.Staff.SaveStaffMember(*thisStaff)
-	week, err := s.Repos.RosterWeek.LoadRosterWeek(thisStaff.Config.RosterDateOffset)
+	s.Repos.Staff.SaveStaffMember(r.Context(), *thisStaff)
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(r.Context(), thisStaff.Config.RosterDateOffset)
 	if err != nil {
 		utils.PrintError(err, "Failed to load roster week")
 		return
 	}
-	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(*thisStaff, *week))
+	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(r.Context(), *thisStaff, *week))
 }
 
 func (s *Server) HandleToggleHideByLeave(w http.ResponseWriter, r *http.Request) {
@@ -555,13 +614,13 @@ func (s *Server) HandleToggleHideByLeave(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	thisStaff.Config.HideByLeave = !thisStaff.Config.HideByLeave
-	s.Repos.Staff.SaveStaffMember(*thisStaff)
-	week, err := s.Repos.RosterWeek.LoadRosterWeek(thisStaff.Config.RosterDateOffset)
+	s.Repos.Staff.SaveStaffMember(r.Context(), *thisStaff)
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(r.Context(), thisStaff.Config.RosterDateOffset)
 	if err != nil {
 		utils.PrintError(err, "Failed to load roster week")
 		return
 	}
-	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(*thisStaff, *week))
+	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(r.Context(), *thisStaff, *week))
 }
 
 func (s *Server) HandleToggleHideStaffList(w http.ResponseWriter, r *http.Request) {
@@ -570,13 +629,13 @@ func (s *Server) HandleToggleHideStaffList(w http.ResponseWriter, r *http.Reques
 		return
 	}
 	thisStaff.Config.HideStaffList = !thisStaff.Config.HideStaffList
-	s.Repos.Staff.SaveStaffMember(*thisStaff)
-	week, err := s.Repos.RosterWeek.LoadRosterWeek(thisStaff.Config.RosterDateOffset)
+	s.Repos.Staff.SaveStaffMember(r.Context(), *thisStaff)
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(r.Context(), thisStaff.Config.RosterDateOffset)
 	if err != nil {
 		utils.PrintError(err, "Failed to load roster week")
 		return
 	}
-	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(*thisStaff, *week))
+	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(r.Context(), *thisStaff, *week))
 }
 
 func (s *Server) HandleToggleLive(w http.ResponseWriter, r *http.Request) {
@@ -584,14 +643,18 @@ func (s *Server) HandleToggleLive(w http.ResponseWriter, r *http.Request) {
 	if thisStaff == nil {
 		return
 	}
-	week, err := s.Repos.RosterWeek.LoadRosterWeek(thisStaff.Config.RosterDateOffset)
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(r.Context(), thisStaff.Config.RosterDateOffset)
 	if err != nil {
 		utils.PrintError(err, "Failed to load roster week")
 		return
 	}
 	week.IsLive = !week.IsLive
-	s.Repos.RosterWeek.SaveRosterWeek(week)
-	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(*thisStaff, *week))
+	if !s.saveClientRosterWeek(w, r, *thisStaff, week) {
+		return
+	}
+	s.recordAudit(r.Context(), *thisStaff, models.AuditToggleLive, models.AuditEntityRoster, week.ID,
+		map[string]bool{"IsLive": !week.IsLive}, map[string]bool{"IsLive": week.IsLive})
+	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(r.Context(), *thisStaff, *week))
 }
 
 type ToggleClosedBody struct {
@@ -613,7 +676,7 @@ func (s *Server) HandleToggleClosed(w http.ResponseWriter, r *http.Request) {
 	if thisStaff == nil {
 		return
 	}
-	week, err := s.Repos.RosterWeek.LoadRosterWeek(thisStaff.Config.RosterDateOffset)
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(r.Context(), thisStaff.Config.RosterDateOffset)
 	if err != nil {
 		utils.PrintError(err, "Failed to load roster week")
 		w.WriteHeader(http.StatusBadRequest)
@@ -626,8 +689,12 @@ func (s *Server) HandleToggleClosed(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	day.IsClosed = !day.IsClosed
-	s.Repos.RosterWeek.SaveRosterWeek(week)
-	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(*thisStaff, *week))
+	if !s.saveClientRosterWeek(w, r, *thisStaff, week) {
+		return
+	}
+	s.recordAudit(r.Context(), *thisStaff, models.AuditToggleClosed, models.AuditEntityRoster, dayID,
+		map[string]bool{"IsClosed": !day.IsClosed}, map[string]bool{"IsClosed": day.IsClosed})
+	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(r.Context(), *thisStaff, *week))
 }
 
 type AddTrialBody struct {
@@ -639,19 +706,24 @@ func (s *Server) HandleAddTrial(w http.ResponseWriter, r *http.Request) {
 	if err := ReadAndUnmarshal(w, r, &reqBody); err != nil {
 		return
 	}
-	s.Repos.Staff.CreateTrial(reqBody.Name)
+	err := s.Repos.Staff.CreateTrial(r.Context(), reqBody.Name)
 	thisStaff := s.GetSessionUser(w, r)
 	if thisStaff == nil {
 		// TODO: Handle error, also loading the roster week below
 		return
 	}
-	week, err := s.Repos.RosterWeek.LoadRosterWeek(thisStaff.Config.RosterDateOffset)
+	if err == nil {
+		// CreateTrial doesn't return the new ID, so only the name is recorded.
+		s.recordAudit(r.Context(), *thisStaff, models.AuditAddTrial, models.AuditEntityStaff, uuid.Nil,
+			nil, map[string]string{"FirstName": reqBody.Name})
+	}
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(r.Context(), thisStaff.Config.RosterDateOffset)
 	if err != nil {
 		utils.PrintError(err, "Failed to load roster week")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(*thisStaff, *week))
+	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(r.Context(), *thisStaff, *week))
 }
 
 type ShiftWindowBody struct {
@@ -673,16 +745,16 @@ func (s *Server) HandleShiftWindow(w http.ResponseWriter, r *http.Request) {
 	case "-":
 		thisStaff.Config.RosterDateOffset = thisStaff.Config.RosterDateOffset - 1
 	default:
-		thisStaff.Config.RosterDateOffset = utils.WeekOffsetFromDate(utils.GetLastTuesday())
+		thisStaff.Config.RosterDateOffset = utils.WeekOffsetFromDate(utils.GetWeekStart())
 	}
-	s.Repos.Staff.SaveStaffMember(*thisStaff)
-	week, err := s.Repos.RosterWeek.LoadRosterWeek(thisStaff.Config.RosterDateOffset)
+	s.Repos.Staff.SaveStaffMember(r.Context(), *thisStaff)
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(r.Context(), thisStaff.Config.RosterDateOffset)
 	if err != nil {
 		utils.PrintError(err, "Failed to load roster week")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(*thisStaff, *week))
+	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(r.Context(), *thisStaff, *week))
 }
 
 type ModifyRowsBody struct {
@@ -707,14 +779,29 @@ func (s *Server) HandleModifyRows(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newDay, isLive, err := s.Repos.RosterWeek.ChangeDayRowCount(thisStaff.Config.RosterDateOffset, dayID, reqBody.Action)
+	var rowsBefore int
+	if week, err := s.Repos.RosterWeek.LoadRosterWeek(r.Context(), thisStaff.Config.RosterDateOffset); err == nil {
+		if day := week.GetDayByID(dayID); day != nil {
+			rowsBefore = len(day.Rows)
+		}
+	}
+	newDay, isLive, err := s.Repos.RosterWeek.ChangeDayRowCount(r.Context(), thisStaff.Config.RosterDateOffset, dayID, reqBody.Action)
 	if err != nil {
 		utils.PrintError(err, "Failed to change day row count")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	s.recordAudit(r.Context(), *thisStaff, models.AuditChangeRows, models.AuditEntityRoster, dayID,
+		map[string]int{"Rows": rowsBefore}, map[string]int{"Rows": len(newDay.Rows)})
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(r.Context(), thisStaff.Config.RosterDateOffset)
+	if err != nil {
+		utils.PrintError(err, "Failed to load roster week")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
-	s.renderTemplate(w, "rosterDay", MakeDayStruct(isLive, *newDay, s, *thisStaff))
+	s.renderTemplate(w, "rosterDay", MakeDayStruct(r.Context(), isLive, *newDay, s, *thisStaff))
+	s.renderRevisionIfCurrent(w, r, week.Revision)
 }
 
 func duplicateRosterWeek(src models.RosterWeek, newWeek models.RosterWeek) models.RosterWeek {
@@ -729,17 +816,16 @@ func duplicateRosterWeek(src models.RosterWeek, newWeek models.RosterWeek) model
 			Rows:     []*models.Row{},
 		}
 		for _, row := range day.Rows {
-			newRow := &models.Row{
-				ID:    uuid.New(),
-				Early: duplicateSlot(row.Early),
-				Mid:   duplicateSlot(row.Mid),
-				Late:  duplicateSlot(row.Late),
+			newRow := &models.Row{ID: uuid.New(), Slots: []models.Slot{}}
+			for _, slot := range row.Slots {
+				newRow.Slots = append(newRow.Slots, duplicateSlot(slot))
 			}
 			newDay.Rows = append(newDay.Rows, newRow)
 		}
 		newDays = append(newDays, &newDay)
 	}
 	newWeek.Days = newDays
+	newWeek.Slots = append([]models.SlotDefinition{}, src.Slots...)
 
 	return newWeek
 }
@@ -759,6 +845,7 @@ func duplicateSlot(src models.Slot) models.Slot {
 
 	return models.Slot{
 		ID:            uuid.New(),
+		Name:          src.Name,
 		StartTime:     src.StartTime,
 		AssignedStaff: newAssignedStaff,
 		StaffString:   newStaffString,
@@ -812,18 +899,6 @@ type ShiftHours struct {
 	Deliveries float64
 }
 
-type DayIdx int
-
-const (
-	Tuesday DayIdx = iota
-	Wednesday
-	Thursday
-	Friday
-	Saturday
-	Sunday
-	Monday
-)
-
 type PayLevel int
 
 const (
@@ -833,6 +908,8 @@ const (
 	Level5
 )
 
+// StaffPayData holds a week of hours at each pay level, indexed by
+// time.Weekday.
 type StaffPayData struct {
 	Level2Hrs [7]DayBreakdown
 	Level3Hrs [7]DayBreakdown
@@ -862,11 +939,11 @@ func ApplyEntryToLevel(dayBreakdown DayBreakdown, thisDate time.Time, entry mode
 	return dayBreakdown
 }
 
-func AddEntryToPaydata(entry models.TimesheetEntry, thisDate time.Time, day DayIdx, payData StaffPayData) StaffPayData {
+func AddEntryToPaydata(entry models.TimesheetEntry, thisDate time.Time, day time.Weekday, payData StaffPayData) StaffPayData {
 	if entry.ShiftType == models.Bar || entry.ShiftType == models.Deliveries || entry.ShiftType == models.Admin {
 		payData.Level2Hrs[day] = ApplyEntryToLevel(payData.Level2Hrs[day], thisDate, entry)
 	} else if entry.ShiftType == models.DayManager {
-		if day != Friday && day != Saturday && day != Sunday {
+		if day != time.Friday && day != time.Saturday && day != time.Sunday {
 			payData.Level3Hrs[day] = ApplyEntryToLevel(payData.Level3Hrs[day], thisDate, entry)
 		} else {
 			// day == Friday, Saturday or Sunday
@@ -891,7 +968,7 @@ func (s *Server) getSessionUserAndEntries(w http.ResponseWriter, r *http.Request
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return nil, nil, false
 	}
-	entries, err := s.Repos.Timesheet.GetTimesheetWeek(thisStaff.Config.TimesheetDateOffset)
+	entries, err := s.Repos.Timesheet.GetTimesheetWeek(r.Context(), thisStaff.Config.TimesheetDateOffset)
 	if err != nil {
 		utils.PrintError(err, "No timesheet entries to export")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -901,15 +978,17 @@ func (s *Server) getSessionUserAndEntries(w http.ResponseWriter, r *http.Request
 }
 
 func writeRecordsToCSV(staffData map[uuid.UUID]StaffPayData, allStaff []*models.StaffMember, writer *csv.Writer, reportType string) {
-	header := []string{
-		"Employee",
-		"Tues Ord", "Tues 7-12", "Tues 12+",
-		"Wed Ord", "Wed 7-12", "Wed 12+",
-		"Thurs Ord", "Thurs 7-12", "Thurs 12+",
-		"Fri Ord", "Fri 7-12", "Fri 12+",
-		"Sat Ord", "Sat 12+",
-		"Sun Ord",
-		"Mon Ord", "Mon 7-12", "Mon 12+",
+	header := []string{"Employee"}
+	for _, day := range utils.WeekDays() {
+		name := utils.ShortDayName(day)
+		switch day {
+		case time.Saturday:
+			header = append(header, name+" Ord", name+" 12+")
+		case time.Sunday:
+			header = append(header, name+" Ord")
+		default:
+			header = append(header, name+" Ord", name+" 7-12", name+" 12+")
+		}
 	}
 	if err := writer.Write(header); err != nil {
 		utils.PrintError(err, "Error writing kitchen report header")
@@ -961,8 +1040,8 @@ func processEntries(thisStaff models.StaffMember, entries []*models.TimesheetEnt
 
 	startOfWeekUTC := utils.WeekStartFromOffset(thisStaff.Config.TimesheetDateOffset)
 
-	for day := Tuesday; day <= 6; day++ {
-		currentDayUTC := startOfWeekUTC.AddDate(0, 0, int(day))
+	for i := 0; i <= 6; i++ {
+		currentDayUTC := startOfWeekUTC.AddDate(0, 0, i)
 		// Convert to Local Time (00:00 Local) to ensure windows align with shifts which are stored in Local Time
 		thisDate := time.Date(
 			currentDayUTC.Year(),
@@ -987,7 +1066,7 @@ func processEntries(thisStaff models.StaffMember, entries []*models.TimesheetEnt
 				payData = StaffPayData{}
 				staffData[entry.StaffID] = payData
 			}
-			staffData[entry.StaffID] = AddEntryToPaydata(*entry, thisDate, day, payData)
+			staffData[entry.StaffID] = AddEntryToPaydata(*entry, thisDate, currentDayUTC.Weekday(), payData)
 		}
 	}
 	return staffData
@@ -999,7 +1078,7 @@ func (s *Server) HandleExportKitchenReport(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	allStaff, err := s.Repos.Staff.LoadAllStaff()
+	allStaff, err := s.Repos.Staff.LoadAllStaff(r.Context())
 	if err != nil {
 		utils.PrintError(err, "Failed to load all staff")
 		allStaff = []*models.StaffMember{}
@@ -1034,7 +1113,7 @@ func (s *Server) HandleExportEvanReport(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	allStaff, err := s.Repos.Staff.LoadAllStaff()
+	allStaff, err := s.Repos.Staff.LoadAllStaff(r.Context())
 	if err != nil {
 		utils.PrintError(err, "Failed to load all staff")
 		allStaff = []*models.StaffMember{}
@@ -1072,37 +1151,34 @@ func hasHours(hours [7]DayBreakdown) bool {
 	return false
 }
 
+// BuildReportRecord returns name's row of a report, with columns in the same
+// order as writeRecordsToCSV's header. Saturday's evening hours are paid as
+// ordinary hours and all of Sunday is paid the same.
 func BuildReportRecord(hours [7]DayBreakdown, name string) []string {
-	return []string{
-		name,
-		fmt.Sprintf("%.2f", hours[Tuesday].OrdinaryHrs),
-		fmt.Sprintf("%.2f", hours[Tuesday].EveningHrs),
-		fmt.Sprintf("%.2f", hours[Tuesday].After12Hrs),
-
-		fmt.Sprintf("%.2f", hours[Wednesday].OrdinaryHrs),
-		fmt.Sprintf("%.2f", hours[Wednesday].EveningHrs),
-		fmt.Sprintf("%.2f", hours[Wednesday].After12Hrs),
-
-		fmt.Sprintf("%.2f", hours[Thursday].OrdinaryHrs),
-		fmt.Sprintf("%.2f", hours[Thursday].EveningHrs),
-		fmt.Sprintf("%.2f", hours[Thursday].After12Hrs),
-
-		fmt.Sprintf("%.2f", hours[Friday].OrdinaryHrs),
-		fmt.Sprintf("%.2f", hours[Friday].EveningHrs),
-		fmt.Sprintf("%.2f", hours[Friday].After12Hrs),
-
-		fmt.Sprintf("%.2f", hours[Saturday].OrdinaryHrs+
-			hours[Saturday].EveningHrs),
-		fmt.Sprintf("%.2f", hours[Saturday].After12Hrs),
-
-		fmt.Sprintf("%.2f", hours[Sunday].OrdinaryHrs+
-			hours[Sunday].EveningHrs+
-			hours[Sunday].After12Hrs),
-
-		fmt.Sprintf("%.2f", hours[Monday].OrdinaryHrs),
-		fmt.Sprintf("%.2f", hours[Monday].EveningHrs),
-		fmt.Sprintf("%.2f", hours[Monday].After12Hrs),
+	record := []string{name}
+	for _, day := range utils.WeekDays() {
+		switch day {
+		case time.Saturday:
+			record = append(record,
+				fmt.Sprintf("%.2f", hours[day].OrdinaryHrs+
+					hours[day].EveningHrs),
+				fmt.Sprintf("%.2f", hours[day].After12Hrs),
+			)
+		case time.Sunday:
+			record = append(record,
+				fmt.Sprintf("%.2f", hours[day].OrdinaryHrs+
+					hours[day].EveningHrs+
+					hours[day].After12Hrs),
+			)
+		default:
+			record = append(record,
+				fmt.Sprintf("%.2f", hours[day].OrdinaryHrs),
+				fmt.Sprintf("%.2f", hours[day].EveningHrs),
+				fmt.Sprintf("%.2f", hours[day].After12Hrs),
+			)
+		}
 	}
+	return record
 }
 
 func (s *Server) HandleExportWageReport(w http.ResponseWriter, r *http.Request) {
@@ -1112,7 +1188,7 @@ func (s *Server) HandleExportWageReport(w http.ResponseWriter, r *http.Request)
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
-	entries, err := s.Repos.Timesheet.GetTimesheetWeek(thisStaff.Config.TimesheetDateOffset)
+	entries, err := s.Repos.Timesheet.GetTimesheetWeek(r.Context(), thisStaff.Config.TimesheetDateOffset)
 	if err != nil {
 		utils.PrintError(err, "No timesheet entries to export")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -1248,13 +1324,13 @@ func (s *Server) HandleImportRosterWeek(w http.ResponseWriter, r *http.Request)
 	if thisStaff == nil {
 		return
 	}
-	lastWeek, err := s.Repos.RosterWeek.LoadRosterWeek(thisStaff.Config.RosterDateOffset - 1)
+	lastWeek, err := s.Repos.RosterWeek.LoadRosterWeek(r.Context(), thisStaff.Config.RosterDateOffset-1)
 	if err != nil {
 		utils.PrintError(err, "Couldn't load last week")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
-	thisWeek, err := s.Repos.RosterWeek.LoadRosterWeek(thisStaff.Config.RosterDateOffset)
+	thisWeek, err := s.Repos.RosterWeek.LoadRosterWeek(r.Context(), thisStaff.Config.RosterDateOffset)
 	if err != nil {
 		utils.PrintError(err, "Couldn't load this week")
 		thisWeek = &models.RosterWeek{
@@ -1262,23 +1338,27 @@ func (s *Server) HandleImportRosterWeek(w http.ResponseWriter, r *http.Request)
 			WeekOffset: thisStaff.Config.RosterDateOffset,
 		}
 	}
+	before := *thisWeek
 	newWeek := duplicateRosterWeek(*lastWeek, *thisWeek)
 	thisWeek = &newWeek
-	s.Repos.RosterWeek.SaveRosterWeek(thisWeek)
-	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(*thisStaff, *thisWeek))
+	if !s.saveClientRosterWeek(w, r, *thisStaff, thisWeek) {
+		return
+	}
+	s.recordAudit(r.Context(), *thisStaff, models.AuditImportWeek, models.AuditEntityRoster, thisWeek.ID, before, thisWeek)
+	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(r.Context(), *thisStaff, *thisWeek))
 }
 
-func (s *Server) GetPayWeekForStaff(staffID uuid.UUID, weekOffset int) StaffPayData {
+func (s *Server) GetPayWeekForStaff(ctx context.Context, staffID uuid.UUID, weekOffset int) StaffPayData {
 	payData := StaffPayData{}
-	entries, err := s.Repos.Timesheet.GetStaffTimesheetWeek(staffID, weekOffset)
+	entries, err := s.Repos.Timesheet.GetStaffTimesheetWeek(ctx, staffID, weekOffset)
 	startDate := utils.WeekStartFromOffset(weekOffset)
 	if err != nil {
 		utils.PrintError(err, "Error getting timesheet entries")
 		emptyEntries := []*repository.TimesheetEntry{}
 		entries = &emptyEntries
 	}
-	for day := Tuesday; day <= 6; day++ {
-		currentDayUTC := startDate.AddDate(0, 0, int(day))
+	for i := 0; i <= 6; i++ {
+		currentDayUTC := startDate.AddDate(0, 0, i)
 		thisDate := time.Date(
 			currentDayUTC.Year(),
 			currentDayUTC.Month(),
@@ -1288,7 +1368,7 @@ func (s *Server) GetPayWeekForStaff(staffID uuid.UUID, weekOffset int) StaffPayD
 		)
 		for _, entry := range *entries {
 			if entry.Approved {
-				payData = AddEntryToPaydata(*entry, thisDate, day, payData)
+				payData = AddEntryToPaydata(*entry, thisDate, currentDayUTC.Weekday(), payData)
 			}
 		}
 	}
@@ -1306,10 +1386,10 @@ func AddLevelSummary(paySummary StaffPaySummary, breakdown [7]DayBreakdown, leve
 		paySummary.TotalHrs += day.EveningHrs
 		paySummary.TotalHrs += day.After12Hrs
 
-		dayIdx := DayIdx(i)
-		if dayIdx == Saturday {
+		weekday := time.Weekday(i)
+		if weekday == time.Saturday {
 			paySummary.PayEstimate += (day.OrdinaryHrs + day.EveningHrs + day.After12Hrs) * levelPay * SAT_PAY_MULT
-		} else if dayIdx == Sunday {
+		} else if weekday == time.Sunday {
 			paySummary.PayEstimate += (day.OrdinaryHrs + day.EveningHrs + day.After12Hrs) * levelPay * SUN_PAY_MULT
 		} else {
 			paySummary.PayEstimate += day.OrdinaryHrs * levelPay * WEEK_PAY_MULT
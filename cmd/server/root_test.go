@@ -1,43 +1,63 @@
 package server
 
 import (
+	"bytes"
 	"context"
+	"encoding/csv"
 	"html/template"
+	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"roster/cmd/models"
+	"roster/cmd/repository"
 	"roster/cmd/utils"
 )
 
 // simple fake staff repository for testing
 // fakeStaffRepo implements repository.StaffRepository for testing
 type fakeStaffRepo struct {
-	staff       []*models.StaffMember
-	tokenToUser map[uuid.UUID]*models.StaffMember
+	staff []*models.StaffMember
 }
 
-func (f *fakeStaffRepo) SaveStaffMember(staff models.StaffMember) error         { return nil }
-func (f *fakeStaffRepo) SaveStaffMembers(staff []*models.StaffMember) error     { return nil }
-func (f *fakeStaffRepo) LoadAllStaff() ([]*models.StaffMember, error)           { return f.staff, nil }
-func (f *fakeStaffRepo) GetStaffByGoogleID(string) (*models.StaffMember, error) { return nil, nil }
-func (f *fakeStaffRepo) GetStaffByID(uuid.UUID) (*models.StaffMember, error)    { return nil, nil }
-func (f *fakeStaffRepo) GetStaffByToken(token uuid.UUID) (*models.StaffMember, error) {
-	if s, ok := f.tokenToUser[token]; ok {
-		return s, nil
-	}
+func (f *fakeStaffRepo) SaveStaffMember(ctx context.Context, staff models.StaffMember) error {
+	return nil
+}
+func (f *fakeStaffRepo) SaveStaffMembers(ctx context.Context, staff []*models.StaffMember) error {
+	return nil
+}
+func (f *fakeStaffRepo) LoadAllStaff(ctx context.Context) ([]*models.StaffMember, error) {
+	return f.staff, nil
+}
+func (f *fakeStaffRepo) LoadAllStaffRecords(ctx context.Context) ([]*models.StaffMember, error) {
+	return f.staff, nil
+}
+func (f *fakeStaffRepo) GetStaffByIdentity(context.Context, models.Identity) (*models.StaffMember, error) {
 	return nil, nil
 }
-func (f *fakeStaffRepo) RefreshStaffConfig(s models.StaffMember) (models.StaffMember, error) {
+func (f *fakeStaffRepo) GetStaffByEmail(context.Context, string) (*models.StaffMember, error) {
+	return nil, nil
+}
+func (f *fakeStaffRepo) GetStaffByID(ctx context.Context, id uuid.UUID) (*models.StaffMember, error) {
+	return models.GetStaffFromList(id, f.staff), nil
+}
+func (f *fakeStaffRepo) RefreshStaffConfig(ctx context.Context, s models.StaffMember) (models.StaffMember, error) {
 	return s, nil
 }
-func (f *fakeStaffRepo) UpdateStaffToken(*models.StaffMember, uuid.UUID) error       { return nil }
-func (f *fakeStaffRepo) CreateStaffMember(string, uuid.UUID) error                   { return nil }
-func (f *fakeStaffRepo) DeleteLeaveReqByID(models.StaffMember, uuid.UUID) error      { return nil }
-func (f *fakeStaffRepo) GetStaffByLeaveReqID(uuid.UUID) (*models.StaffMember, error) { return nil, nil }
-func (f *fakeStaffRepo) CreateTrial(string) error                                    { return nil }
-func (f *fakeStaffRepo) DeleteStaffByID(uuid.UUID) error                             { return nil }
+func (f *fakeStaffRepo) CreateStaffMember(context.Context, models.Identity) (*models.StaffMember, error) {
+	return nil, nil
+}
+func (f *fakeStaffRepo) DeleteLeaveReqByID(context.Context, models.StaffMember, uuid.UUID) error {
+	return nil
+}
+func (f *fakeStaffRepo) GetStaffByLeaveReqID(context.Context, uuid.UUID) (*models.StaffMember, error) {
+	return nil, nil
+}
+func (f *fakeStaffRepo) CreateTrial(context.Context, string) error        { return nil }
+func (f *fakeStaffRepo) DeleteStaffByID(context.Context, uuid.UUID) error { return nil }
 
 // simple fake roster week repository for testing
 type fakeRosterWeekRepo struct {
@@ -45,14 +65,18 @@ type fakeRosterWeekRepo struct {
 	saved []*models.RosterWeek
 }
 
-func (f *fakeRosterWeekRepo) SaveRosterWeek(week *models.RosterWeek) error {
+func (f *fakeRosterWeekRepo) SaveRosterWeek(ctx context.Context, week *models.RosterWeek) error {
 	f.saved = append(f.saved, week)
 	f.weeks[week.WeekOffset] = week
 	return nil
 }
-func (f *fakeRosterWeekRepo) SaveAllRosterWeeks(weeks []*models.RosterWeek) error { return nil }
-func (f *fakeRosterWeekRepo) LoadAllRosterWeeks() ([]*models.RosterWeek, error)   { return nil, nil }
-func (f *fakeRosterWeekRepo) LoadRosterWeek(weekOffset int) (*models.RosterWeek, error) {
+func (f *fakeRosterWeekRepo) SaveAllRosterWeeks(ctx context.Context, weeks []*models.RosterWeek) error {
+	return nil
+}
+func (f *fakeRosterWeekRepo) LoadAllRosterWeeks(ctx context.Context) ([]*models.RosterWeek, error) {
+	return nil, nil
+}
+func (f *fakeRosterWeekRepo) LoadRosterWeek(ctx context.Context, weekOffset int) (*models.RosterWeek, error) {
 	if week, ok := f.weeks[weekOffset]; ok {
 		return week, nil
 	}
@@ -65,9 +89,25 @@ func (f *fakeRosterWeekRepo) LoadRosterWeek(weekOffset int) (*models.RosterWeek,
 	f.weeks[weekOffset] = newWeek
 	return newWeek, nil
 }
-func (f *fakeRosterWeekRepo) ChangeDayRowCount(weekOffset int, dayID uuid.UUID, action string) (*models.RosterDay, bool, error) {
+
+func (f *fakeRosterWeekRepo) GetRosterWeek(ctx context.Context, weekOffset int) (*models.RosterWeek, error) {
+	if week, ok := f.weeks[weekOffset]; ok {
+		return week, nil
+	}
+	return nil, repository.ErrNotFound
+}
+func (f *fakeRosterWeekRepo) ChangeDayRowCount(ctx context.Context, weekOffset int, dayID uuid.UUID, action string) (*models.RosterDay, bool, error) {
 	return nil, false, nil
 }
+func (f *fakeRosterWeekRepo) UpdateSlotAssignment(context.Context, int, uuid.UUID, *uuid.UUID, *string) (int, error) {
+	return 0, nil
+}
+func (f *fakeRosterWeekRepo) UpdateSlotStartTime(context.Context, int, uuid.UUID, string) (int, error) {
+	return 0, nil
+}
+func (f *fakeRosterWeekRepo) UpdateSlotDescription(context.Context, int, uuid.UUID, string) (int, error) {
+	return 0, nil
+}
 
 // Test MemberIsAssigned returns true when IDs match, false otherwise.
 func TestMemberIsAssigned(t *testing.T) {
@@ -91,12 +131,12 @@ func TestMakeRootStruct(t *testing.T) {
 	s1 := &models.StaffMember{ID: uuid.New()}
 	s2 := &models.StaffMember{ID: uuid.New()}
 	fakeRepo := &fakeStaffRepo{staff: []*models.StaffMember{s1, s2}}
-	srv := &Server{Repos: Repositories{Staff: fakeRepo}}
+	srv := &Server{Repos: Repositories{Staff: fakeRepo, RosterWeek: &fakeRosterWeekRepo{weeks: map[int]*models.RosterWeek{}}}}
 	// make dummy week
 	wk := models.RosterWeek{ID: uuid.New(), WeekOffset: 2}
 	// active staff
 	active := models.StaffMember{ID: s1.ID}
-	root := srv.MakeRootStruct(active, wk)
+	root := srv.MakeRootStruct(context.Background(), active, wk)
 	// pointer to server
 	if root.Server != srv {
 		t.Error("MakeRootStruct: Server pointer not set correctly")
@@ -112,6 +152,76 @@ func TestMakeRootStruct(t *testing.T) {
 	}
 }
 
+// Test the roster is checked against the weeks either side, and every rule a
+// slot breaks is shown in its tooltip and the week's issues.
+func TestMakeRootStruct_ChecksRules(t *testing.T) {
+	s := newMemoryServer(t)
+	staff, token := newTestSession(t, s)
+	ctx := context.Background()
+	offset := staff.Config.RosterDateOffset
+	previous, err := s.Repos.RosterWeek.LoadRosterWeek(ctx, offset-1)
+	if err != nil {
+		t.Fatalf("LoadRosterWeek: %v", err)
+	}
+	late := &previous.Days[6].Rows[0].Slots[len(previous.Slots)-1]
+	late.AssignedStaff = &staff.ID
+	if err := s.Repos.RosterWeek.SaveRosterWeek(ctx, previous); err != nil {
+		t.Fatalf("SaveRosterWeek: %v", err)
+	}
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(ctx, offset)
+	if err != nil {
+		t.Fatalf("LoadRosterWeek: %v", err)
+	}
+	week.Days[0].Rows[0].Slots[0].AssignedStaff = &staff.ID
+	if err := s.Repos.RosterWeek.SaveRosterWeek(ctx, week); err != nil {
+		t.Fatalf("SaveRosterWeek: %v", err)
+	}
+
+	rec := serveWithSession(s, s.VerifySession(s.HandleIndex), "GET", "/", "", token)
+	if !strings.Contains(rec.Body.String(), " "+late.Name+" the night before") {
+		t.Errorf("expected the late shift the week before to be flagged, got %s", rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "roster issue") || !strings.Contains(rec.Body.String(), `href="#s-`+week.Days[0].Rows[0].Slots[0].ID.String()) {
+		t.Error("expected the issues panel to link to the flagged slot")
+	}
+	if _, err := s.Repos.RosterWeek.GetRosterWeek(ctx, offset+1); err == nil {
+		t.Error("expected checking the roster not to create the next week")
+	}
+}
+
+// Test assigning a slot only writes the assignment, and an unknown staff
+// member is rejected.
+func TestHandleModifySlot(t *testing.T) {
+	s := newMemoryServer(t)
+	staff, token := newTestSession(t, s)
+	ctx := context.Background()
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(ctx, staff.Config.RosterDateOffset)
+	if err != nil {
+		t.Fatalf("LoadRosterWeek: %v", err)
+	}
+	slotID := week.Days[0].Rows[0].Slots[0].ID
+
+	rec := serveWithSession(s, s.HandleModifySlot, "POST", "/modifySlot?slotID="+slotID.String()+"&staffID="+uuid.NewString(), "", token)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected an unknown staff member to be rejected with %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	rec = serveWithSession(s, s.HandleModifySlot, "POST", "/modifySlot?slotID="+slotID.String()+"&staffID="+staff.ID.String(), "", token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	stored, err := s.Repos.RosterWeek.GetRosterWeek(ctx, staff.Config.RosterDateOffset)
+	if err != nil {
+		t.Fatalf("GetRosterWeek: %v", err)
+	}
+	if slot := stored.GetSlotByID(slotID); slot.AssignedStaff == nil || *slot.AssignedStaff != staff.ID {
+		t.Errorf("expected the slot to be assigned, got %+v", slot)
+	}
+	if stored.Revision != week.Revision+1 {
+		t.Errorf("expected only the assignment to be saved, revision went from %d to %d", week.Revision, stored.Revision)
+	}
+}
+
 // Test MakeDayStruct sets date via RosterDateOffset and returns staff list
 func TestMakeDayStruct(t *testing.T) {
 	// fake staff
@@ -122,7 +232,7 @@ func TestMakeDayStruct(t *testing.T) {
 	active := models.StaffMember{ID: uuid.New(), Config: models.StaffConfig{RosterDateOffset: 1}}
 	// day with offset 3
 	day := models.RosterDay{ID: uuid.New(), Offset: 3}
-	ds := MakeDayStruct(true, day, srv, active)
+	ds := MakeDayStruct(context.Background(), true, day, srv, active)
 	// date should be WeekStartFromOffset(1) + 3 days
 	base := utils.WeekStartFromOffset(1)
 	wantDate := base.AddDate(0, 0, 3)
@@ -175,7 +285,6 @@ func TestHandleImportRosterWeek(t *testing.T) {
 			}
 
 			// Create active staff and session
-			sessionToken := uuid.New()
 			activeStaff := &models.StaffMember{
 				ID: uuid.New(),
 				Config: models.StaffConfig{
@@ -193,9 +302,6 @@ func TestHandleImportRosterWeek(t *testing.T) {
 			}
 			fakeStaffRepo := &fakeStaffRepo{
 				staff: []*models.StaffMember{activeStaff},
-				tokenToUser: map[uuid.UUID]*models.StaffMember{
-					sessionToken: activeStaff,
-				},
 			}
 
 			// Setup templates
@@ -211,6 +317,7 @@ func TestHandleImportRosterWeek(t *testing.T) {
 				Repos: Repositories{
 					RosterWeek: fakeRosterRepo,
 					Staff:      fakeStaffRepo,
+					Audit:      repository.NewMemoryAuditRepository(),
 				},
 				Templates: tmpl,
 			}
@@ -218,7 +325,7 @@ func TestHandleImportRosterWeek(t *testing.T) {
 			// Create request
 			req := httptest.NewRequest("POST", "/importRosterWeek", nil)
 			// Add session to context
-			ctx := context.WithValue(req.Context(), "sessionToken", sessionToken)
+			ctx := context.WithValue(req.Context(), SESSION_KEY, models.Session{StaffID: activeStaff.ID})
 			req = req.WithContext(ctx)
 
 			w := httptest.NewRecorder()
@@ -248,3 +355,29 @@ func TestHandleImportRosterWeek(t *testing.T) {
 		})
 	}
 }
+
+// Test report columns follow the week start, and weekend rates go to the
+// weekend whichever column it lands in.
+func TestWriteRecordsToCSV_WeekStart(t *testing.T) {
+	defer utils.SetWeekStart(utils.WeekStart())
+	utils.SetWeekStart(time.Monday)
+	staff := &models.StaffMember{ID: uuid.New(), FirstName: "Sam", LastName: "Lee"}
+	payData := StaffPayData{}
+	payData.Kitchen[time.Monday].OrdinaryHrs = 1
+	payData.Kitchen[time.Sunday].After12Hrs = 2
+
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	writeRecordsToCSV(map[uuid.UUID]StaffPayData{staff.ID: payData}, []*models.StaffMember{staff}, writer, "kitchen")
+	records, err := csv.NewReader(&buffer).ReadAll()
+	if err != nil || len(records) != 2 {
+		t.Fatalf("expected a header and one row, got %v, %v", records, err)
+	}
+	header, row := records[0], records[1]
+	if len(header) != len(row) || header[1] != "Mon Ord" || header[len(header)-1] != "Sun Ord" {
+		t.Errorf("expected columns from Monday to Sunday, got %v", header)
+	}
+	if row[1] != "1.00" || row[len(row)-1] != "2.00" {
+		t.Errorf("expected Monday and Sunday hours at either end, got %v", row)
+	}
+}
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"roster/cmd/models"
+	"roster/cmd/repository"
+	"roster/cmd/utils"
+
+	"github.com/google/uuid"
+)
+
+// RosterTemplates lists the saved templates that can be applied to the week.
+func (rs RootStruct) RosterTemplates() []*models.RosterTemplate {
+	templates, err := rs.Server.Repos.RosterTemplates.LoadAllRosterTemplates(rs.Ctx)
+	if err != nil {
+		utils.PrintError(err, "Failed to load roster templates")
+		return []*models.RosterTemplate{}
+	}
+	return templates
+}
+
+type RosterTemplatePreview struct {
+	RootStruct
+	Template models.RosterTemplate
+	// Dropped are the template's assignments that won't be applied.
+	Dropped []models.DroppedAssignment
+}
+
+// droppedNotice describes the assignments left out when a template was
+// applied.
+func droppedNotice(dropped []models.DroppedAssignment) string {
+	if len(dropped) == 0 {
+		return ""
+	}
+	parts := []string{}
+	for _, d := range dropped {
+		parts = append(parts, d.StaffName+" ("+d.DayName+" "+d.SlotName+", "+d.Reason+")")
+	}
+	return " Some assignments weren't applied because the staff member is hidden or deleted: " + strings.Join(parts, ", ")
+}
+
+// appliedTemplate is a roster week as it is with a template applied.
+type appliedTemplate struct {
+	Template models.RosterTemplate
+	Before   models.RosterWeek
+	Week     models.RosterWeek
+	Dropped  []models.DroppedAssignment
+}
+
+// applyRosterTemplate applies the template with ID templateID to the week
+// activeStaff is viewing, without saving it. It writes the response and
+// returns false on failure.
+func (s *Server) applyRosterTemplate(w http.ResponseWriter, r *http.Request, templateID string, activeStaff models.StaffMember) (*appliedTemplate, bool) {
+	id, err := uuid.Parse(templateID)
+	if err != nil {
+		utils.PrintError(err, "Invalid template ID")
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+	ctx := r.Context()
+	template, err := s.Repos.RosterTemplates.GetRosterTemplate(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		utils.PrintError(err, "Failed to load roster template")
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, false
+	}
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(ctx, activeStaff.Config.RosterDateOffset)
+	if err != nil {
+		utils.PrintError(err, "Failed to load roster week")
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, false
+	}
+	allStaff, err := s.Repos.Staff.LoadAllStaffRecords(ctx)
+	if err != nil {
+		utils.PrintError(err, "Failed to load all staff")
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, false
+	}
+	applied, dropped := template.Apply(*week, allStaff)
+	return &appliedTemplate{Template: *template, Before: *week, Week: applied, Dropped: dropped}, true
+}
+
+type SaveRosterTemplateBody struct {
+	Name               string `json:"name"`
+	IncludeAssignments string `json:"includeAssignments"`
+}
+
+// HandleSaveRosterTemplate saves the week being viewed as a named template.
+// Saving under the name of an existing template replaces it.
+func (s *Server) HandleSaveRosterTemplate(w http.ResponseWriter, r *http.Request) {
+	var reqBody SaveRosterTemplateBody
+	if err := ReadAndUnmarshal(w, r, &reqBody); err != nil {
+		return
+	}
+	name := strings.TrimSpace(reqBody.Name)
+	if name == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	thisStaff := s.GetSessionUser(w, r)
+	if thisStaff == nil {
+		return
+	}
+	ctx := r.Context()
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(ctx, thisStaff.Config.RosterDateOffset)
+	if err != nil {
+		utils.PrintError(err, "Failed to load roster week")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	existing, err := s.Repos.RosterTemplates.LoadAllRosterTemplates(ctx)
+	if err != nil {
+		utils.PrintError(err, "Failed to load roster templates")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	template := models.NewRosterTemplate(name, *week, reqBody.IncludeAssignments == "on", thisStaff.ID)
+	var before *models.RosterTemplate
+	for _, t := range existing {
+		if strings.EqualFold(t.Name, name) {
+			before = t
+			template.ID = t.ID
+		}
+	}
+	if err := s.Repos.RosterTemplates.SaveRosterTemplate(ctx, template); err != nil {
+		utils.PrintError(err, "Failed to save roster template")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	s.recordAudit(ctx, *thisStaff, models.AuditSaveTemplate, models.AuditEntityTemplate, template.ID, before, template)
+	root := s.MakeRootStruct(ctx, *thisStaff, *week)
+	root.Notice = "Saved the week as template " + name
+	s.renderTemplate(w, "rosterMainContainer", root)
+}
+
+type RosterTemplateBody struct {
+	TemplateID string `json:"templateID"`
+}
+
+// HandlePreviewRosterTemplate shows the week being viewed as it would be
+// with a template applied, without saving it.
+func (s *Server) HandlePreviewRosterTemplate(w http.ResponseWriter, r *http.Request) {
+	var reqBody RosterTemplateBody
+	if err := ReadAndUnmarshal(w, r, &reqBody); err != nil {
+		return
+	}
+	thisStaff := s.GetSessionUser(w, r)
+	if thisStaff == nil {
+		return
+	}
+	applied, ok := s.applyRosterTemplate(w, r, reqBody.TemplateID, *thisStaff)
+	if !ok {
+		return
+	}
+	s.renderTemplate(w, "rosterTemplatePreview", RosterTemplatePreview{
+		RootStruct: s.MakeRootStruct(r.Context(), *thisStaff, applied.Week),
+		Template:   applied.Template,
+		Dropped:    applied.Dropped,
+	})
+}
+
+// HandleApplyRosterTemplate lays out the week being viewed like a template,
+// reporting any assignments that were left out.
+func (s *Server) HandleApplyRosterTemplate(w http.ResponseWriter, r *http.Request) {
+	var reqBody RosterTemplateBody
+	if err := ReadAndUnmarshal(w, r, &reqBody); err != nil {
+		return
+	}
+	thisStaff := s.GetSessionUser(w, r)
+	if thisStaff == nil {
+		return
+	}
+	applied, ok := s.applyRosterTemplate(w, r, reqBody.TemplateID, *thisStaff)
+	if !ok {
+		return
+	}
+	if !s.saveClientRosterWeek(w, r, *thisStaff, &applied.Week) {
+		return
+	}
+	s.recordAudit(r.Context(), *thisStaff, models.AuditApplyTemplate, models.AuditEntityRoster, applied.Week.ID, applied.Before, applied.Week)
+	root := s.MakeRootStruct(r.Context(), *thisStaff, applied.Week)
+	root.Notice = "Applied template " + applied.Template.Name + "." + droppedNotice(applied.Dropped)
+	s.renderTemplate(w, "rosterMainContainer", root)
+}
+
+// HandleDeleteRosterTemplate removes a saved template. Weeks it was applied
+// to are unchanged.
+func (s *Server) HandleDeleteRosterTemplate(w http.ResponseWriter, r *http.Request) {
+	var reqBody RosterTemplateBody
+	if err := ReadAndUnmarshal(w, r, &reqBody); err != nil {
+		return
+	}
+	id, err := uuid.Parse(reqBody.TemplateID)
+	if err != nil {
+		utils.PrintError(err, "Invalid template ID")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	thisStaff := s.GetSessionUser(w, r)
+	if thisStaff == nil {
+		return
+	}
+	ctx := r.Context()
+	template, err := s.Repos.RosterTemplates.GetRosterTemplate(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		utils.PrintError(err, "Failed to load roster template")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := s.Repos.RosterTemplates.DeleteRosterTemplate(ctx, id); err != nil {
+		utils.PrintError(err, "Failed to delete roster template")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	s.recordAudit(ctx, *thisStaff, models.AuditDeleteTemplate, models.AuditEntityTemplate, id, template, nil)
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(ctx, thisStaff.Config.RosterDateOffset)
+	if err != nil {
+		utils.PrintError(err, "Failed to load roster week")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	s.renderTemplate(w, "rosterMainContainer", s.MakeRootStruct(ctx, *thisStaff, *week))
+}
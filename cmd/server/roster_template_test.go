@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"roster/cmd/models"
+
+	"github.com/google/uuid"
+)
+
+// Test a week saved as a template can be previewed and applied to another
+// week, reporting assignments to staff who have since been hidden.
+func TestRosterTemplates_SavePreviewApply(t *testing.T) {
+	s := newMemoryServer(t)
+	staff, token := newTestSession(t, s)
+	ctx := context.Background()
+	hal := models.StaffMember{ID: uuid.New(), FirstName: "Hal"}
+	if err := s.Repos.Staff.SaveStaffMember(ctx, hal); err != nil {
+		t.Fatalf("SaveStaffMember: %v", err)
+	}
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(ctx, staff.Config.RosterDateOffset)
+	if err != nil {
+		t.Fatalf("LoadRosterWeek: %v", err)
+	}
+	name := "Hal"
+	slot := &week.Days[0].Rows[0].Slots[0]
+	slot.AssignedStaff, slot.StaffString, slot.Description = &hal.ID, &name, "Deliveries"
+	week.Days[3].IsClosed = true
+	if err := s.Repos.RosterWeek.SaveRosterWeek(ctx, week); err != nil {
+		t.Fatalf("SaveRosterWeek: %v", err)
+	}
+
+	save := s.VerifyPermission(s.HandleSaveRosterTemplate, models.PermRosterEdit)
+	rec := serveWithSession(s, save, "POST", "/saveRosterTemplate", `{"name":"Winter","includeAssignments":"on"}`, token)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `<option value=`) {
+		t.Fatalf("expected the template to be offered after saving, got %d", rec.Code)
+	}
+	rec = serveWithSession(s, save, "POST", "/saveRosterTemplate", `{"name":"winter","includeAssignments":"on"}`, token)
+	templates, err := s.Repos.RosterTemplates.LoadAllRosterTemplates(ctx)
+	if err != nil || len(templates) != 1 || templates[0].Name != "winter" {
+		t.Fatalf("expected saving under the same name to replace the template, got %+v, %v", templates, err)
+	}
+	templateID := templates[0].ID.String()
+
+	hal.IsHidden = true
+	if err := s.Repos.Staff.SaveStaffMember(ctx, hal); err != nil {
+		t.Fatalf("SaveStaffMember: %v", err)
+	}
+	staff.Config.RosterDateOffset++
+	if err := s.Repos.Staff.SaveStaffMember(ctx, *staff); err != nil {
+		t.Fatalf("SaveStaffMember: %v", err)
+	}
+	body := `{"templateID":"` + templateID + `"}`
+	rec = serveWithSession(s, s.VerifyPermission(s.HandlePreviewRosterTemplate, models.PermRosterEdit), "POST", "/previewRosterTemplate", body, token)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Hal on") || !strings.Contains(rec.Body.String(), "/applyRosterTemplate") {
+		t.Fatalf("expected a preview reporting Hal's dropped shift, got %d: %s", rec.Code, rec.Body.String())
+	}
+	target, err := s.Repos.RosterWeek.LoadRosterWeek(ctx, staff.Config.RosterDateOffset)
+	if err != nil {
+		t.Fatalf("LoadRosterWeek: %v", err)
+	}
+	if target.Days[3].IsClosed {
+		t.Fatal("expected previewing not to change the week")
+	}
+
+	rec = serveWithSession(s, s.VerifyPermission(s.HandleApplyRosterTemplate, models.PermRosterEdit), "POST", "/applyRosterTemplate", body, token)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Hal (") {
+		t.Fatalf("expected the applied week to report Hal's dropped shift, got %d", rec.Code)
+	}
+	applied, err := s.Repos.RosterWeek.LoadRosterWeek(ctx, staff.Config.RosterDateOffset)
+	if err != nil {
+		t.Fatalf("LoadRosterWeek: %v", err)
+	}
+	got := applied.Days[0].Rows[0].Slots[0]
+	if applied.ID != target.ID || !applied.Days[3].IsClosed || got.Description != "Deliveries" || got.AssignedStaff != nil {
+		t.Errorf("expected the template's layout without Hal, got %+v", applied.Days[0].Rows[0])
+	}
+
+	rec = serveWithSession(s, s.VerifyPermission(s.HandleDeleteRosterTemplate, models.PermRosterEdit), "POST", "/deleteRosterTemplate", body, token)
+	if templates, _ := s.Repos.RosterTemplates.LoadAllRosterTemplates(ctx); rec.Code != http.StatusOK || len(templates) != 0 {
+		t.Errorf("expected the template to be deleted, got %d, %+v", rec.Code, templates)
+	}
+}
@@ -3,36 +3,55 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"math"
 	"net/http"
+	"os"
+	"slices"
 	"time"
 
+	"roster/cmd/auth"
+	"roster/cmd/mail"
 	"roster/cmd/models"
 	"roster/cmd/repository"
 	"roster/cmd/utils"
 
 	"github.com/google/uuid"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 const SESSION_KEY = "sessionToken"
-const DEV_MODE = false
+
+// DefaultRequestTimeout bounds each request when no other timeout is set.
+const DefaultRequestTimeout = 10 * time.Second
 
 type Server struct {
 	CacheBust string
 	Templates *template.Template
 	Repos     Repositories
+	// RequestTimeout is the deadline given to each request's context, and so
+	// to every repository call made while handling it.
+	RequestTimeout time.Duration
+	// SessionIdleTimeout and SessionLifetime bound how long a login lasts
+	// without being used, and at most.
+	SessionIdleTimeout time.Duration
+	SessionLifetime    time.Duration
+	// Providers are the identity providers staff can log in with, in the
+	// order they are offered.
+	Providers []auth.Provider
+	// CookieSecret signs cookies the server needs to trust when they come
+	// back, such as the state of a login in progress.
+	CookieSecret []byte
+	// Mailer sends email, such as login links.
+	Mailer mail.Sender
+	// BaseURL is the address staff reach the server at, used in links they
+	// open elsewhere. Links use the request's host when it is empty.
+	BaseURL string
 }
 
-type Repositories struct {
-	Staff      repository.StaffRepository
-	RosterWeek repository.RosterWeekRepository
-	Timesheet  repository.TimesheetRepository
-	Config     repository.ConfigRepository
-}
+type Repositories = repository.Repositories
 
 func (s *Server) renderTemplate(w http.ResponseWriter, templateName string, data any) {
 	err := s.Templates.ExecuteTemplate(w, templateName, data)
@@ -42,26 +61,23 @@ func (s *Server) renderTemplate(w http.ResponseWriter, templateName string, data
 	}
 }
 
-func (s *Server) VerifyManager(handler http.HandlerFunc) http.HandlerFunc {
-	return s.VerifySession(func(w http.ResponseWriter, r *http.Request) {
-		staff := s.GetSessionUser(w, r)
-		if staff == nil || !staff.IsManagerRole() {
-			http.Redirect(w, r, "/profile", http.StatusSeeOther)
-			return
-		}
-		handler(w, r)
-	})
-}
-
-func (s *Server) VerifyAdmin(handler http.HandlerFunc) http.HandlerFunc {
-	return s.VerifySession(func(w http.ResponseWriter, r *http.Request) {
+// VerifyPermission wraps handler so only staff whose role grants at least
+// one of perms can use it. Everyone else is sent to their profile, or refused
+// if they are using an API token.
+func (s *Server) VerifyPermission(handler http.HandlerFunc, perms ...models.Permission) http.HandlerFunc {
+	return s.verifySession(func(w http.ResponseWriter, r *http.Request) {
 		staff := s.GetSessionUser(w, r)
-		if staff == nil || !staff.IsAdminRole() {
+		if staff == nil || !slices.ContainsFunc(perms, staff.Can) {
+			utils.PrintLog("Denied %v %v without %v", r.Method, r.URL.Path, perms)
+			if _, ok := apiTokenFromContext(r.Context()); ok {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
 			http.Redirect(w, r, "/profile", http.StatusSeeOther)
 			return
 		}
 		handler(w, r)
-	})
+	}, true)
 }
 
 func GetTokenFromCookies(r *http.Request) *uuid.UUID {
@@ -77,34 +93,123 @@ func GetTokenFromCookies(r *http.Request) *uuid.UUID {
 		utils.PrintError(err, "Error parsing session token")
 		return nil
 	}
-	utils.PrintLog("Retrieved token: %v", sessionToken)
 	return &sessionToken
 }
 
 func (s *Server) VerifySession(handler http.HandlerFunc) http.HandlerFunc {
+	return s.verifySession(handler, false)
+}
+
+// verifySession serves handler to logged in staff. Requests with an API
+// token may only change data if tokenWrites is set, as routes that don't
+// check for a permission can't check the token's scope either.
+func (s *Server) verifySession(handler http.HandlerFunc, tokenWrites bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// Scripts authenticate with an API token. They can't be made to send
+		// it by another site, so they don't need a CSRF token.
+		if secret, ok := bearerToken(r); ok {
+			if !tokenWrites && !isSafeMethod(r.Method) {
+				utils.PrintLog("Refused API token for %v %v", r.Method, r.URL.Path)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			s.verifyAPIToken(w, r, secret, handler)
+			return
+		}
 		sessionToken := GetTokenFromCookies(r)
 		if sessionToken == nil {
 			http.Redirect(w, r, "/landing", http.StatusSeeOther)
 			return
 		}
 
-		staffMember, err := s.Repos.Staff.GetStaffByToken(*sessionToken)
+		session, err := s.activeSession(r.Context(), *sessionToken)
 		if err != nil {
 			utils.PrintError(err, "Invalid session")
+			clearSessionCookie(w)
+			http.Redirect(w, r, "/landing", http.StatusSeeOther)
+			return
+		}
+		if !isSafeMethod(r.Method) && !s.validCSRFToken(r, session.ID) {
+			utils.PrintLog("Missing or invalid CSRF token for %v %v", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		staffMember, err := s.Repos.Staff.GetStaffByID(r.Context(), session.StaffID)
+		if err != nil || staffMember == nil {
+			utils.PrintError(err, "No staff member for session")
+			clearSessionCookie(w)
 			http.Redirect(w, r, "/landing", http.StatusSeeOther)
 			return
 		}
-		if staffMember.FirstName == "" && r.URL.String() != "/newAccount" && r.URL.String() != "/createAccount" {
+		if staffMember.FirstName == "" && r.URL.String() != "/newAccount" && r.URL.String() != "/createAccount" && r.URL.String() != "/auth/logout" {
 			utils.PrintLog("Account not created yet")
 			http.Redirect(w, r, "/newAccount", http.StatusSeeOther)
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), SESSION_KEY, *sessionToken)
-		reqWithToken := r.WithContext(ctx)
-		handler(w, reqWithToken)
+		ctx := context.WithValue(r.Context(), SESSION_KEY, *session)
+		if view, ok := s.checkViewAs(w, r, *session, *staffMember); ok {
+			if !allowedWhileViewingAs(r) {
+				utils.PrintLog("Refused %v %v while viewing as %v", r.Method, r.URL.Path, view.StaffID)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			ctx = context.WithValue(ctx, VIEW_AS_KEY, view)
+		}
+		handler(w, r.WithContext(ctx))
+	}
+}
+
+// WithRequestTimeout gives every request handled by handler a context with
+// the server's RequestTimeout. A handler that runs past the deadline and then
+// fails, answering with an error or a redirect, most likely failed because
+// of it, so the client gets a 503 instead. Successful responses are let
+// through however late they are, as the handler's changes were saved and a
+// 503 would invite the client to make them again.
+func (s *Server) WithRequestTimeout(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), s.RequestTimeout)
+		defer cancel()
+		handler.ServeHTTP(&timeoutWriter{ResponseWriter: w, ctx: ctx}, r.WithContext(ctx))
+	})
+}
+
+// timeoutWriter replaces an unsuccessful response with a 503 if its
+// context's deadline has passed by the time the handler starts writing.
+type timeoutWriter struct {
+	http.ResponseWriter
+	ctx         context.Context
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	if tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+	failed := code < 200 || code >= 300
+	if failed && errors.Is(tw.ctx.Err(), context.DeadlineExceeded) {
+		utils.PrintError(tw.ctx.Err(), "Request timed out")
+		tw.timedOut = true
+		tw.Header().Del("Location")
+		tw.Header().Del("Set-Cookie")
+		tw.Header().Del("HX-Redirect")
+		http.Error(tw.ResponseWriter, "Service Unavailable", http.StatusServiceUnavailable)
+		return
 	}
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	if tw.timedOut {
+		// Pretend the write succeeded; the client already has its 503.
+		return len(b), nil
+	}
+	return tw.ResponseWriter.Write(b)
 }
 
 func ReadAndUnmarshal(w http.ResponseWriter, r *http.Request, reqBody any) error {
@@ -126,20 +231,26 @@ func ReadAndUnmarshal(w http.ResponseWriter, r *http.Request, reqBody any) error
 	return nil
 }
 
-func LoadServerState(d *mongo.Database, context context.Context) (*Server, error) {
+// LoadServerState builds the server on top of the given repositories, which
+// may be backed by any storage implementation.
+func LoadServerState(repos Repositories) (*Server, error) {
+	return newServer(repos, "./www/*.html")
+}
+
+func newServer(repos Repositories, templateGlob string) (*Server, error) {
 	var serverState Server
 	var err error
-	staffRepo := repository.NewMongoStaffRepository(context, d)
-	rosterWeekRepo := repository.NewMongoRosterWeekRepository(context, d)
-	timesheetRepo := repository.NewMongoTimesheetRepository(context, d)
-	configRepo := repository.NewMongoConfigRepository(context, d)
 	serverState = Server{
-		CacheBust: fmt.Sprintf("%v", time.Now().UnixNano()),
+		CacheBust:          fmt.Sprintf("%v", time.Now().UnixNano()),
+		RequestTimeout:     DefaultRequestTimeout,
+		SessionIdleTimeout: DefaultSessionIdleTimeout,
+		SessionLifetime:    DefaultSessionLifetime,
+		CookieSecret:       newCookieSecret(),
+		Mailer:             mail.NewLog(os.Stdout),
 		Templates: template.New("").Funcs(template.FuncMap{
 			"MakeHeaderStruct":           MakeHeaderStruct,
 			"MakeDayStruct":              MakeDayStruct,
-			"GetHighlightCol":            models.GetHighlightCol,
-			"GetHighlightDesc":           models.GetHighlightDesc,
+			"SlotColour":                 models.SlotColour,
 			"MakeProfileStruct":          MakeProfileStruct,
 			"MemberIsAssigned":           MemberIsAssigned,
 			"MakeTimesheetEntryStruct":   MakeTimesheetEntryStruct,
@@ -149,8 +260,11 @@ func LoadServerState(d *mongo.Database, context context.Context) (*Server, error
 			"LeavePendingStatus":         func() int { return int(models.LeavePending) },
 			"LeaveDeniedStatus":          func() int { return int(models.LeaveDenied) },
 			"GetAllShiftTypes":           models.GetAllShiftTypes,
+			"AllRoles":                   func() []models.Role { return models.Roles },
 			"DisableTimesheet":           models.DisableTimesheet,
 			"WeekStartFromOffset":        utils.WeekStartFromOffset,
+			"ShiftButtonClass":           ShiftButtonClass,
+			"ShiftNames":                 func() models.SlotNameList { return models.SlotNames(models.DefaultSlots()) },
 			"CountShiftsForStaff": func(staffID uuid.UUID, rosterWeek models.RosterWeek) int {
 				return rosterWeek.CountShiftsForStaff(staffID)
 			},
@@ -190,14 +304,9 @@ func LoadServerState(d *mongo.Database, context context.Context) (*Server, error
 				return intervals
 			},
 		}),
-		Repos: Repositories{
-			Staff:      staffRepo,
-			RosterWeek: rosterWeekRepo,
-			Timesheet:  timesheetRepo,
-			Config:     configRepo,
-		},
-	}
-	serverState.Templates, err = serverState.Templates.ParseGlob("./www/*.html")
+		Repos: repos,
+	}
+	serverState.Templates, err = serverState.Templates.ParseGlob(templateGlob)
 	if err != nil {
 		return nil, err
 	}
@@ -205,21 +314,31 @@ func LoadServerState(d *mongo.Database, context context.Context) (*Server, error
 }
 
 func (s *Server) GetSessionUser(w http.ResponseWriter, r *http.Request) *models.StaffMember {
-	sessionToken, ok := r.Context().Value(SESSION_KEY).(uuid.UUID)
-	if !ok {
+	if view, ok := viewAsFromContext(r.Context()); ok {
+		return s.viewAsStaff(r.Context(), view)
+	}
+	var staffID uuid.UUID
+	var scope []models.Permission
+	if session, ok := sessionFromContext(r.Context()); ok {
+		staffID = session.StaffID
+	} else if token, ok := apiTokenFromContext(r.Context()); ok {
+		staffID = token.StaffID
+		scope = token.Scope()
+	} else {
 		utils.PrintLog("No session for user")
 		return nil
 	}
-	staff, err := s.Repos.Staff.GetStaffByToken(sessionToken)
-	if err != nil {
+	staff, err := s.Repos.Staff.GetStaffByID(r.Context(), staffID)
+	if err != nil || staff == nil {
 		utils.PrintError(err, "Error retrieving session user")
 		return nil
 	}
-	refreshedStaff, err := s.Repos.Staff.RefreshStaffConfig(*staff)
+	refreshedStaff, err := s.Repos.Staff.RefreshStaffConfig(r.Context(), *staff)
 	if err != nil {
 		utils.PrintError(err, "Error refreshing staff config")
 		return nil
 	}
+	refreshedStaff.Scope = scope
 	return &refreshedStaff
 }
 
@@ -230,11 +349,13 @@ func (s *Server) HandleLanding(w http.ResponseWriter, r *http.Request) {
 type HeaderData struct {
 	RosterLive bool
 	IsAdmin    bool
+	ShowAudit  bool
 }
 
-func MakeHeaderStruct(isAdmin bool, rosterLive bool) HeaderData {
+func MakeHeaderStruct(isAdmin bool, rosterLive bool, showAudit bool) HeaderData {
 	return HeaderData{
 		RosterLive: rosterLive,
 		IsAdmin:    isAdmin,
+		ShowAudit:  showAudit,
 	}
 }
@@ -1,12 +1,20 @@
 package server
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
+
+	"roster/cmd/models"
+	"roster/cmd/repository"
 
 	"github.com/google/uuid"
 )
@@ -92,3 +100,262 @@ func TestReadAndUnmarshal_Success(t *testing.T) {
 		t.Errorf("expected Foo=Bar, got %q", dst.Foo)
 	}
 }
+
+// newMemoryServer builds a server backed by in-memory repositories and the
+// real templates.
+func newMemoryServer(t *testing.T) *Server {
+	t.Helper()
+	s, err := newServer(repository.NewMemoryRepositories(), "../../www/*.html")
+	if err != nil {
+		t.Fatalf("newServer: %v", err)
+	}
+	return s
+}
+
+// newTestSession creates a staff member and returns them with their session
+// token.
+func newTestSession(t *testing.T, s *Server) (*models.StaffMember, uuid.UUID) {
+	t.Helper()
+	ctx := context.Background()
+	staff, err := s.Repos.Staff.CreateStaffMember(ctx, models.Identity{Provider: "google", Subject: "google-id"})
+	if err != nil {
+		t.Fatalf("CreateStaffMember: %v", err)
+	}
+	staff.FirstName = "Alice"
+	if err := s.Repos.Staff.SaveStaffMember(ctx, *staff); err != nil {
+		t.Fatalf("SaveStaffMember: %v", err)
+	}
+	now := time.Now()
+	session := models.Session{ID: uuid.New(), StaffID: staff.ID, CreatedAt: now, LastSeen: now, ExpiresAt: now.Add(time.Hour)}
+	if err := s.Repos.Sessions.CreateSession(ctx, session); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	return staff, session.ID
+}
+
+// Test the index page renders end to end without a database.
+func TestHandleIndex_MemoryRepositories(t *testing.T) {
+	s := newMemoryServer(t)
+	staff, token := newTestSession(t, s)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: token.String()})
+	rec := httptest.NewRecorder()
+	s.VerifySession(s.HandleIndex)(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `id="roster-main-container"`) {
+		t.Error("expected roster page to be rendered")
+	}
+	if _, err := s.Repos.RosterWeek.LoadRosterWeek(context.Background(), staff.Config.RosterDateOffset); err != nil {
+		t.Errorf("expected roster week to be created: %v", err)
+	}
+}
+
+// modifyDescription posts a slot description edit made against revision.
+func modifyDescription(s *Server, token uuid.UUID, slotID uuid.UUID, revision int) *httptest.ResponseRecorder {
+	form := url.Values{"slotID": {slotID.String()}, "descVal": {"Bar"}}
+	req := httptest.NewRequest("POST", "/modifyDescriptionSlot", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(RosterRevisionHeader, strconv.Itoa(revision))
+	req.Header.Set(CSRF_HEADER, s.sessionCSRFToken(token))
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: token.String()})
+	rec := httptest.NewRecorder()
+	s.VerifySession(s.HandleModifyDescriptionSlot)(rec, req)
+	return rec
+}
+
+// Test an edit against the current revision is saved and returns the new one.
+func TestHandleModifyDescriptionSlot_CurrentRevision(t *testing.T) {
+	s := newMemoryServer(t)
+	staff, token := newTestSession(t, s)
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(context.Background(), staff.Config.RosterDateOffset)
+	if err != nil {
+		t.Fatalf("LoadRosterWeek: %v", err)
+	}
+	slotID := week.Days[0].Rows[0].Slots[0].ID
+
+	rec := modifyDescription(s, token, slotID, week.Revision)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	want := fmt.Sprintf(`value="%d"`, week.Revision+1)
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("expected response to carry new revision %s, got %q", want, rec.Body.String())
+	}
+	saved, err := s.Repos.RosterWeek.LoadRosterWeek(context.Background(), staff.Config.RosterDateOffset)
+	if err != nil {
+		t.Fatalf("LoadRosterWeek: %v", err)
+	}
+	if got := saved.GetSlotByID(slotID).Description; got != "Bar" {
+		t.Errorf("expected description to be saved, got %q", got)
+	}
+}
+
+// Test a slot edit from a client behind the latest revision is still saved,
+// but does not move the client on to the new revision.
+func TestHandleModifyDescriptionSlot_StaleRevision(t *testing.T) {
+	s := newMemoryServer(t)
+	staff, token := newTestSession(t, s)
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(context.Background(), staff.Config.RosterDateOffset)
+	if err != nil {
+		t.Fatalf("LoadRosterWeek: %v", err)
+	}
+	slotID := week.Days[0].Rows[0].Slots[0].ID
+
+	rec := modifyDescription(s, token, slotID, week.Revision-1)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "roster-revision") {
+		t.Errorf("expected stale client to keep its revision, got %q", rec.Body.String())
+	}
+	saved, err := s.Repos.RosterWeek.LoadRosterWeek(context.Background(), staff.Config.RosterDateOffset)
+	if err != nil {
+		t.Fatalf("LoadRosterWeek: %v", err)
+	}
+	if got := saved.GetSlotByID(slotID).Description; got != "Bar" {
+		t.Errorf("expected description to be saved, got %q", got)
+	}
+}
+
+// Test a whole-week edit against an old revision is rejected with the
+// reloaded roster.
+func TestHandleToggleLive_StaleRevision(t *testing.T) {
+	s := newMemoryServer(t)
+	staff, token := newTestSession(t, s)
+	week, err := s.Repos.RosterWeek.LoadRosterWeek(context.Background(), staff.Config.RosterDateOffset)
+	if err != nil {
+		t.Fatalf("LoadRosterWeek: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/toggleLive", nil)
+	req.Header.Set(RosterRevisionHeader, strconv.Itoa(week.Revision-1))
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: token.String()})
+	rec := httptest.NewRecorder()
+	s.VerifySession(s.HandleToggleLive)(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected status %d, got %d", http.StatusConflict, rec.Code)
+	}
+	if got := rec.Header().Get("HX-Retarget"); got != "#roster-main-container" {
+		t.Errorf("expected roster to be retargeted, got %q", got)
+	}
+	if !strings.Contains(rec.Body.String(), "was not saved") {
+		t.Error("expected conflict notice in response")
+	}
+	saved, err := s.Repos.RosterWeek.LoadRosterWeek(context.Background(), staff.Config.RosterDateOffset)
+	if err != nil {
+		t.Fatalf("LoadRosterWeek: %v", err)
+	}
+	if saved.Revision != week.Revision || saved.IsLive {
+		t.Error("expected stale edit not to be saved")
+	}
+}
+
+// Test a handler that finishes within the deadline responds as normal.
+func TestWithRequestTimeout_InTime(t *testing.T) {
+	s := newMemoryServer(t)
+	handler := s.WithRequestTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); !ok {
+			t.Error("expected request context to have a deadline")
+		}
+		w.Write([]byte("ok"))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+		t.Errorf("expected 200 ok, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+// Test a handler that fails after the deadline is answered with a 503 rather
+// than the redirect or cookie it tries to send.
+func TestWithRequestTimeout_DeadlineExceeded(t *testing.T) {
+	s := newMemoryServer(t)
+	s.RequestTimeout = time.Millisecond
+	handler := s.WithRequestTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		clearSessionCookie(w)
+		http.Redirect(w, r, "/landing", http.StatusSeeOther)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if loc := rec.Header().Get("Location"); loc != "" {
+		t.Errorf("expected no redirect on timeout, got Location %q", loc)
+	}
+	if cookie := rec.Header().Get("Set-Cookie"); cookie != "" {
+		t.Errorf("expected no cookie on timeout, got %q", cookie)
+	}
+}
+
+// Test a change saved just before the deadline is reported as saved even if
+// the response is written after it.
+func TestWithRequestTimeout_SavedThenLate(t *testing.T) {
+	s := newMemoryServer(t)
+	s.RequestTimeout = time.Millisecond
+	handler := s.WithRequestTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := s.Repos.Config.SaveVersion(r.Context(), models.Version{ID: "late", Version: 1}); err != nil {
+			t.Errorf("SaveVersion: %v", err)
+		}
+		<-r.Context().Done()
+		w.Header().Set("HX-Redirect", "/")
+		w.Write([]byte("saved"))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/submitLeave", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "saved" || rec.Header().Get("HX-Redirect") != "/" {
+		t.Errorf("expected the late response to be let through, got %d %q", rec.Code, rec.Body.String())
+	}
+	if v, err := s.Repos.Config.LoadVersionByID(context.Background(), "late"); err != nil || v.Version != 1 {
+		t.Errorf("expected the change to be saved, got %+v, %v", v, err)
+	}
+}
+
+// Test routes only let through staff whose role grants the permission, and a
+// kitchen lead can only approve kitchen shifts.
+func TestVerifyPermission_KitchenLead(t *testing.T) {
+	s := newMemoryServer(t)
+	staff, token := newTestSession(t, s)
+	ctx := context.Background()
+	staff.Role = models.KitchenLead
+	if err := s.Repos.Staff.SaveStaffMember(ctx, *staff); err != nil {
+		t.Fatalf("SaveStaffMember: %v", err)
+	}
+	kitchen := models.TimesheetEntry{ID: uuid.New(), StaffID: uuid.New(), ShiftType: models.Kitchen}
+	bar := models.TimesheetEntry{ID: uuid.New(), StaffID: uuid.New(), ShiftType: models.Bar}
+	for _, entry := range []models.TimesheetEntry{kitchen, bar} {
+		if err := s.Repos.Timesheet.SaveTimesheetEntry(ctx, entry); err != nil {
+			t.Fatalf("SaveTimesheetEntry: %v", err)
+		}
+	}
+	approve := s.VerifyPermission(s.HandleToggleApproved, models.PermTimesheetApprove, models.PermTimesheetApproveKitchen)
+
+	rec := serveWithSession(s, approve, "POST", "/toggleApproved", `{"EntryID":"`+kitchen.ID.String()+`"}`, token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the kitchen shift to be approved, got %d", rec.Code)
+	}
+	rec = serveWithSession(s, approve, "POST", "/toggleApproved", `{"EntryID":"`+bar.ID.String()+`"}`, token)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected the bar shift to be refused, got %d", rec.Code)
+	}
+	if entry, _ := s.Repos.Timesheet.GetTimesheetEntryByID(ctx, kitchen.ID); !entry.Approved {
+		t.Error("expected the kitchen shift to be approved")
+	}
+	if entry, _ := s.Repos.Timesheet.GetTimesheetEntryByID(ctx, bar.ID); entry.Approved {
+		t.Error("expected the bar shift to stay unapproved")
+	}
+
+	rec = serveWithSession(s, s.VerifyPermission(s.HandleToggleLive, models.PermRosterPublish), "POST", "/toggleLive", "", token)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/profile" {
+		t.Errorf("expected a kitchen lead to be turned away from publishing, got %d", rec.Code)
+	}
+}
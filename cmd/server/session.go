@@ -0,0 +1,228 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"roster/cmd/models"
+	"roster/cmd/repository"
+	"roster/cmd/utils"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultSessionIdleTimeout signs a browser out after this long unused.
+	DefaultSessionIdleTimeout = 14 * 24 * time.Hour
+	// DefaultSessionLifetime signs a browser out this long after login,
+	// however often it is used.
+	DefaultSessionLifetime = 90 * 24 * time.Hour
+)
+
+// sessionTouchInterval limits how often a session's last use is saved, so
+// that every request doesn't cost a write.
+const sessionTouchInterval = time.Minute
+
+// errSessionExpired is returned for sessions that exist but can no longer be
+// used.
+var errSessionExpired = errors.New("session expired")
+
+// startSession creates a session for the staff member and sends its cookie.
+func (s *Server) startSession(w http.ResponseWriter, r *http.Request, staffID uuid.UUID) error {
+	now := time.Now()
+	session := models.Session{
+		ID:        uuid.New(),
+		StaffID:   staffID,
+		CreatedAt: now,
+		LastSeen:  now,
+		ExpiresAt: now.Add(s.SessionLifetime),
+		UserAgent: r.UserAgent(),
+	}
+	if err := s.Repos.Sessions.CreateSession(r.Context(), session); err != nil {
+		return err
+	}
+	setSessionCookie(w, session)
+
+	// Opportunistically clear out sessions nobody can use any more.
+	removed, err := s.Repos.Sessions.DeleteExpiredSessions(r.Context(), now, now.Add(-s.SessionIdleTimeout))
+	if err != nil {
+		utils.PrintError(err, "Failed to delete expired sessions")
+	} else if removed > 0 {
+		utils.PrintLog("Deleted %d expired sessions", removed)
+	}
+	return nil
+}
+
+// activeSession returns the session for token if it can still be used,
+// recording that it has just been used. Expired sessions are deleted.
+func (s *Server) activeSession(ctx context.Context, token uuid.UUID) (*models.Session, error) {
+	session, err := s.Repos.Sessions.GetSession(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if !session.Active(now, s.SessionIdleTimeout) {
+		if err := s.Repos.Sessions.DeleteSession(ctx, session.ID); err != nil {
+			utils.PrintError(err, "Failed to delete expired session")
+		}
+		return nil, errSessionExpired
+	}
+	if now.Sub(session.LastSeen) > sessionTouchInterval {
+		if err := s.Repos.Sessions.TouchSession(ctx, session.ID, now); err != nil {
+			utils.PrintError(err, "Failed to update session")
+		}
+		session.LastSeen = now
+	}
+	return session, nil
+}
+
+// sessionFromContext returns the session VerifySession attached to the
+// request.
+func sessionFromContext(ctx context.Context) (models.Session, bool) {
+	session, ok := ctx.Value(SESSION_KEY).(models.Session)
+	return session, ok
+}
+
+func setSessionCookie(w http.ResponseWriter, session models.Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_token",
+		Value:    session.ID.String(),
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/",
+	})
+}
+
+func clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_token",
+		Value:    "",
+		Path:     "/",
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// SessionData describes one of a staff member's sessions on their profile.
+type SessionData struct {
+	models.Session
+	Browser       string
+	IdleExpiresAt time.Time
+	IsCurrent     bool
+}
+
+// makeSessionsData lists the staff member's sessions that can still be used.
+func (s *Server) makeSessionsData(ctx context.Context, staffID uuid.UUID, current uuid.UUID) ([]SessionData, error) {
+	sessions, err := s.Repos.Sessions.FindStaffSessions(ctx, staffID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	data := []SessionData{}
+	for _, session := range sessions {
+		if !session.Active(now, s.SessionIdleTimeout) {
+			continue
+		}
+		data = append(data, SessionData{
+			Session:       *session,
+			Browser:       describeUserAgent(session.UserAgent),
+			IdleExpiresAt: session.IdleExpiresAt(s.SessionIdleTimeout),
+			IsCurrent:     session.ID == current,
+		})
+	}
+	return data, nil
+}
+
+// HandleSignOutEverywhere revokes every one of the user's sessions,
+// including the current one.
+func (s *Server) HandleSignOutEverywhere(w http.ResponseWriter, r *http.Request) {
+	thisStaff := s.GetSessionUser(w, r)
+	if thisStaff == nil {
+		return
+	}
+	if err := s.Repos.Sessions.DeleteStaffSessions(r.Context(), thisStaff.ID); err != nil {
+		utils.PrintError(err, "Failed to revoke sessions")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	clearSessionCookie(w)
+	w.Header().Set("HX-Redirect", "/landing")
+	w.WriteHeader(http.StatusOK)
+}
+
+type RevokeSessionBody struct {
+	SessionID string `json:"sessionID"`
+}
+
+// HandleRevokeSession signs out one of the user's other sessions.
+func (s *Server) HandleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	thisStaff := s.GetSessionUser(w, r)
+	if thisStaff == nil {
+		return
+	}
+	var reqBody RevokeSessionBody
+	if err := ReadAndUnmarshal(w, r, &reqBody); err != nil {
+		return
+	}
+	sessionID, err := uuid.Parse(reqBody.SessionID)
+	if err != nil {
+		utils.PrintError(err, "Invalid session ID")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	session, err := s.Repos.Sessions.GetSession(r.Context(), sessionID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && session.StaffID != thisStaff.ID) {
+		// Don't reveal whether other people's sessions exist.
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		utils.PrintError(err, "Failed to load session")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := s.Repos.Sessions.DeleteSession(r.Context(), sessionID); err != nil {
+		utils.PrintError(err, "Failed to revoke session")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	current, _ := sessionFromContext(r.Context())
+	if sessionID == current.ID {
+		clearSessionCookie(w)
+		w.Header().Set("HX-Redirect", "/landing")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	s.renderSessions(w, r, *thisStaff)
+}
+
+func (s *Server) renderSessions(w http.ResponseWriter, r *http.Request, staff models.StaffMember) {
+	current, _ := sessionFromContext(r.Context())
+	sessions, err := s.makeSessionsData(r.Context(), staff.ID, current.ID)
+	if err != nil {
+		utils.PrintError(err, "Failed to load sessions")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	s.renderTemplate(w, "sessions", sessions)
+}
+
+// describeUserAgent shortens a browser's user agent for display.
+func describeUserAgent(userAgent string) string {
+	const maxLength = 80
+	if userAgent == "" {
+		return "Unknown browser"
+	}
+	if runes := []rune(userAgent); len(runes) > maxLength {
+		return fmt.Sprintf("%s…", string(runes[:maxLength]))
+	}
+	return userAgent
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"roster/cmd/models"
+	"roster/cmd/repository"
+
+	"github.com/google/uuid"
+)
+
+// serveWithSession runs handler behind VerifySession with the given session
+// cookie and its CSRF token.
+func serveWithSession(s *Server, handler http.HandlerFunc, method string, target string, body string, token uuid.UUID) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("User-Agent", "TestBrowser/1.0")
+	req.Header.Set(CSRF_HEADER, s.sessionCSRFToken(token))
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: token.String()})
+	rec := httptest.NewRecorder()
+	s.VerifySession(handler)(rec, req)
+	return rec
+}
+
+// Test logging out revokes the session rather than just dropping the cookie.
+func TestHandleGoogleLogout_RevokesSession(t *testing.T) {
+	s := newMemoryServer(t)
+	_, token := newTestSession(t, s)
+
+	logout := RequirePost(s.VerifySession(s.HandleLogout))
+	req := httptest.NewRequest("GET", "/auth/logout", nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: token.String()})
+	rec := httptest.NewRecorder()
+	logout(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected a GET to be refused, got %d", rec.Code)
+	}
+
+	rec = serveWithSession(s, logout, "POST", "/auth/logout", "", token)
+	if rec.Code != http.StatusOK || rec.Header().Get("HX-Redirect") != "/landing" {
+		t.Errorf("expected logging out to redirect to /landing, got %d %q", rec.Code, rec.Header().Get("HX-Redirect"))
+	}
+	if _, err := s.Repos.Sessions.GetSession(context.Background(), token); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected the session to be deleted, got %v", err)
+	}
+	rec = serveWithSession(s, s.HandleIndex, "GET", "/", "", token)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/landing" {
+		t.Errorf("expected a revoked session to be sent to /landing, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+// Test sessions stop working once idle too long or past their lifetime.
+func TestVerifySession_Expiry(t *testing.T) {
+	s := newMemoryServer(t)
+	staff, _ := newTestSession(t, s)
+	ctx := context.Background()
+	now := time.Now()
+	sessions := map[string]models.Session{
+		"idle": {ID: uuid.New(), StaffID: staff.ID, CreatedAt: now.Add(-time.Hour),
+			LastSeen: now.Add(-s.SessionIdleTimeout - time.Minute), ExpiresAt: now.Add(time.Hour)},
+		"expired": {ID: uuid.New(), StaffID: staff.ID, CreatedAt: now.Add(-time.Hour),
+			LastSeen: now, ExpiresAt: now.Add(-time.Minute)},
+	}
+	for name, session := range sessions {
+		if err := s.Repos.Sessions.CreateSession(ctx, session); err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+		rec := serveWithSession(s, s.HandleIndex, "GET", "/", "", session.ID)
+		if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/landing" {
+			t.Errorf("%s: expected redirect to /landing, got %d", name, rec.Code)
+		}
+		if _, err := s.Repos.Sessions.GetSession(ctx, session.ID); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("%s: expected the session to be deleted, got %v", name, err)
+		}
+	}
+}
+
+// Test the profile page lists the user's sessions and signing out
+// everywhere revokes all of them.
+func TestHandleSignOutEverywhere(t *testing.T) {
+	s := newMemoryServer(t)
+	staff, token := newTestSession(t, s)
+	ctx := context.Background()
+	now := time.Now()
+	phone := models.Session{ID: uuid.New(), StaffID: staff.ID, CreatedAt: now, LastSeen: now,
+		ExpiresAt: now.Add(time.Hour), UserAgent: "PhoneBrowser/2.0"}
+	if err := s.Repos.Sessions.CreateSession(ctx, phone); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	rec := serveWithSession(s, s.HandleProfileIndex, "GET", "/profile", "", token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "PhoneBrowser/2.0") || !strings.Contains(body, "This browser") {
+		t.Error("expected the profile page to list both sessions")
+	}
+
+	rec = serveWithSession(s, s.HandleSignOutEverywhere, "POST", "/signOutEverywhere", "", token)
+	if rec.Code != http.StatusOK || rec.Header().Get("HX-Redirect") != "/landing" {
+		t.Fatalf("expected redirect to /landing, got %d", rec.Code)
+	}
+	remaining, err := s.Repos.Sessions.FindStaffSessions(ctx, staff.ID)
+	if err != nil {
+		t.Fatalf("FindStaffSessions: %v", err)
+	}
+	if len(remaining) != 0 {
+		t.Errorf("expected every session to be revoked, %d remain", len(remaining))
+	}
+}
+
+// Test a user can sign out their other sessions but not other people's.
+func TestHandleRevokeSession(t *testing.T) {
+	s := newMemoryServer(t)
+	staff, token := newTestSession(t, s)
+	ctx := context.Background()
+	now := time.Now()
+	mine := models.Session{ID: uuid.New(), StaffID: staff.ID, CreatedAt: now, LastSeen: now, ExpiresAt: now.Add(time.Hour)}
+	theirs := models.Session{ID: uuid.New(), StaffID: uuid.New(), CreatedAt: now, LastSeen: now, ExpiresAt: now.Add(time.Hour)}
+	for _, session := range []models.Session{mine, theirs} {
+		if err := s.Repos.Sessions.CreateSession(ctx, session); err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+	}
+
+	rec := serveWithSession(s, s.HandleRevokeSession, "POST", "/revokeSession", `{"sessionID":"`+theirs.ID.String()+`"}`, token)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for another user's session, got %d", http.StatusNotFound, rec.Code)
+	}
+	if _, err := s.Repos.Sessions.GetSession(ctx, theirs.ID); err != nil {
+		t.Errorf("expected another user's session to survive, got %v", err)
+	}
+
+	rec = serveWithSession(s, s.HandleRevokeSession, "POST", "/revokeSession", `{"sessionID":"`+mine.ID.String()+`"}`, token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if _, err := s.Repos.Sessions.GetSession(ctx, mine.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected the session to be revoked, got %v", err)
+	}
+	if !strings.Contains(rec.Body.String(), `id="sessions"`) {
+		t.Error("expected the updated session list")
+	}
+}
+
+// Test long user agents are cut short without splitting a character.
+func TestDescribeUserAgent(t *testing.T) {
+	if got := describeUserAgent(""); got != "Unknown browser" {
+		t.Errorf("expected an unknown browser, got %q", got)
+	}
+	long := strings.Repeat("é", 100)
+	got := describeUserAgent(long)
+	if !utf8.ValidString(got) || got != strings.Repeat("é", 80)+"…" {
+		t.Errorf("expected 80 characters and an ellipsis, got %q", got)
+	}
+}
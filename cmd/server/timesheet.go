@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"math"
 
 	"net/http"
@@ -34,10 +35,12 @@ type TimesheetData struct {
 	StaffPaySummary StaffPaySummary
 	RosterLive      bool
 	CacheBust       string
+	CSRFToken       string
+	ViewAs          *ViewAsBanner
 }
 
-func (s *Server) MakeTimesheetStruct(activeStaff models.StaffMember) TimesheetData {
-	entries, err := s.Repos.Timesheet.GetTimesheetWeek(activeStaff.Config.TimesheetDateOffset)
+func (s *Server) MakeTimesheetStruct(ctx context.Context, activeStaff models.StaffMember) TimesheetData {
+	entries, err := s.Repos.Timesheet.GetTimesheetWeek(ctx, activeStaff.Config.TimesheetDateOffset)
 	if err != nil {
 		utils.PrintError(err, "Failed to load timesheet week")
 		emptyEntries := []*repository.TimesheetEntry{}
@@ -45,10 +48,10 @@ func (s *Server) MakeTimesheetStruct(activeStaff models.StaffMember) TimesheetDa
 	}
 
 	//TODO: this can be optimised
-	staffPayData := s.GetPayWeekForStaff(activeStaff.ID, activeStaff.Config.TimesheetDateOffset)
+	staffPayData := s.GetPayWeekForStaff(ctx, activeStaff.ID, activeStaff.Config.TimesheetDateOffset)
 	paySummary := s.GetPaySummary(staffPayData)
 	//TODO: Handle errors for LoadAllStaff better
-	allStaff, err := s.Repos.Staff.LoadAllStaff()
+	allStaff, err := s.Repos.Staff.LoadAllStaff(ctx)
 	if err != nil {
 		utils.PrintError(err, "Error loading all staff")
 		allStaff = []*models.StaffMember{}
@@ -57,10 +60,12 @@ func (s *Server) MakeTimesheetStruct(activeStaff models.StaffMember) TimesheetDa
 	return TimesheetData{
 		Entries:         *entries,
 		StaffMember:     activeStaff,
-		DayNames:        []string{"Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday", "Monday"},
+		DayNames:        utils.WeekDayNames(),
 		AllStaff:        allStaff,
 		StaffPaySummary: paySummary,
 		CacheBust:       s.CacheBust,
+		CSRFToken:       s.csrfToken(ctx),
+		ViewAs:          s.viewAsBanner(ctx),
 	}
 }
 
@@ -69,7 +74,7 @@ func (s *Server) HandleTimesheet(w http.ResponseWriter, r *http.Request) {
 	if thisStaff == nil {
 		return
 	}
-	data := s.MakeTimesheetStruct(*thisStaff)
+	data := s.MakeTimesheetStruct(r.Context(), *thisStaff)
 	s.renderTemplate(w, "timesheet", data)
 }
 
@@ -79,7 +84,7 @@ func (s *Server) RenderTimesheetTemplate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	data := s.MakeTimesheetStruct(*thisStaff)
+	data := s.MakeTimesheetStruct(r.Context(), *thisStaff)
 	s.renderTemplate(w, "timesheet", data)
 }
 
@@ -103,9 +108,9 @@ func (s *Server) HandleShiftTimesheetWindow(w http.ResponseWriter, r *http.Reque
 	case "-":
 		thisStaff.Config.TimesheetDateOffset = thisStaff.Config.TimesheetDateOffset - 1
 	default:
-		thisStaff.Config.TimesheetDateOffset = utils.WeekOffsetFromDate(utils.GetLastTuesday())
+		thisStaff.Config.TimesheetDateOffset = utils.WeekOffsetFromDate(utils.GetWeekStart())
 	}
-	s.Repos.Staff.SaveStaffMember(*thisStaff)
+	s.Repos.Staff.SaveStaffMember(r.Context(), *thisStaff)
 	s.RenderTimesheetTemplate(w, r)
 }
 
@@ -130,12 +135,24 @@ func (s *Server) HandleDeleteTimesheetEntry(w http.ResponseWriter, r *http.Reque
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	err = s.Repos.Timesheet.DeleteTimesheetEntry(entryID)
+	before, err := s.Repos.Timesheet.GetTimesheetEntryByID(r.Context(), entryID)
+	if err != nil {
+		utils.PrintError(err, "Error getting timesheet entry")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !thisStaff.CanEditTimesheetEntry(*before) {
+		utils.PrintLog("%v can't delete timesheet entry %v", thisStaff.ID, entryID)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	err = s.Repos.Timesheet.DeleteTimesheetEntry(r.Context(), entryID)
 	if err != nil {
 		utils.PrintError(err, "Error deleting timesheet entry")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	s.recordAudit(r.Context(), *thisStaff, models.AuditDeleteTimesheet, models.AuditEntityTimesheet, entryID, before, nil)
 	s.RenderTimesheetTemplate(w, r)
 }
 
@@ -163,12 +180,19 @@ func (s *Server) HandleAddTimesheetEntry(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	newEntry := MakeEmptyTimesheetEntry(reqBody.WeekOffset, reqBody.DayOffset, staffID)
-	allStaff, err := s.Repos.Staff.LoadAllStaff()
+	// Approvers may start an entry for anyone; what they save is checked
+	// again once its shift type is known.
+	if !thisStaff.CanApproveTimesheets() && !thisStaff.CanEditTimesheetEntry(newEntry) {
+		utils.PrintLog("%v can't add a timesheet entry for %v", thisStaff.ID, staffID)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	allStaff, err := s.Repos.Staff.LoadAllStaff(r.Context())
 	if err != nil {
 		utils.PrintError(err, "Error loading all staff")
 		allStaff = []*models.StaffMember{}
 	}
-	data := MakeTimesheetEditModalStruct(newEntry, thisStaff.ID, allStaff, thisStaff.IsManagerRole(), thisStaff.IsKitchen)
+	data := MakeTimesheetEditModalStruct(newEntry, thisStaff.ID, allStaff, thisStaff.Can(models.PermTimesheetApprove), thisStaff.IsKitchen)
 	s.renderTemplate(w, "timesheetEditModal", data)
 }
 
@@ -205,7 +229,12 @@ func (s *Server) HandleModifyTimesheetEntry(w http.ResponseWriter, r *http.Reque
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	entry, err := s.Repos.Timesheet.GetTimesheetEntryByID(entryID)
+	thisStaff := s.GetSessionUser(w, r)
+	if thisStaff == nil {
+		return
+	}
+	var before *TimesheetEntry
+	entry, err := s.Repos.Timesheet.GetTimesheetEntryByID(r.Context(), entryID)
 	if err != nil {
 		utils.PrintError(err, "Failed to get timesheet entry")
 		newEntry := TimesheetEntry{
@@ -214,6 +243,14 @@ func (s *Server) HandleModifyTimesheetEntry(w http.ResponseWriter, r *http.Reque
 			DayOffset:  reqBody.DayOffset,
 		}
 		entry = &newEntry
+	} else {
+		existing := *entry
+		before = &existing
+		if !thisStaff.CanEditTimesheetEntry(existing) {
+			utils.PrintLog("%v can't modify timesheet entry %v", thisStaff.ID, entryID)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
 	}
 	entry.StaffID = staffID
 	entry.Approved = reqBody.Approved
@@ -243,7 +280,16 @@ func (s *Server) HandleModifyTimesheetEntry(w http.ResponseWriter, r *http.Reque
 		entry.ShiftEnd = entry.ShiftEnd.AddDate(0, 0, 1)
 	}
 	entry.ShiftLength = math.Round((entry.ShiftEnd.Sub(entry.ShiftStart).Hours()-entry.BreakLength)*100) / 100
-	s.Repos.Timesheet.SaveTimesheetEntry(*entry)
+	// Checking the result as well stops staff approving their own entries or
+	// handing them to someone else.
+	if !thisStaff.CanEditTimesheetEntry(*entry) {
+		utils.PrintLog("%v can't save timesheet entry %v", thisStaff.ID, entryID)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if err := s.Repos.Timesheet.SaveTimesheetEntry(r.Context(), *entry); err == nil {
+		s.recordAudit(r.Context(), *thisStaff, models.AuditSaveTimesheetEntry, models.AuditEntityTimesheet, entryID, before, entry)
+	}
 
 	s.RenderTimesheetTemplate(w, r)
 }
@@ -254,7 +300,7 @@ func (s *Server) HandleToggleShowAll(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	thisStaff.Config.ShowAll = !thisStaff.Config.ShowAll
-	s.Repos.Staff.SaveStaffMember(*thisStaff)
+	s.Repos.Staff.SaveStaffMember(r.Context(), *thisStaff)
 	s.RenderTimesheetTemplate(w, r)
 }
 
@@ -264,7 +310,7 @@ func (s *Server) HandleToggleHideApproved(w http.ResponseWriter, r *http.Request
 		return
 	}
 	thisStaff.Config.HideApproved = !thisStaff.Config.HideApproved
-	s.Repos.Staff.SaveStaffMember(*thisStaff)
+	s.Repos.Staff.SaveStaffMember(r.Context(), *thisStaff)
 	s.RenderTimesheetTemplate(w, r)
 }
 
@@ -283,14 +329,26 @@ func (s *Server) HandleToggleApproved(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	entry, err := s.Repos.Timesheet.GetTimesheetEntryByID(entryID)
+	entry, err := s.Repos.Timesheet.GetTimesheetEntryByID(r.Context(), entryID)
 	if err != nil {
 		utils.PrintError(err, "Couldn't find entry to modify")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	thisStaff := s.GetSessionUser(w, r)
+	if thisStaff == nil {
+		return
+	}
+	if !thisStaff.CanApprove(*entry) {
+		utils.PrintLog("%v can't approve %v shifts", thisStaff.ID, entry.ShiftType)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	before := *entry
 	entry.Approved = !entry.Approved
-	s.Repos.Timesheet.SaveTimesheetEntry(*entry)
+	if err := s.Repos.Timesheet.SaveTimesheetEntry(r.Context(), *entry); err == nil {
+		s.recordAudit(r.Context(), *thisStaff, models.AuditToggleApproved, models.AuditEntityTimesheet, entryID, before, entry)
+	}
 
 	s.RenderTimesheetTemplate(w, r)
 }
@@ -368,17 +426,22 @@ func (s *Server) HandleGetTimesheetEditModal(w http.ResponseWriter, r *http.Requ
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	entry, err := s.Repos.Timesheet.GetTimesheetEntryByID(entryID)
+	entry, err := s.Repos.Timesheet.GetTimesheetEntryByID(r.Context(), entryID)
 	if err != nil {
 		utils.PrintError(err, "Couldn't find entry to modify")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	allStaff, err := s.Repos.Staff.LoadAllStaff()
+	if !thisStaff.CanEditTimesheetEntry(*entry) {
+		utils.PrintLog("%v can't edit timesheet entry %v", thisStaff.ID, entryID)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	allStaff, err := s.Repos.Staff.LoadAllStaff(r.Context())
 	if err != nil {
 		utils.PrintError(err, "Error loading all staff")
 		allStaff = []*models.StaffMember{}
 	}
-	data := MakeTimesheetEditModalStruct(*entry, thisStaff.ID, allStaff, thisStaff.IsManagerRole(), thisStaff.IsKitchen)
+	data := MakeTimesheetEditModalStruct(*entry, thisStaff.ID, allStaff, thisStaff.Can(models.PermTimesheetApprove), thisStaff.IsKitchen)
 	s.renderTemplate(w, "timesheetEditModal", data)
 }
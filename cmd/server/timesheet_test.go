@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"roster/cmd/models"
+	"roster/cmd/utils"
+
+	"github.com/google/uuid"
+)
+
+// openTimesheetEntry returns an entry for staffID on a day whose timesheet
+// is still open to staff.
+func openTimesheetEntry(staffID uuid.UUID) models.TimesheetEntry {
+	day := time.Now()
+	if day.Hour() < 8 {
+		day = day.AddDate(0, 0, -1)
+	}
+	weekOffset := utils.WeekOffsetFromDate(day)
+	date := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	dayOffset := int(date.Sub(utils.WeekStartFromOffset(weekOffset)).Hours() / 24)
+	return models.TimesheetEntry{ID: uuid.New(), StaffID: staffID, WeekOffset: weekOffset, DayOffset: dayOffset}
+}
+
+// newStaffSession is newTestSession for a staff member without any
+// permissions.
+func newStaffSession(t *testing.T, s *Server) (*models.StaffMember, uuid.UUID) {
+	t.Helper()
+	staff, token := newTestSession(t, s)
+	staff.Role = models.Staff
+	if err := s.Repos.Staff.SaveStaffMember(context.Background(), *staff); err != nil {
+		t.Fatalf("SaveStaffMember: %v", err)
+	}
+	return staff, token
+}
+
+func saveEntries(t *testing.T, s *Server, entries ...models.TimesheetEntry) {
+	t.Helper()
+	for _, entry := range entries {
+		if err := s.Repos.Timesheet.SaveTimesheetEntry(context.Background(), entry); err != nil {
+			t.Fatalf("SaveTimesheetEntry: %v", err)
+		}
+	}
+}
+
+func modifyEntryBody(entry models.TimesheetEntry, staffID uuid.UUID, approved bool) string {
+	return fmt.Sprintf(`{"entryID":%q,"staffID":%q,"weekOffset":%d,"dayOffset":%d,"shiftStart":"09:00","shiftEnd":"17:00","approved":%t,"shiftType":"0"}`,
+		entry.ID, staffID, entry.WeekOffset, entry.DayOffset, approved)
+}
+
+// Test staff can edit and delete their own open entries but nobody else's,
+// and can't approve or give away their own.
+func TestTimesheetEntry_StaffOwnership(t *testing.T) {
+	s := newMemoryServer(t)
+	staff, token := newStaffSession(t, s)
+	ctx := context.Background()
+	own := openTimesheetEntry(staff.ID)
+	other := openTimesheetEntry(uuid.New())
+	approved := openTimesheetEntry(staff.ID)
+	approved.Approved = true
+	closed := openTimesheetEntry(staff.ID)
+	closed.WeekOffset -= 4
+	saveEntries(t, s, own, other, approved, closed)
+
+	for _, entry := range []models.TimesheetEntry{other, approved, closed} {
+		rec := serveWithSession(s, s.HandleGetTimesheetEditModal, "POST", "/getTimesheetEditModal", `{"EntryID":"`+entry.ID.String()+`"}`, token)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("expected the edit modal to be refused, got %d", rec.Code)
+		}
+		rec = serveWithSession(s, s.HandleModifyTimesheetEntry, "POST", "/modifyTimesheetEntry", modifyEntryBody(entry, staff.ID, false), token)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("expected the change to be refused, got %d", rec.Code)
+		}
+		rec = serveWithSession(s, s.HandleDeleteTimesheetEntry, "POST", "/deleteTimesheetEntry", `{"entryID":"`+entry.ID.String()+`"}`, token)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("expected the delete to be refused, got %d", rec.Code)
+		}
+		if _, err := s.Repos.Timesheet.GetTimesheetEntryByID(ctx, entry.ID); err != nil {
+			t.Errorf("expected the entry to survive, got %v", err)
+		}
+	}
+
+	rec := serveWithSession(s, s.HandleModifyTimesheetEntry, "POST", "/modifyTimesheetEntry", modifyEntryBody(own, staff.ID, true), token)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected self approval to be refused, got %d", rec.Code)
+	}
+	rec = serveWithSession(s, s.HandleModifyTimesheetEntry, "POST", "/modifyTimesheetEntry", modifyEntryBody(own, uuid.New(), false), token)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected moving the entry to someone else to be refused, got %d", rec.Code)
+	}
+	rec = serveWithSession(s, s.HandleAddTimesheetEntry, "POST", "/addTimesheetEntry", fmt.Sprintf(`{"staffID":%q,"weekOffset":%d,"dayOffset":%d}`, other.StaffID, other.WeekOffset, other.DayOffset), token)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected adding an entry for someone else to be refused, got %d", rec.Code)
+	}
+
+	rec = serveWithSession(s, s.HandleGetTimesheetEditModal, "POST", "/getTimesheetEditModal", `{"EntryID":"`+own.ID.String()+`"}`, token)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected the edit modal for an own entry, got %d", rec.Code)
+	}
+	rec = serveWithSession(s, s.HandleModifyTimesheetEntry, "POST", "/modifyTimesheetEntry", modifyEntryBody(own, staff.ID, false), token)
+	if entry, _ := s.Repos.Timesheet.GetTimesheetEntryByID(ctx, own.ID); rec.Code != http.StatusOK || entry.ShiftLength != 8 {
+		t.Errorf("expected the own entry to be saved, got %d %+v", rec.Code, entry)
+	}
+	rec = serveWithSession(s, s.HandleDeleteTimesheetEntry, "POST", "/deleteTimesheetEntry", `{"entryID":"`+own.ID.String()+`"}`, token)
+	if _, err := s.Repos.Timesheet.GetTimesheetEntryByID(ctx, own.ID); rec.Code != http.StatusOK || err == nil {
+		t.Errorf("expected the own entry to be deleted, got %d", rec.Code)
+	}
+}
+
+// Test approvers can edit anyone's entries, including approved and closed
+// ones.
+func TestTimesheetEntry_ApproverEditsAny(t *testing.T) {
+	s := newMemoryServer(t)
+	_, token := newTestSession(t, s)
+	ctx := context.Background()
+	entry := openTimesheetEntry(uuid.New())
+	entry.Approved = true
+	entry.WeekOffset -= 4
+	saveEntries(t, s, entry)
+
+	rec := serveWithSession(s, s.HandleModifyTimesheetEntry, "POST", "/modifyTimesheetEntry", modifyEntryBody(entry, entry.StaffID, true), token)
+	if saved, _ := s.Repos.Timesheet.GetTimesheetEntryByID(ctx, entry.ID); rec.Code != http.StatusOK || saved.ShiftLength != 8 || !saved.Approved {
+		t.Errorf("expected the entry to be saved, got %d %+v", rec.Code, saved)
+	}
+	rec = serveWithSession(s, s.HandleDeleteTimesheetEntry, "POST", "/deleteTimesheetEntry", `{"entryID":"`+entry.ID.String()+`"}`, token)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected the entry to be deleted, got %d", rec.Code)
+	}
+}
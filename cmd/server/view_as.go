@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+
+	"roster/cmd/models"
+	"roster/cmd/repository"
+	"roster/cmd/utils"
+
+	"github.com/google/uuid"
+)
+
+const viewAsCookie = "view_as"
+
+// VIEW_AS_KEY holds who an admin is viewing the site as.
+const VIEW_AS_KEY = "viewAs"
+
+// viewAsTTL is how long an admin can view as someone else before they are
+// put back to themselves.
+const viewAsTTL = time.Hour
+
+// viewAsPaths are the pages an admin can see as someone else. Everything
+// else is refused until they stop, so nothing can be changed on anyone's
+// behalf.
+var viewAsPaths = []string{"/", "/timesheets", "/profile"}
+
+// viewAs is kept in a signed cookie while an admin views the site as another
+// staff member. It only works with the session it was made for.
+type viewAs struct {
+	SessionID uuid.UUID `json:"sessionId"`
+	StaffID   uuid.UUID `json:"staffId"`
+	Expires   int64     `json:"expires"`
+}
+
+// viewAsRequest is what VerifySession attaches to requests made while
+// viewing as someone else.
+type viewAsRequest struct {
+	Viewer  models.StaffMember
+	StaffID uuid.UUID
+}
+
+func viewAsFromContext(ctx context.Context) (viewAsRequest, bool) {
+	view, ok := ctx.Value(VIEW_AS_KEY).(viewAsRequest)
+	return view, ok
+}
+
+func (s *Server) setViewAsCookie(w http.ResponseWriter, view viewAs) error {
+	payload, err := json.Marshal(view)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     viewAsCookie,
+		Value:    s.signCookieValue(payload),
+		Path:     "/",
+		MaxAge:   int(viewAsTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+func clearViewAsCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     viewAsCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// checkViewAs returns who viewer is viewing the site as, if anyone. Cookies
+// that are invalid, expired, from another session or held by someone who
+// can no longer view as others are cleared.
+func (s *Server) checkViewAs(w http.ResponseWriter, r *http.Request, session models.Session, viewer models.StaffMember) (viewAsRequest, bool) {
+	cookie, err := r.Cookie(viewAsCookie)
+	if err != nil {
+		return viewAsRequest{}, false
+	}
+	var view viewAs
+	payload, err := s.verifyCookieValue(cookie.Value)
+	if err == nil {
+		err = json.Unmarshal(payload, &view)
+	}
+	if err != nil || view.SessionID != session.ID || time.Now().Unix() > view.Expires || !viewer.Can(models.PermStaffImpersonate) {
+		utils.PrintLog("Ignoring view as cookie for %v", viewer.ID)
+		clearViewAsCookie(w)
+		return viewAsRequest{}, false
+	}
+	return viewAsRequest{Viewer: viewer, StaffID: view.StaffID}, true
+}
+
+// allowedWhileViewingAs reports whether r can be served while an admin views
+// as someone else.
+func allowedWhileViewingAs(r *http.Request) bool {
+	if r.URL.Path == "/stopViewAs" || r.URL.Path == "/auth/logout" {
+		return true
+	}
+	return r.Method == http.MethodGet && slices.Contains(viewAsPaths, r.URL.Path)
+}
+
+// viewAsStaff returns the staff member an admin is viewing as. Their config
+// is brought up to date the way it would be on their next visit, but nothing
+// is saved.
+func (s *Server) viewAsStaff(ctx context.Context, view viewAsRequest) *models.StaffMember {
+	staff, err := s.Repos.Staff.GetStaffByID(ctx, view.StaffID)
+	if err != nil || staff == nil {
+		utils.PrintError(err, "Error retrieving staff to view as")
+		return nil
+	}
+	if time.Since(staff.Config.LastVisit) > repository.ConfigRefreshTime {
+		week := utils.WeekOffsetFromDate(utils.GetWeekStart())
+		staff.Config.RosterDateOffset = week
+		staff.Config.TimesheetDateOffset = week
+	}
+	return staff
+}
+
+// ViewAsBanner tells an admin whose pages they are looking at.
+type ViewAsBanner struct {
+	Viewer models.StaffMember
+	Staff  models.StaffMember
+}
+
+// viewAsBanner returns the banner for pages rendered while viewing as
+// someone else, or nil.
+func (s *Server) viewAsBanner(ctx context.Context) *ViewAsBanner {
+	view, ok := viewAsFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	staff := s.viewAsStaff(ctx, view)
+	if staff == nil {
+		return nil
+	}
+	return &ViewAsBanner{Viewer: view.Viewer, Staff: *staff}
+}
+
+type ViewAsBody struct {
+	StaffID string `json:"staffID"`
+}
+
+// HandleViewAs starts showing an admin the roster, timesheets and profile as
+// another staff member sees them.
+func (s *Server) HandleViewAs(w http.ResponseWriter, r *http.Request) {
+	var reqBody ViewAsBody
+	if err := ReadAndUnmarshal(w, r, &reqBody); err != nil {
+		return
+	}
+	staffID, err := uuid.Parse(reqBody.StaffID)
+	if err != nil {
+		utils.PrintError(err, "Invalid staff ID")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	thisStaff := s.GetSessionUser(w, r)
+	if thisStaff == nil {
+		return
+	}
+	session, ok := sessionFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if staffID == thisStaff.ID {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	staffMember, err := s.Repos.Staff.GetStaffByID(r.Context(), staffID)
+	if err != nil || staffMember == nil || staffMember.IsDeleted {
+		utils.PrintError(err, "Failed to get staff by ID")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	view := viewAs{SessionID: session.ID, StaffID: staffID, Expires: time.Now().Add(viewAsTTL).Unix()}
+	if err := s.setViewAsCookie(w, view); err != nil {
+		utils.PrintError(err, "Failed to set view as cookie")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	s.recordAudit(r.Context(), *thisStaff, models.AuditStartViewAs, models.AuditEntityStaff, staffID, nil, nil)
+	w.Header().Set("HX-Redirect", "/")
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleStopViewAs puts an admin back to seeing the site as themselves.
+func (s *Server) HandleStopViewAs(w http.ResponseWriter, r *http.Request) {
+	clearViewAsCookie(w)
+	redirect := "/profile"
+	if view, ok := viewAsFromContext(r.Context()); ok {
+		s.recordAudit(r.Context(), view.Viewer, models.AuditStopViewAs, models.AuditEntityStaff, view.StaffID, nil, nil)
+		redirect = "/profile?editStaffId=" + view.StaffID.String()
+	}
+	w.Header().Set("HX-Redirect", redirect)
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"roster/cmd/models"
+	"roster/cmd/repository"
+
+	"github.com/google/uuid"
+)
+
+// serveViewingAs runs handler behind VerifySession for the session token
+// with the view as cookie.
+func serveViewingAs(s *Server, handler http.HandlerFunc, method string, target string, token uuid.UUID, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader("{}"))
+	req.Header.Set(CSRF_HEADER, s.sessionCSRFToken(token))
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: token.String()})
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	s.VerifySession(handler)(rec, req)
+	return rec
+}
+
+func viewAsCookieFrom(rec *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == viewAsCookie {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// Test an admin sees the main pages as a staff member without changing
+// anything of theirs, and the viewing is audited.
+func TestViewAs_ReadOnly(t *testing.T) {
+	s := newMemoryServer(t)
+	_, adminToken := newTestSession(t, s)
+	ctx := context.Background()
+	lastVisit := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	sam := models.StaffMember{ID: uuid.New(), FirstName: "Sam", Config: models.StaffConfig{RosterDateOffset: 3, TimesheetDateOffset: 4, LastVisit: lastVisit}}
+	if err := s.Repos.Staff.SaveStaffMember(ctx, sam); err != nil {
+		t.Fatalf("SaveStaffMember: %v", err)
+	}
+
+	rec := serveWithSession(s, s.HandleProfileIndex, "GET", "/profile?editStaffId="+sam.ID.String(), "", adminToken)
+	if !strings.Contains(rec.Body.String(), `hx-post="/viewAs"`) {
+		t.Error("expected Sam's profile to offer viewing as them")
+	}
+	rec = serveWithSession(s, s.VerifyPermission(s.HandleViewAs, models.PermStaffImpersonate), "POST", "/viewAs", `{"staffID":"`+sam.ID.String()+`"}`, adminToken)
+	cookie := viewAsCookieFrom(rec)
+	if rec.Code != http.StatusOK || cookie == nil || rec.Header().Get("HX-Redirect") != "/" {
+		t.Fatalf("expected to start viewing as Sam, got %d", rec.Code)
+	}
+
+	pages := map[string]http.HandlerFunc{"/": s.HandleIndex, "/timesheets": s.HandleTimesheet, "/profile": s.HandleProfileIndex}
+	for path, handler := range pages {
+		rec := serveViewingAs(s, handler, "GET", path, adminToken, cookie)
+		body := rec.Body.String()
+		if rec.Code != http.StatusOK || !strings.Contains(body, "Viewing as Sam") {
+			t.Errorf("expected %s to be shown as Sam, got %d", path, rec.Code)
+		}
+		if strings.Contains(body, "Signed In Browsers") {
+			t.Errorf("expected %s not to show Sam's sessions", path)
+		}
+	}
+	rec = serveViewingAs(s, s.HandleShiftWindow, "POST", "/shiftWindow", adminToken, cookie)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected changes to be refused while viewing as Sam, got %d", rec.Code)
+	}
+	rec = serveViewingAs(s, s.HandleAudit, "GET", "/audit", adminToken, cookie)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected other pages to be refused while viewing as Sam, got %d", rec.Code)
+	}
+	saved, _ := s.Repos.Staff.GetStaffByID(ctx, sam.ID)
+	if saved.Config.RosterDateOffset != 3 || saved.Config.TimesheetDateOffset != 4 || !saved.Config.LastVisit.Equal(lastVisit) {
+		t.Errorf("expected Sam's config to be untouched, got %+v", saved.Config)
+	}
+
+	rec = serveViewingAs(s, s.HandleStopViewAs, "POST", "/stopViewAs", adminToken, cookie)
+	if cleared := viewAsCookieFrom(rec); rec.Code != http.StatusOK || cleared == nil || cleared.MaxAge >= 0 {
+		t.Errorf("expected the view as cookie to be cleared, got %d", rec.Code)
+	}
+	for _, action := range []string{models.AuditStartViewAs, models.AuditStopViewAs} {
+		entries, err := s.Repos.Audit.FindAuditEntries(ctx, repository.AuditFilter{Action: action})
+		if err != nil || len(entries) != 1 || entries[0].EntityID != sam.ID {
+			t.Errorf("expected %q to be audited, got %+v, %v", action, entries, err)
+		}
+	}
+}
+
+// Test a view as cookie does nothing for a session that can't view as
+// others.
+func TestViewAs_RequiresPermission(t *testing.T) {
+	s := newMemoryServer(t)
+	manager, token := newTestSession(t, s)
+	ctx := context.Background()
+	manager.Role = models.Manager
+	if err := s.Repos.Staff.SaveStaffMember(ctx, *manager); err != nil {
+		t.Fatalf("SaveStaffMember: %v", err)
+	}
+	sam := models.StaffMember{ID: uuid.New(), FirstName: "Sam"}
+	if err := s.Repos.Staff.SaveStaffMember(ctx, sam); err != nil {
+		t.Fatalf("SaveStaffMember: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	view := viewAs{SessionID: token, StaffID: sam.ID, Expires: time.Now().Add(time.Hour).Unix()}
+	if err := s.setViewAsCookie(rec, view); err != nil {
+		t.Fatalf("setViewAsCookie: %v", err)
+	}
+
+	rec = serveViewingAs(s, s.HandleIndex, "GET", "/", token, viewAsCookieFrom(rec))
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "Viewing as") {
+		t.Errorf("expected the manager to see their own roster, got %d", rec.Code)
+	}
+	if cleared := viewAsCookieFrom(rec); cleared == nil || cleared.MaxAge >= 0 {
+		t.Error("expected the view as cookie to be cleared")
+	}
+}
+
+// Test the roster sends an admin viewing as someone who has since been
+// deleted to the landing page, without logging the admin out.
+func TestViewAs_DeletedStaff(t *testing.T) {
+	s := newMemoryServer(t)
+	_, token := newTestSession(t, s)
+	ctx := context.Background()
+	sam := models.StaffMember{ID: uuid.New(), FirstName: "Sam"}
+	if err := s.Repos.Staff.SaveStaffMember(ctx, sam); err != nil {
+		t.Fatalf("SaveStaffMember: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	view := viewAs{SessionID: token, StaffID: sam.ID, Expires: time.Now().Add(time.Hour).Unix()}
+	if err := s.setViewAsCookie(rec, view); err != nil {
+		t.Fatalf("setViewAsCookie: %v", err)
+	}
+	cookie := viewAsCookieFrom(rec)
+	if err := s.Repos.Staff.DeleteStaffByID(ctx, sam.ID); err != nil {
+		t.Fatalf("DeleteStaffByID: %v", err)
+	}
+
+	rec = serveViewingAs(s, s.HandleIndex, "GET", "/", token, cookie)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/landing" {
+		t.Errorf("expected a redirect to /landing, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if cleared := viewAsCookieFrom(rec); cleared == nil || cleared.MaxAge >= 0 {
+		t.Error("expected the view as cookie to be cleared")
+	}
+	if _, err := s.Repos.Sessions.GetSession(ctx, token); err != nil {
+		t.Errorf("expected the admin's session to be kept, got %v", err)
+	}
+}
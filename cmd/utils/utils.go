@@ -4,26 +4,87 @@ import (
 	"fmt"
 	"log"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 )
 
-var TuesdayEpoch = time.Date(1970, time.January, 6, 0, 0, 0, 0, time.UTC)
+// weekStart is the day of the week the venue's weeks begin on. Week and day
+// offsets everywhere count from it.
+var weekStart = time.Tuesday
+
+// shortDayNames are the abbreviations used for roster days and report
+// columns, indexed by time.Weekday.
+var shortDayNames = [7]string{"Sun", "Mon", "Tues", "Wed", "Thurs", "Fri", "Sat"}
 
 const week = 7 * 24 * time.Hour
 
-// weekStartFromOffset returns the Tuesday-midnight that begins
-// the block identified by weekOffset.
+// SetWeekStart makes weeks begin on day. It must only be called at startup,
+// once stored offsets have been moved to match.
+func SetWeekStart(day time.Weekday) {
+	weekStart = day
+}
+
+// WeekStart returns the day of the week weeks begin on.
+func WeekStart() time.Weekday {
+	return weekStart
+}
+
+// ParseWeekday returns the day named by name, which can be a full name or an
+// abbreviation in any case.
+func ParseWeekday(name string) (time.Weekday, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if name == strings.ToLower(day.String()) || name == strings.ToLower(shortDayNames[day]) || name == strings.ToLower(day.String()[:3]) {
+			return day, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown day of the week %q", name)
+}
+
+// WeekDays returns the days of the week in order, starting on the week start.
+func WeekDays() []time.Weekday {
+	days := make([]time.Weekday, 7)
+	for i := range days {
+		days[i] = (weekStart + time.Weekday(i)) % 7
+	}
+	return days
+}
+
+// WeekDayNames returns the full names of the days of the week, starting on
+// the week start.
+func WeekDayNames() []string {
+	names := []string{}
+	for _, day := range WeekDays() {
+		names = append(names, day.String())
+	}
+	return names
+}
+
+// ShortDayName returns the abbreviation for day, like "Tues".
+func ShortDayName(day time.Weekday) string {
+	return shortDayNames[day]
+}
+
+// WeekEpoch returns the first midnight in 1970 that falls on day. Week
+// offsets for weeks starting on day count from it.
+func WeekEpoch(day time.Weekday) time.Time {
+	// 4 January 1970 was a Sunday.
+	return time.Date(1970, time.January, 4+int(day), 0, 0, 0, 0, time.UTC)
+}
+
+// WeekStartFromOffset returns the midnight that begins the week identified by
+// weekOffset.
 func WeekStartFromOffset(weekOffset int) time.Time {
 	// each offset is exactly 7 days
 	daysToAdd := weekOffset * 7
-	return TuesdayEpoch.AddDate(0, 0, daysToAdd)
+	return WeekEpoch(weekStart).AddDate(0, 0, daysToAdd)
 }
 
 func WeekOffsetFromDate(t time.Time) int {
 	utcT := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
-	d := utcT.UTC().Sub(TuesdayEpoch)
+	d := utcT.UTC().Sub(WeekEpoch(weekStart))
 	off := int(d / week)
 	// If d is negative but not an exact multiple of 7 days,
 	// we need to subtract 1 to get the mathematical floor.
@@ -33,28 +94,30 @@ func WeekOffsetFromDate(t time.Time) int {
 	return off
 }
 
-func GetLastTuesday() time.Time {
-	nextTuesday := GetNextTuesday()
-	lastTuesday := nextTuesday.AddDate(0, 0, -7)
+// GetWeekStart returns the local midnight that began the current week.
+func GetWeekStart() time.Time {
+	nextStart := GetNextWeekStart()
+	lastStart := nextStart.AddDate(0, 0, -7)
 	return time.Date(
-		lastTuesday.Year(),
-		lastTuesday.Month(),
-		lastTuesday.Day(),
+		lastStart.Year(),
+		lastStart.Month(),
+		lastStart.Day(),
 		0, 0, 0, 0,
 		time.Local)
 }
 
-func GetNextTuesday() time.Time {
+// GetNextWeekStart returns the local midnight that begins next week.
+func GetNextWeekStart() time.Time {
 	today := time.Now()
-	daysUntilTuesday := int((7 + (time.Tuesday - today.Weekday())) % 7)
-	if daysUntilTuesday == 0 {
-		daysUntilTuesday = 7
+	daysUntilStart := int((7 + (weekStart - today.Weekday())) % 7)
+	if daysUntilStart == 0 {
+		daysUntilStart = 7
 	}
-	nextTuesday := today.AddDate(0, 0, daysUntilTuesday)
+	nextStart := today.AddDate(0, 0, daysUntilStart)
 	return time.Date(
-		nextTuesday.Year(),
-		nextTuesday.Month(),
-		nextTuesday.Day(),
+		nextStart.Year(),
+		nextStart.Month(),
+		nextStart.Day(),
 		0, 0, 0, 0,
 		time.Local)
 }
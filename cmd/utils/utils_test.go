@@ -22,10 +22,41 @@ func TestWeekOffsetMappings(t *testing.T) {
 }
 
 func TestWeekStartKnownEpoch(t *testing.T) {
-	// offset 0 should be TuesdayEpoch
+	// offset 0 should be the first Tuesday of 1970
 	ws := WeekStartFromOffset(0)
-	if !ws.Equal(TuesdayEpoch) {
-		t.Errorf("WeekStartFromOffset(0) = %v; want %v", ws, TuesdayEpoch)
+	if want := time.Date(1970, time.January, 6, 0, 0, 0, 0, time.UTC); !ws.Equal(want) {
+		t.Errorf("WeekStartFromOffset(0) = %v; want %v", ws, want)
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if epoch := WeekEpoch(day); epoch.Weekday() != day || epoch.Year() != 1970 || epoch.Day() > 10 {
+			t.Errorf("WeekEpoch(%v) = %v", day, epoch)
+		}
+	}
+}
+
+// Test offsets, day order and the current week follow the week start.
+func TestSetWeekStart(t *testing.T) {
+	defer SetWeekStart(WeekStart())
+	SetWeekStart(time.Monday)
+	if days := WeekDays(); days[0] != time.Monday || days[6] != time.Sunday {
+		t.Errorf("WeekDays() = %v; want Monday to Sunday", days)
+	}
+	if ws := WeekStartFromOffset(2); ws.Weekday() != time.Monday || WeekOffsetFromDate(ws.AddDate(0, 0, 6)) != 2 {
+		t.Errorf("WeekStartFromOffset(2) = %v; want a Monday starting week 2", ws)
+	}
+	if ws := GetWeekStart(); ws.Weekday() != time.Monday || time.Since(ws) >= week {
+		t.Errorf("GetWeekStart() = %v; want the last Monday", ws)
+	}
+}
+
+func TestParseWeekday(t *testing.T) {
+	for name, want := range map[string]time.Weekday{"monday": time.Monday, "Tues": time.Tuesday, "THU": time.Thursday, " Sunday ": time.Sunday} {
+		if got, err := ParseWeekday(name); err != nil || got != want {
+			t.Errorf("ParseWeekday(%q) = %v, %v; want %v", name, got, err, want)
+		}
+	}
+	if _, err := ParseWeekday("someday"); err == nil {
+		t.Error("expected an unknown day to be refused")
 	}
 }
 
@@ -47,20 +78,20 @@ func TestLastAndNextWholeHour(t *testing.T) {
 	}
 }
 
-func TestGetNextAndLastTuesdayWeekday(t *testing.T) {
-	nt := GetNextTuesday()
+func TestGetNextAndLastWeekStartWeekday(t *testing.T) {
+	nt := GetNextWeekStart()
 	if nt.Weekday() != time.Tuesday {
-		t.Errorf("GetNextTuesday weekday = %v; want Tuesday", nt.Weekday())
+		t.Errorf("GetNextWeekStart weekday = %v; want Tuesday", nt.Weekday())
 	}
-	lt := GetLastTuesday()
+	lt := GetWeekStart()
 	if lt.Weekday() != time.Tuesday {
-		t.Errorf("GetLastTuesday weekday = %v; want Tuesday", lt.Weekday())
+		t.Errorf("GetWeekStart weekday = %v; want Tuesday", lt.Weekday())
 	}
 	// Ensure times are at midnight local
 	if nt.Hour() != 0 || nt.Minute() != 0 || nt.Second() != 0 {
-		t.Errorf("GetNextTuesday time = %v; want midnight", nt)
+		t.Errorf("GetNextWeekStart time = %v; want midnight", nt)
 	}
 	if lt.Hour() != 0 || lt.Minute() != 0 || lt.Second() != 0 {
-		t.Errorf("GetLastTuesday time = %v; want midnight", lt)
+		t.Errorf("GetWeekStart time = %v; want midnight", lt)
 	}
 }